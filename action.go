@@ -70,7 +70,7 @@ type CommittingAction interface {
 	SetHeader(header *Header)
 	GetHeader() (header *Header)
 	// Low level implementation of putting to DHT (assumes validation has been done)
-	Share(h *Holochain, def *EntryDef) (err error)
+	Share(h *Holochain, trace SpanContext, def *EntryDef) (err error)
 }
 
 // ValidatingAction provides an abstraction for grouping all the actions that participate in validation loop
@@ -114,7 +114,15 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 
 	defer func() {
 		if err != nil {
-			h.dht.dlog.Logf("%T Validation failed with: %v", a, err)
+			metricValidations.Inc(h.dnaHash.String(), "fail")
+			h.dht.dlog.LogWith(LogFields{"action": fmt.Sprintf("%T", a), "entryType": entryType, "err": err}, "validation failed")
+			if IsValidationFailedErr(err) {
+				for _, source := range sources {
+					h.penalize(source, InvalidEntryEvent)
+				}
+			}
+		} else {
+			metricValidations.Inc(h.dnaHash.String(), "pass")
 		}
 	}()
 
@@ -130,6 +138,14 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 		h.Debugf("Sys ValidateAction(%T) err:%v\n", a, err)
 		return
 	}
+	if d, ok := a.(*ActionDel); ok {
+		// dels are of a sys entry type but the deleted entry's type may have rules
+		err = h.checkDelRules(d, sources)
+		if err != nil {
+			h.Debugf("Rules ValidateAction(%T) err:%v\n", a, err)
+			return
+		}
+	}
 	if !def.IsSysEntry() {
 
 		// validation actions for application defined entry types
@@ -138,13 +154,27 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 		if err != nil {
 			return
 		}
+		if p, ok := a.(*ActionPut); ok {
+			vpkg.Status = p.status
+		}
+
+		// check the entry type's rules
+		err = def.Rules.check(h, a, def, vpkg, sources)
+		if err != nil {
+			h.Debugf("Rules ValidateAction(%T) err:%v\n", a, err)
+			return
+		}
+		if def.Rules != nil && def.Rules.RulesOnly {
+			return
+		}
 
 		// run the action's app level validations
 		var n Ribosome
-		n, err = z.MakeRibosome(h)
+		n, err = h.ribosomes.get(h, z)
 		if err != nil {
 			return
 		}
+		defer h.ribosomes.put(z, n)
 
 		err = n.ValidateAction(a, def, vpkg, prepareSources(sources))
 		if err != nil {
@@ -214,17 +244,23 @@ func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp V
 			return
 		}
 
-		// get the packaging request from the app
-		var n Ribosome
-		n, err = z.MakeRibosome(h)
-		if err != nil {
-			return
-		}
-
 		var req PackagingReq
-		req, err = n.ValidatePackagingRequest(a, def)
-		if err != nil {
-			h.Debugf("Ribosome GetValidationPackage(%T) err:%v\n", a, err)
+		if def.Rules == nil || !def.Rules.RulesOnly {
+			// get the packaging request from the app
+			var n Ribosome
+			n, err = h.ribosomes.get(h, z)
+			if err != nil {
+				return
+			}
+			defer h.ribosomes.put(z, n)
+
+			req, err = n.ValidatePackagingRequest(a, def)
+			if err != nil {
+				h.Debugf("Ribosome GetValidationPackage(%T) err:%v\n", a, err)
+			}
+		}
+		if _, ok := a.(*ActionPut); ok {
+			req = def.Rules.packagingReq(def, req)
 		}
 		resp.Package, err = MakePackage(h, req)
 	}
@@ -288,9 +324,14 @@ func argErr(typeName string, index int, arg Arg) error {
 }
 
 // doCommit adds an entry to the local chain after validating the action it's part of
-func (h *Holochain) doCommit(a CommittingAction, change Hash) (d *EntryDef, err error) {
+func (h *Holochain) doCommit(trace SpanContext, a CommittingAction, change Hash) (d *EntryDef, err error) {
 
 	entryType := a.EntryType()
+	span := h.tracer.StartSpan("doCommit", trace)
+	span.SetAttribute("entryType", entryType)
+	defer func() {
+		span.Finish(err)
+	}()
 	entry := a.Entry()
 	var l int
 	var hash Hash
@@ -306,7 +347,7 @@ func (h *Holochain) doCommit(a CommittingAction, change Hash) (d *EntryDef, err
 	// retry loop incase someone sneaks a new commit in between prepareHeader and addEntry
 	for !added {
 		chain.lk.RLock()
-		count := len(chain.Headers)
+		count := chain.Length()
 		l, hash, header, err = chain.prepareHeader(time.Now(), entryType, entry, h.agent.PrivKey(), change)
 		chain.lk.RUnlock()
 		if err != nil {
@@ -320,7 +361,7 @@ func (h *Holochain) doCommit(a CommittingAction, change Hash) (d *EntryDef, err
 		}
 
 		chain.lk.Lock()
-		if count == len(chain.Headers) {
+		if count == chain.Length() {
 			err = chain.addEntry(l, hash, header, entry)
 			if err == nil {
 				added = true
@@ -334,16 +375,20 @@ func (h *Holochain) doCommit(a CommittingAction, change Hash) (d *EntryDef, err
 	return
 }
 
-func (h *Holochain) commitAndShare(a CommittingAction, change Hash) (response Hash, err error) {
+func (h *Holochain) commitAndShare(trace SpanContext, a CommittingAction, change Hash) (response Hash, err error) {
+	span := h.tracer.StartSpan("commitAndShare", trace)
+	defer func() {
+		span.Finish(err)
+	}()
 	var def *EntryDef
-	def, err = h.doCommit(a, change)
+	def, err = h.doCommit(span.Context(), a, change)
 	if err != nil {
 		return
 	}
 
 	bundle := h.Chain().BundleStarted()
 	if bundle == nil {
-		err = a.Share(h, def)
+		err = a.Share(h, span.Context(), def)
 	} else {
 		bundle.sharing = append(bundle.sharing, a)
 	}
@@ -371,16 +416,60 @@ const (
 	ValidationFailureBadRevocationFormat = "bad revocation format"
 )
 
-func RunValidationPhase(h *Holochain, source peer.ID, msgType MsgType, query Hash, handler func(resp ValidateResponse) error) (err error) {
+var ErrEntryHashMismatch = errors.New("entry doesn't match its hash")
+
+// checkValidateResponse checks that the entry and header a source sent back for validation
+// are the ones at the hash that was asked about
+func checkValidateResponse(h *Holochain, query Hash, resp *ValidateResponse) (err error) {
+	var hash Hash
+	if resp.Type == KeyEntryType {
+		// the key entry is the public key whose node id is its hash
+		b58pk, ok := resp.Entry.Content().(string)
+		if !ok {
+			err = ErrEntryHashMismatch
+			return
+		}
+		var pk ic.PubKey
+		pk, err = DecodePubKey(b58pk)
+		if err != nil {
+			return
+		}
+		var id peer.ID
+		id, err = peer.IDFromPublicKey(pk)
+		if err != nil {
+			return
+		}
+		hash = HashFromPeerID(id)
+	} else {
+		if !resp.Header.EntryLink.Equal(query) {
+			err = ErrEntryHashMismatch
+			return
+		}
+		hash, err = resp.Entry.Sum(h.hashSpec)
+		if err != nil {
+			return
+		}
+	}
+	if !hash.Equal(query) {
+		err = ErrEntryHashMismatch
+	}
+	return
+}
+
+func RunValidationPhase(h *Holochain, source peer.ID, trace SpanContext, msgType MsgType, query Hash, handler func(resp ValidateResponse) error) (err error) {
 	var r interface{}
 	msg := h.node.NewMessage(msgType, ValidateQuery{H: query})
+	msg.Trace = trace
 	r, err = h.Send(h.node.ctx, ValidateProtocol, source, msg, 0)
 	if err != nil {
 		return
 	}
 	switch resp := r.(type) {
 	case ValidateResponse:
-		err = handler(resp)
+		err = checkValidateResponse(h, query, &resp)
+		if err == nil {
+			err = handler(resp)
+		}
 	default:
 		err = fmt.Errorf("expected ValidateResponse from validator got %T", r)
 	}
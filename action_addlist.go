@@ -2,6 +2,7 @@ package holochain
 
 import (
 	"fmt"
+	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
 )
 
@@ -51,6 +52,26 @@ func (a *ActionListAdd) Receive(dht *DHT, msg *Message) (response interface{}, e
 		return
 	}
 
+	// only parties to the warrant can be added to the list on its strength
+	var parties []Hash
+	parties, err = w.Parties()
+	if err != nil {
+		err = fmt.Errorf("%s: %v", prefix, err)
+		return
+	}
+	for _, r := range a.list.Records {
+		party := false
+		for _, p := range parties {
+			if PeerIDFromHash(p) == r.ID {
+				party = true
+			}
+		}
+		if !party {
+			err = fmt.Errorf("%s: %v is not a party to the warrant", prefix, r.ID)
+			return
+		}
+	}
+
 	// TODO verify that the warrant, if valid, is sufficient to allow list addition #300
 
 	err = dht.addToList(msg, a.list)
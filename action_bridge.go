@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
 )
 
 //------------------------------------------------------------
 // Bridge
 
 type APIFnBridge struct {
+	app      Hash
 	token    string
 	url      string
 	zome     string
@@ -27,6 +30,14 @@ func (fn *APIFnBridge) Args() []Arg {
 }
 
 func (fn *APIFnBridge) Call(h *Holochain) (response interface{}, err error) {
+	// chains hosted in the same process are called directly
+	if callee := getLocalChain(fn.app); callee != nil {
+		response, err = callee.BridgeCall(fn.zome, fn.function, fn.args, fn.token)
+		if b, ok := response.([]byte); ok {
+			response = string(b)
+		}
+		return
+	}
 	body := bytes.NewBuffer([]byte(fn.args.(string)))
 	var resp *http.Response
 	resp, err = http.Post(fmt.Sprintf("%s/bridge/%s/%s/%s", fn.url, fn.token, fn.zome, fn.function), "", body)
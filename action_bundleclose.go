@@ -4,6 +4,7 @@ package holochain
 // CloseBundle
 
 type APIFnCloseBundle struct {
+	tracing
 	commit bool
 }
 
@@ -48,13 +49,14 @@ func (a *APIFnCloseBundle) Call(h *Holochain) (response interface{}, err error)
 	err = h.Chain().CloseBundle(a.commit)
 	if err == nil {
 		// if there wasn't an error closing the bundle share all the commits
+		trace := a.trace
 		for _, a := range bundle.sharing {
 			_, def, err := h.GetEntryDef(a.GetHeader().Type)
 			if err != nil {
 				h.dht.dlog.Logf("Error getting entry def in close bundle:%v", err)
 				err = nil
 			} else {
-				err = a.Share(h, def)
+				err = a.Share(h, trace, def)
 			}
 		}
 	}
@@ -3,12 +3,14 @@ package holochain
 import (
 	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"reflect"
 )
 
 //------------------------------------------------------------
 // Commit
 
 type APIFnCommit struct {
+	tracing
 	action ActionCommit
 }
 
@@ -17,11 +19,11 @@ func (fn *APIFnCommit) Name() string {
 }
 
 func (fn *APIFnCommit) Args() []Arg {
-	return []Arg{{Name: "entryType", Type: StringArg}, {Name: "entry", Type: EntryArg}}
+	return []Arg{{Name: "entryType", Type: StringArg}, {Name: "entry", Type: EntryArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(CommitOptions{}), Optional: true}}
 }
 
 func (fn *APIFnCommit) Call(h *Holochain) (response interface{}, err error) {
-	response, err = h.commitAndShare(&fn.action, NullHash())
+	response, err = h.commitAndShare(fn.trace, &fn.action, NullHash())
 	return
 }
 
@@ -29,10 +31,16 @@ func (fn *APIFnCommit) SetAction(a *ActionCommit) {
 	fn.action = *a
 }
 
+// CommitOptions options to the commit function
+type CommitOptions struct {
+	TTL int // seconds that the entry and its links are held on the DHT, overrides the EntryDef TTL
+}
+
 type ActionCommit struct {
 	entryType string
 	entry     Entry
 	header    *Header
+	ttl       int
 }
 
 func NewCommitAction(entryType string, entry Entry) *ActionCommit {
@@ -60,7 +68,16 @@ func (a *ActionCommit) GetHeader() (header *Header) {
 	return a.header
 }
 
-func (a *ActionCommit) Share(h *Holochain, def *EntryDef) (err error) {
+// TTL returns the seconds the committed entry is held on the DHT, 0 for forever
+func (a *ActionCommit) TTL(def *EntryDef) int {
+	if a.ttl > 0 {
+		return a.ttl
+	}
+	return def.TTL
+}
+
+func (a *ActionCommit) Share(h *Holochain, trace SpanContext, def *EntryDef) (err error) {
+	ttl := a.TTL(def)
 	if def.DataFormat == DataFormatLinks {
 		// if this is a Link entry we have to send the DHT Link message
 		var le LinksEntry
@@ -75,7 +92,7 @@ func (a *ActionCommit) Share(h *Holochain, def *EntryDef) (err error) {
 			_, exists := bases[l.Base]
 			if !exists {
 				b, _ := NewHash(l.Base)
-				h.dht.Change(b, LINK_REQUEST, HoldReq{RelatedHash: b, EntryHash: a.header.EntryLink})
+				h.dht.Change(trace, b, LINK_REQUEST, HoldReq{RelatedHash: b, EntryHash: a.header.EntryLink, TTL: ttl})
 				//TODO errors from the send??
 				bases[l.Base] = true
 			}
@@ -83,7 +100,7 @@ func (a *ActionCommit) Share(h *Holochain, def *EntryDef) (err error) {
 	}
 	if def.isSharingPublic() {
 		// otherwise we check to see if it's a public entry and if so send the DHT put message
-		err = h.dht.Change(a.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: a.header.EntryLink})
+		err = h.dht.Change(trace, a.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: a.header.EntryLink, TTL: ttl})
 		if err == ErrEmptyRoutingTable {
 			// will still have committed locally and can gossip later
 			err = nil
@@ -9,6 +9,7 @@ import (
 // Del
 
 type APIFnDel struct {
+	tracing
 	action ActionDel
 }
 
@@ -22,7 +23,7 @@ func (fn *APIFnDel) Args() []Arg {
 
 func (fn *APIFnDel) Call(h *Holochain) (response interface{}, err error) {
 	a := &fn.action
-	response, err = h.commitAndShare(a, NullHash())
+	response, err = h.commitAndShare(fn.trace, a, NullHash())
 	return
 }
 
@@ -60,11 +61,11 @@ func (a *ActionDel) GetHeader() (header *Header) {
 	return a.header
 }
 
-func (a *ActionDel) Share(h *Holochain, def *EntryDef) (err error) {
+func (a *ActionDel) Share(h *Holochain, trace SpanContext, def *EntryDef) (err error) {
 	if def.isSharingPublic() {
 		// if it's a public entry send the DHT DEL & PUT messages
-		h.dht.Change(a.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: a.header.EntryLink})
-		h.dht.Change(a.entry.Hash, DEL_REQUEST, HoldReq{RelatedHash: a.entry.Hash, EntryHash: a.header.EntryLink})
+		h.dht.Change(trace, a.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: a.header.EntryLink})
+		h.dht.Change(trace, a.entry.Hash, DEL_REQUEST, HoldReq{RelatedHash: a.entry.Hash, EntryHash: a.header.EntryLink})
 	}
 	return
 }
@@ -81,7 +82,7 @@ func (a *ActionDel) Receive(dht *DHT, msg *Message) (response interface{}, err e
 	t := msg.Body.(HoldReq)
 	var holdResp *HoldResp
 
-	err = RunValidationPhase(dht.h, msg.From, VALIDATE_DEL_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
+	err = RunValidationPhase(dht.h, msg.From, msg.Trace, VALIDATE_DEL_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
 
 		var delEntry DelEntry
 		delEntry, err = DelEntryFromJSON(resp.Entry.Content().(string))
@@ -39,7 +39,7 @@ func TestActionDelete(t *testing.T) {
 	entry := DelEntry{Hash: profileHash, Message: "expired"}
 	action := &ActionDel{entry: entry}
 	var hash Hash
-	deleteHash, err := h.commitAndShare(action, hash)
+	deleteHash, err := h.commitAndShare(SpanContext{}, action, hash)
 	if err != nil {
 		panic(err)
 	}
@@ -12,6 +12,7 @@ import (
 // Get
 
 type APIFnGet struct {
+	tracing
 	action ActionGet
 }
 
@@ -24,8 +25,14 @@ func (fn *APIFnGet) Args() []Arg {
 }
 
 func callGet(h *Holochain, req GetReq, options *GetOptions) (response interface{}, err error) {
+	response, err = callTracedGet(h, SpanContext{}, req, options)
+	return
+}
+
+// callTracedGet gets the entry recording the messages it sends under the trace's span
+func callTracedGet(h *Holochain, trace SpanContext, req GetReq, options *GetOptions) (response interface{}, err error) {
 	a := ActionGet{req: req, options: options}
-	fn := &APIFnGet{action: a}
+	fn := &APIFnGet{tracing: tracing{trace: trace}, action: a}
 	response, err = fn.Call(h)
 	return
 }
@@ -45,7 +52,7 @@ func (fn *APIFnGet) Call(h *Holochain) (response interface{}, err error) {
 		response, err = a.getLocal(bundle.chain)
 		return
 	}
-	rsp, err := h.dht.Query(a.req.H, GET_REQUEST, a.req)
+	rsp, err := h.dht.Query(fn.trace, a.req.H, GET_REQUEST, a.req)
 	if err != nil {
 
 		// follow the modified hash
@@ -60,7 +67,7 @@ func (fn *APIFnGet) Call(h *Holochain) (response interface{}, err error) {
 				return
 			}
 			req := GetReq{H: hash, StatusMask: StatusDefault, GetMask: a.options.GetMask}
-			modResp, err := callGet(h, req, a.options)
+			modResp, err := callTracedGet(h, fn.trace, req, a.options)
 			if err == nil {
 				response = modResp
 			}
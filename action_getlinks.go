@@ -12,6 +12,7 @@ import (
 // GetLinks
 
 type APIFnGetLinks struct {
+	tracing
 	action ActionGetLinks
 }
 
@@ -26,7 +27,7 @@ func (fn *APIFnGetLinks) Args() []Arg {
 func (fn *APIFnGetLinks) Call(h *Holochain) (response interface{}, err error) {
 	var r interface{}
 	a := &fn.action
-	r, err = h.dht.Query(a.linkQuery.Base, GETLINK_REQUEST, *a.linkQuery)
+	r, err = h.dht.Query(fn.trace, a.linkQuery.Base, GETLINK_REQUEST, *a.linkQuery)
 
 	if err == nil {
 		switch t := r.(type) {
@@ -42,7 +43,7 @@ func (fn *APIFnGetLinks) Call(h *Holochain) (response interface{}, err error) {
 					opts := GetOptions{GetMask: GetMaskEntryType + GetMaskEntry, StatusMask: StatusDefault}
 					req := GetReq{H: hash, StatusMask: StatusDefault, GetMask: opts.GetMask}
 					var rsp interface{}
-					rsp, err = callGet(h, req, &opts)
+					rsp, err = callTracedGet(h, fn.trace, req, &opts)
 					if err == nil {
 						// TODO: bleah, really this should be another of those
 						// case statements that choses the encoding baste on
@@ -95,7 +96,19 @@ func (a *ActionGetLinks) SysValidation(h *Holochain, d *EntryDef, pkg *Package,
 func (a *ActionGetLinks) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
 	lq := msg.Body.(LinkQuery)
 	var r LinkQueryResp
-	r.Links, err = dht.GetLinks(lq.Base, lq.T, lq.StatusMask)
+	if lq.Limit == 0 && lq.Cursor == "" && lq.Order == "" {
+		r.Links, err = dht.GetLinks(lq.Base, lq.T, lq.StatusMask)
+		// callers that didn't ask for a page have no way to get the rest of the links, so
+		// rather than silently dropping them tell them to page the request
+		if err == nil && dht.config.MaxLinkSets > 0 && len(r.Links) > dht.config.MaxLinkSets {
+			r.Links = nil
+			err = ErrTooManyLinks
+			return
+		}
+	} else {
+		page := LinkPage{Order: lq.Order, Limit: lq.Limit, Cursor: lq.Cursor}
+		r.Links, r.Next, err = dht.GetLinksPage(lq.Base, lq.T, lq.StatusMask, page)
+	}
 	response = &r
 
 	return
@@ -4,6 +4,7 @@ import (
 	"errors"
 	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"time"
 )
 
 //------------------------------------------------------------
@@ -36,7 +37,12 @@ func (a *ActionLink) Receive(dht *DHT, msg *Message) (response interface{}, err
 	t := msg.Body.(HoldReq)
 	var holdResp *HoldResp
 
-	err = RunValidationPhase(dht.h, msg.From, VALIDATE_LINK_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
+	if changeExpired(msg, time.Now()) {
+		err = ErrChangeExpired
+		return
+	}
+
+	err = RunValidationPhase(dht.h, msg.From, msg.Trace, VALIDATE_LINK_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
 		var le LinksEntry
 		le, err = LinksEntryFromJSON(resp.Entry.Content().(string))
 		if err != nil {
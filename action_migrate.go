@@ -41,8 +41,8 @@ func (a *ActionMigrate) GetHeader() (header *Header) {
 	return a.header
 }
 
-func (action *ActionMigrate) Share(h *Holochain, def *EntryDef) (err error) {
-	err = h.dht.Change(action.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: action.header.EntryLink})
+func (action *ActionMigrate) Share(h *Holochain, trace SpanContext, def *EntryDef) (err error) {
+	err = h.dht.Change(trace, action.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: action.header.EntryLink})
 	return
 }
 
@@ -78,6 +78,7 @@ func (a *ActionMigrate) Receive(dht *DHT, msg *Message) (response interface{}, e
 // Migrate API fn
 
 type APIFnMigrate struct {
+	tracing
 	action ActionMigrate
 }
 
@@ -98,6 +99,6 @@ func (fn *APIFnMigrate) Args() []Arg {
 
 func (fn *APIFnMigrate) Call(h *Holochain) (response interface{}, err error) {
 	var hash Hash
-	response, err = h.commitAndShare(&fn.action, hash)
+	response, err = h.commitAndShare(fn.trace, &fn.action, hash)
 	return
 }
@@ -2,6 +2,7 @@ package holochain
 
 import (
 	peer "github.com/libp2p/go-libp2p-peer"
+	"time"
 )
 
 //------------------------------------------------------------
@@ -11,6 +12,7 @@ type ActionPut struct {
 	entryType string
 	entry     Entry
 	header    *Header
+	status    int // status the entry will be held with if it's valid, other than live
 }
 
 func NewPutAction(entryType string, entry Entry, header *Header) *ActionPut {
@@ -31,6 +33,12 @@ func (a *ActionPut) Receive(dht *DHT, msg *Message) (response interface{}, err e
 	t := msg.Body.(HoldReq)
 	var holdResp *HoldResp
 
+	// don't hold data that has already expired
+	if changeExpired(msg, time.Now()) {
+		err = ErrChangeExpired
+		return
+	}
+
 	// check to see if we are already holding this hash
 	var status int
 	_, _, _, status, err = dht.Get(t.EntryHash, StatusAny, GetMaskEntryType) //TODO should be a getmask for just Status
@@ -43,14 +51,51 @@ func (a *ActionPut) Receive(dht *DHT, msg *Message) (response interface{}, err e
 		return
 	}
 
-	err = RunValidationPhase(dht.h, msg.From, VALIDATE_PUT_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
+	// only hold hashes in our neighborhood, if the hash isn't then point the sender
+	// at closer peers
+	var responsible bool
+	responsible, err = dht.h.IsResponsible(t.EntryHash)
+	if err != nil {
+		return
+	}
+	if !responsible {
+		closest := dht.h.node.betterPeersForHash(&t.EntryHash, msg.From, true, dht.h.RedundancyFactor())
+		if len(closest) > 0 {
+			dht.dlog.Logf("Put %v not in our neighborhood, not holding", t.EntryHash)
+			resp := CloserPeersResp{}
+			resp.CloserPeers = dht.h.node.peers2PeerInfos(closest)
+			response = resp
+			return
+		}
+	}
+
+	err = RunValidationPhase(dht.h, msg.From, msg.Trace, VALIDATE_PUT_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
 		a := NewPutAction(resp.Type, &resp.Entry, &resp.Header)
-		_, err := dht.h.ValidateAction(a, a.entryType, &resp.Package, []peer.ID{msg.From})
+
+		// entries whose headers fork their source's chain get held as forked, which the
+		// app's validation gets to see
+		fork, err := dht.findFork(msg.From, &resp.Header)
+		if err != nil {
+			return err
+		}
+		if fork != nil {
+			a.status = StatusForked
+		}
+		_, err = dht.h.ValidateAction(a, a.entryType, &resp.Package, []peer.ID{msg.From})
+		if err == ErrHashNotFound {
+			// an entry the validation needs hasn't reached us yet, so the put gets retried
+			return err
+		}
 
 		var status int
 		if err != nil {
 			dht.dlog.Logf("Put %v rejected: %v", t.EntryHash, err)
 			status = StatusRejected
+			if IsValidationFailedErr(err) {
+				dht.h.warrantInvalidEntry(msg.From, &resp)
+			}
+		} else if fork != nil {
+			status = StatusForked
 		} else {
 			status = StatusLive
 		}
@@ -60,6 +105,9 @@ func (a *ActionPut) Receive(dht *DHT, msg *Message) (response interface{}, err e
 		if err == nil {
 			err = dht.Put(msg, resp.Type, t.EntryHash, msg.From, b, status)
 		}
+		if err == nil && status != StatusRejected {
+			err = dht.holdHeader(msg.From, &resp.Header, fork)
+		}
 		if err == nil {
 			holdResp, err = dht.MakeHoldResp(msg, status)
 		}
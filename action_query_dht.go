@@ -1,6 +1,7 @@
 package holochain
 
 import (
+  "errors"
   "fmt"
   "reflect"
   "strings"
@@ -22,6 +23,9 @@ type APIFnQueryDHT struct {
 type QueryDHTOptions struct {
   Field string
   Constrain QueryDHTConstraint
+  And []QueryDHTClause // all of these must also match
+  Or []QueryDHTClause // at least one of these must also match
+  Sort string // field to order results by, defaults to Field
   Ascending bool
   Page int
   Count int
@@ -35,6 +39,8 @@ type QueryDHTConstraint struct {
   GT interface{}
   GTE interface{}
   Range QueryDHTRange
+  Prefix string
+  Contains string
 }
 
 type QueryDHTRange struct {
@@ -60,6 +66,8 @@ func (a *APIFnQueryDHT) Args() []Arg {
 
 const DEFAULT_COUNT = 20
 
+var ErrQueryDHTNotSupported = errors.New("queryDHT is not supported by this DHT's HashTableType")
+
 type IterFn func (key, val string) bool
 
 func min(a, b int) int {
@@ -82,15 +90,24 @@ func (a *APIFnQueryDHT) Call(h *Holochain) (response interface{}, err error) {
   constrain := a.options.Constrain
   ascending := a.options.Ascending
   load := a.options.Load
-  db := h.dht.ht.(*BuntHT).db
-  err = nil
+  bunt, ok := h.dht.ht.(*BuntHT)
+  if !ok {
+    err = ErrQueryDHTNotSupported
+    return
+  }
+  db := bunt.db
   // https://golang.org/pkg/encoding/json/#Unmarshal
 
   indexName := buildIndexName(&IndexDef{ZomeName: a.zome.Name, FieldPath: fieldPath, EntryType: entryType})
   var hashList []string
 
   // TODO: stop iteration after count entries when possible
-  if constrain.EQ != nil {
+  if a.options.compound() {
+    hashList, err = a.compoundHashes(db)
+    if err != nil {
+      return
+    }
+  } else if constrain.EQ != nil {
     hashList = collectHashes(db, !ascending, func (tx *buntdb.Tx, f IterFn) error {
       return tx.AscendEqual(indexName, buildPivot(fieldPath, constrain.EQ), f)
     })
@@ -0,0 +1,244 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// action_query_dht_compound implements queryDHT queries that combine constraints on
+// several indexed fields with AND/OR, match strings by prefix or substring, and sort
+// on a field other than the ones being filtered on
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+)
+
+// QueryDHTClause is one part of a compound query. A clause matches the entries that
+// meet its own constraint (if it has a Field), all of its And clauses and, if it has
+// any, at least one of its Or clauses.
+type QueryDHTClause struct {
+	Field     string
+	Constrain QueryDHTConstraint
+	And       []QueryDHTClause
+	Or        []QueryDHTClause
+}
+
+var ErrQueryDHTNoConstraints = errors.New("queryDHT: query has no constraints")
+var ErrQueryDHTInvalidConstraint = errors.New("queryDHT: invalid constraint")
+var ErrQueryDHTNoSortField = errors.New("queryDHT: no field to sort on")
+
+// empty returns true if no constraint has been set
+func (c *QueryDHTConstraint) empty() bool {
+	return c.EQ == nil && c.LT == nil && c.LTE == nil && c.GT == nil && c.GTE == nil &&
+		c.Range.From == nil && c.Range.To == nil && c.Prefix == "" && c.Contains == ""
+}
+
+// compound returns true if the options need more than a single index lookup
+func (o *QueryDHTOptions) compound() bool {
+	return len(o.And) > 0 || len(o.Or) > 0 || (o.Sort != "" && o.Sort != o.Field) ||
+		o.Constrain.Prefix != "" || o.Constrain.Contains != ""
+}
+
+// clause returns the top level of the options as a clause
+func (o *QueryDHTOptions) clause() QueryDHTClause {
+	return QueryDHTClause{Field: o.Field, Constrain: o.Constrain, And: o.And, Or: o.Or}
+}
+
+// firstField returns the first field constrained in a clause
+func (c *QueryDHTClause) firstField() string {
+	if c.Field != "" {
+		return c.Field
+	}
+	for _, clauses := range [][]QueryDHTClause{c.And, c.Or} {
+		for i := range clauses {
+			if f := clauses[i].firstField(); f != "" {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+type indexQuery struct {
+	db        *buntdb.DB
+	zome      string
+	entryType string
+}
+
+func (q *indexQuery) indexName(field string) string {
+	return buildIndexName(&IndexDef{ZomeName: q.zome, FieldPath: field, EntryType: q.entryType})
+}
+
+// iterate runs an index iteration turning a missing index into a useful error
+func (q *indexQuery) iterate(field string, fn func(tx *buntdb.Tx, index string) error) (err error) {
+	err = q.db.View(func(tx *buntdb.Tx) error {
+		return fn(tx, q.indexName(field))
+	})
+	if err == buntdb.ErrNotFound {
+		err = fmt.Errorf("queryDHT: %s is not an indexed field of %s", field, q.entryType)
+	}
+	return
+}
+
+// match returns the set of hashes of the entries that match a clause, or nil if the
+// clause has no constraints at all
+func (q *indexQuery) match(c *QueryDHTClause) (set map[string]bool, err error) {
+	if c.Field != "" && !c.Constrain.empty() {
+		set, err = q.leaf(c.Field, &c.Constrain)
+		if err != nil {
+			return
+		}
+	}
+	for i := range c.And {
+		var s map[string]bool
+		s, err = q.match(&c.And[i])
+		if err != nil {
+			return
+		}
+		set = intersectHashSets(set, s)
+	}
+	if len(c.Or) > 0 {
+		var union map[string]bool
+		for i := range c.Or {
+			var s map[string]bool
+			s, err = q.match(&c.Or[i])
+			if err != nil {
+				return
+			}
+			if s == nil {
+				err = ErrQueryDHTNoConstraints
+				return
+			}
+			if union == nil {
+				union = make(map[string]bool)
+			}
+			for k := range s {
+				union[k] = true
+			}
+		}
+		set = intersectHashSets(set, union)
+	}
+	return
+}
+
+// intersectHashSets returns the hashes in both sets, where nil stands for every hash
+func intersectHashSets(a, b map[string]bool) map[string]bool {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	result := make(map[string]bool)
+	for k := range a {
+		if b[k] {
+			result[k] = true
+		}
+	}
+	return result
+}
+
+// leaf returns the set of hashes of the entries whose field meets the constraint
+func (q *indexQuery) leaf(field string, c *QueryDHTConstraint) (set map[string]bool, err error) {
+	set = make(map[string]bool)
+	add := func(key, val string) bool {
+		set[getHash(key)] = true
+		return true
+	}
+	pivot := func(v interface{}) string {
+		return buildPivot(field, v)
+	}
+	err = q.iterate(field, func(tx *buntdb.Tx, index string) error {
+		switch {
+		case c.EQ != nil:
+			return tx.AscendEqual(index, pivot(c.EQ), add)
+		case c.LT != nil:
+			return tx.AscendLessThan(index, pivot(c.LT), add)
+		case c.LTE != nil:
+			return tx.DescendLessOrEqual(index, pivot(c.LTE), add)
+		case c.GT != nil:
+			return tx.DescendGreaterThan(index, pivot(c.GT), add)
+		case c.GTE != nil:
+			return tx.AscendGreaterOrEqual(index, pivot(c.GTE), add)
+		case c.Range.From != nil && c.Range.To != nil:
+			// as with single field queries the range may be given in either order
+			from, to := pivot(c.Range.From), pivot(c.Range.To)
+			if e := tx.AscendRange(index, from, to, add); e != nil {
+				return e
+			}
+			return tx.DescendRange(index, from, to, add)
+		case c.Prefix != "":
+			// the index orders strings without regard to case so scan from the prefix
+			// until the values no longer start with it in any case
+			lower := strings.ToLower(c.Prefix)
+			return tx.AscendGreaterOrEqual(index, pivot(c.Prefix), func(key, val string) bool {
+				v := gjson.Get(val, field)
+				if v.Type != gjson.String || !strings.HasPrefix(strings.ToLower(v.Str), lower) {
+					return false
+				}
+				if strings.HasPrefix(v.Str, c.Prefix) {
+					add(key, val)
+				}
+				return true
+			})
+		case c.Contains != "":
+			return tx.Ascend(index, func(key, val string) bool {
+				v := gjson.Get(val, field)
+				if v.Type == gjson.String && strings.Contains(v.Str, c.Contains) {
+					add(key, val)
+				}
+				return true
+			})
+		}
+		return ErrQueryDHTInvalidConstraint
+	})
+	return
+}
+
+// sorted returns the hashes in the set in the order of the given field's index
+func (q *indexQuery) sorted(set map[string]bool, field string, ascending bool) (hashes []string, err error) {
+	hashes = make([]string, 0, len(set))
+	collect := func(key, val string) bool {
+		if k := getHash(key); set[k] {
+			hashes = append(hashes, k)
+		}
+		return true
+	}
+	err = q.iterate(field, func(tx *buntdb.Tx, index string) error {
+		if ascending {
+			return tx.Ascend(index, collect)
+		}
+		return tx.Descend(index, collect)
+	})
+	return
+}
+
+// compoundHashes returns the hashes of the entries matching a compound query in
+// sorted order
+func (a *APIFnQueryDHT) compoundHashes(db *buntdb.DB) (hashes []string, err error) {
+	q := indexQuery{db: db, zome: a.zome.Name, entryType: a.entryType}
+	c := a.options.clause()
+	var set map[string]bool
+	set, err = q.match(&c)
+	if err != nil {
+		return
+	}
+	if set == nil {
+		err = ErrQueryDHTNoConstraints
+		return
+	}
+	sort := a.options.Sort
+	if sort == "" {
+		sort = c.firstField()
+	}
+	if sort == "" {
+		err = ErrQueryDHTNoSortField
+		return
+	}
+	hashes, err = q.sorted(set, sort, a.options.Ascending)
+	return
+}
@@ -3,6 +3,7 @@ package holochain
 import (
   "fmt"
   "github.com/robertkrimen/otto"
+  zygo "github.com/glycerine/zygomys/zygo"
   . "github.com/smartystreets/goconvey/convey"
   "testing"
   "encoding/json"
@@ -239,3 +240,86 @@ func TestJSQueryDHTPaging(t *testing.T) {
     So(lookupRange("age", 101, 15, false, 50, 0, false), ShouldEqual, hashcat(sehsah[:17]...))
   })
 }
+
+func TestJSQueryDHTCompound(t *testing.T) {
+  d, _, h := PrepareTestChain("test")
+  defer CleanupTestChain(h, d)
+  zome, _ := h.GetZome("jsSampleZome")
+  v, err := NewJSRibosome(h, zome)
+  if err != nil {
+    panic(err)
+  }
+  z := v.(*JSRibosome)
+
+  hash1 := fmt.Sprint(commit(h, "profile", `{"firstName":"Willem", "lastName":"Dafoe", "age" : 62}`))
+  hash2 := fmt.Sprint(commit(h, "profile", `{"firstName":"Wilma", "lastName":"Flintstone", "age" : 33}`))
+  hash3 := fmt.Sprint(commit(h, "profile", `{"firstName":"Polly", "lastName":"Person", "age" : 37}`))
+  hash4 := fmt.Sprint(commit(h, "profile", `{"firstName":"Maackle", "lastName":"Diggity", "age" : 26}`))
+
+  query := func(options string) string {
+    value, err := z.Run(fmt.Sprintf(`JSON.stringify(queryDHT('profile', %s))`, options))
+    So(err, ShouldBeNil)
+    result, _ := value.(*otto.Value).ToString()
+    return result
+  }
+
+  Convey("Can match strings by prefix", t, func() {
+    So(query(`{Field: "firstName", Constrain: {Prefix: "Wil"}, Ascending: true}`), ShouldEqual, hashcat(hash1, hash2))
+    So(query(`{Field: "firstName", Constrain: {Prefix: "wil"}, Ascending: true}`), ShouldEqual, hashcat(""))
+  })
+
+  Convey("Can match strings containing a substring", t, func() {
+    So(query(`{Field: "firstName", Constrain: {Contains: "ll"}, Ascending: true}`), ShouldEqual, hashcat(hash3, hash1))
+  })
+
+  Convey("Can AND constraints on several fields", t, func() {
+    So(query(`{Field: "firstName", Constrain: {Prefix: "Wil"}, And: [{Field: "age", Constrain: {LT: 50}}], Ascending: true}`), ShouldEqual, hashcat(hash2))
+  })
+
+  Convey("Can OR constraints on several fields", t, func() {
+    So(query(`{Or: [{Field: "firstName", Constrain: {EQ: "Polly"}}, {Field: "age", Constrain: {GT: 60}}], Sort: "age", Ascending: true}`), ShouldEqual, hashcat(hash3, hash1))
+  })
+
+  Convey("Can sort on a field other than the one filtered on", t, func() {
+    So(query(`{Field: "age", Constrain: {LT: 50}, Sort: "firstName", Ascending: true}`), ShouldEqual, hashcat(hash4, hash3, hash2))
+    So(query(`{Field: "age", Constrain: {LT: 50}, Sort: "firstName", Ascending: false}`), ShouldEqual, hashcat(hash2, hash3, hash4))
+    So(query(`{Field: "age", Constrain: {LT: 50}, Sort: "firstName", Ascending: true, Count: 2, Page: 1}`), ShouldEqual, hashcat(hash2))
+  })
+
+  Convey("Compound queries on fields that aren't indexed should fail", t, func() {
+    _, err := z.Run(`queryDHT('profile', {Field: "lastName", Constrain: {Prefix: "D"}})`)
+    So(err.Error(), ShouldContainSubstring, "lastName is not an indexed field of profile")
+  })
+}
+
+func TestZygoQueryDHT(t *testing.T) {
+  d, _, h := PrepareTestChain("test")
+  defer CleanupTestChain(h, d)
+  zome, _ := h.GetZome("zySampleZome")
+  v, err := NewZygoRibosome(h, zome)
+  if err != nil {
+    panic(err)
+  }
+  z := v.(*ZygoRibosome)
+
+  hash1 := fmt.Sprint(commit(h, "profile", `{"firstName":"Willem", "lastName":"Dafoe", "age" : 62}`))
+  hash2 := fmt.Sprint(commit(h, "profile", `{"firstName":"Wilma", "lastName":"Flintstone", "age" : 33}`))
+
+  query := func(options string) string {
+    _, err := z.Run(fmt.Sprintf(`(queryDHT "profile" %s)`, options))
+    So(err, ShouldBeNil)
+    sh := z.lastResult.(*zygo.SexpHash)
+    r, err := sh.HashGet(z.env, z.env.MakeSymbol("result"))
+    So(err, ShouldBeNil)
+    return r.(*zygo.SexpStr).S
+  }
+
+  Convey("Can query a single field", t, func() {
+    So(query(`(hash Field:"age" Constrain:(hash GT:40) Ascending:true)`), ShouldEqual, hashcat(hash1))
+  })
+
+  Convey("Can make compound queries with the same options as javascript", t, func() {
+    So(query(`(hash Field:"firstName" Constrain:(hash Prefix:"Wil") Sort:"age" Ascending:false)`), ShouldEqual, hashcat(hash1, hash2))
+    So(query(`(hash Field:"firstName" Constrain:(hash Prefix:"Wil") And:[(hash Field:"age" Constrain:(hash LT:50))] Ascending:true)`), ShouldEqual, hashcat(hash2))
+  })
+}
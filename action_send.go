@@ -27,6 +27,7 @@ type ActionSend struct {
 }
 
 type APIFnSend struct {
+	tracing
 	action ActionSend
 }
 
@@ -46,6 +47,7 @@ func (fn *APIFnSend) Call(h *Holochain) (response interface{}, err error) {
 		timeout = time.Duration(a.options.Timeout) * time.Millisecond
 	}
 	msg := h.node.NewMessage(APP_MESSAGE, a.msg)
+	msg.Trace = fn.trace
 	if a.options != nil && a.options.Callback != nil {
 		err = h.SendAsync(ActionProtocol, a.to, msg, a.options.Callback, timeout)
 	} else {
@@ -65,10 +67,12 @@ func (a *ActionSend) Name() string {
 func (a *ActionSend) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
 	t := msg.Body.(AppMsg)
 	var r Ribosome
-	r, _, err = dht.h.MakeRibosome(t.ZomeType)
+	var z *Zome
+	r, z, err = dht.h.MakeRibosome(t.ZomeType)
 	if err != nil {
 		return
 	}
+	defer dht.h.ReleaseRibosome(z, r)
 	rsp := AppMsg{ZomeType: t.ZomeType}
 	rsp.Body, err = r.Receive(peer.IDB58Encode(msg.From), t.Body)
 	if err == nil {
@@ -9,6 +9,7 @@ import (
 // Mod
 
 type APIFnMod struct {
+	tracing
 	action ActionMod
 }
 
@@ -22,7 +23,7 @@ func (fn *APIFnMod) Args() []Arg {
 
 func (fn *APIFnMod) Call(h *Holochain) (response interface{}, err error) {
 	a := &fn.action
-	response, err = h.commitAndShare(a, a.replaces)
+	response, err = h.commitAndShare(fn.trace, a, a.replaces)
 	return
 }
 
@@ -58,12 +59,12 @@ func (a *ActionMod) GetHeader() (header *Header) {
 	return a.header
 }
 
-func (a *ActionMod) Share(h *Holochain, def *EntryDef) (err error) {
+func (a *ActionMod) Share(h *Holochain, trace SpanContext, def *EntryDef) (err error) {
 	if def.isSharingPublic() {
 		// if it's a public entry send the DHT MOD & PUT messages
 		// TODO handle errors better!!
-		h.dht.Change(a.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: a.header.EntryLink})
-		h.dht.Change(a.replaces, MOD_REQUEST, HoldReq{RelatedHash: a.replaces, EntryHash: a.header.EntryLink})
+		h.dht.Change(trace, a.header.EntryLink, PUT_REQUEST, HoldReq{EntryHash: a.header.EntryLink, TTL: def.TTL})
+		h.dht.Change(trace, a.replaces, MOD_REQUEST, HoldReq{RelatedHash: a.replaces, EntryHash: a.header.EntryLink})
 	}
 	return
 }
@@ -123,7 +124,7 @@ func (a *ActionMod) Receive(dht *DHT, msg *Message) (response interface{}, err e
 	t := msg.Body.(HoldReq)
 	var holdResp *HoldResp
 
-	err = RunValidationPhase(dht.h, msg.From, VALIDATE_MOD_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
+	err = RunValidationPhase(dht.h, msg.From, msg.Trace, VALIDATE_MOD_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
 		a := NewModAction(resp.Type, &resp.Entry, t.RelatedHash)
 		a.header = &resp.Header
 
@@ -11,6 +11,7 @@ import (
 // ModAgent
 
 type APIFnModAgent struct {
+	tracing
 	Identity   AgentIdentity
 	Revocation string
 }
@@ -76,6 +77,7 @@ func (fn *APIFnModAgent) Call(h *Holochain) (response interface{}, err error) {
 			if err != nil {
 				return
 			}
+			h.Config.Loggers.SetContext(h.Name(), h.nodeIDStr)
 
 			newKey, err = NewHash(h.nodeIDStr)
 			if err != nil {
@@ -87,7 +89,7 @@ func (fn *APIFnModAgent) Call(h *Holochain) (response interface{}, err error) {
 			h.node.Close()
 			h.createNode()
 
-			h.dht.Change(oldKey, MOD_REQUEST, HoldReq{RelatedHash: oldKey, EntryHash: newKey})
+			h.dht.Change(fn.trace, oldKey, MOD_REQUEST, HoldReq{RelatedHash: oldKey, EntryHash: newKey})
 
 			warrant, _ := NewSelfRevocationWarrant(revocation)
 			var data []byte
@@ -97,7 +99,7 @@ func (fn *APIFnModAgent) Call(h *Holochain) (response interface{}, err error) {
 			}
 
 			// TODO, this isn't really a DHT send, but a management send, so the key is bogus.  have to work this out...
-			h.dht.Change(oldKey, LISTADD_REQUEST,
+			h.dht.Change(fn.trace, oldKey, LISTADD_REQUEST,
 				ListAddReq{
 					ListType:    BlockedList,
 					Peers:       []string{peer.IDB58Encode(oldPeer)},
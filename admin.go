@@ -0,0 +1,247 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// admin implements the operations of the admin api of a running node, and the file
+// through which the node tells local clients where to find the api
+
+package holochain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// AdminFileName is the file in a chain's directory that holds the port and token of the
+// admin api while the node is running
+const AdminFileName = "admin.json"
+
+// DaemonFileName is the file in the service's directory that holds the port and token of
+// the control endpoints of hcd's daemon mode while it's running
+const DaemonFileName = "daemon.json"
+
+// AdminInfo is what a client needs to reach the admin api of a running node
+type AdminInfo struct {
+	Port  int
+	Token string
+}
+
+// NodeStatus reports on a running node and the sizes of its chain and dht
+type NodeStatus struct {
+	Name        string
+	DNA         string
+	ID          string
+	ChainLength int
+	ChainBytes  int64
+	DHTEntries  int
+	DHTIdx      int
+	DHTBytes    int64
+	Peers       int
+	Blocked     int
+}
+
+// NodePeer describes a peer in the node's routing table
+type NodePeer struct {
+	ID         string
+	Addrs      []string
+	Blocked    bool
+	Reputation float64
+}
+
+// NodeGossiper is a gossiper and the index of the last of its puts the node has seen
+type NodeGossiper struct {
+	ID     string
+	PutIdx int
+}
+
+var ErrAdminNotRunning = errors.New("admin api not running, is the node running?")
+var ErrDaemonNotRunning = errors.New("daemon not running")
+var ErrHoldingNeedsWorldModel = errors.New("holding checks need the world model enabled")
+
+// NewAdminToken returns a random token for authenticating admin api clients
+func NewAdminToken() (token string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return
+	}
+	token = hex.EncodeToString(b)
+	return
+}
+
+// WriteAdminInfo writes the admin api's port and token to the chain's directory, readable
+// only by the node's user
+func (h *Holochain) WriteAdminInfo(info AdminInfo) (err error) {
+	err = writeAdminFile(filepath.Join(h.rootPath, AdminFileName), info)
+	return
+}
+
+// RemoveAdminInfo removes the admin api file when the api stops
+func (h *Holochain) RemoveAdminInfo() (err error) {
+	err = removeAdminFile(filepath.Join(h.rootPath, AdminFileName))
+	return
+}
+
+// ReadAdminInfo returns the admin api's port and token for the chain at the given path
+func ReadAdminInfo(root string) (info AdminInfo, err error) {
+	info, err = readAdminFile(filepath.Join(root, AdminFileName), ErrAdminNotRunning)
+	return
+}
+
+// WriteDaemonInfo writes the port and token of the daemon's control endpoints to the
+// service's directory, readable only by the daemon's user
+func (s *Service) WriteDaemonInfo(info AdminInfo) (err error) {
+	err = writeAdminFile(filepath.Join(s.Path, DaemonFileName), info)
+	return
+}
+
+// RemoveDaemonInfo removes the daemon file when the daemon stops
+func (s *Service) RemoveDaemonInfo() (err error) {
+	err = removeAdminFile(filepath.Join(s.Path, DaemonFileName))
+	return
+}
+
+// ReadDaemonInfo returns the port and token of the daemon's control endpoints for the
+// service at the given path
+func ReadDaemonInfo(root string) (info AdminInfo, err error) {
+	info, err = readAdminFile(filepath.Join(root, DaemonFileName), ErrDaemonNotRunning)
+	return
+}
+
+func writeAdminFile(path string, info AdminInfo) (err error) {
+	var b []byte
+	b, err = json.Marshal(info)
+	if err != nil {
+		return
+	}
+	var f *os.File
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	return
+}
+
+func removeAdminFile(path string) (err error) {
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+func readAdminFile(path string, notRunning error) (info AdminInfo, err error) {
+	var f *os.File
+	f, err = os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = notRunning
+		}
+		return
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&info)
+	return
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// NodeStatus returns the status of the running node
+func (h *Holochain) NodeStatus() (status NodeStatus, err error) {
+	status = NodeStatus{
+		Name:        h.Name(),
+		DNA:         h.DNAHash().String(),
+		ID:          h.nodeIDStr,
+		ChainLength: h.chain.Length(),
+		ChainBytes:  fileSize(filepath.Join(h.DBPath(), StoreFileName)),
+		DHTBytes:    fileSize(filepath.Join(h.DBPath(), DHTStoreFileName)),
+		Peers:       h.node.routingTable.Size(),
+		Blocked:     h.node.BlockedCount(),
+	}
+	status.DHTIdx, err = h.dht.GetIdx()
+	if err != nil {
+		return
+	}
+	h.dht.Iterate(func(hash Hash) bool {
+		status.DHTEntries++
+		return true
+	})
+	return
+}
+
+// NodePeers returns the peers in the node's routing table
+func (h *Holochain) NodePeers() (peers []NodePeer) {
+	peers = make([]NodePeer, 0)
+	for _, id := range h.node.routingTable.ListPeers() {
+		p := NodePeer{ID: peer.IDB58Encode(id), Blocked: h.node.IsBlocked(id), Reputation: MaxReputation}
+		if h.reputation != nil {
+			p.Reputation = h.reputation.Score(id)
+		}
+		for _, a := range h.node.host.Peerstore().Addrs(id) {
+			p.Addrs = append(p.Addrs, a.String())
+		}
+		peers = append(peers, p)
+	}
+	return
+}
+
+// NodeGossipers returns the node's gossipers and where it's up to with each of them
+func (h *Holochain) NodeGossipers() (gossipers []NodeGossiper, err error) {
+	var glist []GossiperData
+	glist, err = h.dht.GetGossipers()
+	if err != nil {
+		return
+	}
+	gossipers = make([]NodeGossiper, 0, len(glist))
+	for _, g := range glist {
+		gossipers = append(gossipers, NodeGossiper{ID: peer.IDB58Encode(g.ID), PutIdx: g.PutIdx})
+	}
+	return
+}
+
+// BlockPeer stops the node talking to a peer and forgets it as a gossiper
+func (h *Holochain) BlockPeer(id peer.ID) {
+	h.node.Block(id)
+	if h.dht != nil {
+		h.dht.DeleteGossiper(id) // ignore error
+	}
+}
+
+// UnblockPeer lets the node talk to a peer again, forgetting what lowered its reputation
+func (h *Holochain) UnblockPeer(id peer.ID) {
+	h.node.Unblock(id)
+	if h.reputation != nil {
+		h.reputation.Reset(id) // ignore error
+	}
+}
+
+// TriggerGossip starts a round of gossip with a random gossiper now
+func (h *Holochain) TriggerGossip() (err error) {
+	err = h.dht.gossip()
+	return
+}
+
+// TriggerHoldingCheck runs the check of the entries the node should be holding now
+func (h *Holochain) TriggerHoldingCheck() (err error) {
+	if h.world == nil {
+		err = ErrHoldingNeedsWorldModel
+		return
+	}
+	HoldingTask(h)
+	return
+}
@@ -0,0 +1,80 @@
+package holochain
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdminInfo(t *testing.T) {
+	d, _, h := SetupTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should write, read and remove the admin info", t, func() {
+		_, err := ReadAdminInfo(h.RootPath())
+		So(err, ShouldEqual, ErrAdminNotRunning)
+
+		token, err := NewAdminToken()
+		So(err, ShouldBeNil)
+		So(len(token), ShouldEqual, 64)
+		So(h.WriteAdminInfo(AdminInfo{Port: 1234, Token: token}), ShouldBeNil)
+
+		info, err := ReadAdminInfo(h.RootPath())
+		So(err, ShouldBeNil)
+		So(info.Port, ShouldEqual, 1234)
+		So(info.Token, ShouldEqual, token)
+
+		So(h.RemoveAdminInfo(), ShouldBeNil)
+		_, err = ReadAdminInfo(h.RootPath())
+		So(err, ShouldEqual, ErrAdminNotRunning)
+		So(h.RemoveAdminInfo(), ShouldBeNil)
+	})
+}
+
+func TestNodeAdmin(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	h0 := nodes[0]
+	h1 := nodes[1]
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+
+	Convey("it should report the node's status", t, func() {
+		status, err := h0.NodeStatus()
+		So(err, ShouldBeNil)
+		So(status.Name, ShouldEqual, h0.Name())
+		So(status.ChainLength, ShouldEqual, h0.chain.Length())
+		So(status.Peers, ShouldEqual, 1)
+		So(status.Blocked, ShouldEqual, 0)
+		idx, _ := h0.dht.GetIdx()
+		So(status.DHTIdx, ShouldEqual, idx)
+		So(status.DHTEntries, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("it should list the peers in the routing table", t, func() {
+		peers := h0.NodePeers()
+		So(len(peers), ShouldEqual, 1)
+		So(peers[0].ID, ShouldEqual, h1.NodeIDStr())
+		So(len(peers[0].Addrs), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("blocking a peer should forget it as a gossiper", t, func() {
+		h0.dht.AddGossiper(h1.nodeID)
+		gossipers, err := h0.NodeGossipers()
+		So(err, ShouldBeNil)
+		So(len(gossipers), ShouldEqual, 1)
+		So(gossipers[0].ID, ShouldEqual, h1.NodeIDStr())
+
+		h0.BlockPeer(h1.nodeID)
+		So(h0.node.IsBlocked(h1.nodeID), ShouldBeTrue)
+		gossipers, err = h0.NodeGossipers()
+		So(err, ShouldBeNil)
+		So(len(gossipers), ShouldEqual, 0)
+		status, _ := h0.NodeStatus()
+		So(status.Blocked, ShouldEqual, 1)
+
+		h0.UnblockPeer(h1.nodeID)
+		So(h0.node.IsBlocked(h1.nodeID), ShouldBeFalse)
+	})
+}
@@ -215,6 +215,7 @@ type benchmark struct {
 	DHTGrowth   int64
 	BytesSent   int64
 	GossipSent  int64
+	GossipSaved int64
 	start       time.Time
 	h           *Holochain
 	process     *process.Process
@@ -255,6 +256,7 @@ func StartBench(h *Holochain) *benchmark {
 
 func (b *benchmark) updateBytesSent(bsc chan BytesSent) {
 	bs := <-bsc
+	b.GossipSaved += bs.Saved
 	switch bs.MsgType {
 	case GOSSIP_REQUEST:
 		fallthrough
@@ -360,6 +362,7 @@ func logBenchmarkTotals(log *Logger, benchmarks map[string]*benchmark) {
 		total.CPU += b.CPU
 		total.BytesSent += b.BytesSent
 		total.GossipSent += b.GossipSent
+		total.GossipSaved += b.GossipSaved
 	}
 	log.Logf(`Benchmark Summary:
    Total elapsed time: %v
@@ -367,8 +370,9 @@ func logBenchmarkTotals(log *Logger, benchmarks map[string]*benchmark) {
    Total DHT growth: %.2fK bytes
    Total Bytes sent: %.2fK
    Total Gossip sent: %.2fK
+   Total Gossip saved: %.2fK
    Total CPU use: %.2fms
-`, total.ElapsedTime, toK(total.ChainGrowth), toK(total.DHTGrowth), toK(total.BytesSent), toK(total.GossipSent), total.CPU*1000)
+`, total.ElapsedTime, toK(total.ChainGrowth), toK(total.DHTGrowth), toK(total.BytesSent), toK(total.GossipSent), toK(total.GossipSaved), total.CPU*1000)
 
 }
 
@@ -379,8 +383,9 @@ func logBenchmark(log *Logger, name string, b *benchmark) {
    DHT growth: %.2fK bytes
    BytesSent: %.2fK
    GossipSent: %.2fK
+   GossipSaved: %.2fK
    CPU: %.2fms
-`, name, b.ElapsedTime, toK(b.ChainGrowth), toK(b.DHTGrowth), toK(b.BytesSent), toK(b.GossipSent), b.CPU*1000)
+`, name, b.ElapsedTime, toK(b.ChainGrowth), toK(b.DHTGrowth), toK(b.BytesSent), toK(b.GossipSent), toK(b.GossipSaved), b.CPU*1000)
 }
 
 func toK(bytes int64) float64 {
@@ -508,11 +513,12 @@ func DoTest(h *Holochain, name string, i int, fixtures TestFixtures, t TestData,
 			b = StartBench(h)
 		}
 		if t.Raw {
-			n, _, err := h.MakeRibosome(t.Zome)
+			n, z, err := h.MakeRibosome(t.Zome)
 			if err != nil {
 				actualError = err
 			} else {
 				actualResult, actualError = n.Run(input)
+				h.ReleaseRibosome(z, n)
 			}
 		} else {
 			actualResult, actualError = h.Call(t.Zome, t.FnName, input, t.Exposure)
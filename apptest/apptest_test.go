@@ -195,9 +195,11 @@ func TestTestBenchmark(t *testing.T) {
 		BytesSentChan <- BytesSent{Bytes: int64(100), MsgType: PUT_REQUEST}
 		BytesSentChan <- BytesSent{Bytes: int64(500), MsgType: GOSSIP_REQUEST}
 		BytesSentChan <- BytesSent{Bytes: int64(200), MsgType: GET_REQUEST}
+		BytesSentChan <- BytesSent{Saved: int64(700), MsgType: GOSSIP_REQUEST}
 		benchmark.End()
 		So(benchmark.BytesSent, ShouldEqual, 300)
 		So(benchmark.GossipSent, ShouldEqual, 500)
+		So(benchmark.GossipSaved, ShouldEqual, 700)
 	})
 }
 
@@ -0,0 +1,1060 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements a boltdb based instance of HashTable
+// unlike buntdb, boltdb keeps its data on disk and only pages in what it needs,
+// so this store can hold more data than fits into memory
+
+package holochain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	"github.com/boltdb/bolt"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+type BoltHT struct {
+	db *bolt.DB
+}
+
+var (
+	boltEntryBucket       = []byte("entry")
+	boltTypeBucket        = []byte("type")
+	boltSrcBucket         = []byte("src")
+	boltStatusBucket      = []byte("status")
+	boltReplacedByBucket  = []byte("replacedBy")
+	boltLinkBucket        = []byte("link")
+	boltIdxBucket         = []byte("idx")
+	boltFingerprintBucket = []byte("f")
+	boltPeerBucket        = []byte("peer")
+	boltListBucket        = []byte("list")
+	boltMetaBucket        = []byte("meta")
+	boltExpiresBucket     = []byte("expires")
+	boltThrottledBucket   = []byte("throttled")
+	boltHeaderBucket      = []byte("header")
+	boltHeadBucket        = []byte("head")
+
+	boltBuckets = [][]byte{
+		boltEntryBucket, boltTypeBucket, boltSrcBucket, boltStatusBucket,
+		boltReplacedByBucket, boltLinkBucket, boltIdxBucket, boltFingerprintBucket,
+		boltPeerBucket, boltListBucket, boltMetaBucket, boltExpiresBucket, boltThrottledBucket,
+		boltHeaderBucket, boltHeadBucket,
+	}
+
+	boltIdxKey        = []byte("_idx")
+	boltCheckpointKey = []byte("_checkpoint")
+)
+
+const (
+	BoltOpenTimeout = time.Second
+)
+
+// ErrBoltNotFound mirrors buntdb's not found error for keys that aren't hashes
+var ErrBoltNotFound = errors.New("not found")
+
+// Open initializes the table
+func (ht *BoltHT) Open(opts interface{}) (err error) {
+	file := opts.(string)
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: BoltOpenTimeout})
+	if err != nil {
+		return
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range boltBuckets {
+			_, err := tx.CreateBucketIfNotExists(b)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return
+	}
+	ht.db = db
+	return
+}
+
+// Close cleans up any resources used by the table
+func (ht *BoltHT) Close() {
+	ht.db.Close()
+	ht.db = nil
+}
+
+// boltIdxBytes encodes a change index so that keys sort in numeric order
+func boltIdxBytes(idx int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(idx))
+	return b
+}
+
+// boltGetIntVal returns an integer value at a given key, and assumes the value 0 if the key doesn't exist
+func boltGetIntVal(b *bolt.Bucket, key []byte) (val int, err error) {
+	v := b.Get(key)
+	if v != nil {
+		val, err = strconv.Atoi(string(v))
+	}
+	return
+}
+
+// boltIncIdx adds a new index record to dht for gossiping later
+func boltIncIdx(tx *bolt.Tx, m *Message) (index int, err error) {
+	// if message is nil we can't record this for gossiping
+	// this should only be the case for the DNA
+	if m == nil {
+		return
+	}
+
+	meta := tx.Bucket(boltMetaBucket)
+	index, err = boltGetIntVal(meta, boltIdxKey)
+	if err != nil {
+		return
+	}
+	index++
+	err = meta.Put(boltIdxKey, []byte(strconv.Itoa(index)))
+	if err != nil {
+		return
+	}
+
+	var b []byte
+	b, err = ByteEncoder(m)
+	if err != nil {
+		return
+	}
+	err = tx.Bucket(boltIdxBucket).Put(boltIdxBytes(index), b)
+	if err != nil {
+		return
+	}
+
+	var f Hash
+	f, err = m.Fingerprint()
+	if err != nil {
+		return
+	}
+	err = tx.Bucket(boltFingerprintBucket).Put([]byte(f.String()), []byte(strconv.Itoa(index)))
+	return
+}
+
+// Put stores a value to the DHT store
+// N.B. This call assumes that the value has already been validated
+func (ht *BoltHT) Put(m *Message, entryType string, key Hash, src peer.ID, value []byte, status int) (err error) {
+	k := []byte(key.String())
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		_, err := boltIncIdx(tx, m)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(boltEntryBucket).Put(k, value)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(boltTypeBucket).Put(k, []byte(entryType))
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(boltSrcBucket).Put(k, []byte(peer.IDB58Encode(src)))
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(boltStatusBucket).Put(k, []byte(fmt.Sprintf("%d", status)))
+		if err != nil {
+			return err
+		}
+		return _boltSetExpiry(tx, k, m)
+	})
+	return
+}
+
+// _boltSetExpiry records when the data at a key expires according to the message that put it.
+// Data that's put again without a TTL no longer expires.
+func _boltSetExpiry(tx *bolt.Tx, k []byte, m *Message) (err error) {
+	t := changeExpiry(m)
+	if t.IsZero() {
+		err = tx.Bucket(boltExpiresBucket).Delete(k)
+		return
+	}
+	err = tx.Bucket(boltExpiresBucket).Put(k, []byte(strconv.FormatInt(t.UnixNano(), 10)))
+	return
+}
+
+// _boltExpired returns true if the data at a key has expired by the given time
+func _boltExpired(tx *bolt.Tx, k []byte, now time.Time) bool {
+	val := tx.Bucket(boltExpiresBucket).Get(k)
+	if val == nil {
+		return false
+	}
+	t, err := strconv.ParseInt(string(val), 10, 64)
+	return err == nil && now.UnixNano() >= t
+}
+
+func _boltSetStatus(tx *bolt.Tx, m *Message, key string, status int) (err error) {
+	k := []byte(key)
+	if tx.Bucket(boltTypeBucket).Get(k) == nil {
+		err = ErrHashNotFound
+		return
+	}
+
+	_, err = boltIncIdx(tx, m)
+	if err != nil {
+		return
+	}
+
+	err = tx.Bucket(boltStatusBucket).Put(k, []byte(fmt.Sprintf("%d", status)))
+	return
+}
+
+// Del moves the given hash to the StatusDeleted status
+// N.B. this functions assumes that the validity of this action has been confirmed
+func (ht *BoltHT) Del(m *Message, key Hash) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		return _boltSetStatus(tx, m, key.String(), StatusDeleted)
+	})
+	return
+}
+
+// Mod moves the given hash to the StatusModified status
+// N.B. this functions assumes that the validity of this action has been confirmed
+func (ht *BoltHT) Mod(m *Message, key Hash, newkey Hash) (err error) {
+	k := key.String()
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		err := _boltSetStatus(tx, m, k, StatusModified)
+		if err != nil {
+			return err
+		}
+		link := newkey.String()
+		err = _boltLink(tx, k, link, SysTagReplacedBy, m.From, StatusLive, newkey, m.Time, changeExpiry(m))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltReplacedByBucket).Put([]byte(k), []byte(link))
+	})
+	return
+}
+
+// Fork moves the given hash to the StatusForked status
+func (ht *BoltHT) Fork(key Hash) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		return _boltSetStatus(tx, nil, key.String(), StatusForked)
+	})
+	return
+}
+
+func _boltGet(tx *bolt.Tx, k string, statusMask int) (val string, err error) {
+	key := []byte(k)
+	if tx.Bucket(boltTypeBucket).Get(key) == nil || _boltExpired(tx, key, time.Now()) {
+		err = ErrHashNotFound
+		return
+	}
+	val = string(tx.Bucket(boltEntryBucket).Get(key))
+
+	statusVal := string(tx.Bucket(boltStatusBucket).Get(key))
+	if statusMask == StatusDefault {
+		// if the status mask is not given (i.e. Default) then
+		// we return information about the status if it's other than live
+		switch statusVal {
+		case StatusDeletedVal:
+			err = ErrHashDeleted
+		case StatusModifiedVal:
+			r := tx.Bucket(boltReplacedByBucket).Get(key)
+			if r == nil {
+				panic("missing expected replacedBy record")
+			}
+			val = string(r)
+			err = ErrHashModified
+		case StatusRejectedVal:
+			err = ErrHashRejected
+		case StatusForkedVal:
+			err = ErrHashForked
+		case StatusLiveVal:
+		default:
+			panic("unknown status!")
+		}
+	} else {
+		// otherwise we return the value only if the status is in the mask
+		var status int
+		status, err = strconv.Atoi(statusVal)
+		if err == nil {
+			if (status & statusMask) == 0 {
+				err = ErrHashNotFound
+			}
+		}
+	}
+	return
+}
+
+// Forget removes all the data held for a hash, including links on it, without
+// recording a change
+func (ht *BoltHT) Forget(key Hash) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		return _boltForget(tx, key.String())
+	})
+	return
+}
+
+func _boltForget(tx *bolt.Tx, key string) (err error) {
+	k := []byte(key)
+	if tx.Bucket(boltTypeBucket).Get(k) == nil {
+		return ErrHashNotFound
+	}
+	for _, name := range [][]byte{boltEntryBucket, boltTypeBucket, boltSrcBucket, boltStatusBucket, boltReplacedByBucket, boltExpiresBucket} {
+		if err := tx.Bucket(name).Delete(k); err != nil {
+			return err
+		}
+	}
+	// collect the link keys first as deleting while iterating skips keys
+	var links [][]byte
+	prefix := []byte(key + ":")
+	c := tx.Bucket(boltLinkBucket).Cursor()
+	for lk, _ := c.Seek(prefix); lk != nil && bytes.HasPrefix(lk, prefix); lk, _ = c.Next() {
+		links = append(links, append([]byte{}, lk...))
+	}
+	for _, lk := range links {
+		if err := tx.Bucket(boltLinkBucket).Delete(lk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sweep removes the entries and links that have expired by the given time
+func (ht *BoltHT) Sweep(now time.Time) (swept int, err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		// collect the keys first as deleting while iterating skips keys
+		var entries []string
+		var links [][]byte
+		err := tx.Bucket(boltExpiresBucket).ForEach(func(k, v []byte) error {
+			t, e := strconv.ParseInt(string(v), 10, 64)
+			if e == nil && now.UnixNano() >= t {
+				entries = append(entries, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(boltLinkBucket).ForEach(func(k, v []byte) error {
+			var records []linkEvent
+			json.Unmarshal(v, &records)
+			if l := len(records); l > 0 && records[l-1].expired(now) {
+				links = append(links, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range entries {
+			err = _boltForget(tx, k)
+			if err == ErrHashNotFound {
+				// only the expiry record was left
+				err = tx.Bucket(boltExpiresBucket).Delete([]byte(k))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			swept++
+		}
+		b := tx.Bucket(boltLinkBucket)
+		for _, k := range links {
+			// the link may have been on an entry we just swept
+			if b.Get(k) == nil {
+				continue
+			}
+			err = b.Delete(k)
+			if err != nil {
+				return err
+			}
+			swept++
+		}
+		return nil
+	})
+	return
+}
+
+// Exists checks for the existence of the hash in the store
+func (ht *BoltHT) Exists(key Hash, statusMask int) (err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		_, err := _boltGet(tx, key.String(), statusMask)
+		return err
+	})
+	return
+}
+
+// Source returns the source node address of a given hash
+func (ht *BoltHT) Source(key Hash) (id peer.ID, err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(boltSrcBucket).Get([]byte(key.String()))
+		if val == nil {
+			return ErrHashNotFound
+		}
+		var err error
+		id, err = peer.IDB58Decode(string(val))
+		return err
+	})
+	return
+}
+
+// Get retrieves a value from the DHT store
+func (ht *BoltHT) Get(key Hash, statusMask int, getMask int) (data []byte, entryType string, sources []string, status int, err error) {
+	if getMask == GetMaskDefault {
+		getMask = GetMaskEntry
+	}
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		k := key.String()
+		val, err := _boltGet(tx, k, statusMask)
+		data = []byte(val) // gotta do this because value is valid if ErrHashModified
+		if err != nil {
+			return err
+		}
+
+		if (getMask & GetMaskEntryType) != 0 {
+			entryType = string(tx.Bucket(boltTypeBucket).Get([]byte(k)))
+		}
+		if (getMask & GetMaskSources) != 0 {
+			src := tx.Bucket(boltSrcBucket).Get([]byte(k))
+			if src == nil {
+				return ErrHashNotFound
+			}
+			sources = append(sources, string(src))
+		}
+
+		status, err = strconv.Atoi(string(tx.Bucket(boltStatusBucket).Get([]byte(k))))
+		return err
+	})
+	return
+}
+
+// _boltLink is a low level routine to add a link, also used by delLink
+// this ensure monotonic recording of linking attempts
+func _boltLink(tx *bolt.Tx, base string, link string, tag string, src peer.ID, status int, linkingEntryHash Hash, t time.Time, expires time.Time) (err error) {
+	key := []byte(base + ":" + link + ":" + tag)
+	b := tx.Bucket(boltLinkBucket)
+	var records []linkEvent
+	val := b.Get(key)
+	if val != nil {
+		// load the previous value so we can append to it.
+		json.Unmarshal(val, &records)
+	} else if status == StatusDeleted {
+		// when deleting the key must exist
+		err = ErrLinkNotFound
+		return
+	}
+	event := linkEvent{Status: status, Source: peer.IDB58Encode(src), LinksEntry: linkingEntryHash.String(), Time: t.UnixNano()}
+	if !expires.IsZero() {
+		event.Expires = expires.UnixNano()
+	}
+	records = append(records, event)
+	var j []byte
+	j, err = json.Marshal(records)
+	if err != nil {
+		return
+	}
+	err = b.Put(key, j)
+	return
+}
+
+func (ht *BoltHT) link(m *Message, base string, link string, tag string, status int) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		_, err := _boltGet(tx, base, StatusLive)
+		if err != nil {
+			return err
+		}
+		err = _boltLink(tx, base, link, tag, m.From, status, m.Body.(HoldReq).EntryHash, m.Time, changeExpiry(m))
+		if err != nil {
+			return err
+		}
+		_, err = boltIncIdx(tx, m)
+		return err
+	})
+	return
+}
+
+// PutLink associates a link with a stored hash
+// N.B. this function assumes that the data associated has been properly retrieved
+// and validated from the cource chain
+func (ht *BoltHT) PutLink(m *Message, base string, link string, tag string) (err error) {
+	err = ht.link(m, base, link, tag, StatusLive)
+	return
+}
+
+// DelLink removes a link and tag associated with a stored hash
+// N.B. this function assumes that the action has been properly validated
+func (ht *BoltHT) DelLink(m *Message, base string, link string, tag string) (err error) {
+	err = ht.link(m, base, link, tag, StatusDeleted)
+	return
+}
+
+// boltLinkKeyParts splits a link key into the link hash and the tag given the base prefix
+func boltLinkKeyParts(key []byte, prefix []byte) (link string, tag string) {
+	x := strings.SplitN(string(key[len(prefix):]), ":", 2)
+	link = x[0]
+	if len(x) > 1 {
+		tag = x[1]
+	}
+	return
+}
+
+// GetLinks retrieves meta value associated with a base
+func (ht *BoltHT) GetLinks(base Hash, tag string, statusMask int) (results []TaggedHash, err error) {
+	var links []linkRecord
+	links, err = ht.getLinks(base, tag, statusMask)
+	if err != nil {
+		return
+	}
+	results = make([]TaggedHash, len(links))
+	for i := range links {
+		results[i] = links[i].th
+	}
+	return
+}
+
+// GetLinksPage retrieves one page of the links on a base and the cursor of the next page
+func (ht *BoltHT) GetLinksPage(base Hash, tag string, statusMask int, page LinkPage) (results []TaggedHash, next string, err error) {
+	var links []linkRecord
+	links, err = ht.getLinks(base, tag, statusMask)
+	if err != nil {
+		return
+	}
+	results, next, err = pageLinks(links, page)
+	return
+}
+
+func (ht *BoltHT) getLinks(base Hash, tag string, statusMask int) (links []linkRecord, err error) {
+	b := base.String()
+	now := time.Now()
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		_, err := _boltGet(tx, b, StatusLive+StatusModified) //only get links on live and modified bases
+		if err != nil {
+			return err
+		}
+
+		if statusMask == StatusDefault {
+			statusMask = StatusLive
+		}
+
+		prefix := []byte(b + ":")
+		c := tx.Bucket(boltLinkBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			link, t := boltLinkKeyParts(k, prefix)
+			if tag != "" && tag != t {
+				continue
+			}
+			var records []linkEvent
+			json.Unmarshal(v, &records)
+			l := len(records)
+			// as with BuntHT only the last linking event counts
+			if l > 0 {
+				entry := records[l-1]
+				if (entry.Status&statusMask) > 0 && !entry.expired(now) {
+					th := TaggedHash{H: link, Source: entry.Source}
+					if tag == "" {
+						th.T = t
+					}
+					links = append(links, linkRecord{th: th, link: link, tag: t, time: records[0].Time})
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// GetIdx returns the current index of changes to the HashTable
+func (ht *BoltHT) GetIdx() (idx int, err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		var e error
+		idx, e = boltGetIntVal(tx.Bucket(boltMetaBucket), boltIdxKey)
+		return e
+	})
+	return
+}
+
+// GetIdxMessage returns the messages that causes the change at a given index
+func (ht *BoltHT) GetIdxMessage(idx int) (msg Message, err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(boltIdxBucket).Get(boltIdxBytes(idx))
+		if val == nil {
+			return ErrNoSuchIdx
+		}
+		return ByteDecoder(val, &msg)
+	})
+	return
+}
+
+// boltLinksOf returns the link keys and values of a base for dumping
+func boltLinksOf(tx *bolt.Tx, base string, fn func(link, tag, value string)) {
+	prefix := []byte(base + ":")
+	c := tx.Bucket(boltLinkBucket).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		link, tag := boltLinkKeyParts(k, prefix)
+		fn(link, tag, string(v))
+	}
+}
+
+// String converts the table into a human readable string
+func (ht *BoltHT) String() (result string) {
+	idx, err := ht.GetIdx()
+	if err != nil {
+		return err.Error()
+	}
+	result += fmt.Sprintf("DHT changes: %d\n", idx)
+	for i := 1; i <= idx; i++ {
+		str, err := dumpIdx(ht, i)
+		if err != nil {
+			result += fmt.Sprintf("%d Error:%v\n", i, err)
+		} else {
+			result += fmt.Sprintf("%d\n%v\n", i, str)
+		}
+	}
+
+	result += fmt.Sprintf("DHT entries:\n")
+	ht.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEntryBucket).ForEach(func(key, value []byte) error {
+			k := string(key)
+			status := statusValueToString(string(tx.Bucket(boltStatusBucket).Get(key)))
+			sources := string(tx.Bucket(boltSrcBucket).Get(key))
+			var links string
+			boltLinksOf(tx, k, func(link, tag, value string) {
+				links += fmt.Sprintf("Linked to: %s with tag %s\n", link, tag)
+				links += value + "\n"
+			})
+			result += fmt.Sprintf("Hash--%s (status %s):\nValue: %s\nSources: %s\n%s\n", k, status, string(value), sources, links)
+			return nil
+		})
+	})
+	return
+}
+
+// JSON converts the table into a JSON string representation.
+func (ht *BoltHT) JSON() (result string, err error) {
+	var buffer, entries bytes.Buffer
+	idx, err := ht.GetIdx()
+	if err != nil {
+		return "", err
+	}
+	buffer.WriteString("{ \"dht_changes\": [")
+	var changes []string
+	for i := 1; i <= idx; i++ {
+		json, err := dumpIdxJSON(ht, i)
+		if err == ErrNoSuchIdx {
+			// dropped by compaction
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("DHT Change %d,  Error: %v", i, err)
+		}
+		changes = append(changes, json)
+	}
+	buffer.WriteString(strings.Join(changes, ","))
+	buffer.WriteString("], \"dht_entries\": [")
+	ht.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEntryBucket).ForEach(func(key, value []byte) error {
+			k := string(key)
+			status := statusValueToString(string(tx.Bucket(boltStatusBucket).Get(key)))
+			sources := string(tx.Bucket(boltSrcBucket).Get(key))
+			var links bytes.Buffer
+			boltLinksOf(tx, k, func(link, tag, value string) {
+				links.WriteString(fmt.Sprintf("{ \"linkTo\": \"%s\",", link))
+				links.WriteString(fmt.Sprintf("\"tag\": \"%s\",", tag))
+				links.WriteString(fmt.Sprintf("\"value\": \"%s\" },", EscapeJSONValue(value)))
+			})
+			entries.WriteString(fmt.Sprintf("{ \"hash\": \"%s\",", k))
+			entries.WriteString(fmt.Sprintf("\"status\": \"%s\",", status))
+			entries.WriteString(fmt.Sprintf("\"value\": \"%s\",", EscapeJSONValue(string(value))))
+			entries.WriteString(fmt.Sprintf("\"sources\": \"%s\"", sources))
+			if links.Len() > 0 {
+				entries.WriteString(fmt.Sprintf(",\"links\": [%s]", strings.TrimSuffix(links.String(), ",")))
+			}
+			entries.WriteString("},")
+			return nil
+		})
+	})
+	buffer.WriteString(strings.TrimSuffix(entries.String(), ","))
+	buffer.WriteString("]}")
+	return PrettyPrintJSON(buffer.Bytes())
+}
+
+// Iterate call fn on all the hashes in the table
+func (ht *BoltHT) Iterate(fn HashTableIterateFn) {
+	ht.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltEntryBucket).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			hash, err := NewHash(string(k))
+			if err != nil {
+				return err
+			}
+			if !fn(hash) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// GetFingerprint returns the index that of the message that made a change or -1 if we don't have it
+func (ht *BoltHT) GetFingerprint(f Hash) (index int, err error) {
+	index = -1
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(boltFingerprintBucket).Get([]byte(f.String()))
+		if val == nil {
+			return nil
+		}
+		var e error
+		index, e = strconv.Atoi(string(val))
+		return e
+	})
+	return
+}
+
+// GetPuts returns a list of puts after the given index
+// Puts at or before the checkpoint come from the compacted change log so their
+// indexes may have gaps
+func (ht *BoltHT) GetPuts(since int) (puts []Put, err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		puts, err = _boltGetPuts(tx, since)
+		return err
+	})
+	return
+}
+
+func _boltGetPuts(tx *bolt.Tx, since int) (puts []Put, err error) {
+	puts = make([]Put, 0)
+	if since < 0 {
+		since = 0
+	}
+	c := tx.Bucket(boltIdxBucket).Cursor()
+	for k, v := c.Seek(boltIdxBytes(since)); k != nil; k, v = c.Next() {
+		p := Put{Idx: int(binary.BigEndian.Uint64(k))}
+		if len(v) > 0 {
+			err = ByteDecoder(v, &p.M)
+			if err != nil {
+				return
+			}
+		}
+		puts = append(puts, p)
+	}
+	return
+}
+
+// GetCheckpoint returns the index up to which the change log has been compacted
+func (ht *BoltHT) GetCheckpoint() (idx int, err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		var e error
+		idx, e = boltGetIntVal(tx.Bucket(boltMetaBucket), boltCheckpointKey)
+		return e
+	})
+	return
+}
+
+// Compact drops the payloads of entries deleted or modified before the given time and
+// rewrites the change log up to a new checkpoint without the puts no longer needed
+func (ht *BoltHT) Compact(before time.Time) (stats CompactStats, err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(boltMetaBucket)
+		idx, err := boltGetIntVal(meta, boltIdxKey)
+		if err != nil {
+			return err
+		}
+		puts, err := _boltGetPuts(tx, 0)
+		if err != nil {
+			return err
+		}
+		plan := planCompaction(puts, before, time.Now(), func(k string) (status int, held bool) {
+			val := tx.Bucket(boltStatusBucket).Get([]byte(k))
+			if val == nil {
+				return
+			}
+			var e error
+			status, e = strconv.Atoi(string(val))
+			held = e == nil
+			return
+		})
+
+		entries := tx.Bucket(boltEntryBucket)
+		for _, k := range plan.dead {
+			if len(entries.Get([]byte(k))) == 0 {
+				// already compacted
+				continue
+			}
+			err = entries.Put([]byte(k), []byte{})
+			if err != nil {
+				return err
+			}
+			stats.Payloads++
+		}
+
+		idxs := tx.Bucket(boltIdxBucket)
+		for _, i := range plan.drop {
+			key := boltIdxBytes(i)
+			if plan.forget[i] {
+				var m Message
+				err = ByteDecoder(idxs.Get(key), &m)
+				if err != nil {
+					return err
+				}
+				f, err := m.Fingerprint()
+				if err != nil {
+					return err
+				}
+				err = tx.Bucket(boltFingerprintBucket).Delete([]byte(f.String()))
+				if err != nil {
+					return err
+				}
+			}
+			err = idxs.Delete(key)
+			if err != nil {
+				return err
+			}
+			stats.Puts++
+		}
+
+		stats.Checkpoint = idx
+		return meta.Put(boltCheckpointKey, []byte(strconv.Itoa(idx)))
+	})
+	return
+}
+
+// Export returns the entries, links and change log held in the table
+func (ht *BoltHT) Export() (archive DHTArchive, err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(boltTypeBucket).ForEach(func(key, value []byte) error {
+			k := string(key)
+			e := ArchivedEntry{Hash: k, EntryType: string(value)}
+			e.Value = append([]byte{}, tx.Bucket(boltEntryBucket).Get(key)...)
+			var err error
+			e.Status, err = strconv.Atoi(string(tx.Bucket(boltStatusBucket).Get(key)))
+			if err != nil {
+				return err
+			}
+			e.Source = string(tx.Bucket(boltSrcBucket).Get(key))
+			e.ReplacedBy = string(tx.Bucket(boltReplacedByBucket).Get(key))
+			if val := tx.Bucket(boltExpiresBucket).Get(key); val != nil {
+				e.Expires, _ = strconv.ParseInt(string(val), 10, 64)
+			}
+			archive.Entries = append(archive.Entries, e)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(boltLinkBucket).ForEach(func(key, value []byte) error {
+			x := strings.SplitN(string(key), ":", 3)
+			l := ArchivedLink{Base: x[0], Link: x[1], Tag: x[2]}
+			json.Unmarshal(value, &l.Events)
+			archive.Links = append(archive.Links, l)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltIdxBucket).ForEach(func(key, value []byte) error {
+			p := ArchivedPut{Idx: int(binary.BigEndian.Uint64(key)), Message: append([]byte{}, value...)}
+			archive.Puts = append(archive.Puts, p)
+			return nil
+		})
+	})
+	return
+}
+
+// GetGossiper loads returns last known index of the gossiper
+func (ht *BoltHT) GetGossiper(id peer.ID) (idx int, err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		var e error
+		idx, e = boltGetIntVal(tx.Bucket(boltPeerBucket), []byte(peer.IDB58Encode(id)))
+		return e
+	})
+	return
+}
+
+// UpdateGossiper updates a gossiper, assumes all checks have been made
+func (ht *BoltHT) UpdateGossiper(id peer.ID, newIdx int) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPeerBucket)
+		key := []byte(peer.IDB58Encode(id))
+		idx, e := boltGetIntVal(b, key)
+		if e != nil {
+			return e
+		}
+		if newIdx < idx {
+			return nil
+		}
+		return b.Put(key, []byte(fmt.Sprintf("%d", newIdx)))
+	})
+	return
+}
+
+// DeleteGossiper removes a gossiper from the database
+func (ht *BoltHT) DeleteGossiper(id peer.ID) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPeerBucket)
+		key := []byte(peer.IDB58Encode(id))
+		if b.Get(key) == nil {
+			return ErrBoltNotFound
+		}
+		return b.Delete(key)
+	})
+	return
+}
+
+// GetGossipers returns the ids of all the gossipers in the database
+func (ht *BoltHT) GetGossipers() (glist []peer.ID, err error) {
+	glist = make([]peer.ID, 0)
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltPeerBucket).ForEach(func(key, value []byte) error {
+			id, e := peer.IDB58Decode(string(key))
+			if e != nil {
+				return e
+			}
+			glist = append(glist, id)
+			return nil
+		})
+	})
+	return
+}
+
+// GetList returns the peer list of the given type
+func (ht *BoltHT) GetList(listType PeerListType) (result PeerList, err error) {
+	result.Type = listType
+	result.Records = make([]PeerRecord, 0)
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(string(listType) + ":")
+		c := tx.Bucket(boltListBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			pid, e := peer.IDB58Decode(string(k[len(prefix):]))
+			if e != nil {
+				return e
+			}
+			result.Records = append(result.Records, PeerRecord{ID: pid, Warrant: string(v)})
+		}
+		return nil
+	})
+	return
+}
+
+// AddToList adds the peers to a list
+func (ht *BoltHT) AddToList(m *Message, list PeerList) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		_, err := boltIncIdx(tx, m)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket(boltListBucket)
+		for _, r := range list.Records {
+			k := peer.IDB58Encode(r.ID)
+			err = b.Put([]byte(string(list.Type)+":"+k), []byte(r.Warrant))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// AddThrottled records that a peer went over its rate limit
+func (ht *BoltHT) AddThrottled(id peer.ID, at time.Time) (err error) {
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltThrottledBucket)
+		key := []byte(peer.IDB58Encode(id))
+		var count int
+		if v := b.Get(key); v != nil {
+			tp, e := parseThrottled(id, string(v))
+			if e != nil {
+				return e
+			}
+			count = tp.Count
+		}
+		return b.Put(key, []byte(fmt.Sprintf("%d:%d", count+1, at.UnixNano())))
+	})
+	return
+}
+
+// GetThrottled returns the peers that have been throttled
+func (ht *BoltHT) GetThrottled() (throttled []ThrottledPeer, err error) {
+	throttled = make([]ThrottledPeer, 0)
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltThrottledBucket).ForEach(func(key, value []byte) error {
+			id, e := peer.IDB58Decode(string(key))
+			if e != nil {
+				return e
+			}
+			tp, e := parseThrottled(id, string(value))
+			if e != nil {
+				return e
+			}
+			throttled = append(throttled, tp)
+			return nil
+		})
+	})
+	return
+}
+
+// PutAgentHeader records a header signed by an agent under the header it follows and as
+// the agent's latest header if it's newer
+func (ht *BoltHT) PutAgentHeader(agent peer.ID, header *Header) (err error) {
+	var b []byte
+	b, err = ByteEncoder(header)
+	if err != nil {
+		return
+	}
+	a := []byte(peer.IDB58Encode(agent))
+	err = ht.db.Update(func(tx *bolt.Tx) error {
+		headers := tx.Bucket(boltHeaderBucket)
+		key := []byte(string(a) + ":" + header.HeaderLink.String())
+		if headers.Get(key) == nil {
+			if e := headers.Put(key, b); e != nil {
+				return e
+			}
+		}
+		heads := tx.Bucket(boltHeadBucket)
+		if head := heads.Get(a); head != nil {
+			var hd Header
+			e := ByteDecoder(head, &hd)
+			if e != nil || !header.Time.After(hd.Time) {
+				return e
+			}
+		}
+		return heads.Put(a, b)
+	})
+	return
+}
+
+// GetAgentHeader returns the header recorded for an agent as following the given header
+func (ht *BoltHT) GetAgentHeader(agent peer.ID, headerLink Hash) (header Header, err error) {
+	err = ht.getAgentHeader(boltHeaderBucket, peer.IDB58Encode(agent)+":"+headerLink.String(), &header)
+	return
+}
+
+// GetAgentHead returns the latest header recorded for an agent
+func (ht *BoltHT) GetAgentHead(agent peer.ID) (header Header, err error) {
+	err = ht.getAgentHeader(boltHeadBucket, peer.IDB58Encode(agent), &header)
+	return
+}
+
+func (ht *BoltHT) getAgentHeader(bucket []byte, key string, header *Header) (err error) {
+	err = ht.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucket).Get([]byte(key))
+		if v == nil {
+			return ErrHashNotFound
+		}
+		return ByteDecoder(v, header)
+	})
+	return
+}
@@ -0,0 +1,115 @@
+package holochain
+
+import (
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltHTOpen(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+
+	Convey("It should initialize the data store", t, func() {
+		f := filepath.Join(d, DHTStoreFileName)
+		So(FileExists(f), ShouldBeFalse)
+		ht := &BoltHT{}
+		ht.Open(f)
+		defer ht.Close()
+		So(FileExists(f), ShouldBeTrue)
+	})
+
+	Convey("It should return an error if the data store can't be opened", t, func() {
+		ht := &BoltHT{}
+		err := ht.Open(filepath.Join(d, "no-such-dir", DHTStoreFileName))
+		So(err, ShouldNotBeNil)
+		So(ht.db, ShouldBeNil)
+	})
+}
+
+func TestBoltHTPutGetModDel(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	node, err := makeNode(1234, "")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	ht := &BoltHT{}
+	f := filepath.Join(d, DHTStoreFileName)
+	ht.Open(f)
+	defer ht.Close()
+
+	testHTPutGetModDel(t, ht, node)
+
+	Convey("It should persist data across re-opening", t, func() {
+		idx, _ := ht.GetIdx()
+		ht.Close()
+		ht.Open(f)
+		reopenedIdx, err := ht.GetIdx()
+		So(err, ShouldBeNil)
+		So(reopenedIdx, ShouldEqual, idx)
+		count := 0
+		ht.Iterate(func(hsh Hash) bool {
+			count++
+			return true
+		})
+		So(count, ShouldEqual, 1)
+	})
+}
+
+func TestBoltHTLinking(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	node, err := makeNode(1234, "")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	ht := &BoltHT{}
+	f := filepath.Join(d, DHTStoreFileName)
+	ht.Open(f)
+	defer ht.Close()
+
+	testHTLinking(t, ht, node)
+	testHTLinkPaging(t, ht, node)
+	testHTForget(t, ht, node)
+	testHTExpiry(t, ht, node)
+}
+
+func TestBoltHTGossipStore(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	node, err := makeNode(1234, "")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	ht := &BoltHT{}
+	f := filepath.Join(d, DHTStoreFileName)
+	ht.Open(f)
+	defer ht.Close()
+
+	testHTGossipStore(t, ht, node)
+}
+
+func TestBoltHTCompact(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	node, err := makeNode(1234, "")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	ht := &BoltHT{}
+	f := filepath.Join(d, DHTStoreFileName)
+	ht.Open(f)
+	defer ht.Close()
+
+	testHTCompact(t, ht, node)
+}
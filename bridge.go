@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // BridgeApp describes a data necessary for bridging
@@ -42,6 +43,38 @@ type BridgeSpec map[string]map[string]bool
 
 var BridgeAppNotFoundErr = errors.New("bridge app not found")
 
+// localChains holds the chains being hosted in this process by DNA hash so that bridge
+// calls between them can be made directly instead of through the webserver
+var localChains = struct {
+	sync.RWMutex
+	chains map[Hash]*Holochain
+}{chains: make(map[Hash]*Holochain)}
+
+// HostLocally registers the chain as running in this process so that other chains
+// hosted alongside it can bridge to it directly
+func (h *Holochain) HostLocally() {
+	localChains.Lock()
+	localChains.chains[h.DNAHash()] = h
+	localChains.Unlock()
+}
+
+// StopHostingLocally removes the chain from the chains running in this process
+func (h *Holochain) StopHostingLocally() {
+	localChains.Lock()
+	if localChains.chains[h.DNAHash()] == h {
+		delete(localChains.chains, h.DNAHash())
+	}
+	localChains.Unlock()
+}
+
+// getLocalChain returns the chain with the given DNA if it is running in this process
+func getLocalChain(dna Hash) (h *Holochain) {
+	localChains.RLock()
+	h = localChains.chains[dna]
+	localChains.RUnlock()
+	return
+}
+
 // AddBridgeAsCallee registers a token for allowing bridged calls from some other app
 // and calls bridgeGenesis in any zomes with bridge functions
 func (h *Holochain) AddBridgeAsCallee(fromDNA Hash, appData string) (token string, err error) {
@@ -301,6 +334,22 @@ func (h *Holochain) BuildBridgeToCallee(app *BridgeApp) (err error) {
 	return
 }
 
+// BuildLocalBridge connects h as the caller to a callee chain running in the same process.
+// The url is only used if the callee is later run somewhere else.
+func (h *Holochain) BuildLocalBridge(callee *Holochain, bridgeZome string, url string, callerData string, calleeData string) (err error) {
+	var token string
+	token, err = callee.AddBridgeAsCallee(h.DNAHash(), calleeData)
+	if err != nil {
+		h.Debugf("adding local bridge to callee %s from %s failed with %v\n", callee.Name(), h.Name(), err)
+		return
+	}
+	err = h.AddBridgeAsCaller(bridgeZome, callee.DNAHash(), callee.Name(), token, url, callerData)
+	if err != nil {
+		h.Debugf("adding local bridge to callee %s from %s failed with %v\n", callee.Name(), h.Name(), err)
+	}
+	return
+}
+
 // GetBridges returns a list of the active bridges on the holochain
 func (h *Holochain) GetBridges() (bridges []Bridge, err error) {
 	if h.bridgeDB == nil {
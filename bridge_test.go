@@ -5,6 +5,7 @@ import (
 	"fmt"
 	. "github.com/HC-Interns/holochain-proto/hash"
 	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
 	"testing"
 )
 
@@ -63,6 +64,52 @@ func TestBridgeCall(t *testing.T) {
 
 }
 
+func TestBridgeLocal(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	h2, err := s.MakeTestingApp(filepath.Join(s.Path, "test2"), "toml", InitializeDB, CloneWithNewUUID, nil)
+	if err != nil {
+		panic(err)
+	}
+	h2.Config.DHTPort, err = getFreePort()
+	if err != nil {
+		panic(err)
+	}
+	prepareTestChain(h2)
+	defer h2.Close()
+
+	url := "http://localhost:31415/test2"
+	Convey("it should bridge to a chain in the same process", t, func() {
+		err := h.BuildLocalBridge(h2, "jsSampleZome", url, "caller data", "callee data")
+		So(err, ShouldBeNil)
+		_, u, err := h.GetBridgeToken(h2.DNAHash())
+		So(err, ShouldBeNil)
+		So(u, ShouldEqual, url)
+	})
+
+	Convey("it should only find chains that are hosted locally", t, func() {
+		So(getLocalChain(h2.DNAHash()), ShouldBeNil)
+		h2.HostLocally()
+		So(getLocalChain(h2.DNAHash()), ShouldEqual, h2)
+		h2.StopHostingLocally()
+		So(getLocalChain(h2.DNAHash()), ShouldBeNil)
+	})
+
+	Convey("it should call bridged functions on a locally hosted chain directly", t, func() {
+		h2.HostLocally()
+		defer h2.StopHostingLocally()
+		z, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType})
+		So(err, ShouldBeNil)
+		_, err = z.Run(fmt.Sprintf(`bridge("%s","zySampleZome","testStrFn1","foo")`, h2.DNAHash().String()))
+		So(err, ShouldBeNil)
+		So(z.(*JSRibosome).lastResult.String(), ShouldEqual, "result: foo")
+
+		_, err = z.Run(fmt.Sprintf(`bridge("%s","zySampleZome","testStrFn2","foo")`, h2.DNAHash().String()))
+		So(err, ShouldNotBeNil)
+	})
+}
+
 func TestBridgeSpec(t *testing.T) {
 	spec := BridgeSpec{
 		"bridgedZome": {"bridgedFunc": true},
@@ -10,8 +10,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
@@ -29,6 +31,12 @@ type linkEvent struct {
 	Status     int
 	Source     string
 	LinksEntry string
+	Time       int64 `json:",omitempty"` // nanoseconds since epoch of the linking message
+	Expires    int64 `json:",omitempty"` // nanoseconds since epoch after which the event no longer holds
+}
+
+func (e linkEvent) expired(now time.Time) bool {
+	return e.Expires != 0 && now.UnixNano() >= e.Expires
 }
 
 func (ht *BuntHT) Open(opts interface{}) (err error) {
@@ -41,6 +49,7 @@ func (ht *BuntHT) Open(opts interface{}) (err error) {
 	db.CreateIndex("idx", "idx:*", buntdb.IndexInt)
 	db.CreateIndex("peer", "peer:*", buntdb.IndexString)
 	db.CreateIndex("list", "list:*", buntdb.IndexString)
+	db.CreateIndex("throttled", "throttled:*", buntdb.IndexString)
 	db.CreateIndex("entry", "entry:*", buntdb.IndexString)
 
 	ht.db = db
@@ -90,11 +99,37 @@ func (ht *BuntHT) Put(m *Message, entryType string, key Hash, src peer.ID, value
 		if err != nil {
 			return err
 		}
+		err = _setExpiry(tx, k, m)
 		return err
 	})
 	return
 }
 
+// _setExpiry records when the data at a key expires according to the message that put it.
+// Data that's put again without a TTL no longer expires.
+func _setExpiry(tx *buntdb.Tx, k string, m *Message) (err error) {
+	t := changeExpiry(m)
+	if t.IsZero() {
+		_, err = tx.Delete("expires:" + k)
+		if err == buntdb.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	_, _, err = tx.Set("expires:"+k, strconv.FormatInt(t.UnixNano(), 10), nil)
+	return
+}
+
+// _expired returns true if the data at a key has expired by the given time
+func _expired(tx *buntdb.Tx, k string, now time.Time) bool {
+	val, err := tx.Get("expires:" + k)
+	if err != nil {
+		return false
+	}
+	t, err := strconv.ParseInt(val, 10, 64)
+	return err == nil && now.UnixNano() >= t
+}
+
 func buildEntryKey(k string, entryType string) string {
 	return "entry:" + entryType + ":" + k
 }
@@ -145,7 +180,7 @@ func (ht *BuntHT) Mod(m *Message, key Hash, newkey Hash) (err error) {
 		err = _setStatus(tx, m, k, StatusModified)
 		if err == nil {
 			link := newkey.String()
-			err = _link(tx, k, link, SysTagReplacedBy, m.From, StatusLive, newkey)
+			err = _link(tx, k, link, SysTagReplacedBy, m.From, StatusLive, newkey, m.Time, changeExpiry(m))
 			if err == nil {
 				_, _, err = tx.Set("replacedBy:"+k, link, nil)
 				if err != nil {
@@ -158,10 +193,18 @@ func (ht *BuntHT) Mod(m *Message, key Hash, newkey Hash) (err error) {
 	return
 }
 
+// Fork moves the given hash to the StatusForked status
+func (ht *BuntHT) Fork(key Hash) (err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		return _setStatus(tx, nil, key.String(), StatusForked)
+	})
+	return
+}
+
 func _get(tx *buntdb.Tx, k string, statusMask int) (string, error) {
 	entryType, err := tx.Get("type:" + k)
 	val, err := tx.Get(buildEntryKey(k, entryType))
-	if err == buntdb.ErrNotFound {
+	if err == buntdb.ErrNotFound || (err == nil && _expired(tx, k, time.Now())) {
 		err = ErrHashNotFound
 		return val, err
 	}
@@ -183,6 +226,8 @@ func _get(tx *buntdb.Tx, k string, statusMask int) (string, error) {
 				err = ErrHashModified
 			case StatusRejectedVal:
 				err = ErrHashRejected
+			case StatusForkedVal:
+				err = ErrHashForked
 			case StatusLiveVal:
 			default:
 				panic("unknown status!")
@@ -201,6 +246,98 @@ func _get(tx *buntdb.Tx, k string, statusMask int) (string, error) {
 	return val, err
 }
 
+// Forget removes all the data held for a hash, including links on it, without
+// recording a change
+func (ht *BuntHT) Forget(key Hash) (err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		return _forget(tx, key.String())
+	})
+	return
+}
+
+func _forget(tx *buntdb.Tx, k string) (err error) {
+	entryType, err := tx.Get("type:" + k)
+	if err == buntdb.ErrNotFound {
+		return ErrHashNotFound
+	}
+	if err != nil {
+		return err
+	}
+	keys := []string{buildEntryKey(k, entryType), "type:" + k, "src:" + k, "status:" + k, "replacedBy:" + k, "expires:" + k}
+	// collect the link keys first as keys can't be deleted while iterating
+	err = tx.AscendKeys("link:"+k+":*", func(key, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, dk := range keys {
+		_, err = tx.Delete(dk)
+		if err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sweep removes the entries and links that have expired by the given time
+func (ht *BuntHT) Sweep(now time.Time) (swept int, err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		// collect the keys first as keys can't be deleted while iterating
+		var entries, links []string
+		err := tx.AscendKeys("expires:*", func(key, value string) bool {
+			t, e := strconv.ParseInt(value, 10, 64)
+			if e == nil && now.UnixNano() >= t {
+				entries = append(entries, strings.TrimPrefix(key, "expires:"))
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Ascend("link", func(key, value string) bool {
+			var records []linkEvent
+			json.Unmarshal([]byte(value), &records)
+			if l := len(records); l > 0 && records[l-1].expired(now) {
+				links = append(links, key)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range entries {
+			err = _forget(tx, k)
+			if err == ErrHashNotFound {
+				// only the expiry record was left
+				_, err = tx.Delete("expires:" + k)
+				if err != nil && err != buntdb.ErrNotFound {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			swept++
+		}
+		for _, k := range links {
+			_, err = tx.Delete(k)
+			if err == buntdb.ErrNotFound {
+				// the link was on an entry we just swept
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			swept++
+		}
+		return nil
+	})
+	return
+}
+
 // Exists checks for the existence of the hash in the store
 func (ht *BuntHT) Exists(key Hash, statusMask int) (err error) {
 	err = ht.db.View(func(tx *buntdb.Tx) error {
@@ -274,7 +411,7 @@ func (ht *BuntHT) Get(key Hash, statusMask int, getMask int) (data []byte, entry
 
 // _link is a low level routine to add a link, also used by delLink
 // this ensure monotonic recording of linking attempts
-func _link(tx *buntdb.Tx, base string, link string, tag string, src peer.ID, status int, linkingEntryHash Hash) (err error) {
+func _link(tx *buntdb.Tx, base string, link string, tag string, src peer.ID, status int, linkingEntryHash Hash, t time.Time, expires time.Time) (err error) {
 	key := "link:" + base + ":" + link + ":" + tag
 	var val string
 	val, err = tx.Get(key)
@@ -311,7 +448,11 @@ func _link(tx *buntdb.Tx, base string, link string, tag string, src peer.ID, sta
 	} else {
 		return
 	}
-	records = append(records, linkEvent{status, source, lehStr})
+	event := linkEvent{Status: status, Source: source, LinksEntry: lehStr, Time: t.UnixNano()}
+	if !expires.IsZero() {
+		event.Expires = expires.UnixNano()
+	}
+	records = append(records, event)
 	var b []byte
 	b, err = json.Marshal(records)
 	if err != nil {
@@ -330,7 +471,7 @@ func (ht *BuntHT) link(m *Message, base string, link string, tag string, status
 		if err != nil {
 			return err
 		}
-		err = _link(tx, base, link, tag, m.From, status, m.Body.(HoldReq).EntryHash)
+		err = _link(tx, base, link, tag, m.From, status, m.Body.(HoldReq).EntryHash, m.Time, changeExpiry(m))
 		if err != nil {
 			return err
 		}
@@ -363,7 +504,32 @@ func (ht *BuntHT) DelLink(m *Message, base string, link string, tag string) (err
 
 // GetLinks retrieves meta value associated with a base
 func (ht *BuntHT) GetLinks(base Hash, tag string, statusMask int) (results []TaggedHash, err error) {
+	var links []linkRecord
+	links, err = ht.getLinks(base, tag, statusMask)
+	if err != nil {
+		return
+	}
+	results = make([]TaggedHash, len(links))
+	for i := range links {
+		results[i] = links[i].th
+	}
+	return
+}
+
+// GetLinksPage retrieves one page of the links on a base and the cursor of the next page
+func (ht *BuntHT) GetLinksPage(base Hash, tag string, statusMask int, page LinkPage) (results []TaggedHash, next string, err error) {
+	var links []linkRecord
+	links, err = ht.getLinks(base, tag, statusMask)
+	if err != nil {
+		return
+	}
+	results, next, err = pageLinks(links, page)
+	return
+}
+
+func (ht *BuntHT) getLinks(base Hash, tag string, statusMask int) (links []linkRecord, err error) {
 	b := base.String()
+	now := time.Now()
 	err = ht.db.View(func(tx *buntdb.Tx) error {
 		_, err := _get(tx, b, StatusLive+StatusModified) //only get links on live and modified bases
 		if err != nil {
@@ -374,7 +540,6 @@ func (ht *BuntHT) GetLinks(base Hash, tag string, statusMask int) (results []Tag
 			statusMask = StatusLive
 		}
 
-		results = make([]TaggedHash, 0)
 		err = tx.Ascend("link", func(key, value string) bool {
 			x := strings.Split(key, ":")
 			t := string(x[3])
@@ -386,12 +551,12 @@ func (ht *BuntHT) GetLinks(base Hash, tag string, statusMask int) (results []Tag
 				// looking at the last item we ever got
 				if l > 0 {
 					entry := records[l-1]
-					if err == nil && (entry.Status&statusMask) > 0 {
+					if err == nil && (entry.Status&statusMask) > 0 && !entry.expired(now) {
 						th := TaggedHash{H: string(x[2]), Source: entry.Source}
 						if tag == "" {
 							th.T = t
 						}
-						results = append(results, th)
+						links = append(links, linkRecord{th: th, link: string(x[2]), tag: t, time: records[0].Time})
 					}
 				}
 			}
@@ -506,27 +671,9 @@ func (ht *BuntHT) GetIdxMessage(idx int) (msg Message, err error) {
 	return
 }
 
-// DumpIdx converts message and data of a DHT change request to a string for human consumption
+// dumpIdx converts message and data of a DHT change request to a string for human consumption
 func (ht *BuntHT) dumpIdx(idx int) (str string, err error) {
-	var msg Message
-	msg, err = ht.GetIdxMessage(idx)
-	if err != nil {
-		return
-	}
-	f, _ := msg.Fingerprint()
-	str = fmt.Sprintf("MSG (fingerprint %v):\n   %v\n", f, msg)
-	switch msg.Type {
-	case PUT_REQUEST:
-		key := msg.Body.(HoldReq).EntryHash
-		entry, entryType, _, _, e := ht.Get(key, StatusDefault, GetMaskAll)
-		if e != nil {
-			err = fmt.Errorf("couldn't get %v err:%v ", key, e)
-			return
-		} else {
-			str += fmt.Sprintf("DATA: type:%s entry: %v\n", entryType, entry)
-		}
-	}
-	return
+	return dumpIdx(ht, idx)
 }
 
 func statusValueToString(val string) string {
@@ -589,40 +736,9 @@ func (ht *BuntHT) String() (result string) {
 	return
 }
 
-// DumpIdxJSON converts message and data of a DHT change request to a JSON string representation.
+// dumpIdxJSON converts message and data of a DHT change request to a JSON string representation.
 func (ht *BuntHT) dumpIdxJSON(idx int) (str string, err error) {
-	var msg Message
-	var buffer bytes.Buffer
-	var msgField, dataField string
-	msg, err = ht.GetIdxMessage(idx)
-
-	if err != nil {
-		return "", err
-	}
-
-	f, _ := msg.Fingerprint()
-	buffer.WriteString(fmt.Sprintf("{ \"index\": %d,", idx))
-	msgField = fmt.Sprintf("\"message\": { \"fingerprint\": \"%v\", \"content\": \"%v\" },", f, msg)
-
-	switch msg.Type {
-	case PUT_REQUEST:
-		key := msg.Body.(HoldReq).EntryHash
-		entry, entryType, _, _, e := ht.Get(key, StatusAny, GetMaskAll)
-		if e != nil {
-			err = fmt.Errorf("couldn't get %v err:%v ", key, e)
-			return
-		}
-		dataField = fmt.Sprintf("\"data\": { \"type\": \"%s\", \"entry\": \"%v\" }", entryType, entry)
-	}
-
-	if len(dataField) > 0 {
-		buffer.WriteString(msgField)
-		buffer.WriteString(dataField)
-	} else {
-		buffer.WriteString(strings.TrimSuffix(msgField, ","))
-	}
-	buffer.WriteString("}")
-	return PrettyPrintJSON(buffer.Bytes())
+	return dumpIdxJSON(ht, idx)
 }
 
 // JSON converts the table into a JSON string representation.
@@ -633,16 +749,19 @@ func (ht *BuntHT) JSON() (result string, err error) {
 		return "", err
 	}
 	buffer.WriteString("{ \"dht_changes\": [")
+	var changes []string
 	for i := 1; i <= idx; i++ {
 		json, err := ht.dumpIdxJSON(i)
+		if err == ErrNoSuchIdx {
+			// dropped by compaction
+			continue
+		}
 		if err != nil {
 			return "", fmt.Errorf("DHT Change %d,  Error: %v", i, err)
 		}
-		buffer.WriteString(json)
-		if i < idx {
-			buffer.WriteString(",")
-		}
+		changes = append(changes, json)
 	}
+	buffer.WriteString(strings.Join(changes, ","))
 	buffer.WriteString("], \"dht_entries\": [")
 	err = ht.db.View(func(tx *buntdb.Tx) error {
 		err = tx.Ascend("entry", func(key, value string) bool {
@@ -705,3 +824,427 @@ func (ht *BuntHT) Iterate(fn HashTableIterateFn) {
 		return err
 	})
 }
+
+// GetFingerprint returns the index that of the message that made a change or -1 if we don't have it
+func (ht *BuntHT) GetFingerprint(f Hash) (index int, err error) {
+	index = -1
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		idxStr, e := tx.Get("f:" + f.String())
+		if e == buntdb.ErrNotFound {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		index, e = strconv.Atoi(idxStr)
+		if e != nil {
+			return e
+		}
+		return nil
+	})
+	return
+}
+
+// GetPuts returns a list of puts after the given index
+// Puts at or before the checkpoint come from the compacted change log so their
+// indexes may have gaps
+func (ht *BuntHT) GetPuts(since int) (puts []Put, err error) {
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		puts, err = _getPuts(tx, since)
+		return err
+	})
+	return
+}
+
+func _getPuts(tx *buntdb.Tx, since int) (puts []Put, err error) {
+	puts = make([]Put, 0)
+	err = tx.AscendGreaterOrEqual("idx", string(since), func(key, value string) bool {
+		x := strings.Split(key, ":")
+		idx, _ := strconv.Atoi(x[1])
+		if idx >= since {
+			p := Put{Idx: idx}
+			if value != "" {
+				err := ByteDecoder([]byte(value), &p.M)
+				if err != nil {
+					return false
+				}
+			}
+			puts = append(puts, p)
+		}
+		return true
+	})
+	sort.Slice(puts, func(i, j int) bool { return puts[i].Idx < puts[j].Idx })
+	return
+}
+
+// GetCheckpoint returns the index up to which the change log has been compacted
+func (ht *BuntHT) GetCheckpoint() (idx int, err error) {
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		var e error
+		idx, e = getIntVal("_checkpoint", tx)
+		return e
+	})
+	return
+}
+
+// Compact drops the payloads of entries deleted or modified before the given time and
+// rewrites the change log up to a new checkpoint without the puts no longer needed
+func (ht *BuntHT) Compact(before time.Time) (stats CompactStats, err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		idx, err := getIntVal("_idx", tx)
+		if err != nil {
+			return err
+		}
+		puts, err := _getPuts(tx, 0)
+		if err != nil {
+			return err
+		}
+		plan := planCompaction(puts, before, time.Now(), func(k string) (status int, held bool) {
+			val, e := tx.Get("status:" + k)
+			if e != nil {
+				return
+			}
+			status, e = strconv.Atoi(val)
+			held = e == nil
+			return
+		})
+
+		for _, k := range plan.dead {
+			entryType, err := tx.Get("type:" + k)
+			if err != nil {
+				return err
+			}
+			if val, _ := tx.Get(buildEntryKey(k, entryType)); val == "" {
+				// already compacted
+				continue
+			}
+			_, _, err = tx.Set(buildEntryKey(k, entryType), "", nil)
+			if err != nil {
+				return err
+			}
+			stats.Payloads++
+		}
+
+		for _, i := range plan.drop {
+			key := fmt.Sprintf("idx:%d", i)
+			if plan.forget[i] {
+				var m Message
+				val, err := tx.Get(key)
+				if err != nil {
+					return err
+				}
+				err = ByteDecoder([]byte(val), &m)
+				if err != nil {
+					return err
+				}
+				f, err := m.Fingerprint()
+				if err != nil {
+					return err
+				}
+				_, err = tx.Delete("f:" + f.String())
+				if err != nil && err != buntdb.ErrNotFound {
+					return err
+				}
+			}
+			_, err = tx.Delete(key)
+			if err != nil {
+				return err
+			}
+			stats.Puts++
+		}
+
+		stats.Checkpoint = idx
+		_, _, err = tx.Set("_checkpoint", fmt.Sprintf("%d", idx), nil)
+		return err
+	})
+	return
+}
+
+// Export returns the entries, links and change log held in the table
+func (ht *BuntHT) Export() (archive DHTArchive, err error) {
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		var types []string
+		err := tx.AscendKeys("type:*", func(key, value string) bool {
+			types = append(types, key)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range types {
+			k := strings.TrimPrefix(key, "type:")
+			e := ArchivedEntry{Hash: k}
+			e.EntryType, _ = tx.Get(key)
+			val, err := tx.Get(buildEntryKey(k, e.EntryType))
+			if err != nil {
+				return err
+			}
+			e.Value = []byte(val)
+			statusVal, err := tx.Get("status:" + k)
+			if err != nil {
+				return err
+			}
+			e.Status, err = strconv.Atoi(statusVal)
+			if err != nil {
+				return err
+			}
+			e.Source, _ = tx.Get("src:" + k)
+			e.ReplacedBy, _ = tx.Get("replacedBy:" + k)
+			if val, err := tx.Get("expires:" + k); err == nil {
+				e.Expires, _ = strconv.ParseInt(val, 10, 64)
+			}
+			archive.Entries = append(archive.Entries, e)
+		}
+
+		err = tx.Ascend("link", func(key, value string) bool {
+			x := strings.SplitN(key, ":", 4)
+			l := ArchivedLink{Base: x[1], Link: x[2], Tag: x[3]}
+			json.Unmarshal([]byte(value), &l.Events)
+			archive.Links = append(archive.Links, l)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		err = tx.AscendKeys("idx:*", func(key, value string) bool {
+			idx, _ := strconv.Atoi(strings.TrimPrefix(key, "idx:"))
+			archive.Puts = append(archive.Puts, ArchivedPut{Idx: idx, Message: []byte(value)})
+			return true
+		})
+		sort.Slice(archive.Puts, func(i, j int) bool { return archive.Puts[i].Idx < archive.Puts[j].Idx })
+		return err
+	})
+	return
+}
+
+// GetGossiper loads returns last known index of the gossiper
+func (ht *BuntHT) GetGossiper(id peer.ID) (idx int, err error) {
+	key := "peer:" + peer.IDB58Encode(id)
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		var e error
+		idx, e = getIntVal(key, tx)
+		if e != nil {
+			return e
+		}
+		return nil
+	})
+	return
+}
+
+// UpdateGossiper updates a gossiper, assumes all checks have been made
+func (ht *BuntHT) UpdateGossiper(id peer.ID, newIdx int) (err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		key := "peer:" + peer.IDB58Encode(id)
+		idx, e := getIntVal(key, tx)
+		if e != nil {
+			return e
+		}
+		if newIdx < idx {
+			return nil
+		}
+		sidx := fmt.Sprintf("%d", newIdx)
+		_, _, err = tx.Set(key, sidx, nil)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	return
+}
+
+// DeleteGossiper removes a gossiper from the database
+func (ht *BuntHT) DeleteGossiper(id peer.ID) (err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		key := "peer:" + peer.IDB58Encode(id)
+		_, e := tx.Delete(key)
+		return e
+	})
+	return
+}
+
+// GetGossipers returns the ids of all the gossipers in the database
+func (ht *BuntHT) GetGossipers() (glist []peer.ID, err error) {
+	glist = make([]peer.ID, 0)
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		err = tx.Ascend("peer", func(key, value string) bool {
+			x := strings.Split(key, ":")
+			id, e := peer.IDB58Decode(x[1])
+			if e != nil {
+				return false
+			}
+			glist = append(glist, id)
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+// GetList returns the peer list of the given type
+func (ht *BuntHT) GetList(listType PeerListType) (result PeerList, err error) {
+	result.Type = listType
+	result.Records = make([]PeerRecord, 0)
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		err = tx.Ascend("list", func(key, value string) bool {
+			x := strings.Split(key, ":")
+
+			if x[1] == string(listType) {
+				pid, e := peer.IDB58Decode(x[2])
+				if e != nil {
+					return false
+				}
+				r := PeerRecord{ID: pid, Warrant: value}
+				result.Records = append(result.Records, r)
+			}
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+// AddToList adds the peers to a list
+func (ht *BuntHT) AddToList(m *Message, list PeerList) (err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		_, err = incIdx(tx, m)
+		if err != nil {
+			return err
+		}
+		for _, r := range list.Records {
+			k := peer.IDB58Encode(r.ID)
+			_, _, err = tx.Set("list:"+string(list.Type)+":"+k, r.Warrant, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return err
+	})
+	return
+}
+
+// AddThrottled records that a peer went over its rate limit
+func (ht *BuntHT) AddThrottled(id peer.ID, at time.Time) (err error) {
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		key := "throttled:" + peer.IDB58Encode(id)
+		var count int
+		value, e := tx.Get(key)
+		if e == nil {
+			var tp ThrottledPeer
+			tp, e = parseThrottled(id, value)
+			if e != nil {
+				return e
+			}
+			count = tp.Count
+		} else if e != buntdb.ErrNotFound {
+			return e
+		}
+		_, _, e = tx.Set(key, fmt.Sprintf("%d:%d", count+1, at.UnixNano()), nil)
+		return e
+	})
+	return
+}
+
+// GetThrottled returns the peers that have been throttled
+func (ht *BuntHT) GetThrottled() (throttled []ThrottledPeer, err error) {
+	throttled = make([]ThrottledPeer, 0)
+	err = ht.db.View(func(tx *buntdb.Tx) (e error) {
+		tx.Ascend("throttled", func(key, value string) bool {
+			var id peer.ID
+			id, e = peer.IDB58Decode(strings.TrimPrefix(key, "throttled:"))
+			if e != nil {
+				return false
+			}
+			var tp ThrottledPeer
+			tp, e = parseThrottled(id, value)
+			if e != nil {
+				return false
+			}
+			throttled = append(throttled, tp)
+			return true
+		})
+		return
+	})
+	return
+}
+
+// PutAgentHeader records a header signed by an agent under the header it follows and as
+// the agent's latest header if it's newer
+func (ht *BuntHT) PutAgentHeader(agent peer.ID, header *Header) (err error) {
+	var b []byte
+	b, err = ByteEncoder(header)
+	if err != nil {
+		return
+	}
+	a := peer.IDB58Encode(agent)
+	err = ht.db.Update(func(tx *buntdb.Tx) error {
+		key := "header:" + a + ":" + header.HeaderLink.String()
+		_, e := tx.Get(key)
+		if e == buntdb.ErrNotFound {
+			_, _, e = tx.Set(key, string(b), nil)
+		}
+		if e != nil {
+			return e
+		}
+		head, e := tx.Get("head:" + a)
+		if e == nil {
+			var hd Header
+			e = ByteDecoder([]byte(head), &hd)
+			if e != nil || !header.Time.After(hd.Time) {
+				return e
+			}
+		} else if e != buntdb.ErrNotFound {
+			return e
+		}
+		_, _, e = tx.Set("head:"+a, string(b), nil)
+		return e
+	})
+	return
+}
+
+// GetAgentHeader returns the header recorded for an agent as following the given header
+func (ht *BuntHT) GetAgentHeader(agent peer.ID, headerLink Hash) (header Header, err error) {
+	err = ht.getAgentHeader("header:"+peer.IDB58Encode(agent)+":"+headerLink.String(), &header)
+	return
+}
+
+// GetAgentHead returns the latest header recorded for an agent
+func (ht *BuntHT) GetAgentHead(agent peer.ID) (header Header, err error) {
+	err = ht.getAgentHeader("head:"+peer.IDB58Encode(agent), &header)
+	return
+}
+
+func (ht *BuntHT) getAgentHeader(key string, header *Header) (err error) {
+	err = ht.db.View(func(tx *buntdb.Tx) error {
+		val, e := tx.Get(key)
+		if e == buntdb.ErrNotFound {
+			return ErrHashNotFound
+		}
+		if e != nil {
+			return e
+		}
+		return ByteDecoder([]byte(val), header)
+	})
+	return
+}
+
+// parseThrottled decodes a throttled peer record stored as "count:unixnano"
+func parseThrottled(id peer.ID, value string) (tp ThrottledPeer, e error) {
+	tp.ID = id
+	x := strings.Split(value, ":")
+	if len(x) != 2 {
+		e = fmt.Errorf("bad throttled peer record: %s", value)
+		return
+	}
+	tp.Count, e = strconv.Atoi(x[0])
+	if e != nil {
+		return
+	}
+	var t int64
+	t, e = strconv.ParseInt(x[1], 10, 64)
+	if e != nil {
+		return
+	}
+	tp.Last = time.Unix(0, t)
+	return
+}
@@ -2,7 +2,8 @@
 // Use of this source code is governed by GPLv3 found in the LICENSE file
 //----------------------------------------------------------------------------------------
 
-// implements in-memory chain representation with marshaling, & validation
+// implements chain representation with marshaling, & validation, in memory or
+// stored in an indexed chain file (see chain_store.go)
 
 package holochain
 
@@ -13,7 +14,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -48,18 +48,20 @@ type Bundle struct {
 	sharing   []CommittingAction
 }
 
-// Chain structure for providing in-memory access to chain data, entries headers and hashes
+// Chain structure for providing access to chain data, entries headers and hashes.
+// Chains loaded from a file keep only the hashes and maps in memory, leaving Headers and
+// Entries empty, and read headers and entries from the file as they are needed.
 type Chain struct {
 	Hashes   []Hash
-	Headers  []*Header
-	Entries  []Entry
+	Headers  []*Header      // only used by in-memory chains
+	Entries  []Entry        // only used by in-memory chains
 	TypeTops map[string]int // pointer to index of top of a given type
 	Hmap     map[Hash]int   // map header hashes to index number
 	Emap     map[Hash]int   // map entry hashes to index number
 
 	//---
 
-	s        *os.File // if this stream is not nil, new entries will get marshaled to it
+	store    *chainStore // if not nil, the chain is read from and new entries are appended to it
 	hashSpec HashSpec
 	lk       sync.RWMutex
 	bundle   *Bundle // non-nil when this chain has a bundle in progress
@@ -81,8 +83,9 @@ func NewChain(hashSpec HashSpec) (chain *Chain) {
 	return
 }
 
-// NewChainFromFile creates a chain from a file, loading any data there,
-// and setting it to be persisted to. If no file exists it will be created.
+// NewChainFromFile creates a chain from a file, loading its index, and setting it to be
+// persisted to. If no file exists it will be created. Chain files from before chains were
+// indexed get indexed the first time they are loaded.
 func NewChainFromFile(spec HashSpec, path string) (c *Chain, err error) {
 	defer func() {
 		if err != nil {
@@ -91,63 +94,45 @@ func NewChainFromFile(spec HashSpec, path string) (c *Chain, err error) {
 	}()
 	c = NewChain(spec)
 
-	var f *os.File
-	if FileExists(path) {
-		f, err = os.Open(path)
-		if err != nil {
-			return
-		}
-		var i int
-		for {
-			var header *Header
-			var e Entry
-			header, e, err = readPair(ChainMarshalFlagsNone, f)
-			if err != nil && err.Error() == "EOF" {
-				err = nil
-				break
-			}
-			if err != nil {
-				Debugf("error reading pair:%s", err.Error())
-				return
-			}
-			c.addPair(header, e, i)
-			i++
-		}
-		f.Close()
-		i--
-		// if we read anything then we have to calculate the final hash and add it
-		if i >= 0 {
-			hd := c.Headers[i]
-			var hash Hash
-
-			// hash the header
-			hash, _, err = hd.Sum(spec)
-			if err != nil {
-				return
-			}
-
-			c.Hashes = append(c.Hashes, hash)
-			c.Hmap[hash] = i
+	var index []chainIndexRec
+	c.store, index, err = openChainStore(spec, path)
+	if err != nil {
+		return
+	}
+	for i, rec := range index {
+		c.Hashes = append(c.Hashes, rec.hash)
+		c.Hmap[rec.hash] = i
+		c.Emap[rec.entryLink] = i
+		c.TypeTops[rec.entryType] = i
+	}
+	return
+}
 
-			// finally validate that it all hashes out correctly
-			/*			err = c.Validate(h)
-						if err != nil {
-							return
-						}
-			*/
-		}
+// header returns the ith header, reading it from the chain's file if it has one
+func (c *Chain) header(i int) (header *Header, err error) {
+	if c.store != nil {
+		header, err = c.store.header(i)
+		return
+	}
+	if i < 0 || i >= len(c.Headers) {
+		err = ErrChainIndexOutOfRange
+		return
+	}
+	header = c.Headers[i]
+	return
+}
 
-		f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
-		if err != nil {
-			return
-		}
-	} else {
-		f, err = os.Create(path)
-		if err != nil {
-			return
-		}
+// entry returns the ith entry, reading it from the chain's file if it has one
+func (c *Chain) entry(i int) (entry Entry, err error) {
+	if c.store != nil {
+		entry, err = c.store.entry(i)
+		return
+	}
+	if i < 0 || i >= len(c.Entries) {
+		err = ErrChainIndexOutOfRange
+		return
 	}
-	c.s = f
+	entry = c.Entries[i]
 	return
 }
 
@@ -160,9 +145,13 @@ func (c *Chain) Top() (header *Header) {
 func (c *Chain) Nth(n int) (header *Header) {
 	c.lk.RLock()
 	defer c.lk.RUnlock()
-	l := len(c.Headers)
+	l := c.Length()
 	if l-n > 0 {
-		header = c.Headers[l-n-1]
+		var err error
+		header, err = c.header(l - n - 1)
+		if err != nil {
+			Debugf("error reading header %d: %v", l-n-1, err)
+		}
 	}
 	return
 }
@@ -173,7 +162,12 @@ func (c *Chain) TopType(entryType string) (hash *Hash, header *Header) {
 	defer c.lk.RUnlock()
 	i, ok := c.TypeTops[entryType]
 	if ok {
-		header = c.Headers[i]
+		var err error
+		header, err = c.header(i)
+		if err != nil {
+			Debugf("error reading header %d: %v", i, err)
+			return
+		}
 		var hs = c.Hashes[i].Clone()
 		hash = &hs
 	}
@@ -258,7 +252,7 @@ func (c *Chain) addEntry(entryIdx int, hash Hash, header *Header, e Entry) (err
 		return
 	}
 
-	if l != len(c.Entries) {
+	if c.store == nil && l != len(c.Entries) {
 		err = ErrIncompleteChain
 		return
 	}
@@ -266,17 +260,20 @@ func (c *Chain) addEntry(entryIdx int, hash Hash, header *Header, e Entry) (err
 	var g GobEntry
 	g = *e.(*GobEntry)
 
+	if c.store != nil {
+		err = c.store.append(hash, header, &g)
+		if err != nil {
+			return
+		}
+	} else {
+		c.Headers = append(c.Headers, header)
+		c.Entries = append(c.Entries, &g)
+	}
 	c.Hashes = append(c.Hashes, hash)
-	c.Headers = append(c.Headers, header)
-	c.Entries = append(c.Entries, &g)
 	c.TypeTops[header.Type] = entryIdx
 	c.Emap[header.EntryLink] = entryIdx
 	c.Hmap[hash] = entryIdx
 
-	if c.s != nil {
-		err = writePair(c.s, header, &g)
-	}
-
 	return
 }
 
@@ -286,7 +283,7 @@ func (c *Chain) Get(h Hash) (header *Header, err error) {
 	defer c.lk.RUnlock()
 	i, ok := c.Hmap[h]
 	if ok {
-		header = c.Headers[i]
+		header, err = c.header(i)
 	} else {
 		err = ErrHashNotFound
 	}
@@ -299,8 +296,16 @@ func (c *Chain) GetEntry(h Hash) (entry Entry, entryType string, err error) {
 	defer c.lk.RUnlock()
 	i, ok := c.Emap[h]
 	if ok {
-		entry = c.Entries[i]
-		entryType = c.Headers[i].Type
+		var header *Header
+		header, err = c.header(i)
+		if err != nil {
+			return
+		}
+		entry, err = c.entry(i)
+		if err != nil {
+			return
+		}
+		entryType = header.Type
 	} else {
 		err = ErrHashNotFound
 	}
@@ -313,7 +318,7 @@ func (c *Chain) GetEntryHeader(h Hash) (header *Header, err error) {
 	defer c.lk.RUnlock()
 	i, ok := c.Emap[h]
 	if ok {
-		header = c.Headers[i]
+		header, err = c.header(i)
 	} else {
 		err = ErrHashNotFound
 	}
@@ -379,7 +384,7 @@ func (c *Chain) MarshalChain(writer io.Writer, flags int64, whitelistTypes []str
 	c.lk.RLock()
 	defer c.lk.RUnlock()
 
-	if len(c.Headers) != len(c.Entries) {
+	if c.store == nil && len(c.Headers) != len(c.Entries) {
 		err = ErrIncompleteChain
 		return
 	}
@@ -392,12 +397,21 @@ func (c *Chain) MarshalChain(writer io.Writer, flags int64, whitelistTypes []str
 	var pairsToWrite []ChainPair
 	var lastHeaderToWrite int
 
-	for i, hdr := range c.Headers {
+	l := c.Length()
+	for i := 0; i < l; i++ {
 		var empty []string
 		var e Entry
+		var hdr *Header
+		hdr, err = c.header(i)
+		if err != nil {
+			return
+		}
 
 		if i == 0 || filterPass(i, hdr, whitelistTypes, empty) {
-			e = c.Entries[i]
+			e, err = c.entry(i)
+			if err != nil {
+				return
+			}
 
 			if (i == 0) && ((flags & ChainMarshalFlagsOmitDNA) != 0) {
 				e = &GobEntry{C: ""}
@@ -502,9 +516,19 @@ func UnmarshalChain(hashSpec HashSpec, reader io.Reader) (flags int64, c *Chain,
 
 // Walk traverses chain from most recent to first entry calling fn on each one
 func (c *Chain) Walk(fn WalkerFn) (err error) {
-	l := len(c.Headers)
+	l := c.Length()
 	for i := l - 1; i >= 0; i-- {
-		err = fn(&c.Hashes[i], c.Headers[i], c.Entries[i])
+		var hd *Header
+		var e Entry
+		hd, err = c.header(i)
+		if err != nil {
+			return
+		}
+		e, err = c.entry(i)
+		if err != nil {
+			return
+		}
+		err = fn(&c.Hashes[i], hd, e)
 		if err != nil {
 			return
 		}
@@ -518,9 +542,13 @@ func (c *Chain) Walk(fn WalkerFn) (err error) {
 func (c *Chain) Validate(skipEntries bool) (err error) {
 	c.lk.RLock()
 	defer c.lk.RUnlock()
-	l := len(c.Headers)
+	l := c.Length()
 	for i := 0; i < l; i++ {
-		hd := c.Headers[i]
+		var hd *Header
+		hd, err = c.header(i)
+		if err != nil {
+			return
+		}
 
 		var hash, nexth Hash
 		// hash the header
@@ -530,7 +558,12 @@ func (c *Chain) Validate(skipEntries bool) (err error) {
 		}
 		// we can't compare top hash to next link, because it doesn't exist yet!
 		if i < l-2 {
-			nexth = c.Headers[i+1].HeaderLink
+			var next *Header
+			next, err = c.header(i + 1)
+			if err != nil {
+				return
+			}
+			nexth = next.HeaderLink
 		} else {
 			// so get it from the Hashes (even though this could be cheated)
 			nexth = c.Hashes[i]
@@ -542,8 +575,13 @@ func (c *Chain) Validate(skipEntries bool) (err error) {
 		}
 
 		if !skipEntries {
+			var e Entry
+			e, err = c.entry(i)
+			if err != nil {
+				return
+			}
 			var b []byte
-			b, err = c.Entries[i].Marshal()
+			b, err = e.Marshal()
 			if err != nil {
 				return
 			}
@@ -561,6 +599,126 @@ func (c *Chain) Validate(skipEntries bool) (err error) {
 	return
 }
 
+// Verify checks every pair of the chain in order and stops at the first bad one, returning
+// an error with its index and what's wrong with it. Each header must link to the header
+// before it and to the previous header of its type, its entry must hash to its entry link,
+// and it must be signed with the agent's key as of that point in the chain, i.e. the key in
+// the latest agent entry, or in the first one for the DNA. Pairs that pass are passed on to
+// the validate function if it's not nil.
+func (c *Chain) Verify(validate WalkerFn) (err error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+	l := c.Length()
+	if c.store == nil && len(c.Entries) != l {
+		err = ErrIncompleteChain
+		return
+	}
+	var key ic.PubKey
+	prev := NullHash()
+	typeTops := make(map[string]Hash)
+	for i := 0; i < l; i++ {
+		var hd *Header
+		var e Entry
+		hd, err = c.header(i)
+		if err == nil {
+			e, err = c.entry(i)
+		}
+		if err != nil {
+			err = fmt.Errorf("chain verification failed at index %d: %v", i, err)
+			return
+		}
+		bad := func(format string, args ...interface{}) error {
+			return fmt.Errorf("chain verification failed at index %d (%s): %s", i, hd.Type, fmt.Sprintf(format, args...))
+		}
+
+		if !hd.HeaderLink.Equal(prev) {
+			err = bad("header links to %v instead of previous header %v", hd.HeaderLink, prev)
+			return
+		}
+		typeTop, ok := typeTops[hd.Type]
+		if !ok {
+			typeTop = NullHash()
+		}
+		if !hd.TypeLink.Equal(typeTop) {
+			err = bad("header links to %v instead of previous header of its type %v", hd.TypeLink, typeTop)
+			return
+		}
+
+		var hash Hash
+		hash, err = e.Sum(c.hashSpec)
+		if err != nil {
+			err = bad("unable to hash entry: %v", err)
+			return
+		}
+		if !hash.Equal(hd.EntryLink) {
+			err = bad("entry hashes to %v instead of entry link %v", hash, hd.EntryLink)
+			return
+		}
+
+		// the DNA is signed with the key in the agent entry that follows it
+		agentIdx := i
+		if i == 0 && l > 1 {
+			agentIdx = 1
+		}
+		agentHd, agentE := hd, e
+		if agentIdx != i {
+			agentHd, err = c.header(agentIdx)
+			if err == nil {
+				agentE, err = c.entry(agentIdx)
+			}
+			if err != nil {
+				err = bad("unable to read agent entry at index %d: %v", agentIdx, err)
+				return
+			}
+		}
+		if agentHd.Type == AgentEntryType {
+			j, ok := agentE.Content().(string)
+			if !ok {
+				err = bad("agent entry at index %d isn't a string", agentIdx)
+				return
+			}
+			var ae AgentEntry
+			ae, err = AgentEntryFromJSON(j)
+			if err == nil {
+				key, err = DecodePubKey(ae.PublicKey)
+			}
+			if err != nil {
+				err = bad("unable to get public key from agent entry at index %d: %v", agentIdx, err)
+				return
+			}
+		}
+		if key == nil {
+			err = bad("no agent entry to verify the signature with")
+			return
+		}
+		var matches bool
+		matches, err = hd.VerifySig(c.hashSpec, key)
+		if err == nil && !matches {
+			err = errors.New("doesn't match the agent's key")
+		}
+		if err != nil {
+			err = bad("bad header signature: %v", err)
+			return
+		}
+
+		prev, _, err = hd.Sum(c.hashSpec)
+		if err != nil {
+			err = bad("unable to hash header: %v", err)
+			return
+		}
+		typeTops[hd.Type] = prev
+
+		if validate != nil {
+			err = validate(&prev, hd, e)
+			if err != nil {
+				err = bad("%v", err)
+				return
+			}
+		}
+	}
+	return
+}
+
 // String converts a chain to a textual dump of the headers and entries
 func (c *Chain) String() string {
 	return c.Dump(0)
@@ -570,17 +728,24 @@ func (c *Chain) String() string {
 func (c *Chain) Dump(start int) string {
 	c.lk.RLock()
 	defer c.lk.RUnlock()
-	l := len(c.Headers)
+	l := c.Length()
 	r := ""
 	for i := start; i < l; i++ {
-		hdr := c.Headers[i]
+		hdr, err := c.header(i)
+		var e Entry
+		if err == nil {
+			e, err = c.entry(i)
+		}
+		if err != nil {
+			r += fmt.Sprintf("error reading pair %d: %v\n\n", i, err)
+			continue
+		}
 		hash := c.Hashes[i]
 		r += fmt.Sprintf("%s:%s @ %v\n", hdr.Type, hash, hdr.Time)
 		r += fmt.Sprintf("    Sig: %v\n", hdr.Sig)
 		r += fmt.Sprintf("    Next Header: %v\n", hdr.HeaderLink)
 		r += fmt.Sprintf("    Next %s: %v\n", hdr.Type, hdr.TypeLink)
 		r += fmt.Sprintf("    Entry: %v\n", hdr.EntryLink)
-		e := c.Entries[i]
 		switch hdr.Type {
 		case KeyEntryType:
 			r += fmt.Sprintf("       %v\n", e.(*GobEntry).C)
@@ -602,7 +767,7 @@ func (c *Chain) Dump(start int) string {
 func (c *Chain) JSON(start int) (string, error) {
 	c.lk.RLock()
 	defer c.lk.RUnlock()
-	l := len(c.Headers)
+	l := c.Length()
 	firstEntry := false
 	lastEntry := false
 
@@ -611,10 +776,16 @@ func (c *Chain) JSON(start int) (string, error) {
 	buffer.WriteString("{")
 
 	for i := start; i < l; i++ {
-		hdr := c.Headers[i]
+		hdr, err := c.header(i)
+		if err != nil {
+			return "", err
+		}
 		hash := c.Hashes[i]
 
-		e := c.Entries[i]
+		e, err := c.entry(i)
+		if err != nil {
+			return "", err
+		}
 		lastEntry = (i == l-1)
 
 		switch hdr.Type {
@@ -648,7 +819,7 @@ func (c *Chain) JSON(start int) (string, error) {
 func (c *Chain) Dot(start int) (dump string, err error) {
 	c.lk.RLock()
 	defer c.lk.RUnlock()
-	l := len(c.Headers)
+	l := c.Length()
 
 	var buffer bytes.Buffer
 
@@ -658,7 +829,11 @@ func (c *Chain) Dot(start int) (dump string, err error) {
 	buffer.WriteString(`edge [penwidth=2, color="#8d00ff"];` + "\n")
 
 	for i := start; i < l; i++ {
-		hdr := c.Headers[i]
+		var hdr *Header
+		hdr, err = c.header(i)
+		if err != nil {
+			return
+		}
 		hash := c.Hashes[i]
 		headerLabel := ""
 		contentLabel := ""
@@ -689,7 +864,11 @@ func (c *Chain) Dot(start int) (dump string, err error) {
 		if i == 0 {
 			contentBody = "See dna.json"
 		} else {
-			e := c.Entries[i]
+			var e Entry
+			e, err = c.entry(i)
+			if err != nil {
+				return
+			}
 			contentBody = fmt.Sprintf("%s", e.(*GobEntry).C)
 			contentBody = strings.Replace(contentBody, `{"`, `\{"`, -1)
 			contentBody = strings.Replace(contentBody, `"}`, `"\}`, -1)
@@ -713,6 +892,9 @@ func (c *Chain) Dot(start int) (dump string, err error) {
 
 // Length returns the number of entries in the chain
 func (c *Chain) Length() int {
+	if c.store != nil {
+		return len(c.Hashes)
+	}
 	return len(c.Headers)
 }
 
@@ -767,10 +949,12 @@ func (c *Chain) CloseBundle(commit bool) (err error) {
 	return
 }
 
-// Close the chain's file
+// Close the chain's file, the chain's hashes are still there but its headers and entries
+// can't be read any more
 func (c *Chain) Close() {
-	c.s.Close()
-	c.s = nil
+	if c.store != nil {
+		c.store.close()
+	}
 }
 
 func appendEntryAsJSON(buffer *bytes.Buffer, hdr *Header, hash *Hash, g *GobEntry) {
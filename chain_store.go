@@ -0,0 +1,368 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements the on-disk storage of a chain: header/entry pairs get appended to the chain
+// file in the same format as always, and an index file alongside it records where each
+// pair is in the chain file along with the hashes needed to look it up, so that opening a
+// chain only reads the index and headers and entries get read when they are asked for.
+// Chain files without an index, or with an index that's behind, get indexed when opened.
+
+package holochain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+)
+
+const (
+	ChainIndexFileExt = ".idx"
+
+	chainIndexMagic   uint32 = 0x48434958 // "HCIX"
+	chainIndexVersion uint32 = 1
+)
+
+var ErrChainIndexOutOfRange = errors.New("chain index out of range")
+var ErrChainClosed = errors.New("chain file closed")
+
+// chainStoreRec is where a pair is in the chain file
+type chainStoreRec struct {
+	header int64 // offset of the header
+	entry  int64 // offset of the entry
+	end    int64 // offset just past the entry
+}
+
+// chainIndexRec is what gets recorded in the index file for each pair
+type chainIndexRec struct {
+	chainStoreRec
+	hash      Hash
+	entryLink Hash
+	entryType string
+}
+
+// chainStore holds a chain in an append-only chain file and its index
+type chainStore struct {
+	f    *os.File // the chain file
+	idx  *os.File // the index file
+	size int64    // size of the chain file
+	recs []chainStoreRec
+}
+
+// countingReader counts the bytes read through it, starting from n
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return
+}
+
+// openChainStore opens the chain file at the given path and its index, creating them if
+// they don't exist, and returns the index records of the pairs in the chain. Pairs in the
+// chain file that aren't in the index yet get read and added to it.
+func openChainStore(spec HashSpec, path string) (s *chainStore, index []chainIndexRec, err error) {
+	s = &chainStore{}
+	defer func() {
+		if err != nil {
+			s.close()
+			s = nil
+			index = nil
+		}
+	}()
+	s.f, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	var info os.FileInfo
+	info, err = s.f.Stat()
+	if err != nil {
+		return
+	}
+	s.size = info.Size()
+
+	index, err = s.openIndex(spec, path+ChainIndexFileExt)
+	if err != nil {
+		return
+	}
+	index, err = s.indexPairs(spec, index)
+	return
+}
+
+// openIndex loads the index records from the index file dropping any that don't follow
+// on from each other or lie past the end of the chain file, as would happen if writing
+// them got interrupted or the chain file was replaced, so those pairs get indexed again.
+// If the last record isn't for the header at its offset the index isn't for the chain
+// file at all and gets rebuilt.
+func (s *chainStore) openIndex(spec HashSpec, path string) (index []chainIndexRec, err error) {
+	s.idx, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	r := &countingReader{r: bufio.NewReader(s.idx)}
+	var magic, version uint32
+	err = binary.Read(r, binary.LittleEndian, &magic)
+	if err == nil {
+		err = binary.Read(r, binary.LittleEndian, &version)
+	}
+	if err != nil || magic != chainIndexMagic || version != chainIndexVersion {
+		if err != io.EOF {
+			Debugf("chain index %s unreadable, rebuilding it", path)
+		}
+		err = s.resetIndex(0)
+		return
+	}
+
+	var good, end int64
+	good = r.n
+	for {
+		var rec chainIndexRec
+		rec, err = readChainIndexRec(r)
+		if err != nil || rec.header != end || rec.end > s.size {
+			break
+		}
+		end = rec.end
+		index = append(index, rec)
+		s.recs = append(s.recs, rec.chainStoreRec)
+		good = r.n
+	}
+	if err != io.EOF {
+		Debugf("chain index %s truncated after %d pairs", path, len(index))
+		err = s.resetIndex(good)
+	} else {
+		err = nil
+	}
+	if err != nil || len(index) == 0 || s.matches(spec, index[len(index)-1]) {
+		return
+	}
+	Debugf("chain index %s doesn't match its chain file, rebuilding it", path)
+	index = nil
+	s.recs = nil
+	err = s.resetIndex(0)
+	return
+}
+
+// matches returns true if an index record is for the header at its offset in the chain file
+func (s *chainStore) matches(spec HashSpec, rec chainIndexRec) bool {
+	b, err := s.read(rec.header, rec.entry)
+	if err != nil {
+		return false
+	}
+	var hd Header
+	if hd.Unmarshal(b, 34) != nil {
+		return false
+	}
+	hash, _, err := hd.Sum(spec)
+	return err == nil && hash.Equal(rec.hash) && hd.EntryLink.Equal(rec.entryLink) && hd.Type == rec.entryType
+}
+
+// resetIndex truncates the index file to the given size, writing a new index header
+// if that empties it
+func (s *chainStore) resetIndex(size int64) (err error) {
+	err = s.idx.Truncate(size)
+	if err != nil || size > 0 {
+		return
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, chainIndexMagic)
+	binary.Write(&b, binary.LittleEndian, chainIndexVersion)
+	_, err = s.idx.Write(b.Bytes())
+	return
+}
+
+// indexPairs reads the pairs of the chain file that follow the indexed ones and adds
+// them to the index
+func (s *chainStore) indexPairs(spec HashSpec, index []chainIndexRec) (result []chainIndexRec, err error) {
+	result = index
+	var start int64
+	if l := len(s.recs); l > 0 {
+		start = s.recs[l-1].end
+	}
+	if start >= s.size {
+		return
+	}
+	Debugf("indexing chain file from offset %d", start)
+	r := &countingReader{r: bufio.NewReader(io.NewSectionReader(s.f, start, s.size-start)), n: start}
+	for r.n < s.size {
+		rec := chainIndexRec{chainStoreRec: chainStoreRec{header: r.n}}
+		var hd Header
+		err = UnmarshalHeader(r, &hd, 34)
+		if err != nil {
+			return
+		}
+		rec.entry = r.n
+		_, err = UnmarshalEntry(r)
+		if err != nil {
+			return
+		}
+		rec.end = r.n
+		rec.hash, _, err = hd.Sum(spec)
+		if err != nil {
+			return
+		}
+		rec.entryLink = hd.EntryLink
+		rec.entryType = hd.Type
+		err = s.writeIndexRec(rec)
+		if err != nil {
+			return
+		}
+		result = append(result, rec)
+	}
+	return
+}
+
+func readChainIndexRec(reader io.Reader) (rec chainIndexRec, err error) {
+	err = binary.Read(reader, binary.LittleEndian, &rec.header)
+	if err != nil {
+		return
+	}
+	defer func() {
+		// a partially written record isn't the end of the index
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+	err = binary.Read(reader, binary.LittleEndian, &rec.entry)
+	if err == nil {
+		err = binary.Read(reader, binary.LittleEndian, &rec.end)
+	}
+	if err == nil {
+		rec.hash, err = UnmarshalHash(reader)
+	}
+	if err == nil {
+		rec.entryLink, err = UnmarshalHash(reader)
+	}
+	if err == nil {
+		rec.entryType, err = readStr(reader)
+	}
+	return
+}
+
+// writeIndexRec appends a record to the index file
+func (s *chainStore) writeIndexRec(rec chainIndexRec) (err error) {
+	var b bytes.Buffer
+	err = binary.Write(&b, binary.LittleEndian, rec.header)
+	if err == nil {
+		err = binary.Write(&b, binary.LittleEndian, rec.entry)
+	}
+	if err == nil {
+		err = binary.Write(&b, binary.LittleEndian, rec.end)
+	}
+	if err == nil {
+		err = rec.hash.MarshalHash(&b)
+	}
+	if err == nil {
+		err = rec.entryLink.MarshalHash(&b)
+	}
+	if err == nil {
+		err = writeStr(&b, rec.entryType)
+	}
+	if err != nil {
+		return
+	}
+	_, err = s.idx.Write(b.Bytes())
+	if err == nil {
+		s.recs = append(s.recs, rec.chainStoreRec)
+	}
+	return
+}
+
+// append writes a pair to the end of the chain file and indexes it
+func (s *chainStore) append(hash Hash, header *Header, entry Entry) (err error) {
+	if s.f == nil {
+		err = ErrChainClosed
+		return
+	}
+	var b bytes.Buffer
+	err = MarshalHeader(&b, header)
+	if err != nil {
+		return
+	}
+	entryOffset := int64(b.Len())
+	err = MarshalEntry(&b, entry)
+	if err != nil {
+		return
+	}
+	rec := chainIndexRec{
+		chainStoreRec: chainStoreRec{
+			header: s.size,
+			entry:  s.size + entryOffset,
+			end:    s.size + int64(b.Len()),
+		},
+		hash:      hash,
+		entryLink: header.EntryLink,
+		entryType: header.Type,
+	}
+	_, err = s.f.Write(b.Bytes())
+	if err != nil {
+		return
+	}
+	s.size = rec.end
+	err = s.writeIndexRec(rec)
+	return
+}
+
+// read reads the bytes between two offsets of the chain file
+func (s *chainStore) read(from, to int64) (b []byte, err error) {
+	if s.f == nil {
+		err = ErrChainClosed
+		return
+	}
+	b = make([]byte, to-from)
+	_, err = s.f.ReadAt(b, from)
+	return
+}
+
+// header reads the header of the ith pair
+func (s *chainStore) header(i int) (header *Header, err error) {
+	if i < 0 || i >= len(s.recs) {
+		err = ErrChainIndexOutOfRange
+		return
+	}
+	var b []byte
+	b, err = s.read(s.recs[i].header, s.recs[i].entry)
+	if err != nil {
+		return
+	}
+	var hd Header
+	err = hd.Unmarshal(b, 34)
+	if err == nil {
+		header = &hd
+	}
+	return
+}
+
+// entry reads the entry of the ith pair
+func (s *chainStore) entry(i int) (entry Entry, err error) {
+	if i < 0 || i >= len(s.recs) {
+		err = ErrChainIndexOutOfRange
+		return
+	}
+	var b []byte
+	b, err = s.read(s.recs[i].entry, s.recs[i].end)
+	if err != nil {
+		return
+	}
+	entry, err = UnmarshalEntry(bytes.NewReader(b))
+	return
+}
+
+// close closes the chain and index files
+func (s *chainStore) close() {
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+	if s.idx != nil {
+		s.idx.Close()
+		s.idx = nil
+	}
+}
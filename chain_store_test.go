@@ -0,0 +1,151 @@
+package holochain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChainStore(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	hashSpec, key, now := chainTestSetup()
+	path := filepath.Join(d, "chain.dat")
+
+	c, err := NewChainFromFile(hashSpec, path)
+	if err != nil {
+		panic(err)
+	}
+	h1, _ := c.AddEntry(now, "entryTypeFoo1", &GobEntry{C: "some data1"}, key)
+	h2, _ := c.AddEntry(now, "entryTypeFoo2", &GobEntry{C: "some other data2"}, key)
+	h3, _ := c.AddEntry(now, "entryTypeFoo1", &GobEntry{C: "more data3"}, key)
+	dump := c.String()
+	c.Close()
+
+	Convey("it should load only the index and read pairs when they are asked for", t, func() {
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		So(c.Length(), ShouldEqual, 3)
+		So(len(c.Headers), ShouldEqual, 0)
+		So(len(c.Entries), ShouldEqual, 0)
+		So(c.Hashes, ShouldResemble, []Hash{h1, h2, h3})
+		So(c.TypeTops["entryTypeFoo1"], ShouldEqual, 2)
+
+		hd, err := c.Get(h2)
+		So(err, ShouldBeNil)
+		So(hd.Type, ShouldEqual, "entryTypeFoo2")
+		entry, entryType, err := c.GetEntry(hd.EntryLink)
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "entryTypeFoo2")
+		So(entry.Content(), ShouldEqual, "some other data2")
+
+		var contents []interface{}
+		err = c.Walk(func(key *Hash, header *Header, entry Entry) error {
+			contents = append(contents, entry.Content())
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(contents, ShouldResemble, []interface{}{"more data3", "some other data2", "some data1"})
+		So(c.Validate(false), ShouldBeNil)
+		So(c.String(), ShouldEqual, dump)
+		c.Close()
+	})
+
+	Convey("it should index chain files that don't have an index", t, func() {
+		err := os.Remove(path + ChainIndexFileExt)
+		So(err, ShouldBeNil)
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		So(FileExists(path+ChainIndexFileExt), ShouldBeTrue)
+		So(c.Hashes, ShouldResemble, []Hash{h1, h2, h3})
+		So(c.String(), ShouldEqual, dump)
+		c.Close()
+	})
+
+	Convey("it should index pairs the index is missing", t, func() {
+		info, err := os.Stat(path + ChainIndexFileExt)
+		So(err, ShouldBeNil)
+		// chop the index part way through the last record
+		err = os.Truncate(path+ChainIndexFileExt, info.Size()-10)
+		So(err, ShouldBeNil)
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		So(c.Hashes, ShouldResemble, []Hash{h1, h2, h3})
+		So(c.String(), ShouldEqual, dump)
+
+		h4, err := c.AddEntry(now, "entryTypeFoo2", &GobEntry{C: "data4"}, key)
+		So(err, ShouldBeNil)
+		dump = c.String()
+		c.Close()
+
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		So(c.Hashes, ShouldResemble, []Hash{h1, h2, h3, h4})
+		So(c.String(), ShouldEqual, dump)
+		info2, err := os.Stat(path + ChainIndexFileExt)
+		So(err, ShouldBeNil)
+		So(info2.Size(), ShouldBeGreaterThan, info.Size())
+		c.Close()
+	})
+
+	Convey("it should rebuild an index it can't read", t, func() {
+		f, err := os.OpenFile(path+ChainIndexFileExt, os.O_WRONLY, 0600)
+		So(err, ShouldBeNil)
+		f.Write([]byte("fish"))
+		f.Close()
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		So(c.String(), ShouldEqual, dump)
+		c.Close()
+	})
+
+	Convey("it should rebuild an index that's for a different chain file", t, func() {
+		otherPath := filepath.Join(d, "other.dat")
+		other, err := NewChainFromFile(hashSpec, otherPath)
+		So(err, ShouldBeNil)
+		// pairs the same size as the chain's so the index records look right for it
+		other.AddEntry(now, "entryTypeFoo1", &GobEntry{C: "SOME DATA1"}, key)
+		other.AddEntry(now, "entryTypeFoo2", &GobEntry{C: "SOME OTHER DATA2"}, key)
+		other.AddEntry(now, "entryTypeFoo1", &GobEntry{C: "MORE DATA3"}, key)
+		other.AddEntry(now, "entryTypeFoo2", &GobEntry{C: "DATA4"}, key)
+		otherHashes := other.Hashes
+		other.Close()
+		b, err := ioutil.ReadFile(otherPath + ChainIndexFileExt)
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(path+ChainIndexFileExt, b, 0600), ShouldBeNil)
+
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		So(c.Hashes[0], ShouldNotResemble, otherHashes[0])
+		So(c.String(), ShouldEqual, dump)
+		So(c.Validate(false), ShouldBeNil)
+		c.Close()
+	})
+
+	Convey("it should keep its length but not read pairs once closed", t, func() {
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		c.Close()
+		So(c.Length(), ShouldEqual, 4)
+		_, err = c.header(0)
+		So(err, ShouldEqual, ErrChainClosed)
+		_, err = c.AddEntry(now, "entryTypeFoo1", &GobEntry{C: "data5"}, key)
+		So(err, ShouldEqual, ErrChainClosed)
+	})
+
+	Convey("it should return an error for pairs out of range", t, func() {
+		c, err = NewChainFromFile(hashSpec, path)
+		So(err, ShouldBeNil)
+		_, err = c.header(4)
+		So(err, ShouldEqual, ErrChainIndexOutOfRange)
+		_, err = c.entry(-1)
+		So(err, ShouldEqual, ErrChainIndexOutOfRange)
+		So(c.Nth(4), ShouldBeNil)
+		So(c.Top().Type, ShouldEqual, "entryTypeFoo2")
+		c.Close()
+	})
+}
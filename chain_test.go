@@ -2,6 +2,7 @@ package holochain
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"reflect"
@@ -35,8 +36,9 @@ func TestChainNewChainFromFile(t *testing.T) {
 	Convey("it should make an empty chain with encoder", t, func() {
 		c, err = NewChainFromFile(hashSpec, path)
 		So(err, ShouldBeNil)
-		So(c.s, ShouldNotBeNil)
+		So(c.store, ShouldNotBeNil)
 		So(FileExists(path), ShouldBeTrue)
+		So(FileExists(path+ChainIndexFileExt), ShouldBeTrue)
 	})
 
 	e := GobEntry{C: "some data1"}
@@ -44,7 +46,7 @@ func TestChainNewChainFromFile(t *testing.T) {
 	e = GobEntry{C: "some other data2"}
 	c.AddEntry(now, "entryTypeFoo2", &e, key)
 	dump := c.String()
-	c.s.Close()
+	c.Close()
 	c, err = NewChainFromFile(hashSpec, path)
 	Convey("it should load chain data if available", t, func() {
 		So(err, ShouldBeNil)
@@ -54,7 +56,7 @@ func TestChainNewChainFromFile(t *testing.T) {
 	e = GobEntry{C: "yet other data"}
 	c.AddEntry(now, "yourData", &e, key)
 	dump = c.String()
-	c.s.Close()
+	c.Close()
 
 	c, err = NewChainFromFile(hashSpec, path)
 	Convey("should continue to append data after reload", t, func() {
@@ -415,6 +417,88 @@ func TestChainValidateChain(t *testing.T) {
 	})
 }
 
+func TestChainVerify(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	commit(h, "evenNumbers", "2")
+	commit(h, "oddNumbers", "3")
+	commit(h, "evenNumbers", "4")
+
+	// tamper with an in-memory copy of the chain
+	var buf bytes.Buffer
+	err := h.chain.MarshalChain(&buf, ChainMarshalFlagsNone, nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	_, c, err := UnmarshalChain(h.hashSpec, &buf)
+	if err != nil {
+		panic(err)
+	}
+	l := len(c.Headers)
+
+	Convey("it should verify a good chain and pass each pair to the validate function", t, func() {
+		var types []string
+		err := c.Verify(func(key *Hash, header *Header, entry Entry) error {
+			types = append(types, header.Type)
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(len(types), ShouldEqual, l)
+		So(types[0], ShouldEqual, DNAEntryType)
+	})
+
+	Convey("it should stop at the first pair the validate function rejects", t, func() {
+		var count int
+		err := c.Verify(func(key *Hash, header *Header, entry Entry) error {
+			count++
+			if header.Type == "oddNumbers" {
+				return errors.New("odd")
+			}
+			return nil
+		})
+		So(err.Error(), ShouldEqual, fmt.Sprintf("chain verification failed at index %d (oddNumbers): odd", l-2))
+		So(count, ShouldEqual, l-1)
+	})
+
+	Convey("it should say what's wrong with a tampered pair", t, func() {
+		prefix := fmt.Sprintf("chain verification failed at index %d (evenNumbers): ", l-1)
+		top := c.Headers[l-1]
+
+		c.Entries[l-1].(*GobEntry).C = "6" // tweak
+		err := c.Verify(nil)
+		So(err.Error(), ShouldStartWith, prefix+"entry hashes to")
+		c.Entries[l-1].(*GobEntry).C = "4" // restore
+
+		val := top.Sig.S[0]
+		top.Sig.S[0] = val + 1 // tweak
+		err = c.Verify(nil)
+		So(err.Error(), ShouldStartWith, prefix+"bad header signature")
+		top.Sig.S[0] = val // restore
+
+		typeLink := top.TypeLink
+		top.TypeLink = NullHash() // tweak
+		err = c.Verify(nil)
+		So(err.Error(), ShouldStartWith, prefix+"header links to "+NullHash().String()+" instead of previous header of its type")
+		top.TypeLink = typeLink // restore
+
+		headerLink := top.HeaderLink
+		top.HeaderLink = typeLink // tweak
+		err = c.Verify(nil)
+		So(err.Error(), ShouldEqual, prefix+fmt.Sprintf("header links to %v instead of previous header %v", typeLink, headerLink))
+		top.HeaderLink = headerLink // restore
+
+		So(c.Verify(nil), ShouldBeNil)
+	})
+
+	Convey("it should fail for pairs not signed with the agent's key", t, func() {
+		_, otherKey := makePeer("peer1")
+		_, err := c.AddEntry(time.Now(), "evenNumbers", &GobEntry{C: "8"}, otherKey)
+		So(err, ShouldBeNil)
+		err = c.Verify(nil)
+		So(err.Error(), ShouldEqual, fmt.Sprintf("chain verification failed at index %d (evenNumbers): bad header signature: doesn't match the agent's key", l))
+	})
+}
+
 func TestChain2String(t *testing.T) {
 	hashSpec, key, now := chainTestSetup()
 	c := NewChain(hashSpec)
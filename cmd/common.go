@@ -189,6 +189,20 @@ func GetService(root string) (service *holo.Service, err error) {
 
 // GetHolochain os a helper function to load a holochain from a directory or report an error based on a command name
 func GetHolochain(name string, service *holo.Service, cmd string) (h *holo.Holochain, err error) {
+	h, err = LoadHolochain(name, service, cmd)
+	if err != nil {
+		return
+	}
+
+	if err = h.Prepare(); err != nil {
+		return
+	}
+	return
+}
+
+// LoadHolochain is like GetHolochain but doesn't prepare the holochain, so its config can
+// still be changed before its node is created
+func LoadHolochain(name string, service *holo.Service, cmd string) (h *holo.Holochain, err error) {
 	if service == nil {
 		err = ErrServiceUninitialized
 		return
@@ -208,10 +222,6 @@ func GetHolochain(name string, service *holo.Service, cmd string) (h *holo.Holoc
 	if val != "" {
 		h.Config.EnableNATUPnP = val == "true"
 	}
-
-	if err = h.Prepare(); err != nil {
-		return
-	}
 	return
 }
 
@@ -10,10 +10,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	holo "github.com/HC-Interns/holochain-proto"
 	"github.com/HC-Interns/holochain-proto/cmd"
 	. "github.com/HC-Interns/holochain-proto/hash"
+	"github.com/HC-Interns/holochain-proto/ui"
 	"github.com/urfave/cli"
 )
 
@@ -31,6 +33,7 @@ func setupApp() (app *cli.App) {
 	var service *holo.Service
 	var bridgeCalleeAppData, bridgeCallerAppData, dumpFormat string
 	var start int
+	var compactAge time.Duration
 
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
@@ -262,6 +265,198 @@ func setupApp() (app *cli.App) {
 				return err
 			},
 		},
+		{
+			Name:  "dht",
+			Usage: "export and import the dht data held by a node",
+			Subcommands: []cli.Command{
+				{
+					Name:      "export",
+					ArgsUsage: "holochain-name archive-file",
+					Usage:     "write the dht entries, links and change log to an archive",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) != 2 {
+							return errors.New("dht export: requires two arguments: holochain-name archive-file")
+						}
+						h, err := cmd.GetHolochain(c.Args()[0], service, "dht export")
+						if err != nil {
+							return err
+						}
+						if !h.Started() {
+							return errors.New("No data to export, chain not yet initialized.")
+						}
+						f, err := os.Create(c.Args()[1])
+						if err != nil {
+							return err
+						}
+						defer f.Close()
+						err = h.DHT().Export(f)
+						if err == nil && verbose {
+							fmt.Printf("exported dht of %s to %s\n", h.Name(), c.Args()[1])
+						}
+						return err
+					},
+				},
+				{
+					Name:      "import",
+					ArgsUsage: "holochain-name archive-file",
+					Usage:     "validate and store the dht data in an archive",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) != 2 {
+							return errors.New("dht import: requires two arguments: holochain-name archive-file")
+						}
+						h, err := cmd.GetHolochain(c.Args()[0], service, "dht import")
+						if err != nil {
+							return err
+						}
+						if !h.Started() {
+							return errors.New("Can't import, chain not yet initialized.")
+						}
+						f, err := os.Open(c.Args()[1])
+						if err != nil {
+							return err
+						}
+						defer f.Close()
+						stats, err := h.DHT().Import(f)
+						if err != nil {
+							return err
+						}
+						fmt.Printf("Imported %d entries, %d links and %d puts into %s\n", stats.Entries, stats.Links, stats.Puts, h.Name())
+						if stats.Rejected > 0 || stats.Skipped > 0 {
+							fmt.Printf("    %d entries failed validation, %d skipped\n", stats.Rejected, stats.Skipped)
+						}
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:      "compact",
+			ArgsUsage: "holochain-name",
+			Usage:     "drop the payloads of long dead dht entries and the puts no longer needed",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:        "age",
+					Usage:       "how long entries must have been deleted or modified for",
+					Value:       time.Hour * 24 * 7,
+					Destination: &compactAge,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				h, err := cmd.GetHolochain(c.Args().First(), service, "compact")
+				if err != nil {
+					return err
+				}
+				if !h.Started() {
+					return errors.New("No data to compact, chain not yet initialized.")
+				}
+				stats, err := h.DHT().Compact(time.Now().Add(-compactAge))
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Compacted %s up to index %d\n", h.Name(), stats.Checkpoint)
+				if verbose {
+					fmt.Printf("    %d payloads dropped\n", stats.Payloads)
+					fmt.Printf("    %d puts dropped\n", stats.Puts)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "node",
+			Usage: "query and control a running node through its admin api",
+			Subcommands: []cli.Command{
+				{
+					Name:      "status",
+					ArgsUsage: "holochain-name",
+					Usage:     "display the running node's chain and dht sizes, peers and gossipers",
+					Action: func(c *cli.Context) error {
+						client, err := getAdminClient(service, c, 1)
+						if err != nil {
+							return err
+						}
+						var status holo.NodeStatus
+						if err = client.Call("status", nil, &status); err != nil {
+							return err
+						}
+						var peers []holo.NodePeer
+						if err = client.Call("peers", nil, &peers); err != nil {
+							return err
+						}
+						var gossipers []holo.NodeGossiper
+						if err = client.Call("gossipers", nil, &gossipers); err != nil {
+							return err
+						}
+						fmt.Printf("Status of running node %s\n", status.Name)
+						fmt.Printf("DNA Hash: %s\n", status.DNA)
+						fmt.Printf("ID Hash: %s\n", status.ID)
+						fmt.Printf("Chain Length: %d (%d bytes)\n", status.ChainLength, status.ChainBytes)
+						fmt.Printf("DHT Entries: %d (%d bytes)\n", status.DHTEntries, status.DHTBytes)
+						fmt.Printf("Current Put Index: %d\n", status.DHTIdx)
+						fmt.Printf("Peers: %d (%d blocked)\n", status.Peers, status.Blocked)
+						for _, p := range peers {
+							blocked := ""
+							if p.Blocked {
+								blocked = " blocked"
+							}
+							fmt.Printf("  %s %v%s\n", p.ID, p.Addrs, blocked)
+						}
+						fmt.Printf("Gossipers:\n")
+						for _, g := range gossipers {
+							fmt.Printf("  %s idx: %d\n", g.ID, g.PutIdx)
+						}
+						return nil
+					},
+				},
+				{
+					Name:      "block",
+					ArgsUsage: "holochain-name peer-id",
+					Usage:     "stop the running node talking to a peer",
+					Action: func(c *cli.Context) error {
+						client, err := getAdminClient(service, c, 2)
+						if err != nil {
+							return err
+						}
+						return client.Call("block", ui.PeerParams{Peer: c.Args()[1]}, nil)
+					},
+				},
+				{
+					Name:      "unblock",
+					ArgsUsage: "holochain-name peer-id",
+					Usage:     "let the running node talk to a blocked peer again",
+					Action: func(c *cli.Context) error {
+						client, err := getAdminClient(service, c, 2)
+						if err != nil {
+							return err
+						}
+						return client.Call("unblock", ui.PeerParams{Peer: c.Args()[1]}, nil)
+					},
+				},
+				{
+					Name:      "gossip",
+					ArgsUsage: "holochain-name",
+					Usage:     "have the running node gossip now",
+					Action: func(c *cli.Context) error {
+						client, err := getAdminClient(service, c, 1)
+						if err != nil {
+							return err
+						}
+						return client.Call("gossip", nil, nil)
+					},
+				},
+				{
+					Name:      "holding",
+					ArgsUsage: "holochain-name",
+					Usage:     "have the running node check the entries it should be holding now",
+					Action: func(c *cli.Context) error {
+						client, err := getAdminClient(service, c, 1)
+						if err != nil {
+							return err
+						}
+						return client.Call("holding", nil, nil)
+					},
+				},
+			},
+		},
 		{
 			Name:      "status",
 			Aliases:   []string{"s"},
@@ -284,6 +479,8 @@ func setupApp() (app *cli.App) {
 					fmt.Printf("ID Hash: %s\n", h.NodeIDStr())
 					idx, _ := h.DHT().GetIdx()
 					fmt.Printf("Current Put Index: %d\n", idx)
+					checkpoint, _ := h.DHT().GetCheckpoint()
+					fmt.Printf("Compacted To Index: %d\n", checkpoint)
 					fmt.Printf("Gossipers:\n")
 					gossipers, err := h.DHT().GetGossipers()
 					if err != nil {
@@ -293,6 +490,17 @@ func setupApp() (app *cli.App) {
 						h := HashFromPeerID(g.ID)
 						fmt.Printf("  %v idx: %d\n", h.String(), g.PutIdx)
 					}
+					throttled, err := h.DHT().GetThrottled()
+					if err != nil {
+						return err
+					}
+					if len(throttled) > 0 {
+						fmt.Printf("Throttled Peers:\n")
+						for _, tp := range throttled {
+							h := HashFromPeerID(tp.ID)
+							fmt.Printf("  %v throttled %d times, last at %v\n", h.String(), tp.Count, tp.Last.Format(time.RFC3339))
+						}
+					}
 				} else {
 					return errors.New("status: expected 0 or 1 argument")
 				}
@@ -354,3 +562,18 @@ func genChain(service *holo.Service, name string) error {
 	}
 	return nil
 }
+
+// getAdminClient returns a client for the admin api of the running node of the chain named
+// in the command's first argument
+func getAdminClient(service *holo.Service, c *cli.Context, args int) (client *ui.AdminClient, err error) {
+	if service == nil {
+		err = cmd.ErrServiceUninitialized
+		return
+	}
+	if len(c.Args()) != args {
+		err = fmt.Errorf("node %s: expected %d argument(s): %s", c.Command.Name, args, c.Command.ArgsUsage)
+		return
+	}
+	client, err = ui.NewAdminClient(filepath.Join(service.Path, c.Args().First()))
+	return
+}
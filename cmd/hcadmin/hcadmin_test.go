@@ -10,6 +10,7 @@ import (
 
 	holo "github.com/HC-Interns/holochain-proto"
 	"github.com/HC-Interns/holochain-proto/cmd"
+	"github.com/HC-Interns/holochain-proto/ui"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/urfave/cli"
 )
@@ -119,6 +120,7 @@ func TestStatus(t *testing.T) {
 		So(out, ShouldContainSubstring, "Status of test")
 		So(out, ShouldContainSubstring, "DNA Hash: Qm")
 		So(out, ShouldContainSubstring, "ID Hash: Qm")
+		So(out, ShouldNotContainSubstring, "Throttled Peers:")
 	})
 }
 
@@ -289,6 +291,152 @@ func TestDumpChainAsJSON(t *testing.T) {
 	})
 }
 
+func TestCompact(t *testing.T) {
+	Convey("Given a joined chain", t, func() {
+		d := holo.SetupTestDir()
+		defer os.RemoveAll(d)
+
+		app := setupApp()
+		_, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "init", "test-identity"})
+		if err != nil {
+			panic(err)
+		}
+
+		err = holo.WriteFile([]byte(holo.BasicTemplateAppPackage), d, "appPackage."+holo.BasicTemplateAppPackageFormat)
+		if err != nil {
+			panic(err)
+		}
+
+		app = setupApp()
+		_, err = runAppWithStdoutCapture(app, []string{"hcadmin", "-verbose", "-path", d, "join", filepath.Join(d, "appPackage."+holo.BasicTemplateAppPackageFormat), "testApp"})
+		if err != nil {
+			panic(err)
+		}
+
+		Convey("compact should compact the dht and report the checkpoint", func() {
+			app := setupApp()
+			out, err := cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "-verbose", "compact", "-age", "1h", "testApp"}, 1*time.Second)
+			So(err, ShouldBeNil)
+			So(out, ShouldContainSubstring, "Compacted testApp up to index 2\n")
+			So(out, ShouldContainSubstring, "0 payloads dropped\n")
+
+			app = setupApp()
+			out, err = cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "status", "testApp"}, 1*time.Second)
+			So(err, ShouldBeNil)
+			So(out, ShouldContainSubstring, "Compacted To Index: 2\n")
+		})
+	})
+}
+
+func TestDHTExportImport(t *testing.T) {
+	Convey("Given a joined chain", t, func() {
+		d := holo.SetupTestDir()
+		defer os.RemoveAll(d)
+
+		app := setupApp()
+		_, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "init", "test-identity"})
+		if err != nil {
+			panic(err)
+		}
+
+		err = holo.WriteFile([]byte(holo.BasicTemplateAppPackage), d, "appPackage."+holo.BasicTemplateAppPackageFormat)
+		if err != nil {
+			panic(err)
+		}
+
+		app = setupApp()
+		_, err = runAppWithStdoutCapture(app, []string{"hcadmin", "-verbose", "-path", d, "join", filepath.Join(d, "appPackage."+holo.BasicTemplateAppPackageFormat), "testApp"})
+		if err != nil {
+			panic(err)
+		}
+
+		archive := filepath.Join(d, "dht.archive")
+		Convey("dht export should write an archive", func() {
+			app := setupApp()
+			_, err := cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "dht", "export", "testApp", archive}, 1*time.Second)
+			So(err, ShouldBeNil)
+			So(holo.FileExists(archive), ShouldBeTrue)
+
+			Convey("dht import should read it back", func() {
+				app := setupApp()
+				out, err := cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "dht", "import", "testApp", archive}, 1*time.Second)
+				So(err, ShouldBeNil)
+				So(out, ShouldContainSubstring, "Imported 3 entries, 0 links and 2 puts into testApp\n")
+			})
+		})
+	})
+}
+
+func TestNode(t *testing.T) {
+	Convey("Given a joined chain", t, func() {
+		d := holo.SetupTestDir()
+		defer os.RemoveAll(d)
+
+		app := setupApp()
+		_, err := runAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "init", "test-identity"})
+		if err != nil {
+			panic(err)
+		}
+
+		err = holo.WriteFile([]byte(holo.BasicTemplateAppPackage), d, "appPackage."+holo.BasicTemplateAppPackageFormat)
+		if err != nil {
+			panic(err)
+		}
+
+		app = setupApp()
+		_, err = runAppWithStdoutCapture(app, []string{"hcadmin", "-verbose", "-path", d, "join", filepath.Join(d, "appPackage."+holo.BasicTemplateAppPackageFormat), "testApp"})
+		if err != nil {
+			panic(err)
+		}
+
+		Convey("node commands should fail if the node isn't running", func() {
+			app := setupApp()
+			_, err := cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "node", "status", "testApp"}, 1*time.Second)
+			So(err, ShouldEqual, holo.ErrAdminNotRunning)
+		})
+
+		Convey("node commands should use the admin api of the running node", func() {
+			service, err := holo.LoadService(d)
+			So(err, ShouldBeNil)
+			h, err := cmd.LoadHolochain("testApp", service, "test")
+			So(err, ShouldBeNil)
+			h.Config.DHTPort, err = cmd.GetFreePort()
+			So(err, ShouldBeNil)
+			So(h.Prepare(), ShouldBeNil)
+			So(h.Activate(), ShouldBeNil)
+			defer h.Close()
+			admin := ui.NewAdminServer(h)
+			So(admin.Start(), ShouldBeNil)
+			defer admin.Stop()
+
+			app := setupApp()
+			out, err := cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "node", "status", "testApp"}, 1*time.Second)
+			So(err, ShouldBeNil)
+			So(out, ShouldContainSubstring, "Status of running node testApp\n")
+			So(out, ShouldContainSubstring, "ID Hash: "+h.NodeIDStr()+"\n")
+			So(out, ShouldContainSubstring, "Chain Length: 2")
+			So(out, ShouldContainSubstring, "Peers: 0 (0 blocked)\n")
+
+			peerID := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2"
+			app = setupApp()
+			_, err = cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "node", "block", "testApp", peerID}, 1*time.Second)
+			So(err, ShouldBeNil)
+			app = setupApp()
+			out, err = cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "node", "status", "testApp"}, 1*time.Second)
+			So(err, ShouldBeNil)
+			So(out, ShouldContainSubstring, "Peers: 0 (1 blocked)\n")
+
+			app = setupApp()
+			_, err = cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "node", "unblock", "testApp", peerID}, 1*time.Second)
+			So(err, ShouldBeNil)
+
+			app = setupApp()
+			_, err = cmd.RunAppWithStdoutCapture(app, []string{"hcadmin", "-path", d, "node", "block", "testApp"}, 1*time.Second)
+			So(err.Error(), ShouldEqual, "node block: expected 2 argument(s): holochain-name peer-id")
+		})
+	})
+}
+
 func runAppWithStdoutCapture(app *cli.App, args []string) (out string, err error) {
 	return cmd.RunAppWithStdoutCapture(app, args, time.Second*5)
 }
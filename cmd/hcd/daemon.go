@@ -0,0 +1,408 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//---------------------------------------------------------------------------------------
+// daemon mode, serving a number of chains from one process
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	holo "github.com/HC-Interns/holochain-proto"
+	"github.com/HC-Interns/holochain-proto/cmd"
+	"github.com/HC-Interns/holochain-proto/ui"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// daemonControlPrefix is the url prefix of the daemon's control endpoints, the chains
+// themselves are served under /<holochain-name>/.  Clients of the control endpoints
+// authenticate with the token the daemon writes, along with its port, to the service's
+// daemon file.
+const daemonControlPrefix = "/_daemon/"
+
+// daemonMetricsPath is where the daemon serves the metrics of all its chains, each chain's
+// own being under /<holochain-name>/_metrics.  Both need the control endpoints' token.
+const daemonMetricsPath = "/_metrics"
+
+var ErrChainNotServed = errors.New("chain not being served")
+var ErrChainAlreadyServed = errors.New("chain already being served")
+
+// ChainStatus describes a chain being served by the daemon
+type ChainStatus struct {
+	Name    string
+	DNA     string
+	DHTPort int
+}
+
+// BridgeRequest is the body of a request to the daemon to bridge two of its chains
+type BridgeRequest struct {
+	Caller     string
+	Callee     string
+	Zome       string // the caller's bridging zome
+	CallerData string
+	CalleeData string
+}
+
+type hostedChain struct {
+	h       *holo.Holochain
+	handler http.Handler
+	admin   *ui.AdminServer
+}
+
+// Daemon serves a number of chains, each with its own node, from a single web server with
+// each chain's UI, functions and bridging under its own url prefix
+type Daemon struct {
+	service *holo.Service
+	port    string
+	lk      sync.RWMutex
+	chains  map[string]*hostedChain
+	errs    holo.Logger
+	stop    chan bool
+	server  *http.Server
+	token   string // bearer token of the control endpoints
+}
+
+func NewDaemon(service *holo.Service, port string) *Daemon {
+	d := Daemon{service: service, port: port}
+	d.chains = make(map[string]*hostedChain)
+	d.errs = holo.Logger{Format: "%{color:red}%{time} %{message}", Enabled: true}
+	d.errs.New(os.Stderr)
+	d.stop = make(chan bool, 1)
+	return &d
+}
+
+// portAvailable returns true if nothing is listening on the port
+func portAvailable(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// StartChain loads, activates and starts serving a chain. The chain is run on a free
+// DHT port if its configured one is taken, by another chain in the daemon or otherwise.
+func (d *Daemon) StartChain(name string) (err error) {
+	if name == "" || "/"+name+"/" == daemonControlPrefix || "/"+name == daemonMetricsPath {
+		err = fmt.Errorf("can't serve a chain named %s", name)
+		return
+	}
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if _, ok := d.chains[name]; ok {
+		err = ErrChainAlreadyServed
+		return
+	}
+
+	var h *holo.Holochain
+	h, err = cmd.LoadHolochain(name, d.service, "serve")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+	if !h.Started() {
+		err = fmt.Errorf("can't serve un-started chain %s", name)
+		return
+	}
+
+	taken := !portAvailable(h.Config.DHTPort)
+	for _, c := range d.chains {
+		if c.h.Config.DHTPort == h.Config.DHTPort {
+			taken = true
+		}
+	}
+	if taken {
+		h.Config.DHTPort, err = cmd.GetFreePort()
+		if err != nil {
+			return
+		}
+	}
+
+	if err = h.Prepare(); err != nil {
+		return
+	}
+	if err = h.Activate(); err != nil {
+		return
+	}
+	h.StartBackgroundTasks()
+
+	c := hostedChain{h: h}
+	if h.Config.EnableAdmin {
+		c.admin = ui.NewAdminServer(h)
+		if err = c.admin.Start(); err != nil {
+			return
+		}
+	}
+	h.HostLocally()
+
+	ws := ui.NewWebServer(h, d.port)
+	c.handler = http.StripPrefix("/"+name, ws.Handler())
+	d.chains[name] = &c
+	return
+}
+
+// StopChain stops serving a chain and closes it
+func (d *Daemon) StopChain(name string) (err error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	c, ok := d.chains[name]
+	if !ok {
+		err = ErrChainNotServed
+		return
+	}
+	delete(d.chains, name)
+	if c.admin != nil {
+		c.admin.Stop()
+	}
+	c.h.StopHostingLocally()
+	c.h.Close()
+	return
+}
+
+// RestartChain stops and reloads a chain
+func (d *Daemon) RestartChain(name string) (err error) {
+	if err = d.StopChain(name); err != nil {
+		return
+	}
+	err = d.StartChain(name)
+	return
+}
+
+// Chains returns the chains being served sorted by name
+func (d *Daemon) Chains() (chains []ChainStatus) {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	chains = make([]ChainStatus, 0, len(d.chains))
+	for name, c := range d.chains {
+		chains = append(chains, ChainStatus{Name: name, DNA: c.h.DNAHash().String(), DHTPort: c.h.Config.DHTPort})
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].Name < chains[j].Name })
+	return
+}
+
+// BridgeChains bridges two of the chains being served. Calls over the bridge are made
+// directly while both chains are in the daemon.
+func (d *Daemon) BridgeChains(req BridgeRequest) (err error) {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	caller, ok := d.chains[req.Caller]
+	if !ok {
+		err = ErrChainNotServed
+		return
+	}
+	callee, ok := d.chains[req.Callee]
+	if !ok {
+		err = ErrChainNotServed
+		return
+	}
+	url := fmt.Sprintf("http://localhost:%s/%s", d.port, req.Callee)
+	err = caller.h.BuildLocalBridge(callee.h, req.Zome, url, req.CallerData, req.CalleeData)
+	return
+}
+
+// ServeHTTP sends requests under a chain's prefix to that chain and handles the daemon's
+// control endpoints
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	name := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	control := strings.HasPrefix(path, daemonControlPrefix)
+	metrics := path == daemonMetricsPath || path == "/"+name+daemonMetricsPath
+	if (control || metrics) && !ui.Authorized(r, d.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if path == daemonMetricsPath {
+		holo.MetricsHandler().ServeHTTP(w, r)
+		return
+	}
+	if control {
+		d.control(w, r, strings.Split(strings.TrimPrefix(path, daemonControlPrefix), "/"))
+		return
+	}
+	if name == "" {
+		writeJSON(w, d.Chains())
+		return
+	}
+	d.lk.RLock()
+	c, ok := d.chains[name]
+	d.lk.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if path == "/"+name {
+		http.Redirect(w, r, path+"/", http.StatusMovedPermanently)
+		return
+	}
+	c.handler.ServeHTTP(w, r)
+}
+
+// control handles GET of /_daemon/chains, POST of /_daemon/start/<holochain-name>, and likewise
+// stop and restart, and POST of a BridgeRequest to /_daemon/bridge
+func (d *Daemon) control(w http.ResponseWriter, r *http.Request, path []string) {
+	var err error
+	switch path[0] {
+	case "chains":
+		writeJSON(w, d.Chains())
+		return
+	case "start", "stop", "restart":
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(path) != 2 || path[1] == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch path[0] {
+		case "start":
+			err = d.StartChain(path[1])
+		case "stop":
+			err = d.StopChain(path[1])
+		case "restart":
+			err = d.RestartChain(path[1])
+		}
+	case "bridge":
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var body []byte
+		body, err = ioutil.ReadAll(r.Body)
+		if err == nil {
+			var req BridgeRequest
+			err = json.Unmarshal(body, &req)
+			if err == nil {
+				err = d.BridgeChains(req)
+			}
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	switch err {
+	case nil:
+		writeJSON(w, d.Chains())
+	case ErrChainNotServed:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrChainAlreadyServed:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Start starts the daemon's web server and writes the daemon file
+func (d *Daemon) Start() (err error) {
+	var port int
+	port, err = strconv.Atoi(d.port)
+	if err != nil {
+		return
+	}
+	d.token, err = holo.NewAdminToken()
+	if err != nil {
+		return
+	}
+	err = d.service.WriteDaemonInfo(holo.AdminInfo{Port: port, Token: d.token})
+	if err != nil {
+		return
+	}
+	d.server = &http.Server{Addr: ":" + d.port, Handler: d}
+
+	go func() {
+		if err := d.server.ListenAndServe(); err != nil {
+			// when the server is stopped by Shutdown() ListenAndServe returns with ErrServerClosed
+			if err != http.ErrServerClosed {
+				d.errs.Logf("Couldn't start server: %v", err)
+			}
+			d.stop <- true // set the channel to make sure it unblocks
+		}
+	}()
+	return
+}
+
+// Stop sends a message through the stop channel to unblock
+func (d *Daemon) Stop() {
+	d.stop <- true
+}
+
+// Wait blocks on the stop channel and when it finishes shuts down the server and all the chains
+func (d *Daemon) Wait() {
+	<-d.stop
+	if d.server != nil {
+		d.server.Shutdown(context.Background())
+		d.server = nil
+	}
+	d.service.RemoveDaemonInfo()
+	d.stopChains()
+	holo.CloseWASMRuntime() // ignore error
+}
+
+func (d *Daemon) stopChains() {
+	for _, c := range d.Chains() {
+		d.StopChain(c.Name)
+	}
+}
+
+// serveDaemon serves the named chains, or all the started ones if none are named, until stopped
+func serveDaemon(service *holo.Service, names []string, port string) (err error) {
+	if len(names) == 0 {
+		var chains map[string]*holo.Holochain
+		chains, err = service.ConfiguredChains()
+		if err != nil {
+			return
+		}
+		for name, h := range chains {
+			if h.Started() {
+				names = append(names, name)
+			}
+			h.Close()
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		err = errors.New("no started chains to serve")
+		return
+	}
+
+	d := NewDaemon(service, port)
+	for _, name := range names {
+		if err = d.StartChain(name); err != nil {
+			d.stopChains()
+			return
+		}
+	}
+	for _, c := range d.Chains() {
+		fmt.Printf("Serving holochain %s with DNA hash:%v on port %s under /%s/\n", c.Name, c.DNA, port, c.Name)
+	}
+	if err = d.Start(); err != nil {
+		d.stopChains()
+		return
+	}
+	d.Wait()
+	return
+}
@@ -20,12 +20,15 @@ const (
 
 var debug bool
 var verbose bool
+var daemon bool
+var daemonPort string
+var verifyChain bool
 
 func setupApp() (app *cli.App) {
 	app = cli.NewApp()
 	app.Name = "hcd"
 	app.Usage = fmt.Sprintf("serve a chain to the web on localhost:<ui-port> (defaults to %s)", defaultUIPort)
-	app.ArgsUsage = "holochain-name [ui-port]"
+	app.ArgsUsage = "holochain-name [ui-port] | -daemon [holochain-name...]"
 
 	app.Version = fmt.Sprintf("0.0.4 (holochain %s)", holo.VersionStr)
 
@@ -33,6 +36,17 @@ func setupApp() (app *cli.App) {
 	var service *holo.Service
 
 	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:        "daemon",
+			Usage:       "serve all the started chains, or just the ones named, each under /<holochain-name>/",
+			Destination: &daemon,
+		},
+		cli.StringFlag{
+			Name:        "port",
+			Usage:       "ui port to use in daemon mode",
+			Value:       defaultUIPort,
+			Destination: &daemonPort,
+		},
 		cli.BoolFlag{
 			Name:        "debug",
 			Usage:       "debugging output",
@@ -48,6 +62,11 @@ func setupApp() (app *cli.App) {
 			Usage:       "verbose output",
 			Destination: &verbose,
 		},
+		cli.BoolFlag{
+			Name:        "verifyChain",
+			Usage:       "verify every header and entry of the source chain before serving",
+			Destination: &verifyChain,
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
@@ -55,6 +74,9 @@ func setupApp() (app *cli.App) {
 		if debug {
 			os.Setenv("HCLOG_APP_ENABLE", "1")
 		}
+		if verifyChain {
+			os.Setenv("HC_VERIFY_CHAIN", "1")
+		}
 		if verbose {
 			fmt.Printf("hcd version %s \n", app.Version)
 		}
@@ -71,6 +93,9 @@ func setupApp() (app *cli.App) {
 	}
 
 	app.Action = func(c *cli.Context) error {
+		if daemon {
+			return serveDaemon(service, c.Args(), daemonPort)
+		}
 		args := len(c.Args())
 		if args == 1 || args == 2 {
 			h, err := cmd.GetHolochain(c.Args().First(), service, "serve")
@@ -94,6 +119,15 @@ func setupApp() (app *cli.App) {
 
 			h.StartBackgroundTasks()
 
+			if h.Config.EnableAdmin {
+				admin := ui.NewAdminServer(h)
+				err = admin.Start()
+				if err != nil {
+					return err
+				}
+				defer admin.Stop()
+			}
+
 			fmt.Printf("Serving holochain with DNA hash:%v on port %s\n", h.DNAHash(), port)
 
 			ws := ui.NewWebServer(h, port)
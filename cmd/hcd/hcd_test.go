@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	holo "github.com/HC-Interns/holochain-proto"
 	"github.com/HC-Interns/holochain-proto/cmd"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/urfave/cli"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
@@ -40,6 +43,157 @@ func TestWeb(t *testing.T) {
 	})
 }
 
+func TestDaemon(t *testing.T) {
+	tmpTestDir, s, h, _ := setupTestingApp("testApp")
+	defer os.RemoveAll(tmpTestDir)
+	h2, err := s.MakeTestingApp(filepath.Join(s.Path, "testApp2"), "json", holo.InitializeDB, holo.CloneWithNewUUID, nil)
+	if err != nil {
+		panic(err)
+	}
+	h2.GenChain()
+
+	d := NewDaemon(s, "31416")
+	Convey("it should start chains on separate ports", t, func() {
+		So(d.StartChain("testApp"), ShouldBeNil)
+		So(d.StartChain("testApp2"), ShouldBeNil)
+		So(d.StartChain("testApp"), ShouldEqual, ErrChainAlreadyServed)
+		So(d.StartChain("bogusApp"), ShouldNotBeNil)
+		chains := d.Chains()
+		So(len(chains), ShouldEqual, 2)
+		So(chains[0].Name, ShouldEqual, "testApp")
+		So(chains[0].DNA, ShouldEqual, h.DNAHash().String())
+		So(chains[1].DNA, ShouldEqual, h2.DNAHash().String())
+		So(chains[0].DHTPort, ShouldNotEqual, chains[1].DHTPort)
+	})
+
+	Convey("it should write its port and token to the daemon file", t, func() {
+		So(d.Start(), ShouldBeNil)
+		info, err := holo.ReadDaemonInfo(s.Path)
+		So(err, ShouldBeNil)
+		So(info.Port, ShouldEqual, 31416)
+		So(info.Token, ShouldEqual, d.token)
+	})
+	time.Sleep(time.Second * 1)
+	call := func(chain string) (status int, result string) {
+		resp, err := http.Post("http://0.0.0.0:31416/"+chain+"/fn/jsSampleZome/getProperty", "", bytes.NewBuffer([]byte("language")))
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		return resp.StatusCode, string(b)
+	}
+	controlWithToken := func(token string, path string, body string) (status int, chains []ChainStatus) {
+		req, err := http.NewRequest("POST", "http://0.0.0.0:31416/_daemon/"+path, bytes.NewBuffer([]byte(body)))
+		So(err, ShouldBeNil)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		json.Unmarshal(b, &chains)
+		return resp.StatusCode, chains
+	}
+	control := func(path string, body string) (status int, chains []ChainStatus) {
+		return controlWithToken(d.token, path, body)
+	}
+
+	Convey("it should serve each chain under its own prefix", t, func() {
+		status, result := call("testApp")
+		So(status, ShouldEqual, 200)
+		So(result, ShouldEqual, "en")
+		status, result = call("testApp2")
+		So(status, ShouldEqual, 200)
+		So(result, ShouldEqual, "en")
+		status, _ = call("bogusApp")
+		So(status, ShouldEqual, 404)
+
+		resp, err := http.Get("http://0.0.0.0:31416/_metrics")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 401)
+		resp, err = http.Get("http://0.0.0.0:31416/testApp/_metrics")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 401)
+
+		req, _ := http.NewRequest("GET", "http://0.0.0.0:31416/_metrics", nil)
+		req.Header.Set("Authorization", "Bearer "+d.token)
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+		b, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `holochain_zome_call_duration_seconds_count{dna="`+h.DNAHash().String()+`",zome="jsSampleZome",function="getProperty"}`)
+		So(string(b), ShouldContainSubstring, `holochain_zome_call_duration_seconds_count{dna="`+h2.DNAHash().String()+`",zome="jsSampleZome",function="getProperty"}`)
+	})
+
+	Convey("it should refuse control requests without the token", t, func() {
+		status, _ := controlWithToken("", "stop/testApp2", "")
+		So(status, ShouldEqual, 401)
+		status, _ = controlWithToken("bogus", "stop/testApp2", "")
+		So(status, ShouldEqual, 401)
+		So(len(d.Chains()), ShouldEqual, 2)
+	})
+
+	Convey("it should stop, start and restart chains", t, func() {
+		status, chains := control("stop/testApp2", "")
+		So(status, ShouldEqual, 200)
+		So(len(chains), ShouldEqual, 1)
+		status, _ = call("testApp2")
+		So(status, ShouldEqual, 404)
+		status, _ = control("stop/testApp2", "")
+		So(status, ShouldEqual, 404)
+
+		status, chains = control("start/testApp2", "")
+		So(status, ShouldEqual, 200)
+		So(len(chains), ShouldEqual, 2)
+		status, _ = call("testApp2")
+		So(status, ShouldEqual, 200)
+
+		status, chains = control("restart/testApp", "")
+		So(status, ShouldEqual, 200)
+		So(len(chains), ShouldEqual, 2)
+		status, _ = call("testApp")
+		So(status, ShouldEqual, 200)
+	})
+
+	Convey("it should bridge co-hosted chains", t, func() {
+		status, _ := control("bridge", `{"Caller":"testApp","Callee":"testApp2","Zome":"jsSampleZome"}`)
+		So(status, ShouldEqual, 200)
+		bridges, err := d.chains["testApp"].h.GetBridges()
+		So(err, ShouldBeNil)
+		So(len(bridges), ShouldEqual, 1)
+		So(bridges[0].CalleeName, ShouldEqual, "testApp2")
+
+		status, _ = control("bridge", `{"Caller":"testApp","Callee":"bogusApp","Zome":"jsSampleZome"}`)
+		So(status, ShouldEqual, 404)
+	})
+
+	d.Stop()
+	d.Wait()
+	Convey("it should stop all the chains when stopped", t, func() {
+		So(len(d.Chains()), ShouldEqual, 0)
+		_, err := holo.ReadDaemonInfo(s.Path)
+		So(err, ShouldEqual, holo.ErrDaemonNotRunning)
+	})
+}
+
+func TestDaemonApp(t *testing.T) {
+	tmpTestDir, s, h, app := setupTestingApp("testApp")
+	defer os.RemoveAll(tmpTestDir)
+
+	Convey("it should serve all the chains in daemon mode", t, func() {
+		out, err := cmd.RunAppWithStdoutCapture(app, []string{"hcd", "-path", s.Path, "-daemon", "-port", "31417"}, 5*time.Second)
+		So(err, ShouldBeNil)
+		So(out, ShouldContainSubstring, "Serving holochain testApp with DNA hash:"+h.DNAHash().String()+" on port 31417 under /testApp/")
+	})
+}
+
 func setupTestingApp(name string) (string, *holo.Service, *holo.Holochain, *cli.App) {
 	tmpTestDir, err := ioutil.TempDir("", "holochain.testing.hcd")
 	if err != nil {
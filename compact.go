@@ -0,0 +1,84 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// compact implements the planning shared by the HashTable compaction routines, which
+// drop the payloads of long-dead entries (keeping their status as a tombstone so that
+// later changes can still be validated) and the puts in the change log that are no
+// longer needed
+
+package holochain
+
+import (
+	"time"
+)
+
+// CompactStats reports what a compaction of a HashTable removed
+type CompactStats struct {
+	Checkpoint int // put index up to which the change log has been compacted
+	Payloads   int // dead entries whose payloads were dropped
+	Puts       int // puts dropped from the change log
+}
+
+// compactPlan holds what a compaction may drop
+type compactPlan struct {
+	dead   []string     // entries whose payloads can be dropped
+	drop   []int        // indexes of the puts that can be dropped
+	forget map[int]bool // dropped puts whose fingerprints should be forgotten too
+}
+
+// heldStatusFn returns the status of a hash and whether it's held at all
+type heldStatusFn func(k string) (status int, held bool)
+
+// planCompaction works out from the change log which entries have been deleted or
+// modified since before the given time, and which puts can be dropped: the puts of those
+// entries along with the dels, mods and links made to them, puts whose changes have expired and puts of changes at addresses that are no
+// longer held. Fingerprints of puts that are no longer held are forgotten so that the
+// changes can be taken again if the address moves back into our neighborhood.
+func planCompaction(puts []Put, before time.Time, now time.Time, heldStatus heldStatusFn) (plan compactPlan) {
+	plan.forget = make(map[int]bool)
+	dead := make(map[string]bool)
+	for _, p := range puts {
+		if p.M.Type != DEL_REQUEST && p.M.Type != MOD_REQUEST {
+			continue
+		}
+		req, ok := p.M.Body.(HoldReq)
+		if !ok || !p.M.Time.Before(before) {
+			continue
+		}
+		k := req.RelatedHash.String()
+		if dead[k] {
+			continue
+		}
+		status, held := heldStatus(k)
+		if held && (status&(StatusDeleted|StatusModified)) != 0 {
+			dead[k] = true
+			plan.dead = append(plan.dead, k)
+		}
+	}
+
+	for _, p := range puts {
+		req, ok := p.M.Body.(HoldReq)
+		if !ok {
+			// peer list changes aren't held at an address
+			continue
+		}
+		if changeExpired(&p.M, now) {
+			plan.drop = append(plan.drop, p.Idx)
+			continue
+		}
+		a, _ := putAddress(&p.M)
+		if _, held := heldStatus(a.String()); !held {
+			plan.drop = append(plan.drop, p.Idx)
+			plan.forget[p.Idx] = true
+			continue
+		}
+		// the changes made to a dead entry go along with its put, as peers replaying the
+		// log couldn't fetch the entry they change
+		if p.M.Type == PUT_REQUEST && dead[req.EntryHash.String()] ||
+			isRelatedHoldMessage(&p.M) && dead[req.RelatedHash.String()] {
+			plan.drop = append(plan.drop, p.Idx)
+		}
+	}
+	return
+}
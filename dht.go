@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
@@ -30,9 +31,13 @@ type DHTConfig struct {
 	//RedundancyFactor(integer) Establishes minimum online redundancy targets for data, and size of peer sets for sync gossip. A redundancy factor ZERO means no sharding (every node syncs all data with every other node). ONE means you are running this as a centralized application and gossip is turned OFF. For most applications we recommend neighborhoods no smaller than 8 for nearness or 32 for hashmask sharding.
 	RedundancyFactor int
 
+	// HashTableType : (string) Identifies the storage backend used to hold this application's DHT data. Must be one of the types registered with RegisterHashTable (buntdb, boltdb). Defaults to buntdb which holds all data in memory, boltdb keeps data on disk but not the indexes queryDHT needs, so DNAs whose schemas declare indexFields must use buntdb.
+	HashTableType string
+
 	// ShardingMethod : Identifier for sharding method (none, XOR, hashmask, other nearness algorithms?, etc.)
 
-	// MaxLinkSets : (integer) Maximum number of results to return on a GetLinks query to keep computation and traffic to a reasonable size. You need to break these result sets into multiple "pages" of results retrieve more.
+	// MaxLinkSets : (integer) Maximum number of results to return on a GetLinks query to keep computation and traffic to a reasonable size. You need to break these result sets into multiple "pages" of results retrieve more, queries that don't ask for a page get ErrTooManyLinks rather than a partial result. ZERO means no maximum.
+	MaxLinkSets int
 
 	// ValidationTimeout : (integer) Time period in seconds, until data that needs to be validated against a source remains "alive" to keep trying to get validation from that source. If someone commits something and then goes offline, how long do they have to come back online before DHT sync requests consider that data invalid?
 
@@ -63,6 +68,19 @@ type DHT struct {
 	gchan       Channel
 	config      *DHTConfig
 	glk         sync.RWMutex
+	gossipModes map[peer.ID]GossipMode // which gossip protocol each peer understands
+	gmlk        sync.RWMutex
+	limiter     *peerLimiter     // rate limits gossip and put requests from each peer
+	gossipBacks map[peer.ID]bool // peers we have a gossip back queued for
+	gblk        sync.Mutex
+	filter      *GossipFilter // cached filter of our put fingerprints, see gossipFilter
+	filterIdx   int           // index of the last put added to the filter
+	filterCount int           // number of puts added to the filter
+	flk         sync.Mutex
+	// cached buckets of our put fingerprints, see bucketPuts
+	summaryBuckets map[int][]summaryPut
+	summaryIdx     int // index of the last put added to the buckets
+	slk            sync.Mutex
 	//	sources      map[peer.ID]bool
 	//	fingerprints map[string]bool
 }
@@ -85,6 +103,25 @@ const (
 type HoldReq struct {
 	EntryHash   Hash // hash of the entry responsible for the change
 	RelatedHash Hash // hash of the related entry (link=base,del=deleted, mod=modified by)
+	TTL         int  // seconds after the message time that the change expires, 0 for never
+}
+
+// changeExpiry returns the time at which the data changed by a message expires,
+// or the zero time if it never does
+func changeExpiry(m *Message) (t time.Time) {
+	if m == nil {
+		return
+	}
+	if req, ok := m.Body.(HoldReq); ok && req.TTL > 0 {
+		t = m.Time.Add(time.Duration(req.TTL) * time.Second)
+	}
+	return
+}
+
+// changeExpired returns true if the data changed by a message has expired by the given time
+func changeExpired(m *Message, now time.Time) bool {
+	t := changeExpiry(m)
+	return !t.IsZero() && !now.Before(t)
 }
 
 // HoldResp holds the signature and code of how a hold request was treated
@@ -113,7 +150,9 @@ type LinkQuery struct {
 	Base       Hash
 	T          string
 	StatusMask int
-	// order
+	Order      string // LinkOrderHash or LinkOrderTime
+	Limit      int    // maximum number of links per page, 0 for all
+	Cursor     string // where the previous page left off
 	// filter, etc
 }
 
@@ -127,13 +166,17 @@ type GetOptions struct {
 
 // GetLinksOptions options to holochain level GetLinks functions
 type GetLinksOptions struct {
-	Load       bool // indicates whether GetLinks should retrieve the entries of all links
-	StatusMask int  // mask of which status of links to return
+	Load       bool   // indicates whether GetLinks should retrieve the entries of all links
+	StatusMask int    // mask of which status of links to return
+	Order      string // order of the links when paging, LinkOrderHash (default) or LinkOrderTime
+	Limit      int    // maximum number of links to return, 0 for all
+	Cursor     string // Next value of the previous page of links
 }
 
 // LinkQueryResp holds response to getLinks query
 type LinkQueryResp struct {
 	Links []TaggedHash
+	Next  string // cursor for the next page of links, empty if there are no more
 }
 
 type ListAddReq struct {
@@ -152,6 +195,7 @@ const (
 )
 
 var ErrNotAcceptedByAnyRemoteNode = errors.New("Change not accepted by any remote node")
+var ErrChangeExpired = errors.New("change has expired")
 
 // NewDHT creates a new DHT structure
 func NewDHT(h *Holochain) *DHT {
@@ -222,9 +266,18 @@ func (dht *DHT) Open(options interface{}) (err error) {
 
 	indexSpec := getIndexSpec(h.Nucleus().DNA().Zomes)
 
-	dht.ht = &BuntHT{}
-	dht.ht.Open(filepath.Join(h.DBPath(), DHTStoreFileName))
-	RegisterIndexSpec(dht.ht.(*BuntHT), indexSpec)
+	dht.ht, err = CreateHashTable(dht.config.HashTableType)
+	if err != nil {
+		return
+	}
+	err = dht.ht.Open(filepath.Join(h.DBPath(), DHTStoreFileName))
+	if err != nil {
+		return
+	}
+	// custom indexes for queryDHT are only supported by the buntdb store
+	if bunt, ok := dht.ht.(*BuntHT); ok {
+		RegisterIndexSpec(bunt, indexSpec)
+	}
 	dht.retryQueue = make(chan *retry, 100)
 	dht.changeQueue = make(Channel, 1000)
 	//go dht.HandleChangeRequests()
@@ -233,6 +286,9 @@ func (dht *DHT) Open(options interface{}) (err error) {
 	//	dht.fingerprints = make(map[string]bool)
 	dht.gchan = make(Channel, GossipWithQueueSize)
 	dht.gossipPuts = make(Channel, GossipPutQueueSize)
+	dht.gossipModes = make(map[peer.ID]GossipMode)
+	dht.limiter = newPeerLimiter(h.Config.GossipRateLimit, h.Config.GossipBurst)
+	dht.gossipBacks = make(map[peer.ID]bool)
 	return
 }
 
@@ -365,6 +421,18 @@ func (dht *DHT) GetLinks(base Hash, tag string, statusMask int) (results []Tagge
 	return
 }
 
+// GetLinksPage retrieves a page of the links on a base, capping the page size at the
+// configured MaxLinkSets
+func (dht *DHT) GetLinksPage(base Hash, tag string, statusMask int, page LinkPage) (results []TaggedHash, next string, err error) {
+	max := dht.config.MaxLinkSets
+	if max > 0 && (page.Limit == 0 || page.Limit > max) {
+		page.Limit = max
+	}
+	dht.dlog.Logf("getLinks on %v of %s with mask %d, order %s, limit %d after %s", base, tag, statusMask, page.Order, page.Limit, page.Cursor)
+	results, next, err = dht.ht.GetLinksPage(base, tag, statusMask, page)
+	return
+}
+
 // HandleChangeRequests waits on a channel for dht change requests
 func (dht *DHT) HandleChangeRequests() (err error) {
 	err = dht.handleTillDone("HandleChangeRequests", dht.changeQueue, handleChangeRequests)
@@ -413,6 +481,52 @@ func (dht *DHT) sendChange(p peer.ID, msg *Message) (held bool, err error) {
 	return
 }
 
+// handoff re-sends the changes we received for a hash that is no longer in our
+// neighborhood to the nodes closest to it, and forgets the hash once one of them
+// has taken it
+func (dht *DHT) handoff(hash Hash) (err error) {
+	var puts []Put
+	puts, err = dht.GetPuts(0)
+	if err != nil {
+		return
+	}
+	// the original messages must be sent so that the receivers can validate
+	// the changes against their sources
+	var msgs []Message
+	for _, p := range puts {
+		a, e := putAddress(&p.M)
+		if e == nil && a == hash {
+			msgs = append(msgs, p.M)
+		}
+	}
+	if len(msgs) == 0 {
+		dht.dlog.Logf("handoff: no changes recorded for %v, keeping it", hash)
+		return
+	}
+
+	var held bool
+	for _, p := range dht.h.node.nearestPeersToHash(&hash, dht.h.RedundancyFactor()) {
+		if p == dht.h.nodeID {
+			continue
+		}
+		for i := range msgs {
+			wasHeld, e := dht.sendChange(p, &msgs[i])
+			if e != nil {
+				dht.dlog.Logf("handoff: sending %v to %v failed: %v", msgs[i].Type, p, e)
+				break
+			}
+			if wasHeld && msgs[i].Type == PUT_REQUEST {
+				held = true
+			}
+		}
+	}
+	if held {
+		dht.dlog.Logf("handoff: forgetting %v", hash)
+		err = dht.ht.Forget(hash)
+	}
+	return
+}
+
 func (dht *DHT) change(req changeReq) (err error) {
 	key := req.key
 	msg := &req.msg
@@ -450,11 +564,20 @@ func (dht *DHT) change(req changeReq) (err error) {
 	return
 }
 
-// Change sends DHT change messages to the closest peers to the hash in question
-func (dht *DHT) Change(key Hash, msgType MsgType, body interface{}) (err error) {
+// Change sends DHT change messages to the closest peers to the hash in question, recording
+// them under the span of the trace given
+func (dht *DHT) Change(trace SpanContext, key Hash, msgType MsgType, body interface{}) (err error) {
 	dht.h.Debugf("Starting %v Change for %v with body %v", msgType, key, body)
 
+	span := dht.h.tracer.StartSpan("change "+msgType.String(), trace)
+	span.SetAttribute("key", key.String())
+	defer func() {
+		span.Finish(err)
+	}()
+
 	msg := dht.h.node.NewMessage(msgType, body)
+	// the queued sends to other nodes are part of this change
+	msg.Trace = span.Context()
 	// change in our local DHT
 	_, err = dht.send(nil, dht.h.nodeID, msg)
 	if err != nil {
@@ -470,10 +593,11 @@ func (dht *DHT) Change(key Hash, msgType MsgType, body interface{}) (err error)
 }
 
 // Query sends DHT query messages recursively to peers until one is able to respond.
-func (dht *DHT) Query(key Hash, msgType MsgType, body interface{}) (response interface{}, err error) {
+func (dht *DHT) Query(trace SpanContext, key Hash, msgType MsgType, body interface{}) (response interface{}, err error) {
 	dht.h.Debugf("Starting %v Query for %v with body %v", msgType, key, body)
 
 	msg := dht.h.node.NewMessage(msgType, body)
+	msg.Trace = trace
 	// try locally first
 	response, err = dht.send(nil, dht.h.nodeID, msg)
 	if err == nil {
@@ -614,6 +738,7 @@ func RetryTask(h *Holochain) {
 	dht := h.dht
 	if dht != nil && len(dht.retryQueue) > 0 {
 		r := <-dht.retryQueue
+		metricRetryQueueDepth.Set(float64(len(dht.retryQueue)), dht.h.dnaHash.String())
 		if r.retries > 0 {
 			resp, err := actionReceiver(dht.h, &r.msg, r.retries-1)
 			dht.dlog.Logf("retry %d of %v, response: %d error: %v", r.retries, r.msg, resp, err)
@@ -623,6 +748,66 @@ func RetryTask(h *Holochain) {
 	}
 }
 
+// Compact drops the payloads of entries deleted or modified before the given time and
+// the puts in the change log that are no longer needed
+func (dht *DHT) Compact(before time.Time) (stats CompactStats, err error) {
+	stats, err = dht.ht.Compact(before)
+	if err == nil {
+		// the filter would still claim the dropped puts
+		dht.resetGossipFilter()
+		dht.resetBucketPuts()
+		dht.dlog.LogWith(LogFields{"checkpoint": stats.Checkpoint, "payloads": stats.Payloads, "puts": stats.Puts}, "compacted")
+	}
+	return
+}
+
+// GetCheckpoint returns the index up to which the change log has been compacted
+func (dht *DHT) GetCheckpoint() (idx int, err error) {
+	idx, err = dht.ht.GetCheckpoint()
+	return
+}
+
+// ExpiryTask removes the entries and links whose TTL has run out
+func ExpiryTask(h *Holochain) {
+	dht := h.dht
+	if dht != nil {
+		swept, err := dht.ht.Sweep(time.Now())
+		if err != nil {
+			dht.dlog.Logf("expiry sweep failed: %v", err)
+		} else if swept > 0 {
+			dht.dlog.LogWith(LogFields{"swept": swept}, "expiry sweep")
+		}
+	}
+}
+
+// HandoffTask hands off and forgets the hashes that have left our neighborhood.  It uses
+// the world model if it's enabled and the routing table otherwise, so it runs whether or
+// not the world model is.
+func HandoffTask(h *Holochain) {
+	dht := h.dht
+	// to protect against crashes from background routines after close
+	if dht == nil || h.RedundancyFactor() <= 1 {
+		return
+	}
+	for _, hash := range myHashes(h) {
+		if hash.String() == h.dnaHash.String() {
+			continue
+		}
+		responsible, err := h.IsResponsible(hash)
+		if err != nil || responsible {
+			continue
+		}
+		// to protect against crashes from background routines after close
+		if h.node == nil {
+			return
+		}
+		err = dht.handoff(hash)
+		if err != nil {
+			dht.dlog.Logf("HandoffTask: handoff of %v failed: %v", hash, err)
+		}
+	}
+}
+
 // MakeReceiptData converts a message and a code into signable data
 func MakeReceiptData(msg *Message, code int) (reciept []byte, err error) {
 	var data []byte
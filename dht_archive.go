@@ -0,0 +1,180 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// dht_archive implements exporting the data a node holds for a DHT to a portable archive
+// and importing it again, for moving a node to a new machine or seeding test networks
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+)
+
+const (
+	// DHTArchiveVersion is the version of the archive format written by Export
+	DHTArchiveVersion = 1
+)
+
+// DHTArchive is a portable copy of the entries, links and change log a node holds.  Only
+// the change log gets imported, the entries and links are there to inspect.
+type DHTArchive struct {
+	Version int
+	DNAHash string
+	Entries []ArchivedEntry
+	Links   []ArchivedLink
+	Puts    []ArchivedPut
+}
+
+// ArchivedEntry holds an entry with its status and source
+type ArchivedEntry struct {
+	Hash       string
+	EntryType  string
+	Value      []byte // the entry as stored, empty for compacted tombstones
+	Status     int
+	Source     string
+	ReplacedBy string `json:",omitempty"`
+	Expires    int64  `json:",omitempty"` // nanoseconds since epoch
+}
+
+// ArchivedLink holds all the linking events of a link
+type ArchivedLink struct {
+	Base   string
+	Link   string
+	Tag    string
+	Events []linkEvent
+}
+
+// ArchivedPut holds a put of the gossip change log
+type ArchivedPut struct {
+	Idx     int
+	Message []byte // the encoded message that made the change
+}
+
+// DHTImportStats reports the results of an import
+type DHTImportStats struct {
+	Entries  int // entries that passed validation and were imported
+	Rejected int // changes that failed validation
+	Skipped  int // changes that expired, aren't in our neighborhood, change entries we don't hold or couldn't be checked with their source
+	Links    int // links changes imported
+	Puts     int // changes added to the change log
+}
+
+var ErrDHTArchiveVersion = errors.New("unsupported DHT archive version")
+var ErrDHTArchiveWrongDNA = errors.New("DHT archive is for a different DNA")
+
+// Export writes the data held in the DHT to an archive
+func (dht *DHT) Export(w io.Writer) (err error) {
+	var archive DHTArchive
+	archive, err = dht.ht.Export()
+	if err != nil {
+		return
+	}
+	archive.Version = DHTArchiveVersion
+	archive.DNAHash = dht.h.DNAHash().String()
+	err = json.NewEncoder(w).Encode(archive)
+	return
+}
+
+// Import reads an archive written by Export and replays its change log, in order, the
+// same way puts received by gossip are: each change is checked with its source, whose
+// entries, headers and validation packages are validated, and the status of entries and
+// their links are rebuilt from the changes. Nothing else in the archive is trusted, so
+// its entries and links are only there to inspect.
+func (dht *DHT) Import(r io.Reader) (stats DHTImportStats, err error) {
+	var archive DHTArchive
+	err = json.NewDecoder(r).Decode(&archive)
+	if err != nil {
+		return
+	}
+	if archive.Version < 1 || archive.Version > DHTArchiveVersion {
+		err = ErrDHTArchiveVersion
+		return
+	}
+	if archive.DNAHash != dht.h.DNAHash().String() {
+		err = ErrDHTArchiveWrongDNA
+		return
+	}
+
+	sort.Slice(archive.Puts, func(i, j int) bool { return archive.Puts[i].Idx < archive.Puts[j].Idx })
+	for _, p := range archive.Puts {
+		var m Message
+		err = ByteDecoder(p.Message, &m)
+		if err != nil {
+			return
+		}
+		var f Hash
+		f, err = m.Fingerprint()
+		if err != nil {
+			return
+		}
+		var have bool
+		have, err = dht.HaveFingerprint(f)
+		if err != nil {
+			return
+		}
+		if have {
+			continue
+		}
+		err = dht.importChange(&m, f, &stats)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// importChange replays a change from an archive's change log and counts what came of it
+func (dht *DHT) importChange(m *Message, f Hash, stats *DHTImportStats) (err error) {
+	if changeExpired(m, time.Now()) || !dht.inNeighborhood(m) {
+		stats.Skipped++
+		return
+	}
+	req, held := m.Body.(HoldReq)
+	if held && isRelatedHoldMessage(m) && dht.Exists(req.RelatedHash, StatusDefault) != nil {
+		// the change is to an entry that wasn't imported
+		dht.dlog.Logf("import: %v changes %v which isn't held", m.Type, req.RelatedHash)
+		stats.Skipped++
+		return
+	}
+
+	_, e := actionReceiver(dht.h, m, 0)
+	if e != nil {
+		dht.dlog.Logf("import: %v of %v failed: %v", m.Type, req.EntryHash, e)
+		if IsValidationFailedErr(e) {
+			stats.Rejected++
+		} else {
+			stats.Skipped++
+		}
+		return
+	}
+	var recorded bool
+	recorded, err = dht.HaveFingerprint(f)
+	if err != nil || !recorded {
+		stats.Skipped++
+		return
+	}
+	stats.Puts++
+	switch m.Type {
+	case PUT_REQUEST:
+		var status int
+		_, _, _, status, err = dht.Get(req.EntryHash, StatusAny, GetMaskEntryType)
+		if err != nil {
+			return
+		}
+		if status == StatusRejected {
+			stats.Rejected++
+		} else {
+			stats.Entries++
+		}
+	case LINK_REQUEST:
+		stats.Links++
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package holochain
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDHTExportImport(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+
+	h0 := nodes[0]
+	h1 := nodes[1]
+
+	hash := commit(h0, "evenNumbers", "2")
+	profileHash := commit(h0, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+
+	var archive DHTArchive
+	Convey("Export should write a versioned archive of the DHT", t, func() {
+		var buf bytes.Buffer
+		err := h0.dht.Export(&buf)
+		So(err, ShouldBeNil)
+		err = json.Unmarshal(buf.Bytes(), &archive)
+		So(err, ShouldBeNil)
+		So(archive.Version, ShouldEqual, DHTArchiveVersion)
+		So(archive.DNAHash, ShouldEqual, h0.DNAHash().String())
+		So(len(archive.Entries), ShouldBeGreaterThan, 0)
+		idx, _ := h0.dht.GetIdx()
+		So(len(archive.Puts), ShouldEqual, idx)
+	})
+
+	archiveBytes := func(a DHTArchive) *bytes.Buffer {
+		b, err := json.Marshal(a)
+		if err != nil {
+			panic(err)
+		}
+		return bytes.NewBuffer(b)
+	}
+
+	Convey("Import should reject archives of other versions or DNAs", t, func() {
+		a := archive
+		a.Version = DHTArchiveVersion + 1
+		_, err := h1.dht.Import(archiveBytes(a))
+		So(err, ShouldEqual, ErrDHTArchiveVersion)
+
+		a = archive
+		a.DNAHash = profileHash.String()
+		_, err = h1.dht.Import(archiveBytes(a))
+		So(err, ShouldEqual, ErrDHTArchiveWrongDNA)
+	})
+
+	ringConnect(t, mt.ctx, nodes, nodesCount)
+
+	Convey("Import should replay the change log, validating the changes with their sources", t, func() {
+		// an entry on h0's chain that doesn't pass the app's validation
+		bogusHash, _, err := h0.NewEntry(time.Now(), "evenNumbers", &GobEntry{C: "3"})
+		So(err, ShouldBeNil)
+		// and an entry h0 doesn't have at all
+		unknown := GobEntry{C: "4"}
+		unknownHash, _ := unknown.Sum(h0.hashSpec)
+
+		a := archive
+		a.Puts = append([]ArchivedPut{}, archive.Puts...)
+		idx := len(a.Puts)
+		for _, hash := range []Hash{bogusHash, unknownHash} {
+			idx++
+			b, _ := ByteEncoder(h0.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash}))
+			a.Puts = append(a.Puts, ArchivedPut{Idx: idx, Message: b})
+		}
+		// what the archive says about the entries isn't trusted
+		a.Entries = nil
+		for _, e := range archive.Entries {
+			if e.Hash == hash.String() {
+				e.Status = StatusDeleted
+			}
+			a.Entries = append(a.Entries, e)
+		}
+		u, _ := unknown.Marshal()
+		a.Entries = append(a.Entries, ArchivedEntry{Hash: unknownHash.String(), EntryType: "evenNumbers", Value: u, Status: StatusLive, Source: h0.nodeIDStr})
+
+		So(h1.dht.Exists(hash, StatusLive), ShouldEqual, ErrHashNotFound)
+		stats, err := h1.dht.Import(archiveBytes(a))
+		So(err, ShouldBeNil)
+		So(stats.Rejected, ShouldEqual, 1)
+		So(stats.Skipped, ShouldEqual, 1)
+		So(stats.Puts, ShouldEqual, len(archive.Puts)+1)
+
+		So(h1.dht.Exists(hash, StatusLive), ShouldBeNil)
+		So(h1.dht.Exists(profileHash, StatusLive), ShouldBeNil)
+		So(h1.dht.Exists(bogusHash, StatusRejected), ShouldBeNil)
+		So(h1.dht.Exists(unknownHash, StatusAny), ShouldEqual, ErrHashNotFound)
+
+		data, _, _, _, err := h1.dht.Get(hash, StatusLive, GetMaskEntry)
+		So(err, ShouldBeNil)
+		var e GobEntry
+		e.Unmarshal(data)
+		So(e.C, ShouldEqual, "2")
+
+		// the change log of the imported entries can be gossiped on
+		puts, _ := h1.dht.GetPuts(0)
+		var found bool
+		for _, p := range puts {
+			if req, ok := p.M.Body.(HoldReq); ok && p.M.Type == PUT_REQUEST && req.EntryHash == hash {
+				found = true
+			}
+		}
+		So(found, ShouldBeTrue)
+	})
+
+	Convey("sources should only be able to send back the entries at the hashes asked about", t, func() {
+		resp, err := h0.GetValidationResponse(&ActionPut{}, hash)
+		So(err, ShouldBeNil)
+		So(checkValidateResponse(h0, hash, &resp), ShouldBeNil)
+		So(checkValidateResponse(h0, profileHash, &resp), ShouldEqual, ErrEntryHashMismatch)
+		resp.Entry.C = "4"
+		So(checkValidateResponse(h0, hash, &resp), ShouldEqual, ErrEntryHashMismatch)
+
+		resp, err = h0.GetValidationResponse(&ActionPut{}, HashFromPeerID(h0.nodeID))
+		So(err, ShouldBeNil)
+		So(checkValidateResponse(h0, HashFromPeerID(h0.nodeID), &resp), ShouldBeNil)
+		So(checkValidateResponse(h0, HashFromPeerID(h1.nodeID), &resp), ShouldEqual, ErrEntryHashMismatch)
+	})
+
+	Convey("importing again should add nothing new to the change log", t, func() {
+		idx, _ := h1.dht.GetIdx()
+		_, err := h1.dht.Import(archiveBytes(archive))
+		So(err, ShouldBeNil)
+		afterIdx, _ := h1.dht.GetIdx()
+		So(afterIdx, ShouldEqual, idx)
+	})
+}
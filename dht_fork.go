@@ -0,0 +1,123 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// detection of agents that publish divergent source chains, by tracking the headers of the
+// entries held for each agent and looking for two that follow the same previous header
+
+package holochain
+
+import (
+	"fmt"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// agentKey returns an agent's public key, from the peerstore if we've been connected to
+// the agent or else from its key entry on the DHT, which then gets added to the peerstore
+func (dht *DHT) agentKey(agent peer.ID) (key ic.PubKey, err error) {
+	key = dht.h.node.host.Peerstore().PubKey(agent)
+	if key != nil {
+		return
+	}
+	key, err = dht.h.getNodePubKey(agent)
+	if err == ErrHashNotFound {
+		// the key entry may just not have reached us yet, so this gets retried
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to get key of %v: %v", agent, err)
+		return
+	}
+	err = dht.h.node.host.Peerstore().AddPubKey(agent, key)
+	return
+}
+
+// signedBy returns true if the header was signed by the agent, so that a header built by
+// someone else around one of the agent's entries can't be taken for part of its chain.
+// It returns an error if the agent's key can't be found to check the signature.
+func (dht *DHT) signedBy(agent peer.ID, header *Header) (signed bool, err error) {
+	var key ic.PubKey
+	key, err = dht.agentKey(agent)
+	if err != nil {
+		return
+	}
+	signed, err = header.VerifySig(dht.h.hashSpec, key)
+	if err == nil && !signed {
+		dht.dlog.Logf("header of %v not signed by %v", header.EntryLink, agent)
+	}
+	return
+}
+
+// findFork returns the header already recorded for an agent as following the same header as
+// the given one, if it's a different header signed by the agent, i.e. the agent's chain has
+// forked.  Legacy headers don't sign their links to the previous header, so only fully
+// signed headers can show a fork.
+func (dht *DHT) findFork(agent peer.ID, header *Header) (fork *Header, err error) {
+	// the key entry is put without a header
+	if header.EntryLink == "" || !header.FullySigned() {
+		return
+	}
+	var signed bool
+	signed, err = dht.signedBy(agent, header)
+	if err != nil || !signed {
+		return
+	}
+	var held Header
+	held, err = dht.ht.GetAgentHeader(agent, header.HeaderLink)
+	if err == ErrHashNotFound {
+		err = nil
+		return
+	}
+	if err != nil || !held.FullySigned() {
+		return
+	}
+	var heldHash, hash Hash
+	heldHash, _, err = held.Sum(dht.h.hashSpec)
+	if err != nil {
+		return
+	}
+	hash, _, err = header.Sum(dht.h.hashSpec)
+	if err != nil {
+		return
+	}
+	if !heldHash.Equal(hash) {
+		fork = &held
+	}
+	return
+}
+
+// holdHeader records the header of an entry held for an agent and, if the header forks the
+// agent's chain, moves the entry of the other header to the forked status and warrants
+// against the agent.  Only headers the agent signed are recorded.
+func (dht *DHT) holdHeader(agent peer.ID, header *Header, fork *Header) (err error) {
+	if header.EntryLink == "" {
+		return
+	}
+	var signed bool
+	signed, err = dht.signedBy(agent, header)
+	if err != nil || !signed {
+		return
+	}
+	err = dht.ht.PutAgentHeader(agent, header)
+	if err != nil || fork == nil {
+		return
+	}
+	dht.dlog.Logf("chain of %v forked after %v by %v and %v", agent, header.HeaderLink, fork.EntryLink, header.EntryLink)
+	if dht.ht.Exists(fork.EntryLink, StatusLive) == nil {
+		err = dht.ht.Fork(fork.EntryLink)
+		if err != nil {
+			return
+		}
+	}
+	dht.h.warrantChainFork(agent, fork, header)
+	return
+}
+
+// AgentHead returns the latest header held for an agent
+func (dht *DHT) AgentHead(agent peer.ID) (header Header, err error) {
+	header, err = dht.ht.GetAgentHead(agent)
+	return
+}
@@ -0,0 +1,183 @@
+package holochain
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	b58 "github.com/jbenet/go-base58"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testHTAgentHeaders(ht HashTable) {
+	node, err := makeNode(1234, "")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+	id := node.HashAddr
+	link, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	entry1, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+	entry2, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh4")
+	now := time.Unix(1, 0)
+
+	_, err = ht.GetAgentHead(id)
+	So(err, ShouldEqual, ErrHashNotFound)
+	_, err = ht.GetAgentHeader(id, link)
+	So(err, ShouldEqual, ErrHashNotFound)
+
+	header1 := Header{Type: "someType", Time: now, HeaderLink: link, EntryLink: entry1}
+	So(ht.PutAgentHeader(id, &header1), ShouldBeNil)
+	header, err := ht.GetAgentHeader(id, link)
+	So(err, ShouldBeNil)
+	So(header.EntryLink.String(), ShouldEqual, entry1.String())
+	header, err = ht.GetAgentHead(id)
+	So(err, ShouldBeNil)
+	So(header.EntryLink.String(), ShouldEqual, entry1.String())
+
+	// the first header following a link is kept and the newest header is the head
+	header2 := Header{Type: "someType", Time: now.Add(time.Second), HeaderLink: link, EntryLink: entry2}
+	So(ht.PutAgentHeader(id, &header2), ShouldBeNil)
+	header, err = ht.GetAgentHeader(id, link)
+	So(err, ShouldBeNil)
+	So(header.EntryLink.String(), ShouldEqual, entry1.String())
+	header, err = ht.GetAgentHead(id)
+	So(err, ShouldBeNil)
+	So(header.EntryLink.String(), ShouldEqual, entry2.String())
+	So(header.Time.Equal(header2.Time), ShouldBeTrue)
+
+	So(ht.PutAgentHeader(id, &header1), ShouldBeNil)
+	header, err = ht.GetAgentHead(id)
+	So(err, ShouldBeNil)
+	So(header.EntryLink.String(), ShouldEqual, entry2.String())
+
+	// forking an entry doesn't record a change
+	So(ht.Fork(entry1), ShouldEqual, ErrHashNotFound)
+	So(ht.Put(node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: entry1}), "someType", entry1, id, []byte("some value"), StatusLive), ShouldBeNil)
+	idx, _ := ht.GetIdx()
+	So(ht.Fork(entry1), ShouldBeNil)
+	afterIdx, _ := ht.GetIdx()
+	So(afterIdx, ShouldEqual, idx)
+	_, _, _, status, err := ht.Get(entry1, StatusAny, GetMaskDefault)
+	So(err, ShouldBeNil)
+	So(status, ShouldEqual, StatusForked)
+	_, _, _, _, err = ht.Get(entry1, StatusLive, GetMaskDefault)
+	So(err, ShouldEqual, ErrHashNotFound)
+	_, _, _, _, err = ht.Get(entry1, StatusDefault, GetMaskDefault)
+	So(err, ShouldEqual, ErrHashForked)
+}
+
+func TestHTAgentHeaders(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+
+	Convey("BuntHT should record agent headers", t, func() {
+		ht := &BuntHT{}
+		ht.Open(filepath.Join(d, "bunt-"+DHTStoreFileName))
+		defer ht.Close()
+		testHTAgentHeaders(ht)
+	})
+
+	Convey("BoltHT should record agent headers", t, func() {
+		ht := &BoltHT{}
+		ht.Open(filepath.Join(d, "bolt-"+DHTStoreFileName))
+		defer ht.Close()
+		testHTAgentHeaders(ht)
+	})
+}
+
+func TestDHTForks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	pid, privKey := makePeer("peer1")
+	h.node.host.Peerstore().AddPubKey(pid, privKey.GetPublic())
+
+	prev := h.chain.Top()
+	prevHash, _, _ := prev.Sum(h.hashSpec)
+	now := time.Now()
+	_, header1, _ := newHeader(h.hashSpec, now, "evenNumbers", &GobEntry{C: "2"}, privKey, prevHash, NullHash(), NullHash())
+	_, header2, _ := newHeader(h.hashSpec, now.Add(time.Second), "evenNumbers", &GobEntry{C: "4"}, privKey, prevHash, NullHash(), NullHash())
+	entry := GobEntry{C: "2"}
+	b, _ := entry.Marshal()
+	m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: header1.EntryLink})
+	err := h.dht.Put(m, "evenNumbers", header1.EntryLink, pid, b, StatusLive)
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("the first header following a header should not be a fork", t, func() {
+		fork, err := h.dht.findFork(pid, header1)
+		So(err, ShouldBeNil)
+		So(fork, ShouldBeNil)
+		So(h.dht.holdHeader(pid, header1, fork), ShouldBeNil)
+		fork, err = h.dht.findFork(pid, header1)
+		So(err, ShouldBeNil)
+		So(fork, ShouldBeNil)
+		head, err := h.dht.AgentHead(pid)
+		So(err, ShouldBeNil)
+		So(head.EntryLink.String(), ShouldEqual, header1.EntryLink.String())
+	})
+
+	Convey("a different header following the same header should be a fork", t, func() {
+		fork, err := h.dht.findFork(pid, header2)
+		So(err, ShouldBeNil)
+		So(fork, ShouldNotBeNil)
+		So(fork.EntryLink.String(), ShouldEqual, header1.EntryLink.String())
+	})
+
+	Convey("a header the agent didn't sign should not be a fork or be held", t, func() {
+		_, otherKey := makePeer("peer2")
+		_, forged, _ := newHeader(h.hashSpec, now.Add(time.Second), "evenNumbers", &GobEntry{C: "6"}, otherKey, prevHash, NullHash(), NullHash())
+		fork, err := h.dht.findFork(pid, forged)
+		So(err, ShouldBeNil)
+		So(fork, ShouldBeNil)
+		So(h.dht.holdHeader(pid, forged, fork), ShouldBeNil)
+		head, err := h.dht.AgentHead(pid)
+		So(err, ShouldBeNil)
+		So(head.EntryLink.String(), ShouldEqual, header1.EntryLink.String())
+	})
+
+	Convey("the key of an agent we aren't connected to should come from the DHT", t, func() {
+		pid3, privKey3 := makePeer("peer3")
+		_, header3, _ := newHeader(h.hashSpec, now, "evenNumbers", &GobEntry{C: "8"}, privKey3, prevHash, NullHash(), NullHash())
+		_, err := h.dht.findFork(pid3, header3)
+		So(err, ShouldEqual, ErrHashNotFound)
+		So(h.dht.holdHeader(pid3, header3, nil), ShouldEqual, ErrHashNotFound)
+
+		pk, _ := ic.MarshalPublicKey(privKey3.GetPublic())
+		keyEntry := GobEntry{C: b58.Encode(pk)}
+		b, _ := keyEntry.Marshal()
+		keyHash := HashFromPeerID(pid3)
+		m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: keyHash})
+		So(h.dht.Put(m, KeyEntryType, keyHash, pid3, b, StatusLive), ShouldBeNil)
+		signed, err := h.dht.signedBy(pid3, header3)
+		So(err, ShouldBeNil)
+		So(signed, ShouldBeTrue)
+	})
+
+	Convey("holding a forking header should mark the other entry forked and block the agent", t, func() {
+		fork, _ := h.dht.findFork(pid, header2)
+		So(h.dht.holdHeader(pid, header2, fork), ShouldBeNil)
+		_, _, _, status, err := h.dht.Get(header1.EntryLink, StatusAny, GetMaskDefault)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, StatusForked)
+		head, err := h.dht.AgentHead(pid)
+		So(err, ShouldBeNil)
+		So(head.EntryLink.String(), ShouldEqual, header2.EntryLink.String())
+
+		processChangeRequestsInTesting(h)
+		So(h.node.IsBlocked(pid), ShouldBeTrue)
+	})
+
+	Convey("getting a forked entry should need the forked status in the mask", t, func() {
+		req := GetReq{H: header1.EntryLink, StatusMask: StatusDefault, GetMask: GetMaskEntry}
+		_, err := callGet(h, req, &GetOptions{GetMask: req.GetMask})
+		So(err, ShouldEqual, ErrHashForked)
+		req.StatusMask = StatusForked
+		rsp, err := callGet(h, req, &GetOptions{GetMask: req.GetMask})
+		So(err, ShouldBeNil)
+		So(rsp.(GetResp).Entry.C, ShouldEqual, "2")
+	})
+}
@@ -27,6 +27,28 @@ func TestNewDHT(t *testing.T) {
 		So(FileExists(h.DBPath(), DHTStoreFileName), ShouldBeTrue)
 		So(dht.h, ShouldEqual, h)
 		So(dht.config, ShouldEqual, &h.nucleus.dna.DHTConfig)
+		_, ok := dht.ht.(*BuntHT)
+		So(ok, ShouldBeTrue)
+		dht.ht.Close()
+	})
+
+	Convey("It should use the HashTable type specified in the DNA", t, func() {
+		os.Remove(filepath.Join(h.DBPath(), DHTStoreFileName))
+		h.nucleus.dna.DHTConfig.HashTableType = BoltHTType
+		defer func() { h.nucleus.dna.DHTConfig.HashTableType = "" }()
+		dht := NewDHT(h)
+		So(FileExists(h.DBPath(), DHTStoreFileName), ShouldBeTrue)
+		_, ok := dht.ht.(*BoltHT)
+		So(ok, ShouldBeTrue)
+		dht.ht.Close()
+	})
+
+	Convey("DNAs declaring queryDHT indexes should only load with buntdb", t, func() {
+		So(h.nucleus.dna.check(), ShouldBeNil)
+		h.nucleus.dna.DHTConfig.HashTableType = BoltHTType
+		defer func() { h.nucleus.dna.DHTConfig.HashTableType = "" }()
+		err := h.nucleus.dna.check()
+		So(err.Error(), ShouldEqual, "DNA declares queryDHT indexFields, which the boltdb HashTable doesn't support")
 	})
 }
 
@@ -171,7 +193,7 @@ func TestDHTQueryGet(t *testing.T) {
 	// pick a distant node that has to do some of the recursive lookups to get back to node 0.
 	Convey("Kademlia GET_REQUEST should return content", t, func() {
 		h2 := mt.nodes[nodesCount-2]
-		r, err := h2.dht.Query(hash, GET_REQUEST, GetReq{H: hash, StatusMask: StatusLive})
+		r, err := h2.dht.Query(SpanContext{}, hash, GET_REQUEST, GetReq{H: hash, StatusMask: StatusLive})
 		So(err, ShouldBeNil)
 		resp := r.(GetResp)
 		So(fmt.Sprintf("%v", resp.Entry), ShouldEqual, fmt.Sprintf("%v", e))
@@ -220,7 +242,7 @@ func TestDHTKadPut(t *testing.T) {
 		rtp := h.node.routingTable.NearestPeers(hash, AlphaValue)
 		// check that our routing table doesn't contain closest node yet
 		So(fmt.Sprintf("%v", rtp), ShouldEqual, "[<peer.ID UfY4We> <peer.ID dxxuES>]")
-		err := h.dht.Change(hash, PUT_REQUEST, HoldReq{EntryHash: hash})
+		err := h.dht.Change(SpanContext{}, hash, PUT_REQUEST, HoldReq{EntryHash: hash})
 		So(err, ShouldBeNil)
 
 		processChangeRequestsInTesting(h)
@@ -386,6 +408,29 @@ func TestActionReceiver(t *testing.T) {
 		So(l4star.T, ShouldEqual, "4stars")
 	})
 
+	Convey("GETLINK_REQUEST over MaxLinkSets links should only be answered in pages", t, func() {
+		h.dht.config.MaxLinkSets = 1
+		defer func() { h.dht.config.MaxLinkSets = 0 }()
+		mq := LinkQuery{Base: hash, T: ""}
+		m := h.node.NewMessage(GETLINK_REQUEST, mq)
+		_, err := ActionReceiver(h, m)
+		So(err, ShouldEqual, ErrTooManyLinks)
+
+		mq.Limit = 5
+		m = h.node.NewMessage(GETLINK_REQUEST, mq)
+		r, err := ActionReceiver(h, m)
+		So(err, ShouldBeNil)
+		results := r.(*LinkQueryResp)
+		So(len(results.Links), ShouldEqual, 1)
+		So(results.Next, ShouldNotEqual, "")
+
+		mq = LinkQuery{Base: hash, T: "4stars"}
+		m = h.node.NewMessage(GETLINK_REQUEST, mq)
+		r, err = ActionReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(len(r.(*LinkQueryResp).Links), ShouldEqual, 1)
+	})
+
 	Convey("GOSSIP_REQUEST should request and advertise data by idx", t, func() {
 		g := GossipReq{MyIdx: 1, YourIdx: 2}
 		m := h.node.NewMessage(GOSSIP_REQUEST, g)
@@ -456,7 +501,7 @@ func TestActionReceiver(t *testing.T) {
 	Convey("DELETE_REQUEST should set status of hash to deleted", t, func() {
 		entry := DelEntry{Hash: hash2, Message: "expired"}
 		a := NewDelAction(entry)
-		_, err := h.doCommit(a, NullHash())
+		_, err := h.doCommit(SpanContext{}, a, NullHash())
 		entryHash := a.header.EntryLink
 		m := h.node.NewMessage(DEL_REQUEST, HoldReq{RelatedHash: hash2, EntryHash: entryHash})
 		r, err := ActionReceiver(h, m)
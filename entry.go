@@ -41,6 +41,8 @@ type EntryDef struct {
 	DataFormat string
 	Sharing    string
 	Schema     string
+	TTL        int         // seconds that entries of this type are held on the DHT, 0 for forever
+	Rules      *EntryRules // validation rules checked before the zome's validation functions
 	validator  SchemaValidator
 }
 
@@ -0,0 +1,331 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements the validation rules an entry type can declare in the DNA, so the common
+// checks don't need validation functions written for them in the zome's code.  The rules
+// get checked when entries of the type are validated, before the zome's validation
+// functions get called, or instead of them if the rules are all the entry type needs.
+
+package holochain
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// EntryRules are the validation rules of an entry type
+type EntryRules struct {
+	Immutable    bool      // entries can't be modified or deleted
+	AuthorOnly   bool      // only the author of an entry may modify or delete it
+	MaxSize      int       // bytes an entry may be, 0 for no limit
+	LinkBaseType string    // entry type the bases of a links entry's links must be
+	Rate         *RateRule // how many entries an agent may commit in a period
+	RulesOnly    bool      // the rules are all the validation the entry type needs, so the zome's validation functions don't get called
+}
+
+// RateRule limits the number of entries of a type an agent may commit in a period
+type RateRule struct {
+	Count  int // entries allowed in the period
+	Period int // seconds
+}
+
+// needsChain returns true if checking the rules of a put needs the author's chain in the
+// validation package
+func (r *EntryRules) needsChain() bool {
+	return r != nil && r.Rate != nil
+}
+
+// packagingReq adds the chain headers the rules need to an app's packaging request.  The
+// headers of every type are needed to follow the links between them, so any filtering by
+// entry type the app asked for gets dropped.
+func (r *EntryRules) packagingReq(def *EntryDef, req PackagingReq) PackagingReq {
+	if !r.needsChain() {
+		return req
+	}
+	if req == nil {
+		req = PackagingReq{}
+	}
+	flags, _ := req[PkgReqChain].(int64)
+	req[PkgReqChain] = flags | PkgReqChainOptHeaders
+	delete(req, PkgReqEntryTypes)
+	return req
+}
+
+// check checks an action on an entry of the rules' type
+func (r *EntryRules) check(h *Holochain, a ValidatingAction, def *EntryDef, pkg *ValidationPackage, sources []peer.ID) (err error) {
+	if r == nil {
+		return
+	}
+	switch t := a.(type) {
+	case *ActionCommit:
+		err = r.checkEntry(def, t.entry)
+		if err == nil {
+			err = r.checkRate(def, t.header, h.Chain())
+		}
+		if err == nil && def.DataFormat == DataFormatLinks {
+			var le LinksEntry
+			le, err = LinksEntryFromJSON(t.entry.Content().(string))
+			if err == nil {
+				err = r.checkLinks(h, le.Links, "")
+			}
+		}
+	case *ActionPut:
+		err = r.checkEntry(def, t.entry)
+		if err == nil {
+			var chain *Chain
+			if pkg != nil {
+				chain = pkg.Chain
+			}
+			if chain != nil && len(sources) > 0 {
+				err = r.checkAuthorChain(h, sources[0], t.header, chain)
+			}
+			if err == nil {
+				err = r.checkRate(def, t.header, chain)
+			}
+		}
+	case *ActionMod:
+		err = r.checkEntry(def, t.entry)
+		if err == nil {
+			err = r.checkChange(h, t.replaces, nil, sources)
+		}
+		// mods get shared as puts, so other nodes check the rate then
+		if err == nil && len(sources) > 0 && sources[0] == h.nodeID {
+			err = r.checkRate(def, t.header, h.Chain())
+		}
+	case *ActionLink:
+		err = r.checkLinks(h, t.links, t.validationBase.String())
+	}
+	return
+}
+
+// checkEntry checks the rules about an entry's content
+func (r *EntryRules) checkEntry(def *EntryDef, entry Entry) (err error) {
+	if r.MaxSize <= 0 || entry == nil {
+		return
+	}
+	var size int
+	if s, ok := entry.Content().(string); ok {
+		size = len(s)
+	} else {
+		var b []byte
+		b, err = entry.Marshal()
+		if err != nil {
+			return
+		}
+		size = len(b)
+	}
+	if size > r.MaxSize {
+		err = ValidationFailed(fmt.Sprintf("%s entry is %d bytes, more than the maximum of %d", def.Name, size, r.MaxSize))
+	}
+	return
+}
+
+// checkChange checks the rules about modifying or deleting the entry with the given hash,
+// getting its sources if resp doesn't hold them
+func (r *EntryRules) checkChange(h *Holochain, hash Hash, resp *GetResp, sources []peer.ID) (err error) {
+	if r.Immutable {
+		err = ValidationFailed("entry is immutable")
+		return
+	}
+	if !r.AuthorOnly {
+		return
+	}
+	if resp == nil {
+		var got GetResp
+		got, err = getForRules(h, hash)
+		if err != nil {
+			return
+		}
+		resp = &got
+	}
+	if len(sources) > 0 {
+		author := peer.IDB58Encode(sources[0])
+		for _, source := range resp.Sources {
+			if source == author {
+				return
+			}
+		}
+	}
+	err = ValidationFailed("only the entry's author may change it")
+	return
+}
+
+// checkLinks checks the rules about the links of a links entry, only checking links from
+// the given base if there is one
+func (r *EntryRules) checkLinks(h *Holochain, links []Link, base string) (err error) {
+	if r.LinkBaseType == "" {
+		return
+	}
+	for _, l := range links {
+		if base != "" && l.Base != base {
+			continue
+		}
+		var hash Hash
+		hash, err = NewHash(l.Base)
+		if err != nil {
+			return
+		}
+		var resp GetResp
+		resp, err = getForRules(h, hash)
+		if err != nil {
+			return
+		}
+		if resp.EntryType != r.LinkBaseType {
+			err = ValidationFailed(fmt.Sprintf("link base %s is a %s entry, not a %s entry", l.Base, resp.EntryType, r.LinkBaseType))
+			return
+		}
+	}
+	return
+}
+
+// checkRate checks the entry with the given header doesn't take its author over the rate
+// rule, counting the author's entries of the type on the given chain, which the entry may
+// not have been added to yet
+func (r *EntryRules) checkRate(def *EntryDef, header *Header, chain *Chain) (err error) {
+	if r.Rate == nil || r.Rate.Count <= 0 || header == nil {
+		return
+	}
+	if chain == nil {
+		err = ValidationFailed("rate rule needs the author's chain in the validation package")
+		return
+	}
+	since := header.Time.Add(-time.Duration(r.Rate.Period) * time.Second)
+	var count int
+	var onChain bool
+	for i := 0; ; i++ {
+		hd := chain.Nth(i)
+		if hd == nil || !hd.Time.After(since) {
+			break
+		}
+		if hd.Type == def.Name && !hd.Time.After(header.Time) {
+			count++
+			onChain = onChain || (hd.EntryLink == header.EntryLink && hd.Time.Equal(header.Time))
+		}
+	}
+	if !onChain {
+		count++
+	}
+	if count > r.Rate.Count {
+		err = ValidationFailed(fmt.Sprintf("more than %d %s entries in %d seconds", r.Rate.Count, def.Name, r.Rate.Period))
+	}
+	return
+}
+
+// checkAuthorChain checks that the chain sent in a put's validation package really is the
+// author's chain, back past the rate rule's period, so an author can't get under the rate by
+// leaving entries out of it.  The put's header has to be fully signed by the author, and as
+// each header holds the hash of the one before it, the links back from the put's header
+// vouch for the rest of the headers in the period.
+func (r *EntryRules) checkAuthorChain(h *Holochain, author peer.ID, header *Header, chain *Chain) (err error) {
+	if r.Rate == nil || r.Rate.Count <= 0 || header == nil {
+		return
+	}
+	if !header.FullySigned() {
+		err = ValidationFailed("rate rule needs a fully signed header")
+		return
+	}
+	var signed bool
+	signed, err = h.dht.signedBy(author, header)
+	if err != nil {
+		return
+	}
+	if !signed {
+		err = ValidationFailed("header not signed by the entry's author")
+		return
+	}
+	var hash Hash
+	hash, _, err = header.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+
+	// find the put's header on the chain
+	i := 0
+	for ; ; i++ {
+		hd := chain.Nth(i)
+		if hd == nil {
+			err = ValidationFailed("entry's header not on the author's chain")
+			return
+		}
+		var hdHash Hash
+		hdHash, _, err = hd.Sum(h.hashSpec)
+		if err != nil {
+			return
+		}
+		if hdHash.Equal(hash) {
+			break
+		}
+	}
+
+	// and follow its links back past the start of the period
+	since := header.Time.Add(-time.Duration(r.Rate.Period) * time.Second)
+	for hd := chain.Nth(i); hd.Time.After(since); hd = chain.Nth(i) {
+		i++
+		prev := chain.Nth(i)
+		if prev == nil {
+			if !hd.HeaderLink.IsNullHash() {
+				err = ValidationFailed("author's chain doesn't link back to the start of the rate period")
+			}
+			return
+		}
+		var prevHash Hash
+		prevHash, _, err = prev.Sum(h.hashSpec)
+		if err != nil {
+			return
+		}
+		if !hd.HeaderLink.Equal(prevHash) {
+			err = ValidationFailed("author's chain doesn't link back to the start of the rate period")
+			return
+		}
+	}
+	return
+}
+
+// checkDelRules checks the rules of the entry type of the entry a del deletes
+func (h *Holochain) checkDelRules(a *ActionDel, sources []peer.ID) (err error) {
+	if !h.hasChangeRules() {
+		return
+	}
+	var resp GetResp
+	resp, err = getForRules(h, a.entry.Hash)
+	if err != nil {
+		return
+	}
+	var def *EntryDef
+	_, def, err = h.GetEntryDef(resp.EntryType)
+	if err != nil || def.IsSysEntry() || def.Rules == nil {
+		return
+	}
+	err = def.Rules.checkChange(h, a.entry.Hash, &resp, sources)
+	return
+}
+
+// hasChangeRules returns true if any of the DNA's entry types have rules about modifying
+// or deleting their entries
+func (h *Holochain) hasChangeRules() bool {
+	for _, z := range h.nucleus.dna.Zomes {
+		for _, def := range z.Entries {
+			if def.Rules != nil && (def.Rules.Immutable || def.Rules.AuthorOnly) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getForRules gets the type and sources of an entry the rules depend on.  An entry that
+// isn't found may just not have reached the DHT yet, so ErrHashNotFound is returned rather
+// than failing validation, and changes that get it are retried later.
+func getForRules(h *Holochain, hash Hash) (resp GetResp, err error) {
+	mask := GetMaskEntryType | GetMaskSources
+	var r interface{}
+	r, err = callGet(h, GetReq{H: hash, StatusMask: StatusAny, GetMask: mask}, &GetOptions{StatusMask: StatusAny, GetMask: mask})
+	if err == nil {
+		resp = r.(GetResp)
+	}
+	return
+}
@@ -0,0 +1,199 @@
+package holochain
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// setEntryRules sets the rules of an entry type in the DNA
+func setEntryRules(h *Holochain, entryType string, rules *EntryRules) {
+	for i, z := range h.nucleus.dna.Zomes {
+		for j, def := range z.Entries {
+			if def.Name == entryType {
+				h.nucleus.dna.Zomes[i].Entries[j].Rules = rules
+			}
+		}
+	}
+}
+
+func TestEntryRules(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	me := []peer.ID{h.nodeID}
+	other, _ := peer.IDB58Decode("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+
+	hash := commit(h, "oddNumbers", "7")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	otherHash := commit(h, "oddNumbers", "9")
+
+	Convey("it should fail entries over the maximum size", t, func() {
+		setEntryRules(h, "oddNumbers", &EntryRules{MaxSize: 3})
+		defer setEntryRules(h, "oddNumbers", nil)
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "333"})
+		_, err := h.ValidateAction(a, a.entryType, nil, me)
+		So(err, ShouldBeNil)
+		a = NewCommitAction("oddNumbers", &GobEntry{C: "33333"})
+		_, err = h.ValidateAction(a, a.entryType, nil, me)
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": oddNumbers entry is 5 bytes, more than the maximum of 3")
+	})
+
+	Convey("it should fail changes to immutable entries", t, func() {
+		setEntryRules(h, "oddNumbers", &EntryRules{Immutable: true})
+		defer setEntryRules(h, "oddNumbers", nil)
+		m := NewModAction("oddNumbers", &GobEntry{C: "11"}, hash)
+		m.header = &Header{EntryLink: otherHash}
+		_, err := h.ValidateAction(m, m.entryType, nil, me)
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": entry is immutable")
+		del := NewDelAction(DelEntry{Hash: hash, Message: "expunge"})
+		_, err = h.ValidateAction(del, DelEntryType, nil, me)
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": entry is immutable")
+		del = NewDelAction(DelEntry{Hash: profileHash, Message: "expunge"})
+		_, err = h.ValidateAction(del, DelEntryType, nil, me)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should only let authors change their entries", t, func() {
+		setEntryRules(h, "oddNumbers", &EntryRules{AuthorOnly: true})
+		defer setEntryRules(h, "oddNumbers", nil)
+		m := NewModAction("oddNumbers", &GobEntry{C: "11"}, hash)
+		m.header = &Header{EntryLink: otherHash}
+		_, err := h.ValidateAction(m, m.entryType, nil, me)
+		So(err, ShouldBeNil)
+		_, err = h.ValidateAction(m, m.entryType, nil, []peer.ID{other})
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": only the entry's author may change it")
+		del := NewDelAction(DelEntry{Hash: hash, Message: "expunge"})
+		_, err = h.ValidateAction(del, DelEntryType, nil, me)
+		So(err, ShouldBeNil)
+		_, err = h.ValidateAction(del, DelEntryType, nil, []peer.ID{other})
+		So(IsValidationFailedErr(err), ShouldBeTrue)
+	})
+
+	Convey("it should fail links from bases of the wrong type", t, func() {
+		setEntryRules(h, "rating", &EntryRules{LinkBaseType: "profile"})
+		defer setEntryRules(h, "rating", nil)
+		good := Link{Base: profileHash.String(), Link: hash.String(), Tag: "4stars"}
+		bad := Link{Base: hash.String(), Link: profileHash.String(), Tag: "4stars"}
+		links := fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, good.Base, good.Link)
+		a := NewCommitAction("rating", &GobEntry{C: links})
+		_, err := h.ValidateAction(a, a.entryType, nil, me)
+		So(err, ShouldBeNil)
+		links = fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, bad.Base, bad.Link)
+		a = NewCommitAction("rating", &GobEntry{C: links})
+		_, err = h.ValidateAction(a, a.entryType, nil, me)
+		So(err.Error(), ShouldEqual, fmt.Sprintf("%s: link base %s is a oddNumbers entry, not a profile entry", ValidationFailedErrMsg, hash.String()))
+
+		l := NewLinkAction("rating", []Link{good, bad})
+		l.validationBase = profileHash
+		_, err = h.ValidateAction(l, l.entryType, nil, me)
+		So(err, ShouldBeNil)
+		l.validationBase = hash
+		_, err = h.ValidateAction(l, l.entryType, nil, me)
+		So(IsValidationFailedErr(err), ShouldBeTrue)
+	})
+
+	Convey("it should not fail links from bases that haven't been found yet", t, func() {
+		setEntryRules(h, "rating", &EntryRules{LinkBaseType: "profile"})
+		defer setEntryRules(h, "rating", nil)
+		missing, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		links := fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, missing.String(), hash.String())
+		a := NewCommitAction("rating", &GobEntry{C: links})
+		before := h.reputation.Get(other).InvalidEntries
+		_, err := h.ValidateAction(a, a.entryType, nil, []peer.ID{other})
+		So(err, ShouldEqual, ErrHashNotFound)
+		So(h.reputation.Get(other).InvalidEntries, ShouldEqual, before)
+	})
+
+	Convey("it should limit the rate agents commit entries at", t, func() {
+		setEntryRules(h, "oddNumbers", &EntryRules{Rate: &RateRule{Count: 3, Period: 60}})
+		defer setEntryRules(h, "oddNumbers", nil)
+		_, err := commitE(h, "oddNumbers", "13")
+		So(err, ShouldBeNil)
+		_, err = commitE(h, "oddNumbers", "15")
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": more than 3 oddNumbers entries in 60 seconds")
+
+		_, def, _ := h.GetEntryDef("oddNumbers")
+		req := def.Rules.packagingReq(def, nil)
+		So(req, ShouldResemble, PackagingReq{PkgReqChain: int64(PkgReqChainOptHeaders)})
+		pkg, err := MakePackage(h, req)
+		So(err, ShouldBeNil)
+		top := h.chain.Top()
+		p := NewPutAction("oddNumbers", &GobEntry{C: "13"}, top)
+		_, err = h.ValidateAction(p, p.entryType, &pkg, me)
+		So(err, ShouldBeNil)
+
+		setEntryRules(h, "oddNumbers", &EntryRules{Rate: &RateRule{Count: 2, Period: 60}})
+		_, err = h.ValidateAction(p, p.entryType, &pkg, me)
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": more than 2 oddNumbers entries in 60 seconds")
+		_, err = h.ValidateAction(p, p.entryType, &Package{}, me)
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": rate rule needs the author's chain in the validation package")
+	})
+
+	Convey("it should only count the rate over the author's whole chain", t, func() {
+		setEntryRules(h, "oddNumbers", &EntryRules{Rate: &RateRule{Count: 10, Period: 60}})
+		defer setEntryRules(h, "oddNumbers", nil)
+		_, def, _ := h.GetEntryDef("oddNumbers")
+		pkg, err := MakePackage(h, def.Rules.packagingReq(def, nil))
+		So(err, ShouldBeNil)
+		p := NewPutAction("oddNumbers", &GobEntry{C: "13"}, h.chain.Top())
+
+		// a chain with its oldest headers left out doesn't link back to the start
+		_, full, err := UnmarshalChain(h.hashSpec, bytes.NewBuffer(pkg.Chain))
+		So(err, ShouldBeNil)
+		trimmed := NewChain(h.hashSpec)
+		for i := 2; i < len(full.Headers); i++ {
+			trimmed.Headers = append(trimmed.Headers, full.Headers[i])
+			trimmed.Entries = append(trimmed.Entries, &GobEntry{})
+		}
+		trimmed.Hashes = full.Hashes[2:]
+		var b bytes.Buffer
+		err = trimmed.MarshalChain(&b, ChainMarshalFlagsOmitDNA+ChainMarshalFlagsNoEntries, nil, nil)
+		So(err, ShouldBeNil)
+		_, err = h.ValidateAction(p, p.entryType, &Package{Chain: b.Bytes()}, me)
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": author's chain doesn't link back to the start of the rate period")
+
+		// nor does a chain someone else signed count as the author's
+		pid, privKey := makePeer("peer1")
+		h.node.host.Peerstore().AddPubKey(pid, privKey.GetPublic())
+		_, err = h.ValidateAction(p, p.entryType, &pkg, []peer.ID{pid})
+		So(err.Error(), ShouldEqual, ValidationFailedErrMsg+": header not signed by the entry's author")
+
+		_, err = h.ValidateAction(p, p.entryType, &pkg, me)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should add the headers the rules need to the app's packaging request", t, func() {
+		rules := &EntryRules{Rate: &RateRule{Count: 1, Period: 1}}
+		_, def, _ := h.GetEntryDef("oddNumbers")
+		req := rules.packagingReq(def, PackagingReq{PkgReqChain: int64(PkgReqChainOptEntries), PkgReqEntryTypes: []string{"profile"}})
+		So(req, ShouldResemble, PackagingReq{PkgReqChain: int64(PkgReqChainOptFull)})
+		req = (&EntryRules{}).packagingReq(def, nil)
+		So(req, ShouldBeNil)
+	})
+
+	Convey("it should skip the zome's validation functions if the rules are all there is", t, func() {
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "1"})
+		_, err := h.ValidateAction(a, a.entryType, nil, me)
+		So(IsValidationFailedErr(err), ShouldBeTrue)
+		setEntryRules(h, "evenNumbers", &EntryRules{RulesOnly: true})
+		defer setEntryRules(h, "evenNumbers", nil)
+		_, err = h.ValidateAction(a, a.entryType, nil, me)
+		So(err, ShouldBeNil)
+	})
+}
+
+// commitE commits an entry returning any error
+func commitE(h *Holochain, entryType, entryStr string) (entryHash Hash, err error) {
+	fn := &APIFnCommit{}
+	fn.SetAction(NewCommitAction(entryType, &GobEntry{C: entryStr}))
+	var r interface{}
+	r, err = fn.Call(h)
+	if err == nil {
+		entryHash = r.(Hash)
+	}
+	return
+}
@@ -11,11 +11,8 @@ import (
 	"fmt"
 	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
-	"github.com/tidwall/buntdb"
 	"math/rand"
 	"sort"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -27,13 +24,23 @@ type Put struct {
 
 // Gossip holds a gossip message
 type Gossip struct {
-	Puts []Put
+	Puts    []Put
+	Skipped []Hash // fingerprints of puts left out because the requester's filter has them
+	Through int    // index of the last put covered, including skipped ones
+	More    bool   // true if there are more puts to be had by asking again
+	// Checkpoint is the index up to which the responder's change log has been compacted,
+	// set if the request reached back before it, as puts the requester asked for may have
+	// been dropped
+	Checkpoint int
+	Version    int // the responder's gossip protocol version, see GossipVersion
 }
 
 // GossipReq holds a gossip request
 type GossipReq struct {
 	MyIdx   int
 	YourIdx int
+	Have    *GossipFilter // fingerprints of the puts the requester already has
+	Version int           // the requester's gossip protocol version, see GossipVersion
 }
 
 // we also gossip about peers too, keeping lists of different peers e.g. blockedlist etc
@@ -68,63 +75,31 @@ func (dht *DHT) HaveFingerprint(f Hash) (result bool, err error) {
 
 // GetFingerprint returns the index that of the message that made a change or -1 if we don't have it
 func (dht *DHT) GetFingerprint(f Hash) (index int, err error) {
-	index = -1
-	db := dht.ht.(*BuntHT).db
-	err = db.View(func(tx *buntdb.Tx) error {
-		idxStr, e := tx.Get("f:" + f.String())
-		if e == buntdb.ErrNotFound {
-			return nil
-		}
-		if e != nil {
-			return e
-		}
-		index, e = strconv.Atoi(idxStr)
-		if e != nil {
-			return e
-		}
-		return nil
-	})
+	index, err = dht.ht.GetFingerprint(f)
 	return
 }
 
-// GetPuts returns a list of puts after the given index
+// GetPuts returns a list of puts after the given index, leaving out the puts whose
+// changes have expired so that they aren't gossiped back into the DHT
 func (dht *DHT) GetPuts(since int) (puts []Put, err error) {
-	puts = make([]Put, 0)
-	db := dht.ht.(*BuntHT).db
-	err = db.View(func(tx *buntdb.Tx) error {
-		err = tx.AscendGreaterOrEqual("idx", string(since), func(key, value string) bool {
-			x := strings.Split(key, ":")
-			idx, _ := strconv.Atoi(x[1])
-			if idx >= since {
-				p := Put{Idx: idx}
-				if value != "" {
-					err := ByteDecoder([]byte(value), &p.M)
-					if err != nil {
-						return false
-					}
-				}
-				puts = append(puts, p)
-			}
-			return true
-		})
-		sort.Slice(puts, func(i, j int) bool { return puts[i].Idx < puts[j].Idx })
-		return err
-	})
+	var all []Put
+	all, err = dht.ht.GetPuts(since)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	puts = make([]Put, 0, len(all))
+	for _, p := range all {
+		if !changeExpired(&p.M, now) {
+			puts = append(puts, p)
+		}
+	}
 	return
 }
 
 // GetGossiper loads returns last known index of the gossiper, and adds them if not didn't exist before
 func (dht *DHT) GetGossiper(id peer.ID) (idx int, err error) {
-	key := "peer:" + peer.IDB58Encode(id)
-	db := dht.ht.(*BuntHT).db
-	err = db.View(func(tx *buntdb.Tx) error {
-		var e error
-		idx, e = getIntVal(key, tx)
-		if e != nil {
-			return e
-		}
-		return nil
-	})
+	idx, err = dht.ht.GetGossiper(id)
 	return
 }
 
@@ -161,21 +136,10 @@ func (dht *DHT) getGossipers() (glist []peer.ID, err error) {
 }
 
 func (dht *DHT) _getGossipers() (glist []peer.ID, err error) {
-	glist = make([]peer.ID, 0)
-	db := dht.ht.(*BuntHT).db
-	err = db.View(func(tx *buntdb.Tx) error {
-		err = tx.Ascend("peer", func(key, value string) bool {
-			x := strings.Split(key, ":")
-			id, e := peer.IDB58Decode(x[1])
-			if e != nil {
-				return false
-			}
-			//			idx, _ := strconv.Atoi(value)
-			glist = append(glist, id)
-			return true
-		})
-		return nil
-	})
+	glist, err = dht.ht.GetGossipers()
+	if err != nil {
+		return
+	}
 	ns := dht.config.RedundancyFactor
 	if ns > 1 {
 		size := len(glist)
@@ -216,29 +180,7 @@ func (dht *DHT) AddGossiper(id peer.ID) (err error) {
 	if id == dht.h.node.HashAddr {
 		return
 	}
-	err = dht.updateGossiper(id, 0)
-	return
-}
-
-// internal update gossiper function, assumes all checks have been made
-func (dht *DHT) updateGossiper(id peer.ID, newIdx int) (err error) {
-	db := dht.ht.(*BuntHT).db
-	err = db.Update(func(tx *buntdb.Tx) error {
-		key := "peer:" + peer.IDB58Encode(id)
-		idx, e := getIntVal(key, tx)
-		if e != nil {
-			return e
-		}
-		if newIdx < idx {
-			return nil
-		}
-		sidx := fmt.Sprintf("%d", newIdx)
-		_, _, err = tx.Set(key, sidx, nil)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
+	err = dht.ht.UpdateGossiper(id, 0)
 	return
 }
 
@@ -250,19 +192,14 @@ func (dht *DHT) UpdateGossiper(id peer.ID, newIdx int) (err error) {
 		return
 	}
 	dht.glog.Logf("updating %v to %d", id, newIdx)
-	err = dht.updateGossiper(id, newIdx)
+	err = dht.ht.UpdateGossiper(id, newIdx)
 	return
 }
 
 // DeleteGossiper removes a gossiper from the database
 func (dht *DHT) DeleteGossiper(id peer.ID) (err error) {
 	dht.glog.Logf("deleting %v", id)
-	db := dht.ht.(*BuntHT).db
-	err = db.Update(func(tx *buntdb.Tx) error {
-		key := "peer:" + peer.IDB58Encode(id)
-		_, e := tx.Delete(key)
-		return e
-	})
+	err = dht.ht.DeleteGossiper(id)
 	return
 }
 
@@ -273,62 +210,153 @@ const (
 // GossipReceiver implements the handler for the gossip protocol
 func GossipReceiver(h *Holochain, m *Message) (response interface{}, err error) {
 	dht := h.dht
+	if err = dht.throttle(m.From); err != nil {
+		return
+	}
 	switch m.Type {
 	case GOSSIP_REQUEST:
 		dht.glog.Logf("GossipReceiver got: %v", m)
 		switch t := m.Body.(type) {
 		case GossipReq:
-			dht.glog.Logf("%v wants my puts since %d and is at %d", m.From, t.YourIdx, t.MyIdx)
+			dht.glog.LogWith(LogFields{"peer": peer.IDB58Encode(m.From), "since": t.YourIdx, "idx": t.MyIdx}, "gossip request")
 
-			// give the gossiper what they want
+			// give the gossiper what they want, except for what they say they have
 			var puts []Put
 			puts, err = h.dht.GetPuts(t.YourIdx)
-			g := Gossip{Puts: puts}
+			if err != nil {
+				return
+			}
+			// the version tells us whether they can handle summaries when we gossip back
+			dht.setGossipMode(m.From, gossipModeOf(t.Version))
+			g := Gossip{Version: GossipVersion}
+			var checkpoint int
+			checkpoint, err = dht.GetCheckpoint()
+			if err != nil {
+				return
+			}
+			if t.YourIdx <= checkpoint {
+				g.Checkpoint = checkpoint
+			}
+			if max := h.Config.GossipMaxPuts; max > 0 && len(puts) > max {
+				puts = puts[:max]
+				g.More = true
+			}
+			var saved int64
+			g.Puts, g.Skipped, saved, err = filterPuts(puts, t.Have)
+			if err != nil {
+				return
+			}
+			if len(puts) > 0 {
+				g.Through = puts[len(puts)-1].Idx
+			}
+			metricGossipPutsSent.Add(float64(len(g.Puts)), h.dnaHash.String())
+			if len(g.Skipped) > 0 {
+				dht.glog.Logf("skipping %d puts %v already has", len(g.Skipped), m.From)
+				if BytesSentChan != nil {
+					BytesSentChan <- BytesSent{Saved: saved, MsgType: m.Type}
+				}
+			}
 			response = g
 
 			// check to see what we know they said, and if our record is less
 			// that where they are currently at, gossip back
-			idx, e := h.dht.GetGossiper(m.From)
-			if e == nil && idx < t.MyIdx {
-				dht.glog.Logf("we only have %d of %d from %v so gossiping back", idx, t.MyIdx, m.From)
-
-				pi := h.node.host.Peerstore().PeerInfo(m.From)
-				if len(pi.Addrs) == 0 {
-					dht.glog.Logf("NO ADDRESSES FOR PEER:%v", pi)
-				}
-
-				// queue up a request to gossip back
-				go func() {
-					defer func() {
-						if r := recover(); r != nil {
-							// ignore writes past close
-						}
-					}()
-					// but give them a chance to finish handling the response
-					// from this request first so sleep a bit per put
-					time.Sleep(GossipBackPutDelay * time.Duration(len(puts)))
-					dht.gchan <- gossipWithReq{m.From}
-				}()
-			}
+			dht.gossipBack(m.From, t.MyIdx, len(puts))
 
 		default:
 			err = ErrDHTExpectedGossipReqInBody
 		}
+	case GOSSIP_SUMMARY_REQUEST:
+		dht.glog.Logf("GossipReceiver got: %v", m)
+		switch t := m.Body.(type) {
+		case GossipSummaryReq:
+			dht.glog.Logf("%v wants a summary of buckets %d-%d and is at %d", m.From, t.Range.From, t.Range.To, t.MyIdx)
+			// they asked for a summary so we know they can handle them when we gossip back
+			dht.setGossipMode(m.From, GossipModeSummary)
+			var count int
+			response, count, err = dht.summaryResponse(t)
+			if err == nil {
+				dht.gossipBack(m.From, t.MyIdx, count)
+			}
+		default:
+			err = ErrDHTExpectedGossipSummaryReqInBody
+		}
+	case GOSSIP_FETCH_REQUEST:
+		dht.glog.Logf("GossipReceiver got: %v", m)
+		switch t := m.Body.(type) {
+		case GossipFetchReq:
+			dht.glog.Logf("%v wants puts from %d buckets", m.From, len(t.Buckets))
+			response, err = dht.fetchResponse(t)
+		default:
+			err = ErrDHTExpectedGossipFetchReqInBody
+		}
 	default:
 		err = fmt.Errorf("message type %d not in holochain-gossip protocol", int(m.Type))
 	}
 	return
 }
 
+// gossipBack queues up a gossip with a peer if our record of their index is less than
+// where they say they are at
+func (dht *DHT) gossipBack(from peer.ID, theirIdx int, sending int) {
+	idx, e := dht.GetGossiper(from)
+	if e == nil && idx < theirIdx {
+		// only ever have one gossip back with a peer queued up
+		if !dht.setGossipBack(from) {
+			dht.glog.Logf("gossip back with %v already queued", from)
+			return
+		}
+
+		dht.glog.Logf("we only have %d of %d from %v so gossiping back", idx, theirIdx, from)
+
+		pi := dht.h.node.host.Peerstore().PeerInfo(from)
+		if len(pi.Addrs) == 0 {
+			dht.glog.Logf("NO ADDRESSES FOR PEER:%v", pi)
+		}
+
+		// queue up a request to gossip back
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					// ignore writes past close
+				}
+			}()
+			defer dht.clearGossipBack(from)
+			// but give them a chance to finish handling the response
+			// from this request first so sleep a bit per put
+			time.Sleep(GossipBackPutDelay * time.Duration(sending))
+			dht.gchan <- gossipWithReq{from}
+		}()
+	}
+}
+
+// setGossipBack marks that a gossip back with a peer is queued, returning false if
+// one already was
+func (dht *DHT) setGossipBack(id peer.ID) bool {
+	dht.gblk.Lock()
+	defer dht.gblk.Unlock()
+	if dht.gossipBacks[id] {
+		return false
+	}
+	dht.gossipBacks[id] = true
+	return true
+}
+
+func (dht *DHT) clearGossipBack(id peer.ID) {
+	dht.gblk.Lock()
+	defer dht.gblk.Unlock()
+	delete(dht.gossipBacks, id)
+}
+
 // gossipWith gossips with a peer asking for everything after since
 func (dht *DHT) gossipWith(id peer.ID) (err error) {
 	// prevent rentrance
 	dht.glk.Lock()
 	defer dht.glk.Unlock()
 
-	dht.glog.Logf("starting gossipWith %v", id)
+	dht.glog.LogWith(LogFields{"peer": peer.IDB58Encode(id)}, "starting gossipWith")
+	metricGossipRounds.Inc(dht.h.dnaHash.String())
 	defer func() {
-		dht.glog.Logf("finish gossipWith %v, err=%v", id, err)
+		dht.glog.LogWith(LogFields{"peer": peer.IDB58Encode(id), "err": err}, "finish gossipWith")
 	}()
 
 	var myIdx, yourIdx int
@@ -342,8 +370,32 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 		return
 	}
 
+	// if we've never received anything from this peer, rather than replaying their
+	// whole history, swap summaries and only fetch what we are missing
+	if yourIdx == 0 {
+		mode := dht.getGossipMode(id)
+		if mode == GossipModeUnknown {
+			mode, err = dht.probeGossipMode(id, myIdx)
+			if err != nil {
+				return
+			}
+		}
+		if mode == GossipModeSummary {
+			err = dht.gossipSummaryWith(id, myIdx, dht.gossipRange())
+			return
+		}
+	}
+
+	req := GossipReq{MyIdx: myIdx, YourIdx: yourIdx + 1, Version: GossipVersion}
+	if myIdx > 0 {
+		req.Have, err = dht.gossipFilter()
+		if err != nil {
+			return
+		}
+	}
+
 	var r interface{}
-	msg := dht.h.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: myIdx, YourIdx: yourIdx + 1})
+	msg := dht.h.node.NewMessage(GOSSIP_REQUEST, req)
 	r, err = dht.h.Send(dht.h.node.ctx, GossipProtocol, id, msg, 0)
 	if err != nil {
 		return
@@ -352,21 +404,83 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 	gossip := r.(Gossip)
 	puts := gossip.Puts
 
+	// the filter can give false positives, so fetch any skipped puts we don't actually have
+	var missing []Put
+	missing, err = dht.fetchSkipped(id, gossip.Skipped)
+	if err != nil {
+		return
+	}
+	puts = append(puts, missing...)
+	sort.Slice(puts, func(i, j int) bool { return puts[i].Idx < puts[j].Idx })
+
 	// gossiper has more stuff that we new about before so update the gossipers status
 	// and also run their puts
 	count := len(puts)
+	idx := gossip.Through
+	for _, p := range gossip.Puts {
+		// a peer only gives us the puts we asked for
+		if p.Idx < req.YourIdx {
+			dht.glog.Logf("%v gave us put %d when we asked for puts since %d", id, p.Idx, req.YourIdx)
+			dht.h.penalize(id, GossipLieEvent)
+			break
+		}
+	}
 	if count > 0 {
 		dht.glog.Logf("queuing %d puts:\n%v", count, puts)
-		var idx int
-		for i, p := range puts {
-			idx = i + yourIdx + 1
+		for _, p := range puts {
+			// expired puts are left out so indexes may skip
+			if p.Idx > idx {
+				idx = p.Idx
+			}
 			// put the message into the gossip put handling queue so we can return quickly
+			metricGossipPutsReceived.Inc(dht.h.dnaHash.String())
 			dht.gossipPuts <- p
 		}
-		err = dht.UpdateGossiper(id, idx)
 	} else {
 		dht.glog.Log("no new puts received")
 	}
+	if idx > 0 {
+		err = dht.UpdateGossiper(id, idx)
+	}
+	if err == nil && gossip.Checkpoint >= req.YourIdx {
+		// the peer may have compacted away some of the puts we asked for, so rather than
+		// trusting the index swap summaries to fill any gaps
+		dht.glog.Logf("%v compacted its puts through %d, resyncing with summaries", id, gossip.Checkpoint)
+		err = dht.gossipSummaryWith(id, myIdx, dht.gossipRange())
+	}
+	if err == nil && gossip.More {
+		// the peer held some back, so ask for the rest once these have been handled
+		dht.glog.Logf("%v has more puts after %d", id, idx)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					// ignore writes past close
+				}
+			}()
+			dht.gchan <- gossipWithReq{id}
+		}()
+	}
+	return
+}
+
+// fetchSkipped asks a peer for the puts it skipped that we turn out not to have
+func (dht *DHT) fetchSkipped(id peer.ID, skipped []Hash) (puts []Put, err error) {
+	var want []Hash
+	for _, f := range skipped {
+		var have bool
+		have, err = dht.HaveFingerprint(f)
+		if err != nil {
+			return
+		}
+		if !have {
+			want = append(want, f)
+		}
+	}
+	if len(want) == 0 {
+		return
+	}
+	dht.glog.Logf("fetching %d puts missed by our filter from %v", len(want), id)
+	puts, err = dht.fetchPuts(id, GossipFetchReq{Want: want})
 	return
 }
 
@@ -376,12 +490,17 @@ func (dht *DHT) gossipPut(p Put) (err error) {
 	if e == nil {
 		// dht.sources[p.M.From] = true
 		// dht.fingerprints[f.String()[2:4]] = true
-		dht.glog.Logf("PUT--%d (fingerprint: %v)", p.Idx, f)
+		dht.glog.LogWith(LogFields{"idx": p.Idx, "fingerprint": f, "from": peer.IDB58Encode(p.M.From)}, "PUT")
 		exists, e := dht.HaveFingerprint(f)
-		if !exists && e == nil {
+		if !exists && e == nil && changeExpired(&p.M, time.Now()) {
+			dht.glog.Logf("PUT--%d has expired, ignoring", p.Idx)
+		} else if !exists && e == nil && !dht.inNeighborhood(&p.M) {
+			dht.glog.Logf("PUT--%d not in our neighborhood, ignoring", p.Idx)
+		} else if !exists && e == nil {
 			dht.glog.Logf("PUT--%d calling ActionReceiver", p.Idx)
-			r, e := ActionReceiver(dht.h, &p.M)
-			dht.glog.Logf("PUT--%d ActionReceiver returned %v with err %v", p.Idx, r, e)
+			// gossiped puts keep their original source so don't count against its rate limit
+			r, e := actionReceiver(dht.h, &p.M, MaxRetries)
+			dht.glog.LogWith(LogFields{"idx": p.Idx, "response": r, "err": e}, "PUT received")
 			if e != nil {
 				// put receiver error so do what? probably nothing because
 				// put will get retried
@@ -400,6 +519,18 @@ func (dht *DHT) gossipPut(p Put) (err error) {
 	return
 }
 
+// inNeighborhood returns whether the change of a gossiped put is at an address
+// we should be holding
+func (dht *DHT) inNeighborhood(m *Message) bool {
+	// only changes held at an address are sharded, i.e. not peer lists
+	if _, ok := m.Body.(HoldReq); !ok {
+		return true
+	}
+	a, _ := putAddress(m)
+	responsible, err := dht.h.IsResponsible(a)
+	return err != nil || responsible
+}
+
 func handleGossipPut(dht *DHT, x interface{}) (err error) {
 	p := x.(Put)
 	err = dht.gossipPut(p)
@@ -468,45 +599,13 @@ func (dht *DHT) HandleGossipPuts() (err error) {
 
 // getList returns the peer list of the given type
 func (dht *DHT) getList(listType PeerListType) (result PeerList, err error) {
-	result.Type = listType
-	result.Records = make([]PeerRecord, 0)
-	db := dht.ht.(*BuntHT).db
-	err = db.View(func(tx *buntdb.Tx) error {
-		err = tx.Ascend("list", func(key, value string) bool {
-			x := strings.Split(key, ":")
-
-			if x[1] == string(listType) {
-				pid, e := peer.IDB58Decode(x[2])
-				if e != nil {
-					return false
-				}
-				r := PeerRecord{ID: pid, Warrant: value}
-				result.Records = append(result.Records, r)
-			}
-			return true
-		})
-		return nil
-	})
+	result, err = dht.ht.GetList(listType)
 	return
 }
 
 // addToList adds the peers to a list
 func (dht *DHT) addToList(m *Message, list PeerList) (err error) {
 	dht.dlog.Logf("addToList %s=>%v", list.Type, list.Records)
-	db := dht.ht.(*BuntHT).db
-	err = db.Update(func(tx *buntdb.Tx) error {
-		_, err = incIdx(tx, m)
-		if err != nil {
-			return err
-		}
-		for _, r := range list.Records {
-			k := peer.IDB58Encode(r.ID)
-			_, _, err = tx.Set("list:"+string(list.Type)+":"+k, r.Warrant, nil)
-			if err != nil {
-				return err
-			}
-		}
-		return err
-	})
+	err = dht.ht.AddToList(m, list)
 	return
 }
@@ -0,0 +1,160 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// gossip_bloom implements the bloom filter of put fingerprints that a gossiper sends
+// at the start of a gossip round so that the other side can skip sending the puts it
+// already has
+
+package holochain
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+)
+
+const (
+	// GossipFilterBitsPerPut sets the size of the filter, which with GossipFilterHashes
+	// gives a false positive rate of about 1%
+	GossipFilterBitsPerPut = 10
+	GossipFilterHashes     = 7
+
+	gossipFilterMinBits = 64
+)
+
+// GossipFilter is a bloom filter of the fingerprints of the puts a node has
+type GossipFilter struct {
+	Seed uint32 // varied each time the filter is built so false positives don't repeat
+	K    int
+	Bits []byte
+}
+
+// NewGossipFilter returns an empty filter sized to hold count fingerprints
+func NewGossipFilter(count int) (f *GossipFilter) {
+	bits := count * GossipFilterBitsPerPut
+	if bits < gossipFilterMinBits {
+		bits = gossipFilterMinBits
+	}
+	f = &GossipFilter{
+		Seed: rand.Uint32(),
+		K:    GossipFilterHashes,
+		Bits: make([]byte, (bits+7)/8),
+	}
+	return
+}
+
+// locations returns the bit positions of a fingerprint using double hashing
+func (f *GossipFilter) locations(fp Hash) (locs []uint64) {
+	seed := []byte{byte(f.Seed >> 24), byte(f.Seed >> 16), byte(f.Seed >> 8), byte(f.Seed)}
+	h := fnv.New64a()
+	h.Write(seed)
+	h.Write([]byte(fp))
+	h1 := h.Sum64()
+	h = fnv.New64()
+	h.Write(seed)
+	h.Write([]byte(fp))
+	h2 := h.Sum64() | 1
+
+	n := uint64(len(f.Bits)) * 8
+	locs = make([]uint64, f.K)
+	for i := range locs {
+		locs[i] = (h1 + uint64(i)*h2) % n
+	}
+	return
+}
+
+// Add adds a fingerprint to the filter
+func (f *GossipFilter) Add(fp Hash) {
+	for _, l := range f.locations(fp) {
+		f.Bits[l/8] |= 1 << (l % 8)
+	}
+}
+
+// Has returns true if the fingerprint may have been added to the filter, and false if it
+// definitely hasn't
+func (f *GossipFilter) Has(fp Hash) bool {
+	if len(f.Bits) == 0 || f.K <= 0 {
+		return false
+	}
+	for _, l := range f.locations(fp) {
+		if f.Bits[l/8]&(1<<(l%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// gossipFilter returns a filter of the fingerprints of all our puts.  The filter is kept
+// between rounds and only the puts since the last round get added to it, it's rebuilt
+// at twice the size when it fills up past what it was sized for, or after compaction.
+func (dht *DHT) gossipFilter() (f *GossipFilter, err error) {
+	dht.flk.Lock()
+	defer dht.flk.Unlock()
+
+	var puts []Put
+	puts, err = dht.GetPuts(dht.filterIdx + 1)
+	if err != nil {
+		return
+	}
+	if dht.filter == nil || dht.filterCount+len(puts) > len(dht.filter.Bits)*8/GossipFilterBitsPerPut {
+		puts, err = dht.GetPuts(0)
+		if err != nil {
+			return
+		}
+		dht.filter = NewGossipFilter(2 * len(puts))
+		dht.filterCount = 0
+	}
+	for _, p := range puts {
+		var fp Hash
+		fp, err = p.M.Fingerprint()
+		if err != nil {
+			return
+		}
+		dht.filter.Add(fp)
+		dht.filterCount++
+		dht.filterIdx = p.Idx
+	}
+
+	// hand back a copy as the cached filter keeps changing while this one gets sent
+	f = &GossipFilter{Seed: dht.filter.Seed, K: dht.filter.K, Bits: append([]byte{}, dht.filter.Bits...)}
+	return
+}
+
+// resetGossipFilter drops the cached filter so the next round rebuilds it
+func (dht *DHT) resetGossipFilter() {
+	dht.flk.Lock()
+	dht.filter = nil
+	dht.filterIdx = 0
+	dht.filterCount = 0
+	dht.flk.Unlock()
+}
+
+// filterPuts removes the puts whose fingerprints are in the requester's filter, returning
+// the fingerprints of the ones skipped and the number of bytes not sent because of them
+func filterPuts(puts []Put, have *GossipFilter) (send []Put, skipped []Hash, saved int64, err error) {
+	if have == nil {
+		send = puts
+		return
+	}
+	for _, p := range puts {
+		var fp Hash
+		fp, err = p.M.Fingerprint()
+		if err != nil {
+			return
+		}
+		if !have.Has(fp) {
+			send = append(send, p)
+			continue
+		}
+		skipped = append(skipped, fp)
+		var b []byte
+		b, err = ByteEncoder(&p)
+		if err != nil {
+			return
+		}
+		saved += int64(len(b) - len(fp))
+	}
+	return
+}
@@ -0,0 +1,163 @@
+package holochain
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGossipFilter(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	var fps []Hash
+	for i := 0; i < 100; i++ {
+		e := GobEntry{C: fmt.Sprintf("%d", i*2)}
+		hash, _ := e.Sum(h.hashSpec)
+		m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash})
+		f, _ := m.Fingerprint()
+		fps = append(fps, f)
+	}
+
+	Convey("NewGossipFilter should size the filter to the puts", t, func() {
+		f := NewGossipFilter(0)
+		So(len(f.Bits)*8, ShouldEqual, gossipFilterMinBits)
+		f = NewGossipFilter(100)
+		So(len(f.Bits)*8, ShouldEqual, 100*GossipFilterBitsPerPut)
+		So(f.K, ShouldEqual, GossipFilterHashes)
+	})
+
+	Convey("a filter should have everything added to it", t, func() {
+		f := NewGossipFilter(50)
+		So(f.Has(fps[0]), ShouldBeFalse)
+		for _, fp := range fps[:50] {
+			f.Add(fp)
+		}
+		for _, fp := range fps[:50] {
+			So(f.Has(fp), ShouldBeTrue)
+		}
+		var falsePositives int
+		for _, fp := range fps[50:] {
+			if f.Has(fp) {
+				falsePositives++
+			}
+		}
+		So(falsePositives, ShouldBeLessThan, 10)
+	})
+
+	Convey("an empty filter should have nothing", t, func() {
+		var f GossipFilter
+		So(f.Has(fps[0]), ShouldBeFalse)
+	})
+
+	Convey("filterPuts should skip the puts in the filter and count the bytes saved", t, func() {
+		puts, err := h.dht.GetPuts(0)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, 2)
+
+		send, skipped, saved, err := filterPuts(puts, nil)
+		So(err, ShouldBeNil)
+		So(len(send), ShouldEqual, 2)
+		So(skipped, ShouldBeNil)
+		So(saved, ShouldEqual, 0)
+
+		f := NewGossipFilter(1)
+		fp, _ := puts[0].M.Fingerprint()
+		f.Add(fp)
+		send, skipped, saved, err = filterPuts(puts, f)
+		So(err, ShouldBeNil)
+		So(len(send), ShouldEqual, 1)
+		So(send[0].Idx, ShouldEqual, puts[1].Idx)
+		So(skipped, ShouldResemble, []Hash{fp})
+		So(saved, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("gossipFilter should keep its filter and only add the new puts to it", t, func() {
+		f, err := h.dht.gossipFilter()
+		So(err, ShouldBeNil)
+		puts, _ := h.dht.GetPuts(0)
+		for _, p := range puts {
+			fp, _ := p.M.Fingerprint()
+			So(f.Has(fp), ShouldBeTrue)
+		}
+		idx, _ := h.dht.GetIdx()
+		So(h.dht.filterIdx, ShouldEqual, idx)
+
+		hash := commit(h, "evenNumbers", "4")
+		f2, err := h.dht.gossipFilter()
+		So(err, ShouldBeNil)
+		So(f2.Seed, ShouldEqual, f.Seed)
+		puts, _ = h.dht.GetPuts(idx + 1)
+		So(len(puts), ShouldBeGreaterThan, 0)
+		for _, p := range puts {
+			fp, _ := p.M.Fingerprint()
+			So(f2.Has(fp), ShouldBeTrue)
+		}
+		So(h.dht.Exists(hash, StatusLive), ShouldBeNil)
+
+		// a copy is handed back so the cached filter can keep changing
+		f2.Bits[0] = ^f2.Bits[0]
+		So(h.dht.filter.Bits[0], ShouldNotEqual, f2.Bits[0])
+	})
+
+	Convey("gossipFilter should rebuild the filter bigger once it fills up", t, func() {
+		h.dht.resetGossipFilter()
+		f, err := h.dht.gossipFilter()
+		So(err, ShouldBeNil)
+		size := len(f.Bits)
+		for i := 0; i < 10; i++ {
+			commit(h, "evenNumbers", fmt.Sprintf("%d", 100+i*2))
+		}
+		f, err = h.dht.gossipFilter()
+		So(err, ShouldBeNil)
+		So(len(f.Bits), ShouldBeGreaterThan, size)
+		So(h.dht.filterCount, ShouldBeLessThanOrEqualTo, len(f.Bits)*8/GossipFilterBitsPerPut)
+	})
+}
+
+func TestGossipWithFilter(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+
+	h0 := nodes[0]
+	h1 := nodes[1]
+
+	commit(h0, "oddNumbers", "3")
+	commit(h0, "oddNumbers", "5")
+
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+	h1.dht.setGossipMode(h0.nodeID, GossipModeIndex)
+
+	Convey("gossiping with a peer we are in sync with should send no puts", t, func() {
+		err := h1.dht.gossipWith(h0.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h1.dht.gossipPuts), ShouldBeGreaterThan, 0)
+		for len(h1.dht.gossipPuts) > 0 {
+			h1.dht.gossipPut((<-h1.dht.gossipPuts).(Put))
+		}
+
+		// forget where we were at with the peer so the same puts are offered again
+		h1.dht.DeleteGossiper(h0.nodeID)
+		h1.dht.AddGossiper(h0.nodeID)
+
+		BytesSentChan = make(chan BytesSent, 100)
+		defer func() { BytesSentChan = nil }()
+		err = h1.dht.gossipWith(h0.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h1.dht.gossipPuts), ShouldEqual, 0)
+
+		idx, _ := h0.dht.GetIdx()
+		gidx, _ := h1.dht.GetGossiper(h0.nodeID)
+		So(gidx, ShouldEqual, idx)
+
+		var saved int64
+		for len(BytesSentChan) > 0 {
+			saved += (<-BytesSentChan).Saved
+		}
+		So(saved, ShouldBeGreaterThan, 0)
+	})
+}
@@ -0,0 +1,434 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// gossip_summary implements range based gossiping where peers exchange hash summaries
+// of the puts they hold in a range of the DHT address space and then fetch only the
+// puts they are missing, rather than replaying the whole put index
+
+package holochain
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// GossipMode identifies which gossip protocol we use with a given peer
+type GossipMode int
+
+const (
+	GossipModeUnknown GossipMode = iota // haven't tried a summary exchange with the peer yet
+	GossipModeSummary                   // peer understands summary requests
+	GossipModeIndex                     // peer only understands put index replay
+)
+
+const (
+	// GossipSummaryBuckets is the number of buckets the address space is split into,
+	// one for each value of the first byte of the address digest
+	GossipSummaryBuckets = 256
+
+	// GossipVersion is the version of the gossip protocol we run, which gets sent in gossip
+	// requests and responses so peers know what each other understand.  Peers that send
+	// none are at version 0 and only understand put index replay.
+	GossipVersion = 1
+
+	// GossipSummaryVersion is the gossip protocol version summaries were added in
+	GossipSummaryVersion = 1
+)
+
+// GossipRange is an inclusive range of summary buckets
+type GossipRange struct {
+	From int
+	To   int
+}
+
+// FullGossipRange covers the whole DHT address space
+var FullGossipRange = GossipRange{From: 0, To: GossipSummaryBuckets - 1}
+
+// GossipSummaryReq asks a peer for a summary of what they hold in a range
+type GossipSummaryReq struct {
+	MyIdx int
+	Range GossipRange
+	Root  []byte // root digest of the requester's buckets in the range
+}
+
+// GossipBucket holds the digest of all the fingerprints in one bucket
+type GossipBucket struct {
+	Index  int
+	Count  int
+	Digest []byte
+}
+
+// GossipSummary holds a response to a summary request
+type GossipSummary struct {
+	Idx     int  // the responder's current put index
+	InSync  bool // true if the roots matched, in which case no buckets are sent
+	Buckets []GossipBucket
+}
+
+// GossipFetchReq asks a peer for the puts in the given buckets that we don't have,
+// and for any puts with the given fingerprints
+type GossipFetchReq struct {
+	Buckets []int
+	Have    []Hash // fingerprints we already hold in those buckets
+	Want    []Hash // fingerprints of puts we want regardless of bucket
+	After   int    // only puts after this index, for asking for the rest of a response
+}
+
+var ErrDHTExpectedGossipSummaryReqInBody error = errors.New("expected gossip summary request")
+var ErrDHTExpectedGossipFetchReqInBody error = errors.New("expected gossip fetch request")
+var ErrInvalidGossipRange error = errors.New("invalid gossip range")
+
+// Contains returns true if the bucket is in the range
+func (r GossipRange) Contains(bucket int) bool {
+	return bucket >= r.From && bucket <= r.To
+}
+
+func (r GossipRange) valid() bool {
+	return r.From >= 0 && r.To < GossipSummaryBuckets && r.From <= r.To
+}
+
+// GossipBucketOf returns the summary bucket of a DHT address
+func GossipBucketOf(h Hash) int {
+	// skip the multihash code and length bytes
+	if len(h) > 2 {
+		return int(h[2])
+	}
+	return 0
+}
+
+// putAddress returns the DHT address at which a put's change is held
+func putAddress(m *Message) (a Hash, err error) {
+	if req, ok := m.Body.(HoldReq); ok {
+		if !req.RelatedHash.IsNullHash() {
+			a = req.RelatedHash
+		} else {
+			a = req.EntryHash
+		}
+		return
+	}
+	// changes that aren't held at an address (i.e. list adds) are spread out
+	// by their fingerprint
+	a, err = m.Fingerprint()
+	return
+}
+
+type summaryPut struct {
+	f Hash
+	p Put
+}
+
+// bucketPuts groups all our puts that fall in the range by bucket.  The buckets are kept
+// between rounds and only the puts since the last round get added to them, they are
+// rebuilt after compaction.  Puts whose changes have expired since they were added are
+// left out.
+func (dht *DHT) bucketPuts(r GossipRange) (buckets map[int][]summaryPut, err error) {
+	dht.slk.Lock()
+	defer dht.slk.Unlock()
+
+	var puts []Put
+	puts, err = dht.GetPuts(dht.summaryIdx + 1)
+	if err != nil {
+		return
+	}
+	if dht.summaryBuckets == nil {
+		dht.summaryBuckets = make(map[int][]summaryPut)
+	}
+	for _, p := range puts {
+		var a, f Hash
+		a, err = putAddress(&p.M)
+		if err != nil {
+			return
+		}
+		f, err = p.M.Fingerprint()
+		if err != nil {
+			return
+		}
+		b := GossipBucketOf(a)
+		dht.summaryBuckets[b] = append(dht.summaryBuckets[b], summaryPut{f: f, p: p})
+		dht.summaryIdx = p.Idx
+	}
+
+	now := time.Now()
+	buckets = make(map[int][]summaryPut)
+	for b, sps := range dht.summaryBuckets {
+		if !r.Contains(b) {
+			continue
+		}
+		for _, sp := range sps {
+			if !changeExpired(&sp.p.M, now) {
+				buckets[b] = append(buckets[b], sp)
+			}
+		}
+	}
+	return
+}
+
+// resetBucketPuts drops the cached buckets so the next round rebuilds them
+func (dht *DHT) resetBucketPuts() {
+	dht.slk.Lock()
+	dht.summaryBuckets = nil
+	dht.summaryIdx = 0
+	dht.slk.Unlock()
+}
+
+// gossipRange returns the range of buckets around our own address that we hold puts
+// for, which is what gets summarized when gossiping.  Of N nodes the R nearest to an
+// address share about log2(N/R) leading bits with it, and as that's only an estimate
+// the range is widened by a bit.
+func (dht *DHT) gossipRange() GossipRange {
+	return responsibleRange(GossipBucketOf(HashFromPeerID(dht.h.nodeID)), dht.h.node.routingTable.Size()+1, dht.h.RedundancyFactor())
+}
+
+// responsibleRange returns the range of buckets around the given bucket held by a node
+// that's one of n, where each address is held by the r nodes nearest to it
+func responsibleRange(bucket int, n int, r int) GossipRange {
+	if r <= 1 {
+		return FullGossipRange
+	}
+	bits := int(math.Log2(float64(n)/float64(r))) - 1
+	if bits <= 0 {
+		return FullGossipRange
+	}
+	if bits > 8 {
+		bits = 8
+	}
+	width := GossipSummaryBuckets >> uint(bits)
+	from := bucket &^ (width - 1)
+	return GossipRange{From: from, To: from + width - 1}
+}
+
+// summarizeBuckets builds the digest of each bucket and the root digest over all of them
+func summarizeBuckets(buckets map[int][]summaryPut) (summary []GossipBucket, root []byte) {
+	indexes := make([]int, 0, len(buckets))
+	for b := range buckets {
+		indexes = append(indexes, b)
+	}
+	sort.Ints(indexes)
+
+	rootHash := sha256.New()
+	for _, b := range indexes {
+		fps := make([]string, len(buckets[b]))
+		for i, sp := range buckets[b] {
+			fps[i] = string(sp.f)
+		}
+		sort.Strings(fps)
+		h := sha256.New()
+		for _, f := range fps {
+			h.Write([]byte(f))
+		}
+		digest := h.Sum(nil)
+		summary = append(summary, GossipBucket{Index: b, Count: len(fps), Digest: digest})
+		rootHash.Write([]byte{byte(b)})
+		rootHash.Write(digest)
+	}
+	root = rootHash.Sum(nil)
+	return
+}
+
+func (dht *DHT) getGossipMode(id peer.ID) GossipMode {
+	dht.gmlk.RLock()
+	defer dht.gmlk.RUnlock()
+	return dht.gossipModes[id]
+}
+
+func (dht *DHT) setGossipMode(id peer.ID, mode GossipMode) {
+	dht.gmlk.Lock()
+	defer dht.gmlk.Unlock()
+	dht.gossipModes[id] = mode
+}
+
+// summaryResponse builds the response to a summary request
+func (dht *DHT) summaryResponse(req GossipSummaryReq) (summary GossipSummary, count int, err error) {
+	if !req.Range.valid() {
+		err = ErrInvalidGossipRange
+		return
+	}
+	// get the index before the puts so that we never claim more than we sent
+	summary.Idx, err = dht.GetIdx()
+	if err != nil {
+		return
+	}
+	var buckets map[int][]summaryPut
+	buckets, err = dht.bucketPuts(req.Range)
+	if err != nil {
+		return
+	}
+	var root []byte
+	summary.Buckets, root = summarizeBuckets(buckets)
+	if string(root) == string(req.Root) {
+		summary.InSync = true
+		summary.Buckets = nil
+		return
+	}
+	for _, b := range summary.Buckets {
+		count += b.Count
+	}
+	return
+}
+
+// fetchResponse builds the response to a fetch request
+func (dht *DHT) fetchResponse(req GossipFetchReq) (g Gossip, err error) {
+	have := make(map[Hash]bool)
+	for _, f := range req.Have {
+		have[f] = true
+	}
+	want := make(map[Hash]bool)
+	for _, f := range req.Want {
+		want[f] = true
+	}
+	var buckets map[int][]summaryPut
+	buckets, err = dht.bucketPuts(FullGossipRange)
+	if err != nil {
+		return
+	}
+	for _, b := range req.Buckets {
+		for _, sp := range buckets[b] {
+			if sp.p.Idx > req.After && !have[sp.f] {
+				g.Puts = append(g.Puts, sp.p)
+				delete(want, sp.f)
+			}
+		}
+	}
+	if len(want) > 0 {
+		for _, sps := range buckets {
+			for _, sp := range sps {
+				if sp.p.Idx > req.After && want[sp.f] {
+					g.Puts = append(g.Puts, sp.p)
+				}
+			}
+		}
+	}
+	sort.Slice(g.Puts, func(i, j int) bool { return g.Puts[i].Idx < g.Puts[j].Idx })
+	if max := dht.h.Config.GossipMaxPuts; max > 0 && len(g.Puts) > max {
+		g.Puts = g.Puts[:max]
+		g.More = true
+	}
+	return
+}
+
+// fetchPuts sends a fetch request to a peer, asking again for the puts after the last
+// one sent while the peer has more puts than it will send in one response
+func (dht *DHT) fetchPuts(id peer.ID, req GossipFetchReq) (puts []Put, err error) {
+	for {
+		var x interface{}
+		msg := dht.h.node.NewMessage(GOSSIP_FETCH_REQUEST, req)
+		x, err = dht.h.Send(dht.h.node.ctx, GossipProtocol, id, msg, 0)
+		if err != nil {
+			return
+		}
+		g := x.(Gossip)
+		puts = append(puts, g.Puts...)
+		if !g.More || len(g.Puts) == 0 {
+			return
+		}
+		got := make(map[Hash]bool)
+		for _, p := range g.Puts {
+			var f Hash
+			f, err = p.M.Fingerprint()
+			if err != nil {
+				return
+			}
+			got[f] = true
+		}
+		req.After = g.Puts[len(g.Puts)-1].Idx
+		var want []Hash
+		for _, f := range req.Want {
+			if !got[f] {
+				want = append(want, f)
+			}
+		}
+		req.Want = want
+	}
+}
+
+// gossipModeOf returns the gossip mode that goes with the gossip protocol version a peer sent
+func gossipModeOf(version int) GossipMode {
+	if version >= GossipSummaryVersion {
+		return GossipModeSummary
+	}
+	return GossipModeIndex
+}
+
+// probeGossipMode finds out which gossip protocol a peer understands by sending it a gossip
+// request for the puts after any it could have, which peers of every version answer
+// without sending any puts, and then looking at the version it responds with
+func (dht *DHT) probeGossipMode(id peer.ID, myIdx int) (mode GossipMode, err error) {
+	var x interface{}
+	msg := dht.h.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: myIdx, YourIdx: math.MaxInt32, Version: GossipVersion})
+	x, err = dht.h.Send(dht.h.node.ctx, GossipProtocol, id, msg, 0)
+	if err != nil {
+		return
+	}
+	mode = gossipModeOf(x.(Gossip).Version)
+	dht.glog.Logf("%v runs gossip version %d", id, x.(Gossip).Version)
+	dht.setGossipMode(id, mode)
+	return
+}
+
+// gossipSummaryWith exchanges range summaries with a peer and queues up the puts we are
+// missing.  The peer must be known to understand summaries.
+func (dht *DHT) gossipSummaryWith(id peer.ID, myIdx int, r GossipRange) (err error) {
+	var buckets map[int][]summaryPut
+	buckets, err = dht.bucketPuts(r)
+	if err != nil {
+		return
+	}
+	mine, root := summarizeBuckets(buckets)
+
+	var x interface{}
+	msg := dht.h.node.NewMessage(GOSSIP_SUMMARY_REQUEST, GossipSummaryReq{MyIdx: myIdx, Range: r, Root: root})
+	x, err = dht.h.Send(dht.h.node.ctx, GossipProtocol, id, msg, 0)
+	if err != nil {
+		return
+	}
+	summary := x.(GossipSummary)
+	if summary.InSync {
+		dht.glog.Logf("in sync with %v", id)
+		dht.glog.Log("no new puts received")
+		err = dht.UpdateGossiper(id, summary.Idx)
+		return
+	}
+
+	digests := make(map[int][]byte)
+	for _, b := range mine {
+		digests[b.Index] = b.Digest
+	}
+	var req GossipFetchReq
+	for _, b := range summary.Buckets {
+		if string(digests[b.Index]) == string(b.Digest) {
+			continue
+		}
+		req.Buckets = append(req.Buckets, b.Index)
+		for _, sp := range buckets[b.Index] {
+			req.Have = append(req.Have, sp.f)
+		}
+	}
+
+	if len(req.Buckets) > 0 {
+		dht.glog.Logf("fetching %d buckets from %v", len(req.Buckets), id)
+		var puts []Put
+		puts, err = dht.fetchPuts(id, req)
+		if err != nil {
+			return
+		}
+		if len(puts) > 0 {
+			dht.glog.Logf("queuing %d puts:\n%v", len(puts), puts)
+			for _, p := range puts {
+				dht.gossipPuts <- p
+			}
+		} else {
+			dht.glog.Log("no new puts received")
+		}
+	} else {
+		dht.glog.Log("no new puts received")
+	}
+	err = dht.UpdateGossiper(id, summary.Idx)
+	return
+}
@@ -0,0 +1,240 @@
+package holochain
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGossipRange(t *testing.T) {
+	Convey("FullGossipRange should contain all the buckets", t, func() {
+		So(FullGossipRange.valid(), ShouldBeTrue)
+		So(FullGossipRange.Contains(0), ShouldBeTrue)
+		So(FullGossipRange.Contains(GossipSummaryBuckets-1), ShouldBeTrue)
+		So(FullGossipRange.Contains(GossipSummaryBuckets), ShouldBeFalse)
+	})
+	Convey("ranges should be inclusive", t, func() {
+		r := GossipRange{From: 10, To: 20}
+		So(r.Contains(9), ShouldBeFalse)
+		So(r.Contains(10), ShouldBeTrue)
+		So(r.Contains(20), ShouldBeTrue)
+		So(r.Contains(21), ShouldBeFalse)
+	})
+	Convey("invalid ranges should be detected", t, func() {
+		So(GossipRange{From: 20, To: 10}.valid(), ShouldBeFalse)
+		So(GossipRange{From: -1, To: 10}.valid(), ShouldBeFalse)
+		So(GossipRange{From: 0, To: GossipSummaryBuckets}.valid(), ShouldBeFalse)
+	})
+	Convey("GossipBucketOf should use the first byte of the digest", t, func() {
+		h, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqz2")
+		So(GossipBucketOf(h), ShouldEqual, int(h[2]))
+		So(GossipBucketOf(NullHash()), ShouldEqual, 0)
+	})
+}
+
+func TestSummarizeBuckets(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("summaries of the same puts should match", t, func() {
+		b1, err := h.dht.bucketPuts(FullGossipRange)
+		So(err, ShouldBeNil)
+		b2, err := h.dht.bucketPuts(FullGossipRange)
+		So(err, ShouldBeNil)
+		s1, root1 := summarizeBuckets(b1)
+		s2, root2 := summarizeBuckets(b2)
+		So(len(s1), ShouldBeGreaterThan, 0)
+		So(s1, ShouldResemble, s2)
+		So(root1, ShouldResemble, root2)
+	})
+
+	Convey("summaries should change when puts are added", t, func() {
+		b1, _ := h.dht.bucketPuts(FullGossipRange)
+		_, root1 := summarizeBuckets(b1)
+		commit(h, "oddNumbers", "3")
+		b2, _ := h.dht.bucketPuts(FullGossipRange)
+		_, root2 := summarizeBuckets(b2)
+		So(root1, ShouldNotResemble, root2)
+	})
+
+	Convey("summaryResponse should say we're in sync if the roots match", t, func() {
+		b, _ := h.dht.bucketPuts(FullGossipRange)
+		_, root := summarizeBuckets(b)
+		summary, count, err := h.dht.summaryResponse(GossipSummaryReq{Range: FullGossipRange, Root: root})
+		So(err, ShouldBeNil)
+		So(summary.InSync, ShouldBeTrue)
+		So(len(summary.Buckets), ShouldEqual, 0)
+		So(count, ShouldEqual, 0)
+		idx, _ := h.dht.GetIdx()
+		So(summary.Idx, ShouldEqual, idx)
+	})
+
+	Convey("summaryResponse should reject invalid ranges", t, func() {
+		_, _, err := h.dht.summaryResponse(GossipSummaryReq{Range: GossipRange{From: 2, To: 1}})
+		So(err, ShouldEqual, ErrInvalidGossipRange)
+	})
+
+	Convey("fetchResponse should only return puts we don't have", t, func() {
+		b, _ := h.dht.bucketPuts(FullGossipRange)
+		var req GossipFetchReq
+		total := 0
+		for i, puts := range b {
+			req.Buckets = append(req.Buckets, i)
+			total += len(puts)
+		}
+		g, err := h.dht.fetchResponse(req)
+		So(err, ShouldBeNil)
+		So(len(g.Puts), ShouldEqual, total)
+
+		f, _ := g.Puts[0].M.Fingerprint()
+		req.Have = []Hash{f}
+		g, err = h.dht.fetchResponse(req)
+		So(err, ShouldBeNil)
+		So(len(g.Puts), ShouldEqual, total-1)
+		So(g.More, ShouldBeFalse)
+	})
+
+	Convey("fetchResponse should only return puts after the given index", t, func() {
+		b, _ := h.dht.bucketPuts(FullGossipRange)
+		var req GossipFetchReq
+		for i := range b {
+			req.Buckets = append(req.Buckets, i)
+		}
+		all, _ := h.dht.fetchResponse(req)
+		req.After = all.Puts[0].Idx
+		g, err := h.dht.fetchResponse(req)
+		So(err, ShouldBeNil)
+		So(len(g.Puts), ShouldEqual, len(all.Puts)-1)
+		So(g.Puts[0].Idx, ShouldBeGreaterThan, req.After)
+	})
+
+	Convey("bucketPuts should add new puts to the cached buckets and rebuild them after compaction", t, func() {
+		b1, _ := h.dht.bucketPuts(FullGossipRange)
+		idx, _ := h.dht.GetIdx()
+		So(h.dht.summaryIdx, ShouldEqual, idx)
+		commit(h, "oddNumbers", "5")
+		b2, _ := h.dht.bucketPuts(FullGossipRange)
+		count := func(b map[int][]summaryPut) (n int) {
+			for _, sps := range b {
+				n += len(sps)
+			}
+			return
+		}
+		So(count(b2), ShouldBeGreaterThan, count(b1))
+		h.dht.resetBucketPuts()
+		So(h.dht.summaryIdx, ShouldEqual, 0)
+		b3, _ := h.dht.bucketPuts(FullGossipRange)
+		So(count(b3), ShouldEqual, count(b2))
+	})
+
+	Convey("gossipRange should cover the buckets around our address we hold", t, func() {
+		So(h.dht.gossipRange(), ShouldResemble, FullGossipRange)
+		So(responsibleRange(0x93, 10, 0), ShouldResemble, FullGossipRange)
+		So(responsibleRange(0x93, 10, 5), ShouldResemble, FullGossipRange)
+		So(responsibleRange(0x93, 40, 5), ShouldResemble, GossipRange{From: 0x80, To: 0xbf})
+		So(responsibleRange(0x93, 1000, 5), ShouldResemble, GossipRange{From: 0x90, To: 0x93})
+		So(responsibleRange(0x93, 1<<20, 1<<2), ShouldResemble, GossipRange{From: 0x93, To: 0x93})
+	})
+
+	Convey("fetchResponse should be limited to GossipMaxPuts", t, func() {
+		b, _ := h.dht.bucketPuts(FullGossipRange)
+		var req GossipFetchReq
+		for i := range b {
+			req.Buckets = append(req.Buckets, i)
+		}
+		h.Config.GossipMaxPuts = 1
+		defer func() { h.Config.GossipMaxPuts = DefaultGossipMaxPuts }()
+		g, err := h.dht.fetchResponse(req)
+		So(err, ShouldBeNil)
+		So(len(g.Puts), ShouldEqual, 1)
+		So(g.More, ShouldBeTrue)
+	})
+}
+
+func TestGossipSummary(t *testing.T) {
+	nodesCount := 3
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+
+	h0 := nodes[0]
+	h1 := nodes[1]
+	h2 := nodes[2]
+
+	commit(h0, "oddNumbers", "3")
+	commit(h0, "oddNumbers", "5")
+	commit(h0, "oddNumbers", "7")
+
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+
+	Convey("gossipWith a new peer should fetch only the missing puts via summaries", t, func() {
+		So(h1.dht.getGossipMode(h0.nodeID), ShouldEqual, GossipModeUnknown)
+		err := h1.dht.gossipWith(h0.nodeID)
+		So(err, ShouldBeNil)
+		So(h1.dht.getGossipMode(h0.nodeID), ShouldEqual, GossipModeSummary)
+		So(h0.dht.getGossipMode(h1.nodeID), ShouldEqual, GossipModeSummary)
+		So(len(h1.dht.gossipPuts), ShouldEqual, 5)
+
+		go h1.dht.HandleGossipPuts()
+		time.Sleep(time.Millisecond * 100)
+		puts, _ := h1.dht.GetPuts(0)
+		So(len(puts), ShouldEqual, 7)
+
+		idx, _ := h0.dht.GetIdx()
+		gidx, _ := h1.dht.GetGossiper(h0.nodeID)
+		So(gidx, ShouldEqual, idx)
+	})
+
+	Convey("later gossip with the peer should use the put index", t, func() {
+		commit(h0, "evenNumbers", "2")
+		err := h1.dht.gossipWith(h0.nodeID)
+		So(err, ShouldBeNil)
+		time.Sleep(time.Millisecond * 100)
+		puts, _ := h1.dht.GetPuts(0)
+		So(len(puts), ShouldEqual, 8)
+	})
+
+	Convey("peers known to not understand summaries should get index gossip", t, func() {
+		h2.dht.setGossipMode(h0.nodeID, GossipModeIndex)
+		err := h2.dht.gossipWith(h0.nodeID)
+		So(err, ShouldBeNil)
+		// the index gossip request told h0 our version
+		So(h0.dht.getGossipMode(h2.nodeID), ShouldEqual, GossipModeSummary)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 6)
+	})
+
+	Convey("the gossip version should tell which peers understand summaries", t, func() {
+		So(gossipModeOf(0), ShouldEqual, GossipModeIndex)
+		So(gossipModeOf(GossipSummaryVersion), ShouldEqual, GossipModeSummary)
+
+		mode, err := h2.dht.probeGossipMode(h1.nodeID, 0)
+		So(err, ShouldBeNil)
+		So(mode, ShouldEqual, GossipModeSummary)
+		So(h2.dht.getGossipMode(h1.nodeID), ShouldEqual, GossipModeSummary)
+
+		// peers running a version without summaries send gossip requests without a version
+		m := h2.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: 0, YourIdx: math.MaxInt32})
+		r, err := GossipReceiver(h0, m)
+		So(err, ShouldBeNil)
+		So(r.(Gossip).Version, ShouldEqual, GossipVersion)
+		So(len(r.(Gossip).Puts), ShouldEqual, 0)
+		So(h0.dht.getGossipMode(h2.nodeID), ShouldEqual, GossipModeIndex)
+	})
+
+	Convey("fetchPuts should keep asking while the peer has more puts", t, func() {
+		b, _ := h0.dht.bucketPuts(FullGossipRange)
+		var req GossipFetchReq
+		for i := range b {
+			req.Buckets = append(req.Buckets, i)
+		}
+		all, _ := h0.dht.GetPuts(0)
+		h0.Config.GossipMaxPuts = 2
+		defer func() { h0.Config.GossipMaxPuts = DefaultGossipMaxPuts }()
+		puts, err := h2.dht.fetchPuts(h0.nodeID, req)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, len(all))
+	})
+}
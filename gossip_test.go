@@ -256,6 +256,32 @@ func TestGossipData(t *testing.T) {
 		So(fmt.Sprintf("%v", puts[0].M), ShouldEqual, fmt.Sprintf("%v", *m2))
 		So(puts[0].Idx, ShouldEqual, 4)
 	})
+
+	Convey("GetPuts should leave out puts whose changes have expired", t, func() {
+		e := GobEntry{C: "126"}
+		_, hd, _ := h.NewEntry(now, "evenNumbers", &e)
+		m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hd.EntryLink, TTL: 60})
+		m.Time = time.Now().Add(-time.Hour)
+		err := dht.Put(m, "evenNumbers", hd.EntryLink, h.nodeID, []byte("126"), StatusLive)
+		So(err, ShouldBeNil)
+		idx, _ := dht.GetIdx()
+		So(idx, ShouldEqual, 5)
+
+		puts, err := dht.GetPuts(4)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, 1)
+		So(puts[0].Idx, ShouldEqual, 4)
+	})
+
+	Convey("expired changes should not be held", t, func() {
+		e := GobEntry{C: "128"}
+		_, hd, _ := h.NewEntry(now, "evenNumbers", &e)
+		m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hd.EntryLink, TTL: 60})
+		m.Time = time.Now().Add(-time.Hour)
+		_, err := ActionReceiver(h, m)
+		So(err, ShouldEqual, ErrChangeExpired)
+		So(dht.Exists(hd.EntryLink, StatusAny), ShouldEqual, ErrHashNotFound)
+	})
 }
 
 func TestGossip(t *testing.T) {
@@ -298,6 +324,24 @@ func TestGossip(t *testing.T) {
 		puts2, _ = h2.dht.GetPuts(0)
 		So(len(puts2), ShouldEqual, 9)
 	})
+
+	Convey("gossip reaching back before the checkpoint should say the puts were compacted", t, func() {
+		_, err := h1.dht.Compact(time.Now())
+		So(err, ShouldBeNil)
+		checkpoint, _ := h1.dht.GetCheckpoint()
+		So(checkpoint, ShouldBeGreaterThan, 0)
+
+		r, err := GossipReceiver(h1, h1.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: 1, YourIdx: 1}))
+		So(err, ShouldBeNil)
+		So(r.(Gossip).Checkpoint, ShouldEqual, checkpoint)
+
+		r, err = GossipReceiver(h1, h1.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: 1, YourIdx: checkpoint + 1}))
+		So(err, ShouldBeNil)
+		So(r.(Gossip).Checkpoint, ShouldEqual, 0)
+
+		err = h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+	})
 }
 
 func TestPeerLists(t *testing.T) {
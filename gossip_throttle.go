@@ -0,0 +1,137 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// gossip_throttle implements per-peer rate limiting of gossip and put requests with a
+// token bucket for each peer, so that one chatty or malicious peer can't saturate a node
+
+package holochain
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+const (
+	// DefaultGossipRateLimit is the number of gossip and put requests per second
+	// allowed from each peer
+	DefaultGossipRateLimit = 100
+
+	// DefaultGossipBurst is the number of requests a peer can make in a burst before
+	// being held to the rate limit
+	DefaultGossipBurst = 500
+
+	// DefaultGossipMaxPuts is the most puts sent in response to one gossip request,
+	// the requester asks again for the rest
+	DefaultGossipMaxPuts = 1000
+)
+
+// ThrottledPeer records a peer that has been throttled
+type ThrottledPeer struct {
+	ID    peer.ID
+	Count int       // number of times the peer went over the limit
+	Last  time.Time // when the peer last went over the limit
+}
+
+var ErrThrottled = errors.New("peer throttled")
+
+type tokenBucket struct {
+	tokens    float64
+	last      time.Time
+	throttled bool
+}
+
+// peerLimiter holds a token bucket for each peer
+type peerLimiter struct {
+	rate    float64 // tokens added per second, zero means no limit
+	burst   float64
+	lk      sync.Mutex
+	buckets map[peer.ID]*tokenBucket
+	expired time.Time // when idle buckets were last expired
+}
+
+func newPeerLimiter(rate float64, burst int) *peerLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &peerLimiter{rate: rate, burst: float64(burst), buckets: make(map[peer.ID]*tokenBucket)}
+}
+
+// allow takes a token from the peer's bucket returning false if there are none left,
+// and whether this request is the one that went over the limit
+func (l *peerLimiter) allow(id peer.ID, now time.Time) (ok bool, started bool) {
+	if l.rate <= 0 {
+		ok = true
+		return
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if now.Sub(l.expired) >= l.refill() {
+		l.expire(now)
+	}
+	b, found := l.buckets[id]
+	if !found {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[id] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.throttled = false
+		ok = true
+		return
+	}
+	started = !b.throttled
+	b.throttled = true
+	return
+}
+
+// refill returns how long it takes an empty bucket to fill up to the burst
+func (l *peerLimiter) refill() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// expire drops the buckets that have been idle long enough to fill back up, as they are
+// no different from the new bucket a peer gets on its next request
+func (l *peerLimiter) expire(now time.Time) {
+	for id, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, id)
+		}
+	}
+	l.expired = now
+}
+
+// throttle returns ErrThrottled if the peer has gone over its rate limit, recording
+// the peer in the hash table each time it goes over
+func (dht *DHT) throttle(id peer.ID) (err error) {
+	if id == dht.h.nodeID {
+		return
+	}
+	now := time.Now()
+	ok, started := dht.limiter.allow(id, now)
+	if ok {
+		return
+	}
+	if started {
+		dht.glog.Logf("throttling %v", id)
+		if e := dht.ht.AddThrottled(id, now); e != nil {
+			dht.glog.Logf("error recording throttled peer %v: %v", id, e)
+		}
+	}
+	err = ErrThrottled
+	return
+}
+
+// GetThrottled returns the peers that have been throttled
+func (dht *DHT) GetThrottled() (throttled []ThrottledPeer, err error) {
+	throttled, err = dht.ht.GetThrottled()
+	return
+}
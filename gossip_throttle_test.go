@@ -0,0 +1,186 @@
+package holochain
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPeerLimiter(t *testing.T) {
+	node, err := makeNode(1234, "")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+	id := node.HashAddr
+	now := time.Now()
+
+	Convey("a limiter with no rate should allow everything", t, func() {
+		l := newPeerLimiter(0, 0)
+		for i := 0; i < 100; i++ {
+			ok, _ := l.allow(id, now)
+			So(ok, ShouldBeTrue)
+		}
+	})
+
+	Convey("a limiter should allow a burst and then hold the peer to the rate", t, func() {
+		l := newPeerLimiter(10, 3)
+		for i := 0; i < 3; i++ {
+			ok, _ := l.allow(id, now)
+			So(ok, ShouldBeTrue)
+		}
+		ok, started := l.allow(id, now)
+		So(ok, ShouldBeFalse)
+		So(started, ShouldBeTrue)
+		ok, started = l.allow(id, now)
+		So(ok, ShouldBeFalse)
+		So(started, ShouldBeFalse)
+
+		// a tenth of a second later gives one more token
+		ok, _ = l.allow(id, now.Add(100*time.Millisecond))
+		So(ok, ShouldBeTrue)
+		ok, started = l.allow(id, now.Add(100*time.Millisecond))
+		So(ok, ShouldBeFalse)
+		So(started, ShouldBeTrue)
+
+		// buckets never fill past the burst
+		for i := 0; i < 3; i++ {
+			ok, _ := l.allow(id, now.Add(time.Hour))
+			So(ok, ShouldBeTrue)
+		}
+		ok, _ = l.allow(id, now.Add(time.Hour))
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("a limiter should drop the buckets of peers that have gone idle", t, func() {
+		l := newPeerLimiter(10, 3)
+		other := peer.ID("other")
+		l.allow(id, now)
+		l.allow(other, now)
+		So(len(l.buckets), ShouldEqual, 2)
+
+		// the peer that keeps making requests keeps its bucket
+		later := now.Add(l.refill())
+		for i := 0; i < 3; i++ {
+			l.allow(id, later.Add(-time.Millisecond))
+		}
+		l.allow(id, later)
+		So(len(l.buckets), ShouldEqual, 1)
+		So(l.buckets[other], ShouldBeNil)
+		ok, _ := l.allow(id, later)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func testHTThrottled(ht HashTable) {
+	node, err := makeNode(1234, "")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+	id := node.HashAddr
+
+	throttled, err := ht.GetThrottled()
+	So(err, ShouldBeNil)
+	So(len(throttled), ShouldEqual, 0)
+
+	at := time.Unix(1, 0)
+	So(ht.AddThrottled(id, at), ShouldBeNil)
+	So(ht.AddThrottled(id, at.Add(time.Second)), ShouldBeNil)
+	throttled, err = ht.GetThrottled()
+	So(err, ShouldBeNil)
+	So(len(throttled), ShouldEqual, 1)
+	So(throttled[0].ID, ShouldEqual, id)
+	So(throttled[0].Count, ShouldEqual, 2)
+	So(throttled[0].Last.Equal(at.Add(time.Second)), ShouldBeTrue)
+}
+
+func TestHTThrottled(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+
+	Convey("BuntHT should record throttled peers", t, func() {
+		ht := &BuntHT{}
+		ht.Open(filepath.Join(d, "bunt-"+DHTStoreFileName))
+		defer ht.Close()
+		testHTThrottled(ht)
+	})
+
+	Convey("BoltHT should record throttled peers", t, func() {
+		ht := &BoltHT{}
+		ht.Open(filepath.Join(d, "bolt-"+DHTStoreFileName))
+		defer ht.Close()
+		testHTThrottled(ht)
+	})
+}
+
+func TestGossipThrottling(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+
+	h0 := nodes[0]
+	h1 := nodes[1]
+
+	commit(h0, "oddNumbers", "3")
+	commit(h0, "oddNumbers", "5")
+	commit(h0, "oddNumbers", "7")
+
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+	h1.dht.setGossipMode(h0.nodeID, GossipModeIndex)
+
+	Convey("gossip responses should be limited to GossipMaxPuts with the rest to follow", t, func() {
+		h0.Config.GossipMaxPuts = 2
+		m := h1.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: 1, YourIdx: 1})
+		r, err := GossipReceiver(h0, m)
+		So(err, ShouldBeNil)
+		g := r.(Gossip)
+		So(len(g.Puts), ShouldEqual, 2)
+		So(g.More, ShouldBeTrue)
+		So(g.Through, ShouldEqual, g.Puts[1].Idx)
+
+		count := len(g.Puts)
+		for g.More {
+			m = h1.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: 1, YourIdx: g.Through + 1})
+			r, err = GossipReceiver(h0, m)
+			So(err, ShouldBeNil)
+			g = r.(Gossip)
+			So(len(g.Puts), ShouldBeLessThanOrEqualTo, 2)
+			count += len(g.Puts)
+		}
+		idx, _ := h0.dht.GetIdx()
+		So(count, ShouldEqual, idx)
+		h0.Config.GossipMaxPuts = DefaultGossipMaxPuts
+	})
+
+	Convey("peers going over the rate limit should be throttled and recorded", t, func() {
+		h0.dht.limiter = newPeerLimiter(1, 2)
+		defer func() { h0.dht.limiter = newPeerLimiter(0, 0) }()
+		gm := h1.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: 1, YourIdx: 1})
+		_, err := GossipReceiver(h0, gm)
+		So(err, ShouldBeNil)
+		_, err = GossipReceiver(h0, gm)
+		So(err, ShouldBeNil)
+		_, err = GossipReceiver(h0, gm)
+		So(err, ShouldEqual, ErrThrottled)
+
+		m := h1.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: HashFromPeerID(h1.nodeID)})
+		_, err = ActionReceiver(h0, m)
+		So(err, ShouldEqual, ErrThrottled)
+
+		throttled, err := h0.dht.GetThrottled()
+		So(err, ShouldBeNil)
+		So(len(throttled), ShouldEqual, 1)
+		So(throttled[0].ID, ShouldEqual, h1.nodeID)
+		So(throttled[0].Count, ShouldEqual, 1)
+
+		// a throttled peer gets the error over the wire
+		_, err = h1.Send(h1.node.ctx, GossipProtocol, h0.nodeID, gm, 0)
+		So(err, ShouldEqual, ErrThrottled)
+	})
+}
@@ -21,6 +21,14 @@ type Signature struct {
 	S []byte
 }
 
+const (
+	// LegacyHeaderVersion headers are signed over their entry link only
+	LegacyHeaderVersion = uint64(0)
+
+	// HeaderVersion headers are signed over every field, so new headers are made at this version
+	HeaderVersion = uint64(1)
+)
+
 // Header holds chain links, type, timestamp and signature
 type Header struct {
 	Type       string
@@ -30,6 +38,7 @@ type Header struct {
 	TypeLink   Hash // link to header of previous header of this type
 	Sig        Signature
 	Change     Hash
+	Version    uint64 // what the signature covers, see HeaderVersion
 }
 
 // newHeader makes Header object linked to a previous Header by hash
@@ -41,18 +50,17 @@ func newHeader(hashSpec HashSpec, now time.Time, t string, entry Entry, privKey
 	hd.HeaderLink = prev
 	hd.TypeLink = prevType
 	hd.Change = change
+	hd.Version = HeaderVersion
 
 	hd.EntryLink, err = entry.Sum(hashSpec)
 	if err != nil {
 		return
 	}
 
-	// sign the hash of the entry
-	sig, err := privKey.Sign([]byte(hd.EntryLink))
+	err = hd.sign(hashSpec, privKey)
 	if err != nil {
 		return
 	}
-	hd.Sig = Signature{S: sig}
 
 	hash, _, err = (&hd).Sum(hashSpec)
 	if err != nil {
@@ -72,6 +80,53 @@ func (hd *Header) Sum(spec HashSpec) (hash Hash, b []byte, err error) {
 	return
 }
 
+// unsignedSum returns the hash of the header without its signature, which is what gets
+// signed so that the signature covers every field of the header and not just the entry
+func (hd *Header) unsignedSum(spec HashSpec) (hash Hash, err error) {
+	unsigned := *hd
+	unsigned.Sig = Signature{}
+	hash, _, err = unsigned.Sum(spec)
+	return
+}
+
+// sign signs the header with the private key
+func (hd *Header) sign(spec HashSpec, privKey ic.PrivKey) (err error) {
+	var hash Hash
+	hash, err = hd.unsignedSum(spec)
+	if err != nil {
+		return
+	}
+	var sig []byte
+	sig, err = privKey.Sign([]byte(hash))
+	if err != nil {
+		return
+	}
+	hd.Sig = Signature{S: sig}
+	return
+}
+
+// FullySigned returns true if the header's signature covers every field of the header.
+// Legacy headers only sign their entry link, so nothing else in them can be attributed
+// to the signer.
+func (hd *Header) FullySigned() bool {
+	return hd.Version >= HeaderVersion
+}
+
+// VerifySig returns true if the header was signed by the private key of the public key
+func (hd *Header) VerifySig(spec HashSpec, pubKey ic.PubKey) (matches bool, err error) {
+	if !hd.FullySigned() {
+		matches, err = pubKey.Verify([]byte(hd.EntryLink), hd.Sig.S)
+		return
+	}
+	var hash Hash
+	hash, err = hd.unsignedSum(spec)
+	if err != nil {
+		return
+	}
+	matches, err = pubKey.Verify([]byte(hash), hd.Sig.S)
+	return
+}
+
 // B58String encodes a signature as a b58string
 func (sig Signature) B58String() (result string) {
 	return b58.Encode(sig.S)
@@ -162,9 +217,9 @@ func MarshalHeader(writer io.Writer, hd *Header) (err error) {
 		return
 	}
 
-	// write out 0 for future expansion (meta)
-	z := uint64(0)
-	err = binary.Write(writer, binary.LittleEndian, &z)
+	// the version takes the place of the 0 that legacy headers wrote out for future
+	// expansion (meta), so their encoding, and thus their hashes, are unchanged
+	err = binary.Write(writer, binary.LittleEndian, &hd.Version)
 	if err != nil {
 		return
 	}
@@ -234,8 +289,7 @@ func UnmarshalHeader(reader io.Reader, hd *Header, hashSize int) (err error) {
 		return
 	}
 
-	z := uint64(0)
-	err = binary.Read(reader, binary.LittleEndian, &z)
+	err = binary.Read(reader, binary.LittleEndian, &hd.Version)
 	if err != nil {
 		return
 	}
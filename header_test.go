@@ -40,6 +40,31 @@ func TestHeaderNew(t *testing.T) {
 		h2, _ = Sum(h, b)
 		So(h2.String(), ShouldEqual, hash.String())
 	})
+
+	Convey("it should sign the whole header", t, func() {
+		e := GobEntry{C: "some data"}
+		ph := NullHash()
+		_, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, NullHash())
+		So(err, ShouldBeNil)
+		matches, err := header.VerifySig(h, key.GetPublic())
+		So(err, ShouldBeNil)
+		So(matches, ShouldBeTrue)
+
+		header.HeaderLink, _ = NewHash("QmNiCwBNA8MWDADTFVq1BonUEJbS2SvjAoNkZZrhEwcuUi")
+		matches, err = header.VerifySig(h, key.GetPublic())
+		So(err, ShouldBeNil)
+		So(matches, ShouldBeFalse)
+	})
+
+	Convey("it should verify the entry link signatures of legacy headers", t, func() {
+		e := GobEntry{C: "1234"}
+		hd := testHeader(h, "evenNumbers", &e, key, now)
+		So(hd.Version, ShouldEqual, LegacyHeaderVersion)
+		So(hd.FullySigned(), ShouldBeFalse)
+		matches, err := hd.VerifySig(h, key.GetPublic())
+		So(err, ShouldBeNil)
+		So(matches, ShouldBeTrue)
+	})
 }
 
 func TestHeaderToJSON(t *testing.T) {
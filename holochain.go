@@ -40,6 +40,13 @@ const (
 	DefaultSendTimeout = 3000 * time.Millisecond
 )
 
+// SetContext sets the chain name and node ID included in the lines of JSON loggers
+func (loggers *Loggers) SetContext(chain string, nodeID string) {
+	for _, l := range []*Logger{&loggers.App, &loggers.Debug, &loggers.DHT, &loggers.World, &loggers.Gossip, &loggers.TestPassed, &loggers.TestFailed, &loggers.TestInfo} {
+		l.SetContext(chain, nodeID)
+	}
+}
+
 // Loggers holds the logging structures for the different parts of the system
 type Loggers struct {
 	App        Logger
@@ -63,11 +70,28 @@ type Config struct {
 	BootstrapServer  string
 	Loggers          Loggers
 
+	GossipRateLimit float64 // gossip and put requests per second allowed from each peer, zero for no limit
+	GossipBurst     int     // requests a peer can make in a burst before being held to the limit
+	GossipMaxPuts   int     // most puts sent in response to one gossip request
+
+	EnableAdmin bool // serve the admin api on localhost while the node is running
+	AdminPort   int  // port for the admin api, zero for any free port
+
+	TraceExport string // file, or http url of an OTLP collector, to export trace spans to, empty for no tracing
+
+	ReputationDeprioritize float64 // score below which peers are picked last as nearest peers, zero for never
+	ReputationBlock        float64 // score below which peers are blocked, zero for never
+
+	VerifyChain bool // re-verify every header and entry of the source chain, including app validation, on startup
+
 	holdingCheckInterval     time.Duration
 	gossipInterval           time.Duration
 	bootstrapRefreshInterval time.Duration
 	routingRefreshInterval   time.Duration
 	retryInterval            time.Duration
+	expiryInterval           time.Duration
+	handoffInterval          time.Duration
+	reputationInterval       time.Duration
 }
 
 // Progenitor holds data on the creator of the DNA
@@ -95,10 +119,13 @@ type Holochain struct {
 	chain            *Chain // This node's local source chain
 	world            *World
 	bridgeDB         *buntdb.DB
+	tracer           *Tracer
+	reputation       *Reputation
 	validateProtocol *Protocol
 	gossipProtocol   *Protocol
 	actionProtocol   *Protocol
 	asyncSends       chan error
+	ribosomes        *ribosomePool
 }
 
 func (h *Holochain) Nucleus() (n *Nucleus) {
@@ -194,8 +221,12 @@ func InitializeHolochain() {
 		gob.Register(FindNodeReq{})
 		gob.Register(CloserPeersResp{})
 		gob.Register(PeerInfo{})
+		gob.Register(GossipSummaryReq{})
+		gob.Register(GossipSummary{})
+		gob.Register(GossipFetchReq{})
 
 		RegisterBultinRibosomes()
+		RegisterBuiltinHashTables()
 
 		infoLog.New(nil)
 		infoLog.Enabled = true
@@ -288,6 +319,10 @@ func (h *Holochain) createNode() (err error) {
 	}
 	listenaddr := fmt.Sprintf("/ip4/%s/tcp/%d", ip, h.Config.DHTPort)
 	h.node, err = NewNode(listenaddr, h.dnaHash.String(), h.Agent().(*LibP2PAgent), h.Config.EnableNATUPnP, &h.Config.Loggers.Debug)
+	if err != nil {
+		return
+	}
+	h.node.routingTable.Deprioritized = h.deprioritized
 	return
 }
 
@@ -304,8 +339,14 @@ func (h *Holochain) Prepare() (err error) {
 	if err = h.PrepareHashType(); err != nil {
 		return
 	}
+	h.Config.Loggers.SetContext(h.Name(), h.nodeIDStr)
+
+	if err = h.startTracing(); err != nil {
+		return
+	}
 
 	h.asyncSends = make(chan error, 10)
+	h.ribosomes = newRibosomePool(DefaultRibosomePoolSize)
 
 	err = h.createNode()
 	if err != nil {
@@ -316,7 +357,7 @@ func (h *Holochain) Prepare() (err error) {
 	h.nucleus.h = h
 
 	if h.Config.EnableWorldModel {
-		h.world = NewWorld(h.node.HashAddr, h.dht, &h.Config.Loggers.World)
+		h.world = NewWorld(h.node.HashAddr, h.dht.ht, &h.Config.Loggers.World)
 	}
 
 	var peerList PeerList
@@ -326,6 +367,57 @@ func (h *Holochain) Prepare() (err error) {
 	}
 
 	h.node.InitBlockedList(peerList)
+	err = h.openReputation()
+	if err != nil {
+		return
+	}
+
+	if h.Config.VerifyChain {
+		err = h.VerifyChain()
+	}
+	return
+}
+
+// VerifyChain checks the whole source chain as it would be checked when committing: the
+// links, hashes and signatures of every pair and the app's validation of every entry. It
+// also checks that the chain was last signed with this agent's key.
+func (h *Holochain) VerifyChain() (err error) {
+	h.Debugf("Verifying chain of %v", h.dnaHash)
+	err = h.chain.Verify(func(key *Hash, header *Header, entry Entry) (err error) {
+		if header.Type == DNAEntryType {
+			return
+		}
+		a := NewCommitAction(header.Type, entry)
+		a.header = header
+		_, err = h.ValidateAction(a, header.Type, nil, []peer.ID{h.nodeID})
+		return
+	})
+	if err != nil || h.chain.Length() == 0 {
+		return
+	}
+	_, top := h.chain.TopType(AgentEntryType)
+	if top == nil {
+		err = errors.New("chain has no agent entry")
+		return
+	}
+	var entry Entry
+	entry, _, err = h.chain.GetEntry(top.EntryLink)
+	if err != nil {
+		return
+	}
+	var ae AgentEntry
+	ae, err = AgentEntryFromJSON(entry.Content().(string))
+	if err != nil {
+		return
+	}
+	var pk string
+	pk, err = h.agent.EncodePubKey()
+	if err != nil {
+		return
+	}
+	if ae.PublicKey != pk {
+		err = errors.New("chain isn't signed with the agent's key")
+	}
 	return
 }
 
@@ -489,10 +581,19 @@ func (h *Holochain) GenChain() (headerHash Hash, err error) {
 	return
 }
 
-func initLogger(l *Logger, envOverride string, writer io.Writer) (err error) {
+func initLogger(l *Logger, envOverride string, jsonOverride string, writer io.Writer) (err error) {
 	if err = l.New(writer); err != nil {
 		return
 	}
+	// the logger's own override takes precedence over the one for all loggers
+	for _, env := range []string{"HCLOG_JSON", jsonOverride} {
+		switch os.Getenv(env) {
+		case "true", "TRUE", "1":
+			l.JSON = true
+		case "false", "FALSE", "0":
+			l.JSON = false
+		}
+	}
 	d := os.Getenv(envOverride)
 	switch d {
 	case "true":
@@ -528,6 +629,11 @@ func (config *Config) Setup() (err error) {
 		}
 	}
 
+	if val, yes := envBoolRequest("HC_VERIFY_CHAIN"); yes {
+		config.VerifyChain = val
+		Debugf("using environment variable to set VerifyChain to: %v", val)
+	}
+
 	gi := os.Getenv("HC_GOSSIP_INTERVAL")
 	if gi != "" {
 		i, _ := strconv.Atoi(gi)
@@ -540,6 +646,12 @@ func (config *Config) Setup() (err error) {
 	config.bootstrapRefreshInterval = BootstrapTTL
 	config.routingRefreshInterval = DefaultRoutingRefreshInterval
 	config.retryInterval = DefaultRetryInterval
+	config.expiryInterval = DefaultExpiryInterval
+	config.handoffInterval = DefaultHandoffInterval
+	config.reputationInterval = DefaultReputationInterval
+	if config.GossipMaxPuts <= 0 {
+		config.GossipMaxPuts = DefaultGossipMaxPuts
+	}
 	err = config.SetupLogging()
 	return
 }
@@ -550,19 +662,19 @@ func (config *Config) SetGossipInterval(interval time.Duration) {
 
 // SetupLogging initializes loggers as configured by the config file and environment variables
 func (config *Config) SetupLogging() (err error) {
-	if err = initLogger(&config.Loggers.Debug, "HCLOG_DEBUG_ENABLE", nil); err != nil {
+	if err = initLogger(&config.Loggers.Debug, "HCLOG_DEBUG_ENABLE", "HCLOG_DEBUG_JSON", nil); err != nil {
 		return
 	}
-	if err = initLogger(&config.Loggers.App, "HCLOG_APP_ENABLE", nil); err != nil {
+	if err = initLogger(&config.Loggers.App, "HCLOG_APP_ENABLE", "HCLOG_APP_JSON", nil); err != nil {
 		return
 	}
-	if err = initLogger(&config.Loggers.DHT, "HCLOG_DHT_ENABLE", nil); err != nil {
+	if err = initLogger(&config.Loggers.DHT, "HCLOG_DHT_ENABLE", "HCLOG_DHT_JSON", nil); err != nil {
 		return
 	}
-	if err = initLogger(&config.Loggers.World, "HCLOG_WORLD_ENABLE", nil); err != nil {
+	if err = initLogger(&config.Loggers.World, "HCLOG_WORLD_ENABLE", "HCLOG_WORLD_JSON", nil); err != nil {
 		return
 	}
-	if err = initLogger(&config.Loggers.Gossip, "HCLOG_GOSSIP_ENABLE", nil); err != nil {
+	if err = initLogger(&config.Loggers.Gossip, "HCLOG_GOSSIP_ENABLE", "HCLOG_GOSSIP_JSON", nil); err != nil {
 		return
 	}
 	if err = config.Loggers.TestPassed.New(nil); err != nil {
@@ -670,6 +782,7 @@ func (h *Holochain) Call(zomeType string, function string, arguments interface{}
 	if err != nil {
 		return
 	}
+	defer h.ReleaseRibosome(z, n)
 	fn, err := z.GetFunctionDef(function)
 	if err != nil {
 		return
@@ -678,20 +791,34 @@ func (h *Holochain) Call(zomeType string, function string, arguments interface{}
 		err = errors.New("function not available")
 		return
 	}
+	span := h.tracer.StartSpan("call "+zomeType+"."+function, SpanContext{})
+	if t, ok := n.(traced); ok {
+		t.setTrace(span.Context())
+		defer t.setTrace(SpanContext{})
+	}
+	start := time.Now()
 	result, err = n.Call(fn, arguments)
+	metricZomeCallDuration.Observe(time.Since(start).Seconds(), h.dnaHash.String(), zomeType, function)
+	span.Finish(err)
 	return
 }
 
-// MakeRibosome creates a Ribosome object based on the zome type
+// MakeRibosome returns a Ribosome object for the zome type, reusing one from the zome's
+// pool if there's a free one, callers should hand it back with ReleaseRibosome when done
 func (h *Holochain) MakeRibosome(t string) (r Ribosome, z *Zome, err error) {
 	z, err = h.GetZome(t)
 	if err != nil {
 		return
 	}
-	r, err = z.MakeRibosome(h)
+	r, err = h.ribosomes.get(h, z)
 	return
 }
 
+// ReleaseRibosome hands a Ribosome object got from MakeRibosome back to the zome's pool
+func (h *Holochain) ReleaseRibosome(z *Zome, r Ribosome) {
+	h.ribosomes.put(z, r)
+}
+
 // GetProperty returns the value of a DNA property
 func (h *Holochain) GetProperty(prop string) (property string, err error) {
 	if prop == ID_PROPERTY || prop == AGENT_ID_PROPERTY || prop == AGENT_NAME_PROPERTY {
@@ -731,6 +858,20 @@ func (h *Holochain) Close() {
 		h.node.Close()
 		h.node = nil
 	}
+	if h.bridgeDB != nil {
+		h.bridgeDB.Close()
+		h.bridgeDB = nil
+	}
+	if h.tracer != nil {
+		h.tracer.Close()
+		h.tracer = nil
+	}
+	if h.reputation != nil {
+		h.reputation.Close()
+		h.reputation = nil
+	}
+	h.ribosomes.close()
+	releaseWASM(h)
 }
 
 // Reset deletes all chain and dht data and resets data structures
@@ -765,6 +906,8 @@ func (h *Holochain) Reset() (err error) {
 		close(h.asyncSends)
 		h.asyncSends = nil
 	}
+	h.ribosomes.close()
+	h.ribosomes = nil
 
 	return
 }
@@ -792,8 +935,9 @@ func (h *Holochain) SendAsync(proto int, to peer.ID, msg *Message, callback *Cal
 		response, err = h.Send(h.node.ctx, proto, to, msg, timeout)
 		if err == nil {
 			var r Ribosome
-			r, _, err := h.MakeRibosome(callback.zomeType)
+			r, z, err := h.MakeRibosome(callback.zomeType)
 			if err == nil {
+				defer h.ReleaseRibosome(z, r)
 				switch t := response.(type) {
 				case AppMsg:
 					//var result interface{}
@@ -859,6 +1003,9 @@ func (h *Holochain) StartBackgroundTasks() {
 	}
 
 	h.node.stoppers[RefreshingStopper] = h.TaskTicker(h.Config.routingRefreshInterval, RoutingRefreshTask)
+	h.node.stoppers[ExpiringStopper] = h.TaskTicker(h.Config.expiryInterval, ExpiryTask)
+	h.node.stoppers[HandoffStopper] = h.TaskTicker(h.Config.handoffInterval, HandoffTask)
+	h.node.stoppers[ReputationStopper] = h.TaskTicker(h.Config.reputationInterval, ReputationTask)
 }
 
 // BootstrapRefreshTask refreshes our node and gets nodes from the bootstrap server
@@ -884,13 +1031,36 @@ func (h *Holochain) Send(basectx context.Context, proto int, to peer.ID, message
 	}
 	ctx, cancel := context.WithTimeout(basectx, timeout)
 	defer cancel()
+	var span *Span
+	if message.Trace.IsValid() {
+		span = h.tracer.StartSpan("send "+message.Type.String(), message.Trace)
+	}
+	if span != nil {
+		span.SetAttribute("to", peer.IDB58Encode(to))
+		// send a copy so the message's own context stays that of its sender
+		traced := *message
+		traced.Trace = span.Context()
+		message = &traced
+	}
+	start := time.Now()
+	defer func() {
+		span.Finish(err)
+		dna := h.dnaHash.String()
+		metricSendDuration.Observe(time.Since(start).Seconds(), dna, message.Type.String())
+		if err == SendTimeoutErr {
+			metricSendTimeouts.Inc(dna, message.Type.String())
+			h.penalize(to, SendTimeoutEvent)
+		}
+	}()
 	sent := make(chan error, 1)
 	go func() {
 		// if we are sending to ourselves we should bypass the network mechanics and call
 		// the receiver directly
 		if to == h.node.HashAddr {
 			h.Debugf("Sending message (local):%v (fingerprint:%s)", message, f)
+			span := h.traceReceive(message)
 			response, err = h.node.protocols[proto].Receiver(h, message)
+			span.Finish(err)
 			h.Debugf("send result (local): %v (fp:%s)error:%v", response, f, err)
 		} else {
 			h.Debugf("Sending message to %v (net):%v (fingerprint:%s)", to, message, f)
@@ -999,7 +1169,13 @@ func (h *Holochain) Query(options *QueryOptions) (results []QueryResult, err err
 	var equalsMap, containsMap map[string]interface{}
 	var reMap map[string]*regexp.Regexp
 	defs := make(map[string]*EntryDef)
-	for i, header := range chain.Headers {
+	for i := 0; i < chain.Length(); i++ {
+		var header *Header
+		header, err = chain.header(i)
+		if err != nil {
+			return
+		}
+		var entry Entry
 
 		var def *EntryDef
 		var ok bool
@@ -1025,14 +1201,18 @@ func (h *Holochain) Query(options *QueryOptions) (results []QueryResult, err err
 		if !skip && (options.Constrain.Equals != "" || options.Constrain.Contains != "" || options.Constrain.Matches != "") {
 			var content string
 			var contentMap map[string]interface{}
+			entry, err = chain.entry(i)
+			if err != nil {
+				return
+			}
 			if def.DataFormat == DataFormatJSON {
 				contentMap = make(map[string]interface{})
-				err = json.Unmarshal([]byte(chain.Entries[i].Content().(string)), &contentMap)
+				err = json.Unmarshal([]byte(entry.Content().(string)), &contentMap)
 				if err != nil {
 					return
 				}
 			} else {
-				content = chain.Entries[i].Content().(string)
+				content = entry.Content().(string)
 			}
 
 			if !skip && options.Constrain.Equals != "" {
@@ -1124,7 +1304,13 @@ func (h *Holochain) Query(options *QueryOptions) (results []QueryResult, err err
 			// Return values gets limited down to the actual info in the Ribosomes
 			qr := QueryResult{Header: header}
 			if options.Return.Entries {
-				qr.Entry = chain.Entries[i]
+				if entry == nil {
+					entry, err = chain.entry(i)
+					if err != nil {
+						return
+					}
+				}
+				qr.Entry = entry
 			}
 			if options.Order.Ascending {
 				results = append([]QueryResult{qr}, results...)
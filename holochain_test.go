@@ -97,6 +97,17 @@ func TestSetupConfig(t *testing.T) {
 	os.Unsetenv("HC_GOSSIP_INTERVAL")
 	os.Unsetenv("HC_HOLDING_INTERVAL")
 
+	Convey("it should enable chain verification from the environment", t, func() {
+		config := Config{}
+		os.Setenv("HC_VERIFY_CHAIN", "true")
+		config.Setup()
+		So(config.VerifyChain, ShouldBeTrue)
+		os.Setenv("HC_VERIFY_CHAIN", "0")
+		config.Setup()
+		So(config.VerifyChain, ShouldBeFalse)
+	})
+	os.Unsetenv("HC_VERIFY_CHAIN")
+
 }
 
 func TestSetupLogging(t *testing.T) {
@@ -215,6 +226,35 @@ func TestPrepare(t *testing.T) {
 	//@todo build out test for other tests for prepare
 }
 
+func TestVerifyChain(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	commit(h, "evenNumbers", "2")
+
+	Convey("it should verify a chain of valid entries", t, func() {
+		So(h.VerifyChain(), ShouldBeNil)
+	})
+
+	Convey("it should fail if the chain isn't signed with the agent's key", t, func() {
+		agent := h.agent
+		other, _ := NewAgent(LibP2P, "other agent", MakeTestSeed("other"))
+		h.agent = other
+		So(h.VerifyChain().Error(), ShouldEqual, "chain isn't signed with the agent's key")
+		h.agent = agent
+	})
+
+	Convey("it should fail at an entry that doesn't pass app validation after a reload", t, func() {
+		_, err := h.chain.AddEntry(time.Now(), "evenNumbers", &GobEntry{C: "1"}, h.agent.PrivKey())
+		So(err, ShouldBeNil)
+		l := h.chain.Length()
+		h.chain.Close()
+		h.chain, err = NewChainFromFile(h.hashSpec, filepath.Join(h.DBPath(), StoreFileName))
+		So(err, ShouldBeNil)
+		err = h.VerifyChain()
+		So(err.Error(), ShouldStartWith, fmt.Sprintf("chain verification failed at index %d (evenNumbers): Validation Failed", l-1))
+	})
+}
+
 func TestPrepareHashType(t *testing.T) {
 
 	Convey("A bad hash type should return an error", t, func() {
@@ -747,7 +787,7 @@ func TestGetEntryDef(t *testing.T) {
 		zome, def, err := h.GetEntryDef("evenNumbers")
 		So(err, ShouldBeNil)
 		So(zome.Name, ShouldEqual, "zySampleZome")
-		So(fmt.Sprintf("%v", def), ShouldEqual, "&{evenNumbers zygo public  <nil>}")
+		So(fmt.Sprintf("%v", def), ShouldEqual, "&{evenNumbers zygo public  0 <nil> <nil>}")
 	})
 	Convey("it should get sys entry definitions", t, func() {
 		zome, def, err := h.GetEntryDef(DNAEntryType)
@@ -8,9 +8,14 @@
 package holochain
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"sort"
+	"strings"
+	"time"
 )
 
 const (
@@ -26,6 +31,7 @@ const (
 	StatusRejected = 0x02
 	StatusDeleted  = 0x04
 	StatusModified = 0x08
+	StatusForked   = 0x10
 	StatusAny      = 0xFF
 
 	// constants for the stored string status values in buntdb and for building code
@@ -34,6 +40,7 @@ const (
 	StatusRejectedVal = "2"
 	StatusDeletedVal  = "4"
 	StatusModifiedVal = "8"
+	StatusForkedVal   = "16"
 	StatusAnyVal      = "255"
 
 	// constants for system reseved tags (start with 2 underscores)
@@ -71,11 +78,36 @@ type TaggedHash struct {
 	Source    string // the statuses on the link, gets filled if options set Load to true
 }
 
+const (
+	// orderings of paged GetLinks results
+
+	LinkOrderHash = "hash"
+	LinkOrderTime = "time"
+)
+
+// LinkPage specifies a page of GetLinks results
+type LinkPage struct {
+	Order  string // LinkOrderHash (the default) or LinkOrderTime
+	Limit  int    // maximum number of links to return, 0 for no limit
+	Cursor string // the Next value from the previous page, or empty for the first page
+}
+
+// linkRecord holds a link found by a HashTable scan before it gets paged
+type linkRecord struct {
+	th   TaggedHash
+	link string
+	tag  string
+	time int64 // time the link was first made in nanoseconds since epoch
+}
+
 var ErrLinkNotFound = errors.New("link not found")
+var ErrInvalidLinkOrder = errors.New("invalid link order")
+var ErrTooManyLinks = errors.New("too many links, request them in pages")
 var ErrPutLinkOverDeleted = errors.New("putlink over deleted link")
 var ErrHashDeleted = errors.New("hash deleted")
 var ErrHashModified = errors.New("hash modified")
 var ErrHashRejected = errors.New("hash rejected")
+var ErrHashForked = errors.New("hash forked")
 var ErrEntryTypeMismatch = errors.New("entry type mismatch")
 
 type HashTableIterateFn func(hash Hash) (stop bool)
@@ -98,9 +130,32 @@ type HashTable interface {
 	// Mod moves the given hash to the StatusModified status
 	Mod(msg *Message, key Hash, newkey Hash) (err error)
 
+	// Fork moves the given hash to the StatusForked status. Forks are found by each node
+	// from the headers it holds so the change isn't recorded for gossiping.
+	Fork(key Hash) (err error)
+
 	// Exists checks for the existence of the hash in the table
 	Exists(key Hash, statusMask int) (err error)
 
+	// Forget removes all the data held for a hash, including links on it, without
+	// recording a change. Used when a hash moves out of the node's neighborhood.
+	Forget(key Hash) (err error)
+
+	// Compact drops the payloads of entries deleted or modified before the given time,
+	// keeping their status as tombstones, and rewrites the change log up to a new
+	// checkpoint without the puts that are no longer needed
+	Compact(before time.Time) (stats CompactStats, err error)
+
+	// GetCheckpoint returns the index up to which the change log has been compacted
+	GetCheckpoint() (idx int, err error)
+
+	// Export returns the entries, links and change log held in the table
+	Export() (archive DHTArchive, err error)
+
+	// Sweep removes the entries and links that have expired by the given time,
+	// returning how many were removed
+	Sweep(now time.Time) (swept int, err error)
+
 	// Source returns the source node address of a given hash
 	Source(key Hash) (id peer.ID, err error)
 
@@ -116,6 +171,9 @@ type HashTable interface {
 	// GetLinks retrieves meta value associated with a base
 	GetLinks(base Hash, tag string, statusMask int) (results []TaggedHash, err error)
 
+	// GetLinksPage retrieves one page of the links on a base and the cursor of the next page
+	GetLinksPage(base Hash, tag string, statusMask int, page LinkPage) (results []TaggedHash, next string, err error)
+
 	// GetIdx returns the current index of changes to the HashTable
 	GetIdx() (idx int, err error)
 
@@ -131,6 +189,210 @@ type HashTable interface {
 	// Iterate call fn on all the hashes in the table
 	Iterate(fn HashTableIterateFn)
 
+	// GetFingerprint returns the index of the message that made a change or -1 if we don't have it
+	GetFingerprint(f Hash) (index int, err error)
+
+	// GetPuts returns a list of puts after the given index
+	GetPuts(since int) (puts []Put, err error)
+
+	// GetGossiper returns the last known index of the gossiper
+	GetGossiper(id peer.ID) (idx int, err error)
+
+	// UpdateGossiper sets the last known index of a gossiper if it's greater than the current one
+	UpdateGossiper(id peer.ID, newIdx int) (err error)
+
+	// DeleteGossiper removes a gossiper from the table
+	DeleteGossiper(id peer.ID) (err error)
+
+	// GetGossipers returns the ids of all the gossipers in the table
+	GetGossipers() (glist []peer.ID, err error)
+
+	// GetList returns the peer list of the given type
+	GetList(listType PeerListType) (result PeerList, err error)
+
+	// AddToList adds the peers to a list
+	AddToList(m *Message, list PeerList) (err error)
+
+	// AddThrottled records that a peer went over its rate limit at the given time
+	AddThrottled(id peer.ID, at time.Time) (err error)
+
+	// GetThrottled returns the peers that have been throttled
+	GetThrottled() (throttled []ThrottledPeer, err error)
+
+	// PutAgentHeader records a header signed by an agent under the header it follows,
+	// unless one is already recorded there, and as the agent's latest header if it's newer
+	PutAgentHeader(agent peer.ID, header *Header) (err error)
+
+	// GetAgentHeader returns the header recorded for an agent as following the given header
+	GetAgentHeader(agent peer.ID, headerLink Hash) (header Header, err error)
+
+	// GetAgentHead returns the latest header recorded for an agent
+	GetAgentHead(agent peer.ID) (header Header, err error)
+
 	// GetReceipts returns a list of receipts that were generated regarding a hash
 	//GetReceipts()
 }
+
+// HashTableFactory creates an unopened HashTable instance
+type HashTableFactory func() HashTable
+
+const (
+	// BuntHTType is the name of the in-memory buntdb based HashTable
+	BuntHTType = "buntdb"
+
+	// BoltHTType is the name of the disk-backed boltdb based HashTable
+	BoltHTType = "boltdb"
+
+	// DefaultHashTableType is used when the DNA doesn't specify a HashTable type
+	DefaultHashTableType = BuntHTType
+)
+
+var hashTableFactories = make(map[string]HashTableFactory)
+
+// RegisterHashTable sets up a HashTable to be used by the CreateHashTable function
+func RegisterHashTable(name string, factory HashTableFactory) {
+	if factory == nil {
+		panic(fmt.Sprintf("HashTable factory for type %s does not exist.", name))
+	}
+	_, registered := hashTableFactories[name]
+	if registered {
+		panic(fmt.Sprintf("HashTable factory for type %s already registered. ", name))
+	}
+	hashTableFactories[name] = factory
+}
+
+// RegisterBuiltinHashTables adds the built in HashTable types to the factory hash
+func RegisterBuiltinHashTables() {
+	RegisterHashTable(BuntHTType, func() HashTable { return &BuntHT{} })
+	RegisterHashTable(BoltHTType, func() HashTable { return &BoltHT{} })
+}
+
+// CreateHashTable returns a new unopened HashTable of the given type
+func CreateHashTable(name string) (HashTable, error) {
+	if name == "" {
+		name = DefaultHashTableType
+	}
+	factory, ok := hashTableFactories[name]
+	if !ok {
+		// Factory has not been registered.
+		// Make a list of all available HashTable factories for error.
+		var available []string
+		for k := range hashTableFactories {
+			available = append(available, k)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("Invalid HashTable name. Must be one of: %s", strings.Join(available, ", "))
+	}
+
+	return factory(), nil
+}
+
+// dumpIdx converts message and data of a DHT change request to a string for human consumption
+func dumpIdx(ht HashTable, idx int) (str string, err error) {
+	var msg Message
+	msg, err = ht.GetIdxMessage(idx)
+	if err != nil {
+		return
+	}
+	f, _ := msg.Fingerprint()
+	str = fmt.Sprintf("MSG (fingerprint %v):\n   %v\n", f, msg)
+	switch msg.Type {
+	case PUT_REQUEST:
+		key := msg.Body.(HoldReq).EntryHash
+		entry, entryType, _, _, e := ht.Get(key, StatusDefault, GetMaskAll)
+		if e != nil {
+			err = fmt.Errorf("couldn't get %v err:%v ", key, e)
+			return
+		} else {
+			str += fmt.Sprintf("DATA: type:%s entry: %v\n", entryType, entry)
+		}
+	}
+	return
+}
+
+// dumpIdxJSON converts message and data of a DHT change request to a JSON string representation.
+func dumpIdxJSON(ht HashTable, idx int) (str string, err error) {
+	var msg Message
+	var buffer bytes.Buffer
+	var msgField, dataField string
+	msg, err = ht.GetIdxMessage(idx)
+
+	if err != nil {
+		return "", err
+	}
+
+	f, _ := msg.Fingerprint()
+	buffer.WriteString(fmt.Sprintf("{ \"index\": %d,", idx))
+	msgField = fmt.Sprintf("\"message\": { \"fingerprint\": \"%v\", \"content\": \"%v\" },", f, msg)
+
+	switch msg.Type {
+	case PUT_REQUEST:
+		key := msg.Body.(HoldReq).EntryHash
+		entry, entryType, _, _, e := ht.Get(key, StatusAny, GetMaskAll)
+		if e != nil {
+			err = fmt.Errorf("couldn't get %v err:%v ", key, e)
+			return
+		}
+		dataField = fmt.Sprintf("\"data\": { \"type\": \"%s\", \"entry\": \"%v\" }", entryType, entry)
+	}
+
+	if len(dataField) > 0 {
+		buffer.WriteString(msgField)
+		buffer.WriteString(dataField)
+	} else {
+		buffer.WriteString(strings.TrimSuffix(msgField, ","))
+	}
+	buffer.WriteString("}")
+	return PrettyPrintJSON(buffer.Bytes())
+}
+
+// linkCursor returns the position of a link in the given ordering
+func linkCursor(order string, l *linkRecord) string {
+	if order == LinkOrderTime {
+		return fmt.Sprintf("%020d:%s:%s", l.time, l.link, l.tag)
+	}
+	return l.link + ":" + l.tag
+}
+
+// pageLinks orders the links and returns those that come after the page's cursor,
+// along with the cursor for the next page, which is empty if this is the last page
+func pageLinks(links []linkRecord, page LinkPage) (results []TaggedHash, next string, err error) {
+	order := page.Order
+	if order == "" {
+		order = LinkOrderHash
+	}
+	if order != LinkOrderHash && order != LinkOrderTime {
+		err = ErrInvalidLinkOrder
+		return
+	}
+	cursors := make([]string, len(links))
+	for i := range links {
+		cursors[i] = linkCursor(order, &links[i])
+	}
+	sort.Sort(linkRecordSorter{links, cursors})
+
+	results = make([]TaggedHash, 0)
+	for i := range links {
+		if page.Cursor != "" && cursors[i] <= page.Cursor {
+			continue
+		}
+		if page.Limit > 0 && len(results) == page.Limit {
+			next = cursors[i-1]
+			break
+		}
+		results = append(results, links[i].th)
+	}
+	return
+}
+
+type linkRecordSorter struct {
+	links   []linkRecord
+	cursors []string
+}
+
+func (s linkRecordSorter) Len() int           { return len(s.links) }
+func (s linkRecordSorter) Less(a, b int) bool { return s.cursors[a] < s.cursors[b] }
+func (s linkRecordSorter) Swap(a, b int) {
+	s.links[a], s.links[b] = s.links[b], s.links[a]
+	s.cursors[a], s.cursors[b] = s.cursors[b], s.cursors[a]
+}
@@ -1,12 +1,584 @@
 package holochain
 
 import (
-	//	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestHT(t *testing.T) {
-	Convey("", t, func() {
+	Convey("it should create registered hash tables", t, func() {
+		ht, err := CreateHashTable("")
+		So(err, ShouldBeNil)
+		_, ok := ht.(*BuntHT)
+		So(ok, ShouldBeTrue)
+
+		ht, err = CreateHashTable(BoltHTType)
+		So(err, ShouldBeNil)
+		_, ok = ht.(*BoltHT)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("it should fail to create unknown hash tables", t, func() {
+		_, err := CreateHashTable("foo")
+		So(err.Error(), ShouldEqual, "Invalid HashTable name. Must be one of: boltdb, buntdb")
+	})
+
+	Convey("it should not allow re-registering a hash table type", t, func() {
+		So(func() { RegisterHashTable(BuntHTType, func() HashTable { return &BuntHT{} }) }, ShouldPanic)
+	})
+}
+
+// the functions below make up the suite that every HashTable implementation must pass
+
+func testHTPutGetModDel(t *testing.T, ht HashTable, node *Node) {
+	var id = node.HashAddr
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	var idx int
+
+	Convey("It should store and retrieve", t, func() {
+		err := ht.Put(node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash}), "someType", hash, id, []byte("some value"), StatusLive)
+		So(err, ShouldBeNil)
+		idx, _ = ht.GetIdx()
+
+		data, entryType, sources, status, err := ht.Get(hash, StatusLive, GetMaskAll)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "some value")
+		So(entryType, ShouldEqual, "someType")
+		So(status, ShouldEqual, StatusLive)
+		So(sources[0], ShouldEqual, id.Pretty())
+
+		badhash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+		data, entryType, _, _, err = ht.Get(badhash, StatusLive, GetMaskDefault)
+		So(entryType, ShouldEqual, "")
+		So(err, ShouldEqual, ErrHashNotFound)
+	})
+
+	Convey("It should iterate", t, func() {
+		hlist := make([]Hash, 0)
+		ht.Iterate(func(hsh Hash) bool {
+			hlist = append(hlist, hsh)
+			return true
+		})
+		So(len(hlist), ShouldEqual, 1)
+		So(hlist[0].String(), ShouldEqual, hash.String())
+	})
+
+	Convey("mod should move the hash to the modified status and record replacedBy link", t, func() {
+		newhashStr := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh4"
+		newhash, _ := NewHash(newhashStr)
+
+		m := node.NewMessage(MOD_REQUEST, HoldReq{RelatedHash: hash, EntryHash: newhash})
+
+		err := ht.Mod(m, hash, newhash)
+		So(err, ShouldBeNil)
+		data, entryType, _, status, err := ht.Get(hash, StatusAny, GetMaskAll)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "some value")
+		So(entryType, ShouldEqual, "someType")
+		So(status, ShouldEqual, StatusModified)
+
+		afterIdx, _ := ht.GetIdx()
+
+		So(afterIdx-idx, ShouldEqual, 1)
+
+		data, entryType, _, status, err = ht.Get(hash, StatusLive, GetMaskDefault)
+		So(err, ShouldEqual, ErrHashNotFound)
+
+		data, entryType, _, status, err = ht.Get(hash, StatusDefault, GetMaskDefault)
+		So(err, ShouldEqual, ErrHashModified)
+		// replaced by link gets returned in the data!!
+		So(string(data), ShouldEqual, newhashStr)
+
+		links, err := ht.GetLinks(hash, SysTagReplacedBy, StatusLive)
+		So(err, ShouldBeNil)
+		So(len(links), ShouldEqual, 1)
+		So(links[0].H, ShouldEqual, newhashStr)
+	})
+
+	Convey("del should move the hash to the deleted status", t, func() {
+		m := node.NewMessage(DEL_REQUEST, HoldReq{RelatedHash: hash})
+
+		err := ht.Del(m, hash)
+		So(err, ShouldBeNil)
+
+		data, entryType, _, status, err := ht.Get(hash, StatusAny, GetMaskAll)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "some value")
+		So(entryType, ShouldEqual, "someType")
+		So(status, ShouldEqual, StatusDeleted)
+
+		afterIdx, _ := ht.GetIdx()
+
+		So(afterIdx-idx, ShouldEqual, 2)
+
+		data, entryType, _, status, err = ht.Get(hash, StatusLive, GetMaskDefault)
+		So(err, ShouldEqual, ErrHashNotFound)
+
+		data, entryType, _, status, err = ht.Get(hash, StatusDefault, GetMaskDefault)
+		So(err, ShouldEqual, ErrHashDeleted)
+
+	})
+}
+
+func testHTLinking(t *testing.T, ht HashTable, node *Node) {
+	var id = node.HashAddr
+
+	baseStr := "QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRr"
+	base, err := NewHash(baseStr)
+	if err != nil {
+		panic(err)
+	}
+	linkingEntryHashStr := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3"
+	linkingEntryHash, _ := NewHash(linkingEntryHashStr)
+	linkHash1Str := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1"
+	linkHash1, _ := NewHash(linkHash1Str)
+	linkHash2Str := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2"
+	Convey("It should fail if hash doesn't exist", t, func() {
+		err := ht.PutLink(nil, baseStr, linkHash1Str, "tag foo")
+		So(err, ShouldEqual, ErrHashNotFound)
+
+		v, err := ht.GetLinks(base, "tag foo", StatusLive)
+		So(v, ShouldBeNil)
+		So(err, ShouldEqual, ErrHashNotFound)
+	})
+
+	err = ht.Put(node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: base}), "someType", base, id, []byte("some value"), StatusLive)
+	if err != nil {
+		panic(err)
+	}
+
+	// the message doesn't actually matter for this test because it only gets used later in gossiping
+	fakeMsg := node.NewMessage(LINK_REQUEST, HoldReq{RelatedHash: linkHash1, EntryHash: linkingEntryHash})
+
+	Convey("It should store and retrieve links values on a base", t, func() {
+		data, err := ht.GetLinks(base, "tag foo", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 0)
+
+		err = ht.PutLink(fakeMsg, baseStr, linkHash1Str, "tag foo")
+		So(err, ShouldBeNil)
+
+		err = ht.PutLink(fakeMsg, baseStr, linkHash2Str, "tag foo")
+		So(err, ShouldBeNil)
+
+		err = ht.PutLink(fakeMsg, baseStr, linkHash1Str, "tag bar")
+		So(err, ShouldBeNil)
+
+		data, err = ht.GetLinks(base, "tag foo", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 2)
+		m := data[0]
+
+		So(m.H, ShouldEqual, linkHash1Str)
+		m = data[1]
+		So(m.H, ShouldEqual, linkHash2Str)
+
+		data, err = ht.GetLinks(base, "tag bar", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 1)
+		So(data[0].H, ShouldEqual, linkHash1Str)
+	})
+
+	Convey("It should store and retrieve a links source", t, func() {
+		err = ht.PutLink(fakeMsg, baseStr, linkHash1Str, "tag source")
+		So(err, ShouldBeNil)
+
+		data, err := ht.GetLinks(base, "tag source", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 1)
+
+		data, err = ht.GetLinks(base, "tag source", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 1)
+		So(data[0].Source, ShouldEqual, id.Pretty())
+	})
+
+	Convey("It should work to put a link a second time", t, func() {
+		err = ht.PutLink(fakeMsg, baseStr, linkHash1Str, "tag foo")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("It should fail delete links non existent links bases and tags", t, func() {
+		badHashStr := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqhX"
+
+		err := ht.DelLink(fakeMsg, badHashStr, linkHash1Str, "tag foo")
+		So(err, ShouldEqual, ErrHashNotFound)
+		err = ht.DelLink(fakeMsg, baseStr, badHashStr, "tag foo")
+		So(err, ShouldEqual, ErrLinkNotFound)
+		err = ht.DelLink(fakeMsg, baseStr, linkHash1Str, "tag baz")
+		So(err, ShouldEqual, ErrLinkNotFound)
+	})
+
+	Convey("It should delete links", t, func() {
+		err := ht.DelLink(fakeMsg, baseStr, linkHash1Str, "tag bar")
+		So(err, ShouldBeNil)
+		data, err := ht.GetLinks(base, "tag bar", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 0)
+
+		err = ht.DelLink(fakeMsg, baseStr, linkHash1Str, "tag foo")
+		So(err, ShouldBeNil)
+		data, err = ht.GetLinks(base, "tag foo", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 1)
+
+		err = ht.DelLink(fakeMsg, baseStr, linkHash2Str, "tag foo")
+		So(err, ShouldBeNil)
+		data, err = ht.GetLinks(base, "tag foo", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 0)
+	})
+}
+
+func testHTLinkPaging(t *testing.T, ht HashTable, node *Node) {
+	var id = node.HashAddr
+
+	base, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRp")
+	err := ht.Put(node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: base}), "someType", base, id, []byte("some value"), StatusLive)
+	if err != nil {
+		panic(err)
+	}
+	linkingEntryHash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+	links := []string{
+		"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh4",
+		"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1",
+		"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3",
+		"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2",
+	}
+	// link them in the above order at increasing times
+	now := time.Now()
+	for i, l := range links {
+		m := node.NewMessage(LINK_REQUEST, HoldReq{RelatedHash: base, EntryHash: linkingEntryHash})
+		m.Time = now.Add(time.Duration(i) * time.Second)
+		err = ht.PutLink(m, base.String(), l, "tag page")
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	Convey("it should return all links in one page without a limit", t, func() {
+		data, next, err := ht.GetLinksPage(base, "tag page", StatusLive, LinkPage{})
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, "")
+		So(len(data), ShouldEqual, 4)
+	})
+
+	Convey("it should page links ordered by hash", t, func() {
+		data, next, err := ht.GetLinksPage(base, "tag page", StatusLive, LinkPage{Limit: 3})
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 3)
+		So(data[0].H, ShouldEqual, links[1])
+		So(data[1].H, ShouldEqual, links[3])
+		So(data[2].H, ShouldEqual, links[2])
+		So(next, ShouldNotEqual, "")
+
+		data, next, err = ht.GetLinksPage(base, "tag page", StatusLive, LinkPage{Limit: 3, Cursor: next})
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 1)
+		So(data[0].H, ShouldEqual, links[0])
+		So(next, ShouldEqual, "")
+	})
+
+	Convey("it should page links ordered by time", t, func() {
+		var got []string
+		var cursor string
+		for {
+			data, next, err := ht.GetLinksPage(base, "tag page", StatusLive, LinkPage{Order: LinkOrderTime, Limit: 2, Cursor: cursor})
+			So(err, ShouldBeNil)
+			for _, th := range data {
+				got = append(got, th.H)
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		So(got, ShouldResemble, links)
+	})
+
+	Convey("it should reject unknown orders", t, func() {
+		_, _, err := ht.GetLinksPage(base, "tag page", StatusLive, LinkPage{Order: "bogus"})
+		So(err, ShouldEqual, ErrInvalidLinkOrder)
+	})
+}
+
+func testHTForget(t *testing.T, ht HashTable, node *Node) {
+	var id = node.HashAddr
+	base, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRf")
+	other, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRg")
+	linkingEntryHash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+	for _, h := range []Hash{base, other} {
+		err := ht.Put(node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: h}), "someType", h, id, []byte("some value"), StatusLive)
+		if err != nil {
+			panic(err)
+		}
+		err = ht.PutLink(node.NewMessage(LINK_REQUEST, HoldReq{RelatedHash: h, EntryHash: linkingEntryHash}), h.String(), linkingEntryHash.String(), "tag forget")
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	Convey("Forget should remove a hash and its links without touching others", t, func() {
+		idx, _ := ht.GetIdx()
+		err := ht.Forget(base)
+		So(err, ShouldBeNil)
+		So(ht.Exists(base, StatusAny), ShouldEqual, ErrHashNotFound)
+		_, err = ht.GetLinks(base, "tag forget", StatusLive)
+		So(err, ShouldEqual, ErrHashNotFound)
+
+		So(ht.Exists(other, StatusLive), ShouldBeNil)
+		links, err := ht.GetLinks(other, "tag forget", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(links), ShouldEqual, 1)
+
+		// forgetting isn't a change so isn't gossiped
+		afterIdx, _ := ht.GetIdx()
+		So(afterIdx, ShouldEqual, idx)
+	})
+
+	Convey("Forget should fail for unknown hashes", t, func() {
+		So(ht.Forget(base), ShouldEqual, ErrHashNotFound)
+	})
+}
+
+func testHTExpiry(t *testing.T, ht HashTable, node *Node) {
+	var id = node.HashAddr
+	live, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRa")
+	expired, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRb")
+	forever, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRc")
+	linkingEntryHash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+	hourAgo := time.Now().Add(-time.Hour)
+
+	m := node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: live, TTL: 3600})
+	ht.Put(m, "someType", live, id, []byte("live value"), StatusLive)
+	m = node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: expired, TTL: 60})
+	m.Time = hourAgo
+	ht.Put(m, "someType", expired, id, []byte("expired value"), StatusLive)
+	m = node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: forever})
+	ht.Put(m, "someType", forever, id, []byte("forever value"), StatusLive)
+
+	m = node.NewMessage(LINK_REQUEST, HoldReq{RelatedHash: forever, EntryHash: linkingEntryHash, TTL: 60})
+	m.Time = hourAgo
+	ht.PutLink(m, forever.String(), expired.String(), "tag expiry")
+	m = node.NewMessage(LINK_REQUEST, HoldReq{RelatedHash: forever, EntryHash: linkingEntryHash})
+	ht.PutLink(m, forever.String(), live.String(), "tag expiry")
+
+	Convey("expired entries should not be found", t, func() {
+		So(ht.Exists(live, StatusLive), ShouldBeNil)
+		So(ht.Exists(forever, StatusLive), ShouldBeNil)
+		So(ht.Exists(expired, StatusAny), ShouldEqual, ErrHashNotFound)
+		_, _, _, _, err := ht.Get(expired, StatusDefault, GetMaskDefault)
+		So(err, ShouldEqual, ErrHashNotFound)
+	})
+
+	Convey("expired links should not be returned", t, func() {
+		links, err := ht.GetLinks(forever, "tag expiry", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(links), ShouldEqual, 1)
+		So(links[0].H, ShouldEqual, live.String())
+	})
+
+	Convey("Sweep should remove only what has expired", t, func() {
+		swept, err := ht.Sweep(time.Now())
+		So(err, ShouldBeNil)
+		So(swept, ShouldEqual, 2)
+		swept, err = ht.Sweep(time.Now())
+		So(err, ShouldBeNil)
+		So(swept, ShouldEqual, 0)
+
+		swept, err = ht.Sweep(time.Now().Add(2 * time.Hour))
+		So(err, ShouldBeNil)
+		So(swept, ShouldEqual, 1)
+		So(ht.Exists(live, StatusAny), ShouldEqual, ErrHashNotFound)
+		So(ht.Exists(forever, StatusLive), ShouldBeNil)
+	})
+
+	Convey("putting again without a TTL should stop an entry expiring", t, func() {
+		m := node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: live, TTL: 60})
+		ht.Put(m, "someType", live, id, []byte("live value"), StatusLive)
+		m = node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: live})
+		ht.Put(m, "someType", live, id, []byte("live value"), StatusLive)
+		swept, err := ht.Sweep(time.Now().Add(2 * time.Hour))
+		So(err, ShouldBeNil)
+		So(swept, ShouldEqual, 0)
+		So(ht.Exists(live, StatusLive), ShouldBeNil)
+	})
+}
+
+func testHTCompact(t *testing.T, ht HashTable, node *Node) {
+	var id = node.HashAddr
+	deleted, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRd")
+	live, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRe")
+	expired, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRf")
+	forgotten, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRg")
+	twoHoursAgo := time.Now().Add(-2 * time.Hour)
+
+	fingerprint := func(m *Message) Hash {
+		f, _ := m.Fingerprint()
+		return f
+	}
+
+	putDeleted := node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: deleted})
+	putDeleted.Time = twoHoursAgo
+	ht.Put(putDeleted, "someType", deleted, id, []byte("deleted value"), StatusLive)
+	del := node.NewMessage(DEL_REQUEST, HoldReq{RelatedHash: deleted})
+	del.Time = twoHoursAgo
+	ht.Del(del, deleted)
+
+	putLive := node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: live})
+	ht.Put(putLive, "someType", live, id, []byte("live value"), StatusLive)
+
+	putExpired := node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: expired, TTL: 60})
+	putExpired.Time = twoHoursAgo
+	ht.Put(putExpired, "someType", expired, id, []byte("expired value"), StatusLive)
+
+	putForgotten := node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: forgotten})
+	ht.Put(putForgotten, "someType", forgotten, id, []byte("forgotten value"), StatusLive)
+	ht.Forget(forgotten)
+
+	Convey("the checkpoint should start at 0", t, func() {
+		checkpoint, err := ht.GetCheckpoint()
+		So(err, ShouldBeNil)
+		So(checkpoint, ShouldEqual, 0)
+	})
+
+	Convey("Compact should only drop payloads of entries dead for long enough", t, func() {
+		stats, err := ht.Compact(time.Now().Add(-3 * time.Hour))
+		So(err, ShouldBeNil)
+		So(stats.Payloads, ShouldEqual, 0)
+		So(stats.Puts, ShouldEqual, 2) // the puts of the expired entry and of the forgotten one
+		data, _, _, _, _ := ht.Get(deleted, StatusAny, GetMaskEntry)
+		So(string(data), ShouldEqual, "deleted value")
+	})
+
+	Convey("Compact should drop dead payloads and unneeded puts up to a checkpoint", t, func() {
+		idx, _ := ht.GetIdx()
+		stats, err := ht.Compact(time.Now().Add(-time.Hour))
+		So(err, ShouldBeNil)
+		So(stats.Checkpoint, ShouldEqual, idx)
+		So(stats.Payloads, ShouldEqual, 1)
+		So(stats.Puts, ShouldEqual, 2) // the put of the deleted entry and its del
+
+		checkpoint, _ := ht.GetCheckpoint()
+		So(checkpoint, ShouldEqual, idx)
+
+		// the deleted entry is kept as a tombstone
+		data, _, _, status, err := ht.Get(deleted, StatusAny, GetMaskEntry)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, StatusDeleted)
+		So(string(data), ShouldEqual, "")
+		data, _, _, _, err = ht.Get(live, StatusLive, GetMaskEntry)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "live value")
+
+		puts, err := ht.GetPuts(0)
+		So(err, ShouldBeNil)
+		var fingerprints []Hash
+		for _, p := range puts {
+			fingerprints = append(fingerprints, fingerprint(&p.M))
+		}
+		So(fingerprints, ShouldContain, fingerprint(putLive))
+		So(fingerprints, ShouldNotContain, fingerprint(putDeleted))
+		So(fingerprints, ShouldNotContain, fingerprint(del))
+		So(fingerprints, ShouldNotContain, fingerprint(putExpired))
+		So(fingerprints, ShouldNotContain, fingerprint(putForgotten))
+
+		// the fingerprint of the dropped put of a dead entry is kept so it isn't taken
+		// again, but that of a hash we no longer hold is forgotten
+		i, _ := ht.GetFingerprint(fingerprint(putDeleted))
+		So(i, ShouldBeGreaterThan, 0)
+		_, err = ht.GetIdxMessage(i)
+		So(err, ShouldEqual, ErrNoSuchIdx)
+		i, _ = ht.GetFingerprint(fingerprint(del))
+		So(i, ShouldBeGreaterThan, 0)
+		i, _ = ht.GetFingerprint(fingerprint(putForgotten))
+		So(i, ShouldEqual, -1)
+	})
+
+	Convey("compacting again should drop nothing", t, func() {
+		stats, err := ht.Compact(time.Now().Add(-time.Hour))
+		So(err, ShouldBeNil)
+		So(stats.Payloads, ShouldEqual, 0)
+		So(stats.Puts, ShouldEqual, 0)
+	})
+
+	Convey("the dump should skip compacted changes", t, func() {
+		_, err := ht.JSON()
+		So(err, ShouldBeNil)
+	})
+}
+
+func testHTGossipStore(t *testing.T, ht HashTable, node *Node) {
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	m := node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash})
+	gossiper, _ := peer.IDB58Decode("QmNN6oDiV4GsfKDXPVmGLdBLLXCM28Jnm7pz7WD63aiwSG")
+
+	Convey("it should record fingerprints and puts of changes", t, func() {
+		f, _ := m.Fingerprint()
+		idx, err := ht.GetFingerprint(f)
+		So(err, ShouldBeNil)
+		So(idx, ShouldEqual, -1)
+
+		err = ht.Put(m, "someType", hash, node.HashAddr, []byte("some value"), StatusLive)
+		So(err, ShouldBeNil)
+		idx, err = ht.GetFingerprint(f)
+		So(err, ShouldBeNil)
+		So(idx, ShouldEqual, 1)
+
+		puts, err := ht.GetPuts(0)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, 1)
+		So(puts[0].Idx, ShouldEqual, 1)
+		So(puts[0].M.Type, ShouldEqual, PUT_REQUEST)
+
+		puts, err = ht.GetPuts(2)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, 0)
+	})
+
+	Convey("it should keep track of gossipers", t, func() {
+		glist, err := ht.GetGossipers()
+		So(err, ShouldBeNil)
+		So(len(glist), ShouldEqual, 0)
+
+		So(ht.UpdateGossiper(gossiper, 3), ShouldBeNil)
+		idx, err := ht.GetGossiper(gossiper)
+		So(err, ShouldBeNil)
+		So(idx, ShouldEqual, 3)
+
+		// gossiper indexes only ever move forward
+		So(ht.UpdateGossiper(gossiper, 2), ShouldBeNil)
+		idx, _ = ht.GetGossiper(gossiper)
+		So(idx, ShouldEqual, 3)
+
+		glist, err = ht.GetGossipers()
+		So(err, ShouldBeNil)
+		So(glist, ShouldResemble, []peer.ID{gossiper})
+
+		So(ht.DeleteGossiper(gossiper), ShouldBeNil)
+		glist, _ = ht.GetGossipers()
+		So(len(glist), ShouldEqual, 0)
+	})
+
+	Convey("it should store peer lists", t, func() {
+		list, err := ht.GetList(BlockedList)
+		So(err, ShouldBeNil)
+		So(len(list.Records), ShouldEqual, 0)
+
+		lm := node.NewMessage(LISTADD_REQUEST, ListAddReq{ListType: BlockedList, Peers: []string{peer.IDB58Encode(gossiper)}})
+		err = ht.AddToList(lm, PeerList{Type: BlockedList, Records: []PeerRecord{{ID: gossiper, Warrant: "some warrant"}}})
+		So(err, ShouldBeNil)
+
+		list, err = ht.GetList(BlockedList)
+		So(err, ShouldBeNil)
+		So(len(list.Records), ShouldEqual, 1)
+		So(list.Records[0].ID, ShouldEqual, gossiper)
+		So(list.Records[0].Warrant, ShouldEqual, "some warrant")
+
+		idx, _ := ht.GetIdx()
+		So(idx, ShouldEqual, 2)
 	})
 }
@@ -25,10 +25,14 @@ const (
 
 // JSRibosome holds data needed for the Javascript VM
 type JSRibosome struct {
+	tracing
 	h          *Holochain
 	zome       *Zome
 	vm         *otto.Otto
 	lastResult *otto.Value
+	loaded     *otto.Otto // copy of the vm just after the zome's code was loaded
+	limiter    *executionLimiter
+	calls      *jsAsyncCalls
 }
 
 // Type returns the string value under which this ribosome is registered
@@ -37,6 +41,7 @@ func (jsr *JSRibosome) Type() string { return JSRibosomeType }
 // ChainGenesis runs the application genesis function
 // this function gets called after the genesis entries are added to the chain
 func (jsr *JSRibosome) ChainGenesis() (err error) {
+	defer jsr.limit(GenesisCallKind, &err)()
 	err = jsr.boolFn("genesis", "")
 	return
 }
@@ -44,6 +49,7 @@ func (jsr *JSRibosome) ChainGenesis() (err error) {
 // BridgeGenesis runs the bridging genesis function
 // this function gets called on both sides of the bridging
 func (jsr *JSRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	defer jsr.limit(GenesisCallKind, &err)()
 	err = jsr.boolFn("bridgeGenesis", fmt.Sprintf(`%d,"%s","%s"`, side, dnaHash.String(), jsSanitizeString(data)))
 	return
 }
@@ -74,6 +80,7 @@ func (jsr *JSRibosome) boolFn(fnName string, args string) (err error) {
 
 // Receive calls the app receive function for node-to-node messages
 func (jsr *JSRibosome) Receive(from string, msg string) (response string, err error) {
+	defer jsr.limit(ZomeCallKind, &err)()
 	var code string
 	fnName := "receive"
 
@@ -91,6 +98,7 @@ func (jsr *JSRibosome) Receive(from string, msg string) (response string, err er
 
 // BundleCancel calls the app bundleCanceled function
 func (jsr *JSRibosome) BundleCanceled(reason string) (response string, err error) {
+	defer jsr.limit(ZomeCallKind, &err)()
 	var code string
 	fnName := "bundleCanceled"
 	bundle := jsr.h.chain.BundleStarted()
@@ -113,6 +121,7 @@ func (jsr *JSRibosome) BundleCanceled(reason string) (response string, err error
 
 // ValidatePackagingRequest calls the app for a validation packaging request for an action
 func (jsr *JSRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	defer jsr.limit(ValidateCallKind, &err)()
 	var code string
 	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
 	code = fmt.Sprintf(`%s("%s")`, fnName, def.Name)
@@ -203,16 +212,19 @@ func buildJSValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 	}
 	srcs := mkJSSources(sources)
 
-	var pkgObj string
-	if pkg == nil || pkg.Chain == nil {
-		pkgObj = "{}"
-	} else {
-		var j []byte
-		j, err = json.Marshal(pkg.Chain)
-		if err != nil {
-			return
+	p := make(map[string]interface{})
+	if pkg != nil {
+		if pkg.Chain != nil {
+			p["Chain"] = pkg.Chain
 		}
-		pkgObj = fmt.Sprintf(`{"Chain":%s}`, j)
+		if pkg.Status != StatusDefault {
+			p["Status"] = pkg.Status
+		}
+	}
+	var pkgObj []byte
+	pkgObj, err = json.Marshal(p)
+	if err != nil {
+		return
 	}
 	code = fmt.Sprintf(`%s("%s",%s,%s,%s)`, fnName, def.Name, args, pkgObj, srcs)
 
@@ -221,6 +233,7 @@ func buildJSValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 
 // ValidateAction builds the correct validation function based on the action an calls it
 func (jsr *JSRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	defer jsr.limit(ValidateCallKind, &err)()
 	var code string
 	code, err = buildJSValidateAction(action, def, pkg, sources)
 	if err != nil {
@@ -322,6 +335,7 @@ const (
 		`,Rejected:` + StatusRejectedVal +
 		`,Deleted:` + StatusDeletedVal +
 		`,Modified:` + StatusModifiedVal +
+		`,Forked:` + StatusForkedVal +
 		`,Any:` + StatusAnyVal +
 		"}" +
 		`,GetMask:{Default:` + GetMaskDefaultStr +
@@ -364,16 +378,17 @@ func jsSanitizeString(s string) string {
 
 // Call calls the zygo function that was registered with expose
 func (jsr *JSRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	defer jsr.limit(ZomeCallKind, &err)()
 	var code string
 	switch fn.CallingType {
 	case STRING_CALLING:
 		code = fmt.Sprintf(`%s("%s");`, fn.Name, jsSanitizeString(params.(string)))
 	case JSON_CALLING:
 		if params.(string) == "" {
-			code = fmt.Sprintf(`JSON.stringify(%s());`, fn.Name)
+			code = fmt.Sprintf(`%s();`, fn.Name)
 		} else {
 			p := jsSanitizeString(params.(string))
-			code = fmt.Sprintf(`JSON.stringify(%s(JSON.parse("%s")));`, fn.Name, p)
+			code = fmt.Sprintf(`%s(JSON.parse("%s"));`, fn.Name, p)
 		}
 	default:
 		err = errors.New("params type not implemented")
@@ -382,6 +397,13 @@ func (jsr *JSRibosome) Call(fn *FunctionDef, params interface{}) (result interfa
 	jsr.h.Debugf("JS Call: %s", code)
 	var v otto.Value
 	v, err = jsr.vm.Run(code)
+	if err == nil {
+		// the function may return a promise of its result
+		v, err = jsr.settle(v)
+	}
+	if err == nil && fn.CallingType == JSON_CALLING {
+		v, err = jsr.vm.Call("JSON.stringify", nil, v)
+	}
 	if err == nil {
 		if v.IsObject() && v.Class() == "Error" {
 			jsr.h.Debugf("JS Error:\n%v", v)
@@ -570,6 +592,9 @@ func numInterfaceToInt(num interface{}) (val int, ok bool) {
 type fnData struct {
 	apiFn APIFunction
 	f     func([]Arg, APIFunction, otto.FunctionCall) (otto.Value, error)
+	// async sets up the call of functions that have an async version instead of making
+	// it, returning how to convert its result, so the call can be made off the vm
+	async func([]Arg, APIFunction, otto.FunctionCall) (jsConvertFn, error)
 }
 
 func makeOttoObjectFromGetResp(h *Holochain, jsr *JSRibosome, getResp *GetResp) (result interface{}, err error) {
@@ -590,9 +615,10 @@ func makeOttoObjectFromGetResp(h *Holochain, jsr *JSRibosome, getResp *GetResp)
 // NewJSRibosome factory function to build a javascript execution environment for a zome
 func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	jsr := JSRibosome{
-		h:    h,
-		zome: zome,
-		vm:   otto.New(),
+		h:     h,
+		zome:  zome,
+		vm:    otto.New(),
+		calls: newJSAsyncCalls(0),
 	}
 
 	funcs := map[string]fnData{
@@ -704,7 +730,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		},
 		"send": fnData{
 			apiFn: &APIFnSend{},
-			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+			async: func(args []Arg, _f APIFunction, call otto.FunctionCall) (conv jsConvertFn, err error) {
 				f := _f.(*APIFnSend)
 				a := &f.action
 				a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
@@ -746,13 +772,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 						a.options.Timeout = int(timeout.(int64))
 					}
 				}
-
-				var r interface{}
-				r, err = f.Call(h)
-				if err != nil {
-					return
-				}
-				result, err = jsr.vm.ToValue(r)
+				conv = jsr.toValue
 				return
 			},
 		},
@@ -792,9 +812,10 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		},
 		"bridge": fnData{
 			apiFn: &APIFnBridge{},
-			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+			async: func(args []Arg, _f APIFunction, call otto.FunctionCall) (conv jsConvertFn, err error) {
 				f := _f.(*APIFnBridge)
 				hash := args[0].value.(Hash)
+				f.app = hash
 				f.token, f.url, err = h.GetBridgeToken(hash)
 				if err != nil {
 					return
@@ -803,13 +824,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				f.zome = args[1].value.(string)
 				f.function = args[2].value.(string)
 				f.args = args[3].value.(string)
-
-				var r interface{}
-				r, err = f.Call(h)
-				if err != nil {
-					return
-				}
-				result, err = jsr.vm.ToValue(r)
+				conv = jsr.toValue
 				return
 			},
 		},
@@ -823,6 +838,20 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				entry := GobEntry{C: entryStr}
 				f.action.entryType = entryType
 				f.action.entry = &entry
+				if len(call.ArgumentList) == 3 {
+					opts, ok := args[2].value.(map[string]interface{})
+					if ok {
+						ttl, ok := opts["TTL"]
+						if ok {
+							ttlval, ok := numInterfaceToInt(ttl)
+							if !ok {
+								err = errors.New(fmt.Sprintf("expecting int TTL attribute in object, got %T", ttl))
+								return
+							}
+							f.action.ttl = int(ttlval)
+						}
+					}
+				}
 				r, err = f.Call(h)
 				if err != nil {
 					return
@@ -880,9 +909,15 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 					return
 				}
 				err = json.Unmarshal(j, &options)
+				if err != nil {
+					return
+				}
 
 				var r interface{}
 				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
 
 				var code string
 				switch v := r.(type) {
@@ -1005,7 +1040,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		},
 		"get": fnData{
 			apiFn: &APIFnGet{},
-			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+			async: func(args []Arg, _f APIFunction, call otto.FunctionCall) (conv jsConvertFn, err error) {
 				f := _f.(*APIFnGet)
 				options := GetOptions{StatusMask: StatusDefault}
 				if len(call.ArgumentList) == 2 {
@@ -1038,63 +1073,65 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 					}
 				}
 				req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
-				var r interface{}
 				f.action = ActionGet{req: req, options: &options}
-				r, err = f.Call(h)
 				mask := options.GetMask
 				if mask == GetMaskDefault {
 					mask = GetMaskEntry
 				}
-				if err == ErrHashNotFound {
-					// if the hash wasn't found this isn't actually an error
-					// so return nil which is the same as HC.HashNotFound
-					err = nil
-					result = otto.NullValue()
-				} else if err == nil {
-					getResp := r.(GetResp)
-					var singleValueReturn bool
-					if mask&GetMaskEntry != 0 {
-						if GetMaskEntry == mask {
-							singleValueReturn = true
-							var entry interface{}
-							entry, err = makeOttoObjectFromGetResp(h, &jsr, &getResp)
-							if err != nil {
-								return
-							}
-							result, err = jsr.vm.ToValue(entry)
-						}
-					}
-					if mask&GetMaskEntryType != 0 {
-						if GetMaskEntryType == mask {
-							singleValueReturn = true
-							result, err = jsr.vm.ToValue(getResp.EntryType)
-						}
-					}
-					if mask&GetMaskSources != 0 {
-						if GetMaskSources == mask {
-							singleValueReturn = true
-							result, err = jsr.vm.ToValue(getResp.Sources)
-						}
-					}
-					if err == nil && !singleValueReturn {
-						respObj := make(map[string]interface{})
+				conv = func(r interface{}, callErr error) (result otto.Value, err error) {
+					err = callErr
+					if err == ErrHashNotFound {
+						// if the hash wasn't found this isn't actually an error
+						// so return nil which is the same as HC.HashNotFound
+						err = nil
+						result = otto.NullValue()
+					} else if err == nil {
+						getResp := r.(GetResp)
+						var singleValueReturn bool
 						if mask&GetMaskEntry != 0 {
-							var entry interface{}
-							entry, err = makeOttoObjectFromGetResp(h, &jsr, &getResp)
-							if err != nil {
-								return
+							if GetMaskEntry == mask {
+								singleValueReturn = true
+								var entry interface{}
+								entry, err = makeOttoObjectFromGetResp(h, &jsr, &getResp)
+								if err != nil {
+									return
+								}
+								result, err = jsr.vm.ToValue(entry)
 							}
-							respObj["Entry"] = entry
 						}
 						if mask&GetMaskEntryType != 0 {
-							respObj["EntryType"] = getResp.EntryType
+							if GetMaskEntryType == mask {
+								singleValueReturn = true
+								result, err = jsr.vm.ToValue(getResp.EntryType)
+							}
 						}
 						if mask&GetMaskSources != 0 {
-							respObj["Sources"] = getResp.Sources
+							if GetMaskSources == mask {
+								singleValueReturn = true
+								result, err = jsr.vm.ToValue(getResp.Sources)
+							}
+						}
+						if err == nil && !singleValueReturn {
+							respObj := make(map[string]interface{})
+							if mask&GetMaskEntry != 0 {
+								var entry interface{}
+								entry, err = makeOttoObjectFromGetResp(h, &jsr, &getResp)
+								if err != nil {
+									return
+								}
+								respObj["Entry"] = entry
+							}
+							if mask&GetMaskEntryType != 0 {
+								respObj["EntryType"] = getResp.EntryType
+							}
+							if mask&GetMaskSources != 0 {
+								respObj["Sources"] = getResp.Sources
+							}
+							result, err = jsr.vm.ToValue(respObj)
 						}
-						result, err = jsr.vm.ToValue(respObj)
-					}
 
+					}
+					return
 				}
 				return
 			},
@@ -1198,12 +1235,14 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		},
 		"getLinks": fnData{
 			apiFn: &APIFnGetLinks{},
-			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+			async: func(args []Arg, _f APIFunction, call otto.FunctionCall) (conv jsConvertFn, err error) {
 				base := args[0].value.(Hash)
 				tag := args[1].value.(string)
 
 				l := len(call.ArgumentList)
 				options := GetLinksOptions{Load: false, StatusMask: StatusLive}
+				// paged requests get back an object holding the links and the next cursor
+				var paged bool
 				if l == 3 {
 					opts, ok := args[2].value.(map[string]interface{})
 					if ok {
@@ -1225,69 +1264,103 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 							}
 							options.StatusMask = int(maskval)
 						}
-					}
-				}
-				var response interface{}
-				f := _f.(*APIFnGetLinks)
-				f.action = *NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options)
-				response, err = f.Call(h)
-
-				if err == nil {
-					// we build up our response by creating the javascript object
-					// that we want and using otto to create it with vm.
-					// TODO: is there a faster way to do this?
-					lqr := response.(*LinkQueryResp)
-					var js string
-					for i, th := range lqr.Links {
-						var l string
-						l = `Hash:"` + th.H + `"`
-						if tag == "" {
-							l += `,Tag:"` + jsSanitizeString(th.T) + `"`
-						}
-						if options.Load {
-							l += `,EntryType:"` + jsSanitizeString(th.EntryType) + `"`
-							l += `,Source:"` + jsSanitizeString(th.Source) + `"`
-							var def *EntryDef
-							_, def, err = h.GetEntryDef(th.EntryType)
-							if err != nil {
-								break
+						order, ok := opts["Order"]
+						if ok {
+							orderval, ok := order.(string)
+							if !ok {
+								err = errors.New(fmt.Sprintf("expecting string Order attribute in object, got %T", order))
+								return
 							}
-							var entry string
-							switch def.DataFormat {
-							case DataFormatRawJS:
-								entry = th.E
-							case DataFormatRawZygo:
-								fallthrough
-							case DataFormatSysKey:
-								// key is a b58 encoded public key so the entry is just the string value
-								fallthrough
-							case DataFormatString:
-								entry = `"` + jsSanitizeString(th.E) + `"`
-							case DataFormatLinks:
-								fallthrough
-							case DataFormatJSON:
-								entry = `JSON.parse("` + jsSanitizeString(th.E) + `")`
-							default:
-								err = errors.New("data format not implemented: " + def.DataFormat)
+							options.Order = orderval
+							paged = true
+						}
+						limit, ok := opts["Limit"]
+						if ok {
+							limitval, ok := numInterfaceToInt(limit)
+							if !ok {
+								err = errors.New(fmt.Sprintf("expecting int Limit attribute in object, got %T", limit))
 								return
 							}
-
-							l += `,Entry:` + entry
+							options.Limit = int(limitval)
+							paged = true
 						}
-						if i > 0 {
-							js += ","
+						cursor, ok := opts["Cursor"]
+						if ok {
+							cursorval, ok := cursor.(string)
+							if !ok {
+								err = errors.New(fmt.Sprintf("expecting string Cursor attribute in object, got %T", cursor))
+								return
+							}
+							options.Cursor = cursorval
+							paged = true
 						}
-						js += `{` + l + `}`
 					}
+				}
+				f := _f.(*APIFnGetLinks)
+				f.action = *NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask, Order: options.Order, Limit: options.Limit, Cursor: options.Cursor}, &options)
+				conv = func(response interface{}, callErr error) (result otto.Value, err error) {
+					err = callErr
 					if err == nil {
-						js = `[` + js + `]`
-						var obj *otto.Object
-						jsr.h.Debugf("getLinks code:\n%s", js)
-						obj, err = jsr.vm.Object(js)
+						// we build up our response by creating the javascript object
+						// that we want and using otto to create it with vm.
+						// TODO: is there a faster way to do this?
+						lqr := response.(*LinkQueryResp)
+						var js string
+						for i, th := range lqr.Links {
+							var l string
+							l = `Hash:"` + th.H + `"`
+							if tag == "" {
+								l += `,Tag:"` + jsSanitizeString(th.T) + `"`
+							}
+							if options.Load {
+								l += `,EntryType:"` + jsSanitizeString(th.EntryType) + `"`
+								l += `,Source:"` + jsSanitizeString(th.Source) + `"`
+								var def *EntryDef
+								_, def, err = h.GetEntryDef(th.EntryType)
+								if err != nil {
+									break
+								}
+								var entry string
+								switch def.DataFormat {
+								case DataFormatRawJS:
+									entry = th.E
+								case DataFormatRawZygo:
+									fallthrough
+								case DataFormatSysKey:
+									// key is a b58 encoded public key so the entry is just the string value
+									fallthrough
+								case DataFormatString:
+									entry = `"` + jsSanitizeString(th.E) + `"`
+								case DataFormatLinks:
+									fallthrough
+								case DataFormatJSON:
+									entry = `JSON.parse("` + jsSanitizeString(th.E) + `")`
+								default:
+									err = errors.New("data format not implemented: " + def.DataFormat)
+									return
+								}
+
+								l += `,Entry:` + entry
+							}
+							if i > 0 {
+								js += ","
+							}
+							js += `{` + l + `}`
+						}
 						if err == nil {
-							result = obj.Value()
+							js = `[` + js + `]`
+							if paged {
+								js = `{Links:` + js + `,Next:"` + jsSanitizeString(lqr.Next) + `"}`
+							}
+							var obj *otto.Object
+							jsr.h.Debugf("getLinks code:\n%s", js)
+							obj, err = jsr.vm.Object(js)
+							if err == nil {
+								result = obj.Value()
+							}
 						}
 					}
+					return
 				}
 				return
 			},
@@ -1337,7 +1410,17 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		fnPrefix = "__"
 	}
 
+	var asyncLib string
 	for name, data := range funcs {
+		if data.async != nil {
+			data.f = makeJSSyncFn(h, data.async)
+			funcs[name] = data
+			err = jsr.vm.Set("__"+name+"Async", makeJSAsyncFN(&jsr, data))
+			if err != nil {
+				return nil, err
+			}
+			asyncLib += jsAsyncWrapper(name)
+		}
 		wfn := makeJSFN(&jsr, name, data)
 		err = jsr.vm.Set(fnPrefix+name, wfn)
 		if err != nil {
@@ -1409,8 +1492,9 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 function isErr(result) {
     return (result != null && (typeof result === 'object') && result.name == "` + HolochainErrorPrefix + `");
 }`
+	l += jsPromiseLibrary + asyncLib
 
-	_, err = jsr.Run(l + zome.Code)
+	err = jsr.load(l + zome.Code)
 	if err != nil {
 		return
 	}
@@ -1418,6 +1502,74 @@ function isErr(result) {
 	return
 }
 
+// load runs the zome's code under the zome call limits, keeping a copy of the result to
+// reset to
+func (jsr *JSRibosome) load(code string) (err error) {
+	defer jsr.limit(ZomeCallKind, &err)()
+	_, err = jsr.Run(code)
+	if err == nil {
+		jsr.loaded = jsr.vm.Copy()
+	}
+	return
+}
+
+// Reset puts the vm back to how it was just after the zome's code was loaded, bringing
+// the App values that may have changed since then up to date
+func (jsr *JSRibosome) Reset() (err error) {
+	// the API functions in the copy call back into jsr, so they use the new vm
+	jsr.vm = jsr.loaded.Copy()
+	jsr.lastResult = nil
+	// drop any async calls still being made
+	jsr.calls = newJSAsyncCalls(jsr.calls.next)
+	if h := jsr.h; h != nil {
+		_, err = jsr.vm.Run(fmt.Sprintf(`App.Agent.Hash="%s";App.Agent.TopHash="%s";App.Agent.String="%s";App.Key.Hash="%s"`, h.agentHash, h.agentTopHash, jsSanitizeString(string(h.Agent().Identity())), h.nodeIDStr))
+	}
+	return
+}
+
+// limit applies the execution limits of a kind of call to the code run until the returned
+// function gets called, which must be deferred so it can turn the panic used to stop the
+// code into the call's error
+func (jsr *JSRibosome) limit(kind RibosomeCallKind, err *error) func() {
+	limits := jsr.h.executionLimits(kind)
+	if limits.Timeout <= 0 && limits.MaxSteps <= 0 {
+		return func() {}
+	}
+	l := newExecutionLimiter(kind, limits)
+	// otto runs the functions sent on its interrupt channel before each statement, so
+	// each step sends itself again for the next statement
+	interrupt := make(chan func(), 1)
+	var step func()
+	step = func() {
+		interrupt <- step
+		if e := l.step(); e != nil {
+			panic(e)
+		}
+	}
+	interrupt <- step
+	prev, prevLimiter := jsr.vm.Interrupt, jsr.limiter
+	jsr.vm.Interrupt = interrupt
+	jsr.limiter = l
+	return func() {
+		jsr.vm.Interrupt = prev
+		jsr.limiter = prevLimiter
+		recoverExecutionLimit(recover(), err)
+	}
+}
+
+// makeJSSyncFn makes the function of an API function that has an async version, which
+// makes the call the async function sets up right away
+func makeJSSyncFn(h *Holochain, async func([]Arg, APIFunction, otto.FunctionCall) (jsConvertFn, error)) func([]Arg, APIFunction, otto.FunctionCall) (otto.Value, error) {
+	return func(args []Arg, f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+		var conv jsConvertFn
+		conv, err = async(args, f, call)
+		if err == nil {
+			result, err = conv(f.Call(h))
+		}
+		return
+	}
+}
+
 func makeJSFN(jsr *JSRibosome, name string, data fnData) func(call otto.FunctionCall) (result otto.Value) {
 	return func(call otto.FunctionCall) (result otto.Value) {
 		var args []Arg
@@ -1425,6 +1577,9 @@ func makeJSFN(jsr *JSRibosome, name string, data fnData) func(call otto.Function
 
 		err := jsProcessArgs(jsr, args, call.ArgumentList)
 		if err == nil {
+			if t, ok := data.apiFn.(traced); ok {
+				t.setTrace(jsr.trace)
+			}
 			result, err = data.f(args, data.apiFn, call)
 
 		}
@@ -1438,6 +1593,9 @@ func makeJSFN(jsr *JSRibosome, name string, data fnData) func(call otto.Function
 // Run executes javascript code
 func (jsr *JSRibosome) Run(code string) (result interface{}, err error) {
 	v, err := jsr.vm.Run(code)
+	if err == nil {
+		v, err = jsr.settle(v)
+	}
 	if err != nil {
 		errStr := err.Error()
 		if !strings.HasPrefix(errStr, "{") {
@@ -1451,6 +1609,7 @@ func (jsr *JSRibosome) Run(code string) (result interface{}, err error) {
 }
 
 func (jsr *JSRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	defer jsr.limit(ZomeCallKind, &err)()
 
 	code := fmt.Sprintf(`%s(JSON.parse("%s"),"%s")`, callback, jsSanitizeString(response.Body), jsSanitizeString(callbackID))
 	jsr.h.Debugf("Calling %s\n", code)
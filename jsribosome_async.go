@@ -0,0 +1,276 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements promises for the javascript ribosome.  otto is ES5 so it has no Promise, so
+// one gets added to the runtime along with async versions of the API functions that wait
+// on the network: getAsync, getLinksAsync, sendAsync and bridgeAsync.  These set up their
+// call on the vm, make it in a goroutine, and return a promise of its result, so the
+// calls of a fan-out run at the same time.  Promise callbacks get run after the code that
+// queued them, and a zome function (or code passed to Run) that returns a promise gets
+// waited on, running the callbacks of async calls on the vm as the calls come back, until
+// the promise settles.
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto"
+)
+
+const (
+	jsPromiseNone = iota - 1
+	jsPromisePending
+	jsPromiseFulfilled
+	jsPromiseRejected
+)
+
+// jsPromiseLibrary is an ES5 implementation of the parts of Promise zome code needs.
+// Callbacks get queued as jobs which the ribosome runs once the code queuing them is done.
+const jsPromiseLibrary = `
+var __hcJobs=[];
+function __hcRunJobs(){while(__hcJobs.length>0){__hcJobs.shift()()}}
+function Promise(executor){
+    this._state=0;this._handlers=[];
+    var p=this,done=false;
+    try{executor(function(v){if(!done){done=true;__hcResolve(p,v)}},function(r){if(!done){done=true;__hcSettle(p,2,r)}})}
+    catch(e){if(!done){done=true;__hcSettle(p,2,e)}}
+}
+function __hcResolve(p,v){
+    if(v===p){__hcSettle(p,2,new TypeError("promise resolved with itself"));return}
+    if(v!=null&&(typeof v==="object"||typeof v==="function")){
+        var then,done=false;
+        try{then=v.then}catch(e){__hcSettle(p,2,e);return}
+        if(typeof then==="function"){
+            try{then.call(v,function(x){if(!done){done=true;__hcResolve(p,x)}},function(r){if(!done){done=true;__hcSettle(p,2,r)}})}
+            catch(e){if(!done){done=true;__hcSettle(p,2,e)}}
+            return
+        }
+    }
+    __hcSettle(p,1,v)
+}
+function __hcSettle(p,state,value){
+    if(p._state!==0){return}
+    p._state=state;p._value=value;
+    var handlers=p._handlers;p._handlers=null;
+    for(var i=0;i<handlers.length;i++){__hcHandle(p,handlers[i])}
+}
+function __hcHandle(p,h){
+    __hcJobs.push(function(){
+        var cb=p._state===1?h.onFulfilled:h.onRejected;
+        if(typeof cb!=="function"){
+            if(p._state===1){__hcResolve(h.promise,p._value)}else{__hcSettle(h.promise,2,p._value)}
+            return
+        }
+        var r;
+        try{r=cb(p._value)}catch(e){__hcSettle(h.promise,2,e);return}
+        __hcResolve(h.promise,r)
+    })
+}
+function __hcState(p){return (p instanceof Promise)?p._state:-1}
+Promise.prototype.then=function(onFulfilled,onRejected){
+    var h={onFulfilled:onFulfilled,onRejected:onRejected,promise:new Promise(function(){})};
+    if(this._state===0){this._handlers.push(h)}else{__hcHandle(this,h)}
+    return h.promise
+};
+Promise.prototype["catch"]=function(onRejected){return this.then(undefined,onRejected)};
+Promise.resolve=function(v){return (v instanceof Promise)?v:new Promise(function(resolve){resolve(v)})};
+Promise.reject=function(r){return new Promise(function(resolve,reject){reject(r)})};
+Promise.all=function(promises){
+    return new Promise(function(resolve,reject){
+        var results=[],left=promises.length;
+        if(left===0){resolve(results);return}
+        for(var i=0;i<promises.length;i++){(function(i){
+            Promise.resolve(promises[i]).then(function(v){results[i]=v;if(--left===0){resolve(results)}},reject)
+        })(i)}
+    })
+};
+Promise.race=function(promises){
+    return new Promise(function(resolve,reject){
+        for(var i=0;i<promises.length;i++){Promise.resolve(promises[i]).then(resolve,reject)}
+    })
+};
+var __hcCalls={};
+function __hcAsync(id){
+    if(isErr(id)){return Promise.reject(id)}
+    return new Promise(function(resolve,reject){__hcCalls[id]={resolve:resolve,reject:reject}})
+}
+function __hcDone(id,ok,v){var c=__hcCalls[id];delete __hcCalls[id];if(ok){c.resolve(v)}else{c.reject(v)}}`
+
+// jsConvertFn converts the result of an API function call to a javascript value, which
+// has to be done on the vm
+type jsConvertFn func(r interface{}, err error) (otto.Value, error)
+
+// jsAsyncResult is what an async API function call came back with
+type jsAsyncResult struct {
+	id   int
+	r    interface{}
+	err  error
+	conv jsConvertFn
+}
+
+// jsAsyncCalls holds the async API function calls made by a ribosome.  The goroutines
+// making the calls add their results to done, so they never block on a ribosome that
+// stopped waiting for them.
+type jsAsyncCalls struct {
+	lk      sync.Mutex
+	done    []jsAsyncResult
+	ready   chan struct{}
+	next    int
+	pending int
+}
+
+func newJSAsyncCalls(next int) *jsAsyncCalls {
+	return &jsAsyncCalls{next: next, ready: make(chan struct{}, 1)}
+}
+
+// start makes an API function call in a goroutine returning the id of the call
+func (c *jsAsyncCalls) start(h *Holochain, f APIFunction, conv jsConvertFn) (id int) {
+	c.next++
+	c.pending++
+	id = c.next
+	go func() {
+		r, err := f.Call(h)
+		c.lk.Lock()
+		c.done = append(c.done, jsAsyncResult{id: id, r: r, err: err, conv: conv})
+		c.lk.Unlock()
+		select {
+		case c.ready <- struct{}{}:
+		default:
+		}
+	}()
+	return
+}
+
+// wait returns the result of the next call to come back, or an error if the call
+// the ribosome is running times out first
+func (c *jsAsyncCalls) wait(l *executionLimiter) (result jsAsyncResult, err error) {
+	var timeout <-chan time.Time
+	if l != nil && l.limits.Timeout > 0 {
+		t := time.NewTimer(l.deadline.Sub(time.Now()))
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		c.lk.Lock()
+		if len(c.done) > 0 {
+			result = c.done[0]
+			c.done = c.done[1:]
+			c.lk.Unlock()
+			c.pending--
+			return
+		}
+		c.lk.Unlock()
+		select {
+		case <-c.ready:
+		case <-timeout:
+			l.err = l.timedOut()
+			err = l.err
+			return
+		}
+	}
+}
+
+// makeJSAsyncFN makes the native function behind the async version of an API function,
+// which returns the id of the call it starts for __hcAsync to make a promise of
+func makeJSAsyncFN(jsr *JSRibosome, data fnData) func(call otto.FunctionCall) (result otto.Value) {
+	return func(call otto.FunctionCall) (result otto.Value) {
+		// the call outlives this function so it can't use the shared APIFunction
+		f := reflect.New(reflect.TypeOf(data.apiFn).Elem()).Interface().(APIFunction)
+		args := f.Args()
+
+		err := jsProcessArgs(jsr, args, call.ArgumentList)
+		var conv jsConvertFn
+		if err == nil {
+			conv, err = data.async(args, f, call)
+		}
+		if err == nil {
+			result, err = jsr.vm.ToValue(jsr.calls.start(jsr.h, f, conv))
+		}
+		if err != nil {
+			result = mkOttoErr(jsr, err.Error())
+		}
+		return result
+	}
+}
+
+// jsAsyncWrapper returns the javascript async version of an API function
+func jsAsyncWrapper(name string) string {
+	return fmt.Sprintf(`function %sAsync(){return __hcAsync(__%sAsync.apply(null,arguments))}`, name, name)
+}
+
+// settle runs the promise callbacks queued by the code that returned v, and if v is a
+// promise waits for the async calls it depends on until it settles, returning the value
+// it was fulfilled with or an error holding the reason it was rejected
+func (jsr *JSRibosome) settle(v otto.Value) (result otto.Value, err error) {
+	for {
+		_, err = jsr.vm.Call("__hcRunJobs", nil)
+		if err != nil || !v.IsObject() {
+			return v, err
+		}
+		var state otto.Value
+		state, err = jsr.vm.Call("__hcState", nil, v)
+		if err != nil {
+			return
+		}
+		s, _ := state.ToInteger()
+		switch s {
+		case jsPromiseNone:
+			return v, nil
+		case jsPromiseFulfilled:
+			return v.Object().Get("_value")
+		case jsPromiseRejected:
+			var reason otto.Value
+			reason, err = v.Object().Get("_value")
+			if err == nil {
+				err = jsRejectionErr(reason)
+			}
+			return
+		}
+		if jsr.calls.pending == 0 {
+			err = errors.New("promise can't settle as it isn't waiting on any async calls")
+			return
+		}
+		var done jsAsyncResult
+		done, err = jsr.calls.wait(jsr.limiter)
+		if err != nil {
+			return
+		}
+		ok := true
+		var value otto.Value
+		value, e := done.conv(done.r, done.err)
+		if e != nil {
+			ok = false
+			value = mkOttoErr(jsr, e.Error())
+		}
+		_, err = jsr.vm.Call("__hcDone", nil, done.id, ok, value)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// toValue is the jsConvertFn of API functions whose result converts straight to a
+// javascript value
+func (jsr *JSRibosome) toValue(r interface{}, err error) (result otto.Value, _ error) {
+	if err == nil {
+		result, err = jsr.vm.ToValue(r)
+	}
+	return result, err
+}
+
+// jsRejectionErr makes an error from the reason a promise was rejected
+func jsRejectionErr(reason otto.Value) error {
+	if reason.IsObject() && reason.Class() == "Error" {
+		message, err := reason.Object().Get("message")
+		if err == nil {
+			return errors.New(message.String())
+		}
+	}
+	return errors.New(reason.String())
+}
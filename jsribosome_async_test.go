@@ -0,0 +1,153 @@
+package holochain
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSPromise(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType})
+	if err != nil {
+		panic(err)
+	}
+	z := v.(*JSRibosome)
+
+	Convey("it should run promise callbacks and return what the promise resolves to", t, func() {
+		_, err := z.Run(`var order=[];var p=Promise.resolve(1).then(function(x){order.push("then");return x+1});order.push("sync");p`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "2")
+		_, err = z.Run(`order.join(",")`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "sync,then")
+	})
+
+	Convey("it should resolve promises of promises and thenables", t, func() {
+		_, err := z.Run(`new Promise(function(resolve){resolve(Promise.resolve({then:function(r){r("fish")}}))})`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "fish")
+	})
+
+	Convey("it should return rejections as errors", t, func() {
+		_, err := z.Run(`Promise.resolve(1).then(function(){throw new Error("fish")})`)
+		So(err.Error(), ShouldEqual, "Error executing JavaScript: fish")
+		_, err = z.Run(`Promise.reject("fish")["catch"](function(e){return "caught "+e})`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "caught fish")
+	})
+
+	Convey("it should return an error for promises that can't settle", t, func() {
+		_, err := z.Run(`new Promise(function(){})`)
+		So(err.Error(), ShouldEqual, "Error executing JavaScript: promise can't settle as it isn't waiting on any async calls")
+	})
+
+	Convey("Promise.all and Promise.race should combine promises", t, func() {
+		_, err := z.Run(`Promise.all([1,Promise.resolve(2),new Promise(function(r){r(3)})]).then(function(a){return a.join(",")})`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "1,2,3")
+		_, err = z.Run(`Promise.all([])`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.Class(), ShouldEqual, "Array")
+		_, err = z.Run(`Promise.race([Promise.reject("first"),Promise.resolve("second")])`)
+		So(err.Error(), ShouldEqual, "Error executing JavaScript: first")
+	})
+
+	Convey("zome functions should be able to return promises", t, func() {
+		_, err := z.Run(`function asyncStr(s){return Promise.resolve("got "+s)};function asyncJSON(o){return Promise.resolve({got:o.x})}`)
+		So(err, ShouldBeNil)
+		result, err := z.Call(&FunctionDef{Name: "asyncStr", CallingType: STRING_CALLING}, "fish")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "got fish")
+		result, err = z.Call(&FunctionDef{Name: "asyncJSON", CallingType: JSON_CALLING}, `{"x":1}`)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, `{"got":1}`)
+	})
+}
+
+func TestJSAsyncAPI(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	defer func() { h.nucleus.dna.RibosomeLimits = RibosomeLimits{} }()
+
+	hash := commit(h, "oddNumbers", "7")
+	hash2 := commit(h, "oddNumbers", "9")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	commit(h, "rating", fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, hash.String(), profileHash.String()))
+	missing, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
+
+	zome, _ := h.GetZome("jsSampleZome")
+	v, err := NewJSRibosome(h, zome)
+	if err != nil {
+		panic(err)
+	}
+	z := v.(*JSRibosome)
+
+	Convey("getAsync should resolve to the entry", t, func() {
+		_, err := z.Run(fmt.Sprintf(`getAsync("%s")`, hash.String()))
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "7")
+		_, err = z.Run(fmt.Sprintf(`getAsync("%s",{GetMask:HC.GetMask.EntryType})`, hash.String()))
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "oddNumbers")
+		_, err = z.Run(fmt.Sprintf(`getAsync("%s").then(function(e){return e===HC.HashNotFound})`, missing.String()))
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "true")
+	})
+
+	Convey("fanned out getAsync calls should all resolve", t, func() {
+		_, err := z.Run(fmt.Sprintf(`Promise.all([getAsync("%s"),getAsync("%s"),getAsync("%s")]).then(function(a){return a[0]+a[1]+a[2].firstName})`, hash.String(), hash2.String(), profileHash.String()))
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "79Zippy")
+	})
+
+	Convey("getLinksAsync should resolve to the links", t, func() {
+		_, err := z.Run(fmt.Sprintf(`getLinksAsync("%s","4stars",{Load:true})`, hash.String()))
+		So(err, ShouldBeNil)
+		links, _ := z.lastResult.Export()
+		l0 := links.([]map[string]interface{})[0]
+		So(l0["Hash"], ShouldEqual, profileHash.String())
+		So(l0["Entry"].(map[string]interface{})["firstName"], ShouldEqual, "Zippy")
+	})
+
+	Convey("sendAsync should resolve to the response", t, func() {
+		_, err := z.Run(`sendAsync(App.Key.Hash,{ping:"foobar"})`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, `{"pong":"foobar"}`)
+	})
+
+	Convey("async calls that fail should reject", t, func() {
+		_, err := z.Run(`getAsync(1)["catch"](function(e){return e.message})`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "argument 1 (hash) should be string")
+		// there's no bridge to this app
+		_, err = z.Run(fmt.Sprintf(`bridgeAsync("%s","zySampleZome","testStrFn1","foo").then(null,isErr)`, hash.String()))
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "true")
+
+		h.nucleus.dna.RibosomeLimits.Call = ExecutionLimits{Timeout: 1000}
+		_, err = z.Run(`sendAsync(App.Key.Hash,{block:true},{Timeout:100})["catch"](function(e){return e.message})`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, SendTimeoutErr.Error())
+	})
+
+	Convey("waiting on async calls should be limited by the call's timeout", t, func() {
+		h.nucleus.dna.RibosomeLimits.Call = ExecutionLimits{Timeout: 100}
+		z.Run(`function blocked(){return sendAsync(App.Key.Hash,{block:true})}`)
+		_, err := z.Call(&FunctionDef{Name: "blocked", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ZomeCallKind, Limit: TimeoutLimit, Value: 100})
+	})
+
+	Convey("reset should drop async calls that are still being made", t, func() {
+		_, err := z.Run(fmt.Sprintf(`getAsync("%s");1`, hash.String()))
+		So(err, ShouldBeNil)
+		So(z.calls.pending, ShouldEqual, 1)
+		next := z.calls.next
+		So(z.Reset(), ShouldBeNil)
+		So(z.calls.pending, ShouldEqual, 0)
+		So(z.calls.next, ShouldEqual, next)
+	})
+}
@@ -327,7 +327,8 @@ func TestNewJSRibosome(t *testing.T) {
 			// a string calling function
 			_, err := z.Run(`call("zySampleZome","addEven","432")`)
 			So(err, ShouldBeNil)
-			So(h.chain.Entries[len(h.chain.Hashes)-1].Content(), ShouldEqual, "432")
+			top, _, _ := h.chain.GetEntry(h.chain.Top().EntryLink)
+			So(top.Content(), ShouldEqual, "432")
 			z := v.(*JSRibosome)
 			hash, _ := NewHash(z.lastResult.String())
 			entry, _, _ := h.chain.GetEntry(hash)
@@ -336,7 +337,8 @@ func TestNewJSRibosome(t *testing.T) {
 			// a json calling function
 			_, err = z.Run(`call("zySampleZome","addPrime",{prime:7})`)
 			So(err, ShouldBeNil)
-			So(h.chain.Entries[len(h.chain.Hashes)-1].Content(), ShouldEqual, `{"prime":7}`)
+			top, _, _ = h.chain.GetEntry(h.chain.Top().EntryLink)
+			So(top.Content(), ShouldEqual, `{"prime":7}`)
 			hashJSONStr := z.lastResult.String()
 			var hashStr string
 			json.Unmarshal([]byte(hashJSONStr), &hashStr)
@@ -420,6 +422,19 @@ func TestNewJSRibosome(t *testing.T) {
 			entry, _, _ = h.chain.GetEntry(bundleCommitHash)
 			So(entry.Content(), ShouldEqual, "7")
 		})
+		Convey("commit with a TTL", func() {
+			_, err := z.Run(`commit("oddNumbers","9",{TTL:60})`)
+			So(err, ShouldBeNil)
+			hash, _ := NewHash(z.lastResult.String())
+			puts, _ := h.dht.GetPuts(0)
+			var ttl int
+			for _, p := range puts {
+				if req, ok := p.M.Body.(HoldReq); ok && p.M.Type == PUT_REQUEST && req.EntryHash == hash {
+					ttl = req.TTL
+				}
+			}
+			So(ttl, ShouldEqual, 60)
+		})
 		Convey("migrate", func() {
 			dnaHash, err := genTestStringHash()
 			So(err, ShouldBeNil)
@@ -532,6 +547,48 @@ func TestJSBridgeGenesis(t *testing.T) {
 	})
 }
 
+func TestJSExecutionLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	defer func() { h.nucleus.dna.RibosomeLimits = RibosomeLimits{} }()
+	code := `function spin() {while(true) {}}
+function stubborn() {while(true) {try {while(true) {}} catch(e) {}}}
+function genesis() {spin()}
+function validateCommit() {spin()}`
+	z, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: code})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should stop zome calls that run out of steps", t, func() {
+		h.nucleus.dna.RibosomeLimits.Call = ExecutionLimits{Timeout: -1, MaxSteps: 1000}
+		_, err := z.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ZomeCallKind, Limit: StepsLimit, Value: 1000})
+	})
+
+	Convey("it should not let zome code catch running out of limits", t, func() {
+		_, err := z.Call(&FunctionDef{Name: "stubborn", CallingType: STRING_CALLING}, "")
+		So(IsExecutionLimitErr(err), ShouldBeTrue)
+	})
+
+	Convey("it should stop validation and genesis calls that run out of time", t, func() {
+		h.nucleus.dna.RibosomeLimits.Validate = ExecutionLimits{Timeout: 50, MaxSteps: -1}
+		h.nucleus.dna.RibosomeLimits.Genesis = ExecutionLimits{Timeout: 50, MaxSteps: -1}
+		_, def, _ := h.GetEntryDef("evenNumbers")
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+		a.header = &Header{}
+		err := z.ValidateAction(a, def, nil, []string{h.nodeIDStr})
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ValidateCallKind, Limit: TimeoutLimit, Value: 50})
+		err = z.ChainGenesis()
+		So(err.Error(), ShouldEqual, "genesis call exceeded its time limit of 50ms")
+	})
+
+	Convey("it should stop loading zome code that runs out of limits", t, func() {
+		_, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: code + `;spin()`})
+		So(IsExecutionLimitErr(err), ShouldBeTrue)
+	})
+}
+
 func TestJSReceive(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestChain(h, d)
@@ -584,6 +641,13 @@ func TestJSbuildValidate(t *testing.T) {
 		//	So(code, ShouldEqual, `validatePut("evenNumbers","2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"},pgk,["fake_src_hash"])`)
 	})
 
+	Convey("it should build put with the status of forked entries", t, func() {
+		a := NewPutAction("evenNumbers", &e, &header)
+		code, err := buildJSValidateAction(a, &def, &ValidationPackage{Status: StatusForked}, []string{"fake_src_hash"})
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, `validatePut("evenNumbers","2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"},{"Status":16},["fake_src_hash"])`)
+	})
+
 }
 
 func TestJSValidateCommit(t *testing.T) {
@@ -877,6 +941,30 @@ func TestJSDHT(t *testing.T) {
 
 	})
 
+	Convey("getLinks with paging options should return pages of Links", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`getLinks("%s","4stars",{Limit:1});`, hash.String())})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		So(z.lastResult.Class(), ShouldEqual, "Object")
+		x, _ := z.lastResult.Export()
+		page := x.(map[string]interface{})
+		links := page["Links"].([]map[string]interface{})
+		So(len(links), ShouldEqual, 1)
+		So(fmt.Sprintf("%v", links[0]["Hash"]), ShouldEqual, reviewHash.String())
+		next := page["Next"].(string)
+		So(next, ShouldNotEqual, "")
+
+		v, err = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`getLinks("%s","4stars",{Limit:1,Cursor:"%s"});`, hash.String(), next)})
+		So(err, ShouldBeNil)
+		z = v.(*JSRibosome)
+		x, _ = z.lastResult.Export()
+		page = x.(map[string]interface{})
+		links = page["Links"].([]map[string]interface{})
+		So(len(links), ShouldEqual, 1)
+		So(fmt.Sprintf("%v", links[0]["Hash"]), ShouldEqual, profileHash.String())
+		So(page["Next"], ShouldEqual, "")
+	})
+
 	Convey("getLinks with load option should return the Links and entries", t, func() {
 		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`getLinks("%s","4stars",{Load:true});`, hash.String())})
 		So(err, ShouldBeNil)
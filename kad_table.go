@@ -41,6 +41,10 @@ type RoutingTable struct {
 	// notification functions
 	PeerRemoved func(peer.ID)
 	PeerAdded   func(peer.ID)
+
+	// Deprioritized returns true for peers that should only be picked as nearest
+	// peers when there are no others
+	Deprioritized func(peer.ID) bool
 }
 
 // NewRoutingTable creates a new routing table with a given bucketsize, local ID, and latency tolerance.
@@ -232,10 +236,18 @@ func (rt *RoutingTable) NearestPeers(hash Hash, count int) []peer.ID {
 	fmt.Printf("%s\n", s)
 	*/
 
-	var out []peer.ID
-	for i := 0; i < count && i < hashArr.Len(); i++ {
+	var out, last []peer.ID
+	for i := 0; i < hashArr.Len(); i++ {
 		p := PeerIDFromHash(hashArr[i].Hash.(Hash))
-		out = append(out, p)
+		if rt.Deprioritized != nil && rt.Deprioritized(p) {
+			last = append(last, p)
+		} else {
+			out = append(out, p)
+		}
+	}
+	out = append(out, last...)
+	if len(out) > count {
+		out = out[:count]
 	}
 
 	return out
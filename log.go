@@ -7,6 +7,7 @@
 package holochain
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/fatih/color"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 )
@@ -30,8 +32,29 @@ type Logger struct {
 
 	Prefix      string
 	PrefixColor *color.Color
+
+	JSON   bool   // write each line as a JSON object instead of using Format
+	Level  string // level of the lines written by a JSON logger, defaults to info
+	chain  string
+	nodeID string
+}
+
+// LogFields are structured fields added to a log line
+type LogFields map[string]interface{}
+
+// logLine is a line written by a JSON logger
+type logLine struct {
+	Time      string    `json:"time"`
+	Subsystem string    `json:"subsystem"`
+	Level     string    `json:"level"`
+	Chain     string    `json:"chain,omitempty"`
+	Node      string    `json:"node,omitempty"`
+	Message   string    `json:"message"`
+	Fields    LogFields `json:"fields,omitempty"`
 }
 
+const DefaultLogLevel = "info"
+
 var colorMap map[string]*color.Color
 var EnableAllLoggersEnv string = "HC_ENABLE_ALL_LOGS"
 
@@ -116,6 +139,12 @@ func (l *Logger) SetPrefix(prefixFormat string) {
 	l.PrefixColor, l.Prefix = l.setupColor(prefixFormat)
 }
 
+// SetContext sets the chain name and node ID included in the lines of a JSON logger
+func (l *Logger) SetContext(chain string, nodeID string) {
+	l.chain = chain
+	l.nodeID = nodeID
+}
+
 func (l *Logger) parse(m string) (output string) {
 	var t *time.Time
 	if l.tf != "" {
@@ -156,6 +185,10 @@ func (l *Logger) p(m interface{}) {
 
 func (l *Logger) pf(m string, args ...interface{}) {
 	if l != nil && l.Enabled {
+		if l.JSON {
+			l.jsonPrint(fmt.Sprintf(m, args...), nil)
+			return
+		}
 		l.prefixPrint()
 		f := l.parse(m)
 		if l.color != nil {
@@ -174,6 +207,44 @@ func (l *Logger) prefixPrint(args ...interface{}) {
 	}
 }
 
+func (l *Logger) jsonPrint(m string, fields LogFields) {
+	line := logLine{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		Subsystem: l.Name,
+		Level:     l.Level,
+		Chain:     l.chain,
+		Node:      l.nodeID,
+		Message:   m,
+	}
+	if len(fields) > 0 {
+		// errors and hashes would otherwise marshal as empty objects and byte arrays
+		line.Fields = make(LogFields, len(fields))
+		for k, v := range fields {
+			switch x := v.(type) {
+			case error:
+				line.Fields[k] = x.Error()
+			case fmt.Stringer:
+				line.Fields[k] = x.String()
+			default:
+				line.Fields[k] = v
+			}
+		}
+	}
+	if line.Level == "" {
+		line.Level = DefaultLogLevel
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		// fall back to the printed values of fields that can't be marshaled
+		line.Fields = make(LogFields)
+		for k, v := range fields {
+			line.Fields[k] = fmt.Sprintf("%v", v)
+		}
+		b, _ = json.Marshal(line)
+	}
+	l.w.Write(append(b, '\n'))
+}
+
 func (l *Logger) Log(m interface{}) {
 	l.p(m)
 }
@@ -181,3 +252,25 @@ func (l *Logger) Log(m interface{}) {
 func (l *Logger) Logf(m string, args ...interface{}) {
 	l.pf(m, args...)
 }
+
+// LogWith logs a message with structured fields, which a JSON logger writes as an object
+// and otherwise are added to the end of the message as key=value pairs
+func (l *Logger) LogWith(fields LogFields, m string, args ...interface{}) {
+	if l == nil || !l.Enabled {
+		return
+	}
+	if l.JSON {
+		l.jsonPrint(fmt.Sprintf(m, args...), fields)
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m += strings.Replace(fmt.Sprintf(" %s=%v", k, fields[k]), "%", "%%", -1)
+	}
+	// called directly so %{file} and %{line} are found at the same depth as for Logf
+	l.pf(m, args...)
+}
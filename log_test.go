@@ -2,8 +2,13 @@ package holochain
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	. "github.com/HC-Interns/holochain-proto/hash"
 	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -95,7 +100,100 @@ func TestNewLog(t *testing.T) {
 		}
 		l.New(&buf)
 		doDebug(l, "fish")
-		So(buf.String(), ShouldEqual, "log_test.go.97:fish\n")
+		So(buf.String(), ShouldEqual, "log_test.go.102:fish\n")
+	})
+
+	Convey("it should find the file name and line number of LogWith like it does for Logf", t, func() {
+		var buf bytes.Buffer
+		l := Logger{
+			Enabled: true,
+			Format:  "%{file}.%{line}:%{message}",
+		}
+		l.New(&buf)
+		for _, log := range []func(string){
+			func(m string) { l.Logf(m) },
+			func(m string) { l.LogWith(nil, m) },
+		} {
+			doDebugf(log, "fish")
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		So(len(lines), ShouldEqual, 2)
+		So(lines[0], ShouldStartWith, "log_test.go.")
+		So(lines[1], ShouldEqual, lines[0])
+	})
+
+	Convey("it should log structured fields as key value pairs", t, func() {
+		var buf bytes.Buffer
+		l := Logger{
+			Enabled: true,
+			Format:  "%{message}",
+		}
+		l.New(&buf)
+		l.LogWith(LogFields{"peer": "QmFoo", "count": 2}, "got %s", "fish")
+		So(buf.String(), ShouldEqual, "got fish count=2 peer=QmFoo\n")
+
+		buf.Reset()
+		l.LogWith(LogFields{"rate": "100%"}, "at %d", 5)
+		So(buf.String(), ShouldEqual, "at 5 rate=100%\n")
+	})
+}
+
+func TestJSONLog(t *testing.T) {
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+
+	Convey("it should log lines as JSON objects", t, func() {
+		var buf bytes.Buffer
+		l := Logger{
+			Name:    "DHT",
+			Enabled: true,
+			Format:  "%{color:yellow}%{time} DHT: %{message}",
+			JSON:    true,
+		}
+		l.New(&buf)
+		l.SetContext("test", "QmNode")
+		l.Logf("got %s", "fish")
+		l.LogWith(LogFields{"peer": "QmFoo", "count": 2, "err": errors.New("no fish"), "hash": hash}, "put %d", 1)
+
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		So(len(lines), ShouldEqual, 2)
+		var line map[string]interface{}
+		err := json.Unmarshal(lines[0], &line)
+		So(err, ShouldBeNil)
+		So(line["subsystem"], ShouldEqual, "DHT")
+		So(line["level"], ShouldEqual, DefaultLogLevel)
+		So(line["chain"], ShouldEqual, "test")
+		So(line["node"], ShouldEqual, "QmNode")
+		So(line["message"], ShouldEqual, "got fish")
+		So(line["fields"], ShouldBeNil)
+		_, err = time.Parse(time.RFC3339Nano, line["time"].(string))
+		So(err, ShouldBeNil)
+
+		err = json.Unmarshal(lines[1], &line)
+		So(err, ShouldBeNil)
+		So(line["message"], ShouldEqual, "put 1")
+		So(line["fields"], ShouldResemble, map[string]interface{}{"peer": "QmFoo", "count": float64(2), "err": "no fish", "hash": hash.String()})
+	})
+
+	Convey("it should be selectable from the environment", t, func() {
+		var buf bytes.Buffer
+		l := Logger{Name: "App", Enabled: true, Level: "debug"}
+		os.Setenv("HCLOG_JSON", "true")
+		os.Setenv("HCLOG_APP_JSON", "false")
+		err := initLogger(&l, "", "HCLOG_APP_JSON", &buf)
+		So(err, ShouldBeNil)
+		So(l.JSON, ShouldBeFalse)
+		os.Unsetenv("HCLOG_APP_JSON")
+		err = initLogger(&l, "", "HCLOG_APP_JSON", &buf)
+		So(err, ShouldBeNil)
+		So(l.JSON, ShouldBeTrue)
+		os.Unsetenv("HCLOG_JSON")
+
+		l.Log("fish")
+		var line logLine
+		err = json.Unmarshal(buf.Bytes(), &line)
+		So(err, ShouldBeNil)
+		So(line.Level, ShouldEqual, "debug")
+		So(line.Message, ShouldEqual, "fish")
 	})
 
 }
@@ -106,3 +204,7 @@ func TestNewLog(t *testing.T) {
 func doDebug(l Logger, m string) {
 	l.Log(m)
 }
+
+func doDebugf(log func(string), m string) {
+	log(m)
+}
@@ -0,0 +1,294 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// metrics implements a registry of counters, gauges and histograms of node, dht, gossip
+// and ribosome activity that can be scraped over http in the prometheus text format
+
+package holochain
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	CounterMetric   = "counter"
+	GaugeMetric     = "gauge"
+	HistogramMetric = "histogram"
+)
+
+// DefaultMetricBuckets are the upper bounds in seconds of the buckets of duration histograms
+var DefaultMetricBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsRegistry holds the metrics of the process
+type MetricsRegistry struct {
+	lk      sync.Mutex
+	metrics map[string]*metric
+}
+
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	values []string // label values
+	value  float64  // value of a counter or gauge, sum of a histogram
+	counts []uint64 // histogram bucket counts, not cumulative
+	count  uint64
+}
+
+// Counter is a metric that only goes up
+type Counter struct {
+	r *MetricsRegistry
+	m *metric
+}
+
+// Gauge is a metric that can be set to any value
+type Gauge struct {
+	r *MetricsRegistry
+	m *metric
+}
+
+// Histogram is a metric that counts observations in buckets
+type Histogram struct {
+	r *MetricsRegistry
+	m *metric
+}
+
+// Metrics is the registry of the metrics exported by holochain.  Their first label is the
+// DNA hash of the chain they were recorded for, as one process can run several chains.
+var Metrics = NewMetricsRegistry()
+
+var (
+	metricMessagesSent       = Metrics.Counter("holochain_messages_sent_total", "Messages sent to other nodes by type.", "dna", "type")
+	metricMessagesReceived   = Metrics.Counter("holochain_messages_received_total", "Messages received from other nodes by type.", "dna", "type")
+	metricSendDuration       = Metrics.Histogram("holochain_send_duration_seconds", "Time taken to send a message and get its response by type.", DefaultMetricBuckets, "dna", "type")
+	metricSendTimeouts       = Metrics.Counter("holochain_send_timeouts_total", "Sends that timed out by message type.", "dna", "type")
+	metricGossipRounds       = Metrics.Counter("holochain_gossip_rounds_total", "Rounds of gossip started with other nodes.", "dna")
+	metricGossipPutsSent     = Metrics.Counter("holochain_gossip_puts_sent_total", "Puts sent in response to gossip requests.", "dna")
+	metricGossipPutsReceived = Metrics.Counter("holochain_gossip_puts_received_total", "Puts received through gossip.", "dna")
+	metricValidations        = Metrics.Counter("holochain_validations_total", "Validations of actions by result.", "dna", "result")
+	metricRetryQueueDepth    = Metrics.Gauge("holochain_retry_queue_depth", "Messages waiting to be retried.", "dna")
+	metricZomeCallDuration   = Metrics.Histogram("holochain_zome_call_duration_seconds", "Time taken by zome function calls.", DefaultMetricBuckets, "dna", "zome", "function")
+	metricRibosomePool       = Metrics.Counter("holochain_ribosomes_total", "Ribosomes handed out by whether they were made or reused from a pool.", "dna", "source")
+)
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{metrics: make(map[string]*metric)}
+}
+
+func (r *MetricsRegistry) register(name, help, kind string, buckets []float64, labels []string) *metric {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if _, exists := r.metrics[name]; exists {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	m := &metric{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+	r.metrics[name] = m
+	return m
+}
+
+// Counter registers a new counter with the given label names
+func (r *MetricsRegistry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r: r, m: r.register(name, help, CounterMetric, nil, labels)}
+}
+
+// Gauge registers a new gauge with the given label names
+func (r *MetricsRegistry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r: r, m: r.register(name, help, GaugeMetric, nil, labels)}
+}
+
+// Histogram registers a new histogram with the given bucket upper bounds and label names
+func (r *MetricsRegistry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r: r, m: r.register(name, help, HistogramMetric, buckets, labels)}
+}
+
+// get returns the series for the label values, the registry must be locked
+func (m *metric) get(values []string) *metricSeries {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{values: values}
+		if m.kind == HistogramMetric {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Inc adds one to the counter for the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds to the counter for the label values
+func (c *Counter) Add(v float64, values ...string) {
+	c.r.lk.Lock()
+	c.m.get(values).value += v
+	c.r.lk.Unlock()
+}
+
+// Value returns the counter's value for the label values
+func (c *Counter) Value(values ...string) (v float64) {
+	c.r.lk.Lock()
+	v = c.m.get(values).value
+	c.r.lk.Unlock()
+	return
+}
+
+// Set sets the gauge for the label values
+func (g *Gauge) Set(v float64, values ...string) {
+	g.r.lk.Lock()
+	g.m.get(values).value = v
+	g.r.lk.Unlock()
+}
+
+// Value returns the gauge's value for the label values
+func (g *Gauge) Value(values ...string) (v float64) {
+	g.r.lk.Lock()
+	v = g.m.get(values).value
+	g.r.lk.Unlock()
+	return
+}
+
+// Observe adds an observation to the histogram for the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.r.lk.Lock()
+	s := h.m.get(values)
+	for i, le := range h.m.buckets {
+		if v <= le {
+			s.counts[i]++
+			break
+		}
+	}
+	s.value += v
+	s.count++
+	h.r.lk.Unlock()
+}
+
+// Count returns the number of observations made for the label values
+func (h *Histogram) Count(values ...string) (count uint64) {
+	h.r.lk.Lock()
+	count = h.m.get(values).count
+	h.r.lk.Unlock()
+	return
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels returns the label pairs of a series, with an extra pair if given
+func (m *metric) formatLabels(values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range m.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelValueEscaper.Replace(values[i])))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[0], extra[1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// WriteText writes all the metrics in the prometheus text exposition format
+func (r *MetricsRegistry) WriteText(w io.Writer) (err error) {
+	err = r.WriteTextWhere(w, "", "")
+	return
+}
+
+// WriteTextWhere writes the series of the metrics whose label has the given value, all of
+// them if the label is empty, in the prometheus text exposition format
+func (r *MetricsRegistry) WriteTextWhere(w io.Writer, label, value string) (err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := bufio.NewWriter(w)
+	for _, name := range names {
+		m := r.metrics[name]
+		fmt.Fprintf(b, "# HELP %s %s\n", name, m.help)
+		fmt.Fprintf(b, "# TYPE %s %s\n", name, m.kind)
+		keys := make([]string, 0, len(m.series))
+		for k := range m.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		li := -1
+		for i, l := range m.labels {
+			if l == label {
+				li = i
+			}
+		}
+		for _, k := range keys {
+			s := m.series[k]
+			if label != "" && (li < 0 || s.values[li] != value) {
+				continue
+			}
+			if m.kind != HistogramMetric {
+				fmt.Fprintf(b, "%s%s %s\n", name, m.formatLabels(s.values), formatMetricValue(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, le := range m.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(b, "%s_bucket%s %d\n", name, m.formatLabels(s.values, "le", formatMetricValue(le)), cumulative)
+			}
+			fmt.Fprintf(b, "%s_bucket%s %d\n", name, m.formatLabels(s.values, "le", "+Inf"), s.count)
+			fmt.Fprintf(b, "%s_sum%s %s\n", name, m.formatLabels(s.values), formatMetricValue(s.value))
+			fmt.Fprintf(b, "%s_count%s %d\n", name, m.formatLabels(s.values), s.count)
+		}
+	}
+	err = b.Flush()
+	return
+}
+
+// MetricsHandler returns an http handler that serves the holochain metrics of all the
+// chains in the process
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Metrics.WriteText(w)
+	})
+}
+
+// MetricsHandler returns an http handler that serves the holochain metrics of the chain
+func (h *Holochain) MetricsHandler() http.Handler {
+	dna := h.dnaHash.String()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Metrics.WriteTextWhere(w, "dna", dna)
+	})
+}
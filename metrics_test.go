@@ -0,0 +1,115 @@
+package holochain
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	r := NewMetricsRegistry()
+	c := r.Counter("test_counter_total", "A counter.", "kind")
+	g := r.Gauge("test_gauge", "A gauge.")
+	hist := r.Histogram("test_seconds", "A histogram.", []float64{.1, 1}, "fn")
+
+	Convey("it should not register a metric twice", t, func() {
+		So(func() { r.Gauge("test_gauge", "Again.") }, ShouldPanic)
+	})
+
+	Convey("it should require a value for each label", t, func() {
+		So(func() { c.Inc() }, ShouldPanic)
+	})
+
+	Convey("it should count, set and observe", t, func() {
+		c.Inc("a")
+		c.Add(2, "a")
+		c.Inc(`b"`)
+		So(c.Value("a"), ShouldEqual, 3)
+		g.Set(7)
+		g.Set(5)
+		So(g.Value(), ShouldEqual, 5)
+		hist.Observe(.0625, "f")
+		hist.Observe(.5, "f")
+		hist.Observe(4, "f")
+		So(hist.Count("f"), ShouldEqual, 3)
+	})
+
+	Convey("it should write the metrics in the text format", t, func() {
+		var b bytes.Buffer
+		So(r.WriteText(&b), ShouldBeNil)
+		So(b.String(), ShouldEqual, `# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{kind="a"} 3
+test_counter_total{kind="b\""} 1
+# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge 5
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{fn="f",le="0.1"} 1
+test_seconds_bucket{fn="f",le="1"} 2
+test_seconds_bucket{fn="f",le="+Inf"} 3
+test_seconds_sum{fn="f"} 4.5625
+test_seconds_count{fn="f"} 3
+`)
+	})
+
+	Convey("it should write only the series with a label value", t, func() {
+		var b bytes.Buffer
+		So(r.WriteTextWhere(&b, "kind", "a"), ShouldBeNil)
+		So(b.String(), ShouldEqual, `# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{kind="a"} 3
+# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+`)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	dna := h.dnaHash.String()
+
+	Convey("zome calls should be timed", t, func() {
+		count := metricZomeCallDuration.Count(dna, "zySampleZome", "testStrFn1")
+		_, err := h.Call("zySampleZome", "testStrFn1", "foo", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(metricZomeCallDuration.Count(dna, "zySampleZome", "testStrFn1"), ShouldEqual, count+1)
+	})
+
+	Convey("validations should be counted", t, func() {
+		pass := metricValidations.Value(dna, "pass")
+		fail := metricValidations.Value(dna, "fail")
+		commit(h, "oddNumbers", "7")
+		So(metricValidations.Value(dna, "pass"), ShouldBeGreaterThan, pass)
+		_, err := h.Call("jsSampleZome", "addOdd", "2", ZOME_EXPOSURE)
+		So(err, ShouldNotBeNil)
+		So(metricValidations.Value(dna, "fail"), ShouldBeGreaterThan, fail)
+	})
+
+	Convey("sends should be timed", t, func() {
+		count := metricSendDuration.Count(dna, APP_MESSAGE.String())
+		m := h.node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		_, err := h.Send(h.node.ctx, ActionProtocol, h.nodeID, m, 0)
+		So(err, ShouldBeNil)
+		So(metricSendDuration.Count(dna, APP_MESSAGE.String()), ShouldEqual, count+1)
+	})
+
+	Convey("a chain's metrics handler should only serve the chain's metrics", t, func() {
+		metricGossipRounds.Inc("someOtherDNA")
+		w := httptest.NewRecorder()
+		h.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/_metrics", nil))
+		So(w.Body.String(), ShouldContainSubstring, `holochain_zome_call_duration_seconds_count{dna="`+dna+`",zome="zySampleZome",function="testStrFn1"}`)
+		So(w.Body.String(), ShouldNotContainSubstring, "someOtherDNA")
+
+		w = httptest.NewRecorder()
+		MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/_metrics", nil))
+		So(w.Body.String(), ShouldContainSubstring, `holochain_gossip_rounds_total{dna="someOtherDNA"} 1`)
+	})
+}
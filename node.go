@@ -83,6 +83,11 @@ const (
 	// Kademlia messages
 
 	FIND_NODE_REQUEST
+
+	// Range gossip messages
+
+	GOSSIP_SUMMARY_REQUEST
+	GOSSIP_FETCH_REQUEST
 )
 
 func (msgType MsgType) String() string {
@@ -102,21 +107,25 @@ func (msgType MsgType) String() string {
 		"VALIDATE_MOD_REQUEST",
 		"APP_MESSAGE",
 		"LISTADD_REQUEST",
-		"FIND_NODE_REQUEST"}[msgType]
+		"FIND_NODE_REQUEST",
+		"GOSSIP_SUMMARY_REQUEST",
+		"GOSSIP_FETCH_REQUEST"}[msgType]
 }
 
 var ErrBlockedListed = errors.New("node blockedlisted")
 
 // Message represents data that can be sent to node in the network
 type Message struct {
-	Type MsgType
-	Time time.Time
-	From peer.ID
-	Body interface{}
+	Type  MsgType
+	Time  time.Time
+	From  peer.ID
+	Body  interface{}
+	Trace SpanContext `bson:"-"` // not part of the fingerprint, the same message may be sent in different traces
 }
 
 type BytesSent struct {
 	Bytes   int64
+	Saved   int64 // bytes that didn't need to be sent, i.e. puts a gossiper already had
 	MsgType MsgType
 }
 
@@ -128,6 +137,9 @@ const (
 	BootstrappingStopper
 	RefreshingStopper
 	HoldingStopper
+	ExpiringStopper
+	HandoffStopper
+	ReputationStopper
 	_StopperCount
 )
 
@@ -137,12 +149,14 @@ type Node struct {
 	NetAddr      ma.Multiaddr
 	host         *rhost.RoutedHost
 	mdnsSvc      discovery.Service
+	blk          sync.RWMutex
 	blockedlist  map[peer.ID]bool
 	protocols    [_protocolCount]*Protocol
 	peerstore    pstore.Peerstore
 	routingTable *RoutingTable
 	nat          *nat.NAT
 	log          *Logger
+	dna          string // the protocol mux, which is the DNA hash, to label metrics with
 
 	// ticker task stoppers
 	stoppers []chan bool
@@ -173,6 +187,8 @@ const (
 	DefaultRoutingRefreshInterval = time.Minute
 	DefaultGossipInterval         = time.Second * 2
 	DefaultHoldingCheckInterval   = time.Second * 30
+	DefaultExpiryInterval         = time.Minute
+	DefaultHandoffInterval        = time.Second * 30
 )
 
 // implement peer found function for mdns discovery
@@ -384,6 +400,7 @@ func (node *Node) discoverAndHandleNat(listenPort int) {
 func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUPnP bool, log *Logger) (node *Node, err error) {
 	var n Node
 	n.log = log
+	n.dna = protoMux
 	n.log.Logf("Creating new node with protoMux: %s\n", protoMux)
 	nodeID, _, err := agent.NodeID()
 	if err != nil {
@@ -541,16 +558,22 @@ func (node *Node) StartProtocol(h *Holochain, proto int) (err error) {
 		var m Message
 		err := m.Decode(s)
 		var response interface{}
-		if m.From == "" {
-			// @todo other sanity checks on From?
-			err = errors.New("message must have a source")
+		if err != nil || m.From == "" {
+			if err == nil {
+				// @todo other sanity checks on From?
+				err = errors.New("message must have a source")
+			}
+			h.penalize(s.Conn().RemotePeer(), MalformedMessageEvent)
 		} else {
 			if node.IsBlocked(s.Conn().RemotePeer()) {
 				err = ErrBlockedListed
 			}
 
 			if err == nil {
+				metricMessagesReceived.Inc(node.dna, m.Type.String())
+				span := h.traceReceive(&m)
 				response, err = node.protocols[proto].Receiver(h, &m)
+				span.Finish(err)
 			}
 		}
 		node.respondWith(s, err, response)
@@ -597,6 +620,7 @@ func (node *Node) Send(ctx context.Context, proto int, addr peer.ID, m *Message)
 	if n != len(data) {
 		err = errors.New("unable to send all data")
 	}
+	metricMessagesSent.Inc(node.dna, m.Type.String())
 	if BytesSentChan != nil {
 		b := BytesSent{Bytes: int64(n), MsgType: m.Type}
 		BytesSentChan <- b
@@ -620,13 +644,24 @@ func (node *Node) NewMessage(t MsgType, body interface{}) (msg *Message) {
 
 // IsBlockedListed checks to see if a node is on the blockedlist
 func (node *Node) IsBlocked(addr peer.ID) (ok bool) {
+	node.blk.RLock()
+	defer node.blk.RUnlock()
 	ok = node.blockedlist[addr]
 	return
 }
 
+// BlockedCount returns the number of peers on the blockedlist
+func (node *Node) BlockedCount() int {
+	node.blk.RLock()
+	defer node.blk.RUnlock()
+	return len(node.blockedlist)
+}
+
 // InitBlockedList sets up the blockedlist from a PeerList
 func (node *Node) InitBlockedList(list PeerList) {
+	node.blk.Lock()
 	node.blockedlist = make(map[peer.ID]bool)
+	node.blk.Unlock()
 	for _, r := range list.Records {
 		node.Block(r.ID)
 	}
@@ -634,6 +669,8 @@ func (node *Node) InitBlockedList(list PeerList) {
 
 // Block adds a peer to the blocklist
 func (node *Node) Block(addr peer.ID) {
+	node.blk.Lock()
+	defer node.blk.Unlock()
 	if node.blockedlist == nil {
 		node.blockedlist = make(map[peer.ID]bool)
 	}
@@ -642,6 +679,8 @@ func (node *Node) Block(addr peer.ID) {
 
 // Unblock removes a peer from the blocklist
 func (node *Node) Unblock(addr peer.ID) {
+	node.blk.Lock()
+	defer node.blk.Unlock()
 	if node.blockedlist != nil {
 		delete(node.blockedlist, addr)
 	}
@@ -662,6 +701,9 @@ const (
 	ErrLinkNotFoundCode
 	ErrEntryTypeMismatchCode
 	ErrBlockedListedCode
+	ErrThrottledCode
+	ErrHashForkedCode
+	ErrTooManyLinksCode
 )
 
 // NewErrorResponse encodes standard errors for transmitting
@@ -681,6 +723,12 @@ func NewErrorResponse(err error) (errResp ErrorResponse) {
 		errResp.Code = ErrEntryTypeMismatchCode
 	case ErrBlockedListed:
 		errResp.Code = ErrBlockedListedCode
+	case ErrThrottled:
+		errResp.Code = ErrThrottledCode
+	case ErrHashForked:
+		errResp.Code = ErrHashForkedCode
+	case ErrTooManyLinks:
+		errResp.Code = ErrTooManyLinksCode
 	default:
 		errResp.Message = err.Error() //Code will be set to ErrUnknown by default cus it's 0
 	}
@@ -704,6 +752,12 @@ func (errResp ErrorResponse) DecodeResponseError() (err error) {
 		err = ErrEntryTypeMismatch
 	case ErrBlockedListedCode:
 		err = ErrBlockedListed
+	case ErrThrottledCode:
+		err = ErrThrottled
+	case ErrHashForkedCode:
+		err = ErrHashForked
+	case ErrTooManyLinksCode:
+		err = ErrTooManyLinks
 	default:
 		err = errors.New(errResp.Message)
 	}
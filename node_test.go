@@ -37,6 +37,8 @@ func TestNodeConstants(t *testing.T) {
 		So(APP_MESSAGE, ShouldEqual, 14)
 		So(LISTADD_REQUEST, ShouldEqual, 15)
 		So(FIND_NODE_REQUEST, ShouldEqual, 16)
+		So(GOSSIP_SUMMARY_REQUEST, ShouldEqual, 17)
+		So(GOSSIP_FETCH_REQUEST, ShouldEqual, 18)
 	})
 }
 
@@ -21,6 +21,7 @@ type DNA struct {
 	BasedOn                   Hash   // references hash of another holochain that these schemas and code are derived from
 	RequiresVersion           int
 	DHTConfig                 DHTConfig
+	RibosomeLimits            RibosomeLimits
 	Progenitor                Progenitor
 	Zomes                     []Zome
 	propertiesSchemaValidator SchemaValidator
@@ -29,6 +30,16 @@ type DNA struct {
 func (dna *DNA) check() (err error) {
 	if dna.RequiresVersion > Version {
 		err = fmt.Errorf("Chain requires Holochain version %d", dna.RequiresVersion)
+		return
+	}
+	var ht HashTable
+	ht, err = CreateHashTable(dna.DHTConfig.HashTableType)
+	if err != nil {
+		return
+	}
+	// queryDHT needs the indexes the entry schemas declare, which only buntdb keeps
+	if _, ok := ht.(*BuntHT); !ok && len(getIndexSpec(dna.Zomes)) > 0 {
+		err = fmt.Errorf("DNA declares queryDHT indexFields, which the %s HashTable doesn't support", dna.DHTConfig.HashTableType)
 	}
 	return
 }
@@ -89,6 +100,11 @@ type AppMsg struct {
 
 // ActionReceiver handles messages on the action protocol
 func ActionReceiver(h *Holochain, msg *Message) (response interface{}, err error) {
+	if msg.Type == PUT_REQUEST && h.dht != nil {
+		if err = h.dht.throttle(msg.From); err != nil {
+			return
+		}
+	}
 	return actionReceiver(h, msg, MaxRetries)
 }
 
@@ -115,9 +131,7 @@ func actionReceiver(h *Holochain, msg *Message, retries int) (response interface
 			if err != nil {
 				if err == ErrHashNotFound {
 					dht.dlog.Logf("don't yet have %s, trying again later", t.RelatedHash)
-					retry := &retry{msg: *msg, retries: retries}
-					dht.retryQueue <- retry
-					response = DHTChangeUnknownHashQueuedForRetry
+					response = dht.queueRetry(msg, retries)
 					err = nil
 				}
 			}
@@ -131,10 +145,24 @@ func actionReceiver(h *Holochain, msg *Message, retries int) (response interface
 		// The Receive functions understand this and use the values from the message body
 		// TODO, this indicates an architectural error, so fix!
 		response, err = a.Receive(dht, msg)
+
+		// the entries a change's validation rules look up may not have reached us yet
+		if err == ErrHashNotFound && (msg.Type == PUT_REQUEST || isRelatedHoldMessage(msg)) {
+			dht.dlog.Logf("validating %v needs an entry we don't yet have, trying again later", msg)
+			response = dht.queueRetry(msg, retries)
+			err = nil
+		}
 	}
 	return
 }
 
+// queueRetry queues a change message to be received again by the RetryTask
+func (dht *DHT) queueRetry(msg *Message, retries int) interface{} {
+	dht.retryQueue <- &retry{msg: *msg, retries: retries}
+	metricRetryQueueDepth.Set(float64(len(dht.retryQueue)), dht.h.dnaHash.String())
+	return DHTChangeUnknownHashQueuedForRetry
+}
+
 // NewUUID generates a new UUID for the DNA
 func (dna *DNA) NewUUID() (err error) {
 	dna.UUID, err = uuid.NewUUID()
@@ -0,0 +1,301 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// reputation scores peers by the bad things they do, sourcing invalid entries, timing
+// out, sending malformed messages and gossiping puts they weren't asked for, so that peers
+// with low scores are picked last as nearest peers and eventually blocked until their
+// scores recover
+
+package holochain
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+)
+
+// ReputationEvent is a bad thing a peer did
+type ReputationEvent int
+
+const (
+	InvalidEntryEvent ReputationEvent = iota
+	SendTimeoutEvent
+	MalformedMessageEvent
+	GossipLieEvent
+)
+
+func (e ReputationEvent) String() string {
+	return []string{"invalid entry", "send timeout", "malformed message", "gossip lie"}[e]
+}
+
+const (
+	MaxReputation = 100 // score of a peer that has done nothing wrong
+
+	// ReputationRecoveryPerHour is how much a peer's score recovers for each hour since its
+	// last bad act, so that the occasional timeout is forgotten
+	ReputationRecoveryPerHour = 5
+
+	DefaultReputationDeprioritize = 50
+	DefaultReputationBlock        = 10
+
+	// DefaultReputationInterval is how often blocked peers are checked to see if their
+	// scores have recovered
+	DefaultReputationInterval = time.Minute
+)
+
+// ReputationPenalties are the amounts a peer's score drops for each kind of event
+var ReputationPenalties = map[ReputationEvent]float64{
+	InvalidEntryEvent:     20,
+	SendTimeoutEvent:      2,
+	MalformedMessageEvent: 10,
+	GossipLieEvent:        20,
+}
+
+// PeerReputation is a peer's score and the counts of the events that lowered it
+type PeerReputation struct {
+	Score          float64
+	Updated        time.Time
+	InvalidEntries int
+	Timeouts       int
+	Malformed      int
+	GossipLies     int
+	Blocked        bool // blocked because of its score, so unblocked once it recovers
+}
+
+// Reputation holds the reputations of peers, persisting them across restarts
+type Reputation struct {
+	lk    sync.RWMutex
+	db    *buntdb.DB
+	peers map[peer.ID]*PeerReputation
+}
+
+// OpenReputation opens the reputation store at the given path, loading the scores of
+// peers from a previous run
+func OpenReputation(path string) (r *Reputation, err error) {
+	var db *buntdb.DB
+	db, err = buntdb.Open(path)
+	if err != nil {
+		return
+	}
+	r = &Reputation{db: db, peers: make(map[peer.ID]*PeerReputation)}
+	err = db.View(func(tx *buntdb.Tx) error {
+		var e error
+		tx.Ascend("", func(key, value string) bool {
+			var id peer.ID
+			id, e = peer.IDB58Decode(key)
+			if e != nil {
+				return false
+			}
+			var rep PeerReputation
+			e = json.Unmarshal([]byte(value), &rep)
+			if e != nil {
+				return false
+			}
+			r.peers[id] = &rep
+			return true
+		})
+		return e
+	})
+	if err != nil {
+		db.Close()
+		r = nil
+	}
+	return
+}
+
+// Close closes the reputation store
+func (r *Reputation) Close() error {
+	return r.db.Close()
+}
+
+// current returns the score including what it has recovered since it was last lowered
+func (rep *PeerReputation) current(now time.Time) float64 {
+	score := rep.Score + now.Sub(rep.Updated).Hours()*ReputationRecoveryPerHour
+	if score > MaxReputation {
+		score = MaxReputation
+	}
+	return score
+}
+
+// Get returns the reputation of a peer
+func (r *Reputation) Get(id peer.ID) (rep PeerReputation) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	p, ok := r.peers[id]
+	if !ok {
+		rep = PeerReputation{Score: MaxReputation, Updated: time.Now()}
+		return
+	}
+	rep = *p
+	rep.Score = p.current(time.Now())
+	return
+}
+
+// Score returns a peer's current score
+func (r *Reputation) Score(id peer.ID) float64 {
+	return r.Get(id).Score
+}
+
+// Peers returns the peers that have a reputation, i.e. have done something wrong
+func (r *Reputation) Peers() (ids []peer.ID) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	for id := range r.peers {
+		ids = append(ids, id)
+	}
+	return
+}
+
+// Record lowers a peer's score for an event returning its new reputation.  The event
+// won't take the score below floor, though a score already below it stays there.
+func (r *Reputation) Record(id peer.ID, event ReputationEvent, floor float64) (rep PeerReputation, err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	now := time.Now()
+	p, ok := r.peers[id]
+	if !ok {
+		p = &PeerReputation{Score: MaxReputation, Updated: now}
+		r.peers[id] = p
+	}
+	current := p.current(now)
+	p.Score = current - ReputationPenalties[event]
+	if p.Score < floor {
+		p.Score = floor
+		if current < floor {
+			p.Score = current
+		}
+	}
+	if p.Score < 0 {
+		p.Score = 0
+	}
+	p.Updated = now
+	switch event {
+	case InvalidEntryEvent:
+		p.InvalidEntries++
+	case SendTimeoutEvent:
+		p.Timeouts++
+	case MalformedMessageEvent:
+		p.Malformed++
+	case GossipLieEvent:
+		p.GossipLies++
+	}
+	rep = *p
+	err = r.save(id, p)
+	return
+}
+
+// SetBlocked records whether a peer has been blocked because of its score
+func (r *Reputation) SetBlocked(id peer.ID, blocked bool) (err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	p, ok := r.peers[id]
+	if !ok || p.Blocked == blocked {
+		return
+	}
+	p.Blocked = blocked
+	err = r.save(id, p)
+	return
+}
+
+// Reset forgets what a peer has done, restoring its score
+func (r *Reputation) Reset(id peer.ID) (err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	delete(r.peers, id)
+	err = r.db.Update(func(tx *buntdb.Tx) error {
+		_, e := tx.Delete(peer.IDB58Encode(id))
+		if e == buntdb.ErrNotFound {
+			e = nil
+		}
+		return e
+	})
+	return
+}
+
+func (r *Reputation) save(id peer.ID, rep *PeerReputation) (err error) {
+	var b []byte
+	b, err = json.Marshal(rep)
+	if err != nil {
+		return
+	}
+	err = r.db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set(peer.IDB58Encode(id), string(b), nil)
+		return e
+	})
+	return
+}
+
+// penalize records a bad act by a peer, blocking the peer if its score drops below the
+// configured threshold.  Timeouts can be the network's fault rather than the peer's so
+// they alone never take a peer's score below the threshold.
+func (h *Holochain) penalize(id peer.ID, event ReputationEvent) {
+	if h.reputation == nil || id == "" || id == h.nodeID {
+		return
+	}
+	var floor float64
+	if event == SendTimeoutEvent {
+		floor = h.Config.ReputationBlock
+	}
+	rep, err := h.reputation.Record(id, event, floor)
+	if err != nil {
+		h.Debugf("penalize: unable to record %v by %v: %v", event, id, err)
+		return
+	}
+	h.Debugf("penalize: %v by %v, score now %v", event, id, rep.Score)
+	if block := h.Config.ReputationBlock; block > 0 && rep.Score < block && !h.node.IsBlocked(id) {
+		h.Debugf("penalize: blocking %v", id)
+		h.BlockPeer(id)
+		h.reputation.SetBlocked(id, true) // ignore error
+	}
+}
+
+// deprioritized returns true if a peer's score is low enough that it should be picked
+// after all the other peers
+func (h *Holochain) deprioritized(id peer.ID) bool {
+	if h.reputation == nil || h.Config.ReputationDeprioritize <= 0 {
+		return false
+	}
+	return h.reputation.Score(id) < h.Config.ReputationDeprioritize
+}
+
+// openReputation opens the chain's reputation store and blocks the peers whose scores
+// were below the threshold when it was last closed
+func (h *Holochain) openReputation() (err error) {
+	if h.reputation != nil {
+		h.reputation.Close()
+	}
+	h.reputation, err = OpenReputation(filepath.Join(h.DBPath(), ReputationDBFileName))
+	if err != nil {
+		return
+	}
+	ReputationTask(h)
+	return
+}
+
+// ReputationTask blocks the peers whose scores are below the threshold and unblocks the
+// ones it blocked whose scores have since recovered.  Peers blocked for other reasons,
+// e.g. by a warrant or by hand, are left blocked.
+func ReputationTask(h *Holochain) {
+	block := h.Config.ReputationBlock
+	if h.reputation == nil || block <= 0 {
+		return
+	}
+	for _, id := range h.reputation.Peers() {
+		rep := h.reputation.Get(id)
+		if rep.Score < block {
+			if !h.node.IsBlocked(id) {
+				h.BlockPeer(id)
+				h.reputation.SetBlocked(id, true) // ignore error
+			}
+		} else if rep.Blocked {
+			h.Debugf("reputation: %v recovered to %v, unblocking", id, rep.Score)
+			h.node.Unblock(id)
+			h.reputation.SetBlocked(id, false) // ignore error
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package holochain
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	tu "github.com/libp2p/go-testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReputation(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	path := filepath.Join(d, ReputationDBFileName)
+	r, err := OpenReputation(path)
+	if err != nil {
+		panic(err)
+	}
+	id, _ := peer.IDB58Decode("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+
+	Convey("peers should start with the max reputation", t, func() {
+		So(r.Score(id), ShouldEqual, MaxReputation)
+		So(len(r.Peers()), ShouldEqual, 0)
+	})
+
+	Convey("events should lower a peer's score and be counted", t, func() {
+		rep, err := r.Record(id, InvalidEntryEvent, 0)
+		So(err, ShouldBeNil)
+		So(rep.Score, ShouldEqual, MaxReputation-ReputationPenalties[InvalidEntryEvent])
+		So(rep.InvalidEntries, ShouldEqual, 1)
+		rep, err = r.Record(id, SendTimeoutEvent, 0)
+		So(err, ShouldBeNil)
+		So(rep.Timeouts, ShouldEqual, 1)
+		So(r.Score(id), ShouldAlmostEqual, MaxReputation-ReputationPenalties[InvalidEntryEvent]-ReputationPenalties[SendTimeoutEvent], .01)
+		So(r.Peers(), ShouldResemble, []peer.ID{id})
+	})
+
+	Convey("events should not lower a score below their floor", t, func() {
+		before := r.Score(id)
+		rep, err := r.Record(id, SendTimeoutEvent, before-1)
+		So(err, ShouldBeNil)
+		So(rep.Score, ShouldAlmostEqual, before-1, .01)
+		So(rep.Timeouts, ShouldEqual, 2)
+		rep, err = r.Record(id, SendTimeoutEvent, MaxReputation)
+		So(err, ShouldBeNil)
+		So(rep.Score, ShouldAlmostEqual, before-1, .01)
+	})
+
+	Convey("scores should recover with time", t, func() {
+		rep := PeerReputation{Score: 50, Updated: time.Now().Add(-2 * time.Hour)}
+		So(rep.current(time.Now()), ShouldAlmostEqual, 50+2*ReputationRecoveryPerHour, .01)
+		rep.Updated = time.Now().Add(-1000 * time.Hour)
+		So(rep.current(time.Now()), ShouldEqual, MaxReputation)
+	})
+
+	Convey("scores should persist across restarts", t, func() {
+		before := r.Get(id)
+		So(r.Close(), ShouldBeNil)
+		r, err = OpenReputation(path)
+		So(err, ShouldBeNil)
+		after := r.Get(id)
+		So(after.InvalidEntries, ShouldEqual, 1)
+		So(after.Timeouts, ShouldEqual, 3)
+		So(after.Score, ShouldAlmostEqual, before.Score, .01)
+	})
+
+	Convey("reset should forget a peer", t, func() {
+		So(r.Reset(id), ShouldBeNil)
+		So(r.Score(id), ShouldEqual, MaxReputation)
+		So(len(r.Peers()), ShouldEqual, 0)
+		So(r.Reset(id), ShouldBeNil)
+	})
+	r.Close()
+}
+
+func TestRoutingTableDeprioritized(t *testing.T) {
+	local := tu.RandPeerIDFatal(t)
+	rt := NewRoutingTable(20, local, time.Hour, pstore.NewMetrics())
+	var peers []peer.ID
+	for i := 0; i < 10; i++ {
+		p := tu.RandPeerIDFatal(t)
+		peers = append(peers, p)
+		rt.Update(p)
+	}
+	target := HashFromPeerID(peers[0])
+
+	Convey("deprioritized peers should be picked after all the others", t, func() {
+		nearest := rt.NearestPeers(target, 10)
+		So(nearest[0], ShouldEqual, peers[0])
+		rt.Deprioritized = func(p peer.ID) bool { return p == peers[0] }
+		nearest = rt.NearestPeers(target, 10)
+		So(len(nearest), ShouldEqual, 10)
+		So(nearest[9], ShouldEqual, peers[0])
+		nearest = rt.NearestPeers(target, 3)
+		So(len(nearest), ShouldEqual, 3)
+		So(nearest, ShouldNotContain, peers[0])
+	})
+}
+
+func TestPenalize(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	id, _ := peer.IDB58Decode("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+
+	Convey("it should not penalize the node itself", t, func() {
+		h.penalize(h.nodeID, GossipLieEvent)
+		So(h.reputation.Score(h.nodeID), ShouldEqual, MaxReputation)
+	})
+
+	Convey("it should deprioritize and then block peers as their scores drop", t, func() {
+		h.Config.ReputationDeprioritize = 70
+		h.Config.ReputationBlock = 55
+		h.penalize(id, GossipLieEvent)
+		So(h.deprioritized(id), ShouldBeFalse)
+		h.penalize(id, InvalidEntryEvent)
+		So(h.deprioritized(id), ShouldBeTrue)
+		So(h.node.IsBlocked(id), ShouldBeFalse)
+		h.penalize(id, MalformedMessageEvent)
+		So(h.node.IsBlocked(id), ShouldBeTrue)
+	})
+
+	Convey("invalid entries should be held against the peers that sourced them", t, func() {
+		h.UnblockPeer(id)
+		So(h.reputation.Score(id), ShouldEqual, MaxReputation)
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "1"})
+		_, err := h.ValidateAction(a, a.entryType, nil, []peer.ID{id})
+		So(IsValidationFailedErr(err), ShouldBeTrue)
+		So(h.reputation.Get(id).InvalidEntries, ShouldEqual, 1)
+	})
+
+	Convey("blocked peers should be blocked again after a restart", t, func() {
+		for i := 0; i < 3; i++ {
+			h.penalize(id, GossipLieEvent)
+		}
+		So(h.node.IsBlocked(id), ShouldBeTrue)
+		h.node.Unblock(id)
+		So(h.openReputation(), ShouldBeNil)
+		So(h.node.IsBlocked(id), ShouldBeTrue)
+	})
+
+	Convey("timeouts alone should not block a peer", t, func() {
+		h.UnblockPeer(id)
+		for i := 0; i < 100; i++ {
+			h.penalize(id, SendTimeoutEvent)
+		}
+		So(h.reputation.Get(id).Timeouts, ShouldEqual, 100)
+		So(h.reputation.Score(id), ShouldAlmostEqual, h.Config.ReputationBlock, .01)
+		So(h.node.IsBlocked(id), ShouldBeFalse)
+	})
+
+	Convey("peers blocked for their scores should be unblocked once they recover", t, func() {
+		h.UnblockPeer(id)
+		for i := 0; i < 3; i++ {
+			h.penalize(id, GossipLieEvent)
+		}
+		So(h.node.IsBlocked(id), ShouldBeTrue)
+		So(h.reputation.Get(id).Blocked, ShouldBeTrue)
+		ReputationTask(h)
+		So(h.node.IsBlocked(id), ShouldBeTrue)
+
+		h.Config.ReputationBlock = 30
+		ReputationTask(h)
+		So(h.node.IsBlocked(id), ShouldBeFalse)
+		So(h.reputation.Get(id).Blocked, ShouldBeFalse)
+	})
+
+	Convey("peers blocked for other reasons should stay blocked", t, func() {
+		h.UnblockPeer(id)
+		h.penalize(id, GossipLieEvent)
+		h.BlockPeer(id)
+		ReputationTask(h)
+		So(h.node.IsBlocked(id), ShouldBeTrue)
+		h.UnblockPeer(id)
+	})
+}
@@ -115,6 +115,7 @@ func RegisterRibosome(name string, factory RibosomeFactory) {
 func RegisterBultinRibosomes() {
 	RegisterRibosome(ZygoRibosomeType, NewZygoRibosome)
 	RegisterRibosome(JSRibosomeType, NewJSRibosome)
+	RegisterRibosome(WASMRibosomeType, NewWASMRibosome)
 }
 
 // CreateRibosome returns a new Ribosome of the given type
@@ -0,0 +1,140 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements the execution limits of ribosome calls, so that app code that loops forever,
+// perhaps because a remote peer sent it an entry crafted to make it, can't hang the node.
+// Validation, genesis and zome calls can each have a wall-clock timeout and a budget of
+// steps, which DNAs opt in to by setting them, so existing DNAs run as they always have.
+// What a step is depends on the ribosome: a statement for JS, and a function call or a pass
+// through a loop for Zygo.  WASM zomes only get the timeout, and their memory is capped by
+// WASMMaxMemoryPages instead.  Capping the memory of JS and Zygo zomes is out of scope, as
+// neither interpreter can account for what a call allocates.
+
+package holochain
+
+import (
+	"fmt"
+	"time"
+)
+
+// RibosomeCallKind is the kind of ribosome call limits get applied to
+type RibosomeCallKind int
+
+const (
+	ValidateCallKind RibosomeCallKind = iota
+	GenesisCallKind
+	ZomeCallKind
+)
+
+func (k RibosomeCallKind) String() string {
+	return []string{"validate", "genesis", "zome"}[k]
+}
+
+// ExecutionLimits bound a kind of ribosome call, zero or negative values mean no limit
+type ExecutionLimits struct {
+	Timeout  int // milliseconds the call may run for
+	MaxSteps int // steps the call may take
+}
+
+// RibosomeLimits holds the execution limits of each kind of ribosome call
+type RibosomeLimits struct {
+	Validate ExecutionLimits // validation and validation package calls
+	Genesis  ExecutionLimits // chain and bridge genesis calls
+	Call     ExecutionLimits // exposed function, receive and send callback calls, and loading the zome
+}
+
+const (
+	TimeoutLimit = "time"
+	StepsLimit   = "step"
+)
+
+// ExecutionLimitErr is returned when a ribosome call runs past one of its limits
+type ExecutionLimitErr struct {
+	Kind  RibosomeCallKind
+	Limit string // TimeoutLimit or StepsLimit
+	Value int
+}
+
+func (e *ExecutionLimitErr) Error() string {
+	if e.Limit == TimeoutLimit {
+		return fmt.Sprintf("%s call exceeded its time limit of %dms", e.Kind, e.Value)
+	}
+	return fmt.Sprintf("%s call exceeded its step limit of %d", e.Kind, e.Value)
+}
+
+// IsExecutionLimitErr returns true if the error is from a ribosome call running past its limits
+func IsExecutionLimitErr(err error) bool {
+	_, ok := err.(*ExecutionLimitErr)
+	return ok
+}
+
+// Get returns the limits of a kind of call
+func (l *RibosomeLimits) Get(kind RibosomeCallKind) (limits ExecutionLimits) {
+	switch kind {
+	case ValidateCallKind:
+		limits = l.Validate
+	case GenesisCallKind:
+		limits = l.Genesis
+	case ZomeCallKind:
+		limits = l.Call
+	}
+	return
+}
+
+// executionLimits returns the limits the DNA sets for a kind of call
+func (h *Holochain) executionLimits(kind RibosomeCallKind) ExecutionLimits {
+	if h == nil || h.nucleus == nil || h.nucleus.dna == nil {
+		return ExecutionLimits{}
+	}
+	return h.nucleus.dna.RibosomeLimits.Get(kind)
+}
+
+// executionLimiter keeps track of a ribosome call against its limits
+type executionLimiter struct {
+	kind     RibosomeCallKind
+	limits   ExecutionLimits
+	deadline time.Time
+	steps    int
+	err      *ExecutionLimitErr
+}
+
+func newExecutionLimiter(kind RibosomeCallKind, limits ExecutionLimits) *executionLimiter {
+	l := executionLimiter{kind: kind, limits: limits}
+	if limits.Timeout > 0 {
+		l.deadline = time.Now().Add(time.Duration(limits.Timeout) * time.Millisecond)
+	}
+	return &l
+}
+
+// step counts a step of the call returning an error once the call has run past its limits,
+// and on every step after that so app code can't just catch it and carry on
+func (l *executionLimiter) step() *ExecutionLimitErr {
+	if l.err != nil {
+		return l.err
+	}
+	l.steps++
+	if l.limits.MaxSteps > 0 && l.steps > l.limits.MaxSteps {
+		l.err = &ExecutionLimitErr{Kind: l.kind, Limit: StepsLimit, Value: l.limits.MaxSteps}
+	} else if l.limits.Timeout > 0 && time.Now().After(l.deadline) {
+		l.err = l.timedOut()
+	}
+	return l.err
+}
+
+func (l *executionLimiter) timedOut() *ExecutionLimitErr {
+	return &ExecutionLimitErr{Kind: l.kind, Limit: TimeoutLimit, Value: l.limits.Timeout}
+}
+
+// recoverExecutionLimit sets err to the ExecutionLimitErr a ribosome panicked with to stop
+// app code, and passes on any other panic
+func recoverExecutionLimit(r interface{}, err *error) {
+	if r == nil {
+		return
+	}
+	e, ok := r.(*ExecutionLimitErr)
+	if !ok {
+		panic(r)
+	}
+	*err = e
+}
@@ -0,0 +1,44 @@
+package holochain
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRibosomeLimits(t *testing.T) {
+	Convey("unset limits should be no limits", t, func() {
+		l := RibosomeLimits{Validate: ExecutionLimits{Timeout: 200, MaxSteps: -1}}
+		So(l.Get(ValidateCallKind), ShouldResemble, ExecutionLimits{Timeout: 200, MaxSteps: -1})
+		So(l.Get(GenesisCallKind), ShouldResemble, ExecutionLimits{})
+		So(l.Get(ZomeCallKind), ShouldResemble, ExecutionLimits{})
+		var h *Holochain
+		So(h.executionLimits(ValidateCallKind), ShouldResemble, ExecutionLimits{})
+	})
+
+	Convey("limiters without limits should never stop calls", t, func() {
+		l := newExecutionLimiter(ValidateCallKind, ExecutionLimits{})
+		for i := 0; i < 1000; i++ {
+			So(l.step(), ShouldBeNil)
+		}
+	})
+
+	Convey("limiters should stop calls that take too many steps", t, func() {
+		l := newExecutionLimiter(ValidateCallKind, ExecutionLimits{MaxSteps: 2})
+		So(l.step(), ShouldBeNil)
+		So(l.step(), ShouldBeNil)
+		err := l.step()
+		So(err.Error(), ShouldEqual, "validate call exceeded its step limit of 2")
+		So(l.step(), ShouldEqual, err)
+	})
+
+	Convey("limiters should stop calls that take too long", t, func() {
+		l := newExecutionLimiter(ZomeCallKind, ExecutionLimits{Timeout: 10})
+		So(l.step(), ShouldBeNil)
+		time.Sleep(20 * time.Millisecond)
+		err := l.step()
+		So(IsExecutionLimitErr(err), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "zome call exceeded its time limit of 10ms")
+	})
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements pools of warmed ribosomes, so that calls, validations and receives don't each
+// have to build a new ribosome and load the zome's code into it.  Only ribosomes that can
+// reset themselves to the state they were in just after loading get pooled, so no state
+// leaks from one call to the next.  That's the JS and WASM ribosomes: zygomys can't copy
+// an environment without sharing its global scope, so Zygo ribosomes aren't pooled and
+// still get built fresh for every call.
+
+package holochain
+
+import (
+	"sync"
+)
+
+// DefaultRibosomePoolSize is the number of free ribosomes kept for each zome
+const DefaultRibosomePoolSize = 8
+
+// ReusableRibosome is a Ribosome that can be reset and reused across calls
+type ReusableRibosome interface {
+	Ribosome
+
+	// Reset puts the ribosome back to the state it was in just after the zome's code was
+	// loaded
+	Reset() error
+}
+
+// ClosableRibosome is a Ribosome holding resources that have to be released once it's no
+// longer needed
+type ClosableRibosome interface {
+	Ribosome
+
+	// Close releases the ribosome's resources, after which it can't be used
+	Close() error
+}
+
+// closeRibosome closes a ribosome if it holds resources that need releasing
+func closeRibosome(r Ribosome) {
+	if cr, ok := r.(ClosableRibosome); ok {
+		cr.Close() // ignore error
+	}
+}
+
+// ribosomePool holds the free ribosomes of each zome
+type ribosomePool struct {
+	lk   sync.Mutex
+	size int
+	free map[string][]ReusableRibosome
+}
+
+func newRibosomePool(size int) *ribosomePool {
+	return &ribosomePool{size: size, free: make(map[string][]ReusableRibosome)}
+}
+
+// get returns a free ribosome for the zome, making a new one if there aren't any
+func (p *ribosomePool) get(h *Holochain, zome *Zome) (r Ribosome, err error) {
+	if p != nil {
+		p.lk.Lock()
+		free := p.free[zome.Name]
+		if l := len(free); l > 0 {
+			r = free[l-1]
+			p.free[zome.Name] = free[:l-1]
+		}
+		p.lk.Unlock()
+		if r != nil {
+			metricRibosomePool.Inc(h.dnaHash.String(), "reused")
+			return
+		}
+	}
+	metricRibosomePool.Inc(h.dnaHash.String(), "made")
+	r, err = zome.MakeRibosome(h)
+	return
+}
+
+// put resets a ribosome and adds it to the zome's free ribosomes, ribosomes that can't be
+// reset or aren't needed get closed and dropped
+func (p *ribosomePool) put(zome *Zome, r Ribosome) {
+	rr, ok := r.(ReusableRibosome)
+	if p == nil || !ok {
+		closeRibosome(r)
+		return
+	}
+	p.lk.Lock()
+	full := len(p.free[zome.Name]) >= p.size
+	p.lk.Unlock()
+	if full || rr.Reset() != nil {
+		closeRibosome(r)
+		return
+	}
+	p.lk.Lock()
+	if len(p.free[zome.Name]) < p.size {
+		p.free[zome.Name] = append(p.free[zome.Name], rr)
+		rr = nil
+	}
+	p.lk.Unlock()
+	if rr != nil {
+		closeRibosome(rr)
+	}
+}
+
+// close closes and drops all the free ribosomes
+func (p *ribosomePool) close() {
+	if p == nil {
+		return
+	}
+	p.lk.Lock()
+	free := p.free
+	p.free = make(map[string][]ReusableRibosome)
+	p.lk.Unlock()
+	for _, rs := range free {
+		for _, r := range rs {
+			closeRibosome(r)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package holochain
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRibosomePool(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	zome := &Zome{Name: "poolZome", RibosomeType: JSRibosomeType, Code: `var count = 0; function inc() {count++; return count}`}
+	inc := &FunctionDef{Name: "inc", CallingType: STRING_CALLING}
+
+	Convey("it should reuse released ribosomes", t, func() {
+		r1, err := h.ribosomes.get(h, zome)
+		So(err, ShouldBeNil)
+		r2, err := h.ribosomes.get(h, zome)
+		So(err, ShouldBeNil)
+		So(r1, ShouldNotEqual, r2)
+		h.ribosomes.put(zome, r1)
+		r3, err := h.ribosomes.get(h, zome)
+		So(err, ShouldBeNil)
+		So(r3, ShouldEqual, r1)
+		h.ribosomes.put(zome, r2)
+		h.ribosomes.put(zome, r3)
+	})
+
+	Convey("reused ribosomes should not keep state from earlier calls", t, func() {
+		r, _ := h.ribosomes.get(h, zome)
+		result, err := r.Call(inc, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "1")
+		result, _ = r.Call(inc, "")
+		So(result, ShouldEqual, "2")
+		h.ribosomes.put(zome, r)
+
+		r2, _ := h.ribosomes.get(h, zome)
+		So(r2, ShouldEqual, r)
+		result, err = r2.Call(inc, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "1")
+		h.ribosomes.put(zome, r2)
+	})
+
+	Convey("reused ribosomes should have the current App values", t, func() {
+		r, _ := h.ribosomes.get(h, zome)
+		h.ribosomes.put(zome, r)
+		top := h.agentTopHash
+		defer func() { h.agentTopHash = top }()
+		h.agentTopHash, _ = NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		r2, _ := h.ribosomes.get(h, zome)
+		So(r2, ShouldEqual, r)
+		_, err := r2.Run("App.Agent.TopHash")
+		So(err, ShouldBeNil)
+		s, _ := r2.(*JSRibosome).lastResult.ToString()
+		So(s, ShouldEqual, "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		h.ribosomes.put(zome, r2)
+	})
+
+	Convey("it should only keep as many free ribosomes as its size", t, func() {
+		var rs []Ribosome
+		for i := 0; i < DefaultRibosomePoolSize+2; i++ {
+			r, _ := h.ribosomes.get(h, zome)
+			rs = append(rs, r)
+		}
+		for _, r := range rs {
+			h.ribosomes.put(zome, r)
+		}
+		So(len(h.ribosomes.free[zome.Name]), ShouldEqual, DefaultRibosomePoolSize)
+	})
+
+	Convey("it should not pool ribosomes that can't be reset", t, func() {
+		zy := &Zome{Name: "zyPoolZome", RibosomeType: ZygoRibosomeType, Code: `(defn foo [] 1)`}
+		r, err := h.ribosomes.get(h, zy)
+		So(err, ShouldBeNil)
+		h.ribosomes.put(zy, r)
+		So(len(h.ribosomes.free[zy.Name]), ShouldEqual, 0)
+	})
+
+	Convey("it should be safe to use from many goroutines", t, func() {
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r, err := h.ribosomes.get(h, zome)
+				if err == nil {
+					var result interface{}
+					result, err = r.Call(inc, "")
+					if err == nil && result != "1" {
+						err = fmt.Errorf("state leaked between calls, got %v", result)
+					}
+					h.ribosomes.put(zome, r)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+	})
+
+	Convey("calls should release their ribosomes", t, func() {
+		z, _ := h.GetZome("jsSampleZome")
+		h.ribosomes.free[z.Name] = nil
+		_, err := h.Call("jsSampleZome", "testStrFn2", "10", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(len(h.ribosomes.free[z.Name]), ShouldEqual, 1)
+	})
+}
+
+func benchmarkJSCall(b *testing.B, pooled bool) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	if !pooled {
+		h.ribosomes = nil
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := h.Call("jsSampleZome", "testStrFn2", "10", ZOME_EXPOSURE)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSCallPooled(b *testing.B) {
+	benchmarkJSCall(b, true)
+}
+
+func BenchmarkJSCallUnpooled(b *testing.B) {
+	benchmarkJSCall(b, false)
+}
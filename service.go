@@ -28,20 +28,21 @@ import (
 
 // System settings, directory, and file names
 const (
-	DefaultDirectoryName string = ".holochain"  // Directory for storing config data
-	ChainDataDir         string = "db"          // Sub-directory for all chain content files
-	ChainDNADir          string = "dna"         // Sub-directory for all chain definition files
-	ChainUIDir           string = "ui"          // Sub-directory for all chain user interface files
-	ChainTestDir         string = "test"        // Sub-directory for all chain test files
-	DNAFileName          string = "dna"         // Definition of the Holochain
-	ConfigFileName       string = "config"      // Settings of the Holochain
-	SysFileName          string = "system.conf" // Server & System settings
-	AgentFileName        string = "agent.txt"   // User ID info
-	PrivKeyFileName      string = "priv.key"    // Signing key - private
-	StoreFileName        string = "chain.db"    // Filename for local data store
-	DNAHashFileName      string = "dna.hash"    // Filename for storing the hash of the holochain
-	DHTStoreFileName     string = "dht.db"      // Filname for storing the dht
-	BridgeDBFileName     string = "bridge.db"   // Filname for storing bridge keys
+	DefaultDirectoryName string = ".holochain"    // Directory for storing config data
+	ChainDataDir         string = "db"            // Sub-directory for all chain content files
+	ChainDNADir          string = "dna"           // Sub-directory for all chain definition files
+	ChainUIDir           string = "ui"            // Sub-directory for all chain user interface files
+	ChainTestDir         string = "test"          // Sub-directory for all chain test files
+	DNAFileName          string = "dna"           // Definition of the Holochain
+	ConfigFileName       string = "config"        // Settings of the Holochain
+	SysFileName          string = "system.conf"   // Server & System settings
+	AgentFileName        string = "agent.txt"     // User ID info
+	PrivKeyFileName      string = "priv.key"      // Signing key - private
+	StoreFileName        string = "chain.db"      // Filename for local data store
+	DNAHashFileName      string = "dna.hash"      // Filename for storing the hash of the holochain
+	DHTStoreFileName     string = "dht.db"        // Filname for storing the dht
+	BridgeDBFileName     string = "bridge.db"     // Filname for storing bridge keys
+	ReputationDBFileName string = "reputation.db" // Filename for storing the reputations of peers
 
 	TestConfigFileName string = "_config.json"
 
@@ -91,6 +92,7 @@ type EntryDefFile struct {
 	Schema     string
 	SchemaFile string // file name of schema or language schema directive
 	Sharing    string
+	Rules      *EntryRules
 }
 
 type ZomeFile struct {
@@ -113,6 +115,7 @@ type DNAFile struct {
 	BasedOn              Hash // references hash of another holochain that these schemas and code are derived from
 	RequiresVersion      int
 	DHTConfig            DHTConfig
+	RibosomeLimits       RibosomeLimits
 	Progenitor           Progenitor
 	Zomes                []ZomeFile
 }
@@ -371,6 +374,7 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 	dna.BasedOn = dnaFile.BasedOn
 	dna.RequiresVersion = dnaFile.RequiresVersion
 	dna.DHTConfig = dnaFile.DHTConfig
+	dna.RibosomeLimits = dnaFile.RibosomeLimits
 	dna.Progenitor = dnaFile.Progenitor
 	dna.Properties = dnaFile.Properties
 	dna.PropertiesSchema = string(propertiesSchema)
@@ -397,6 +401,8 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 				ext = ".js"
 			case "zygo":
 				ext = ".zy"
+			case "wasm":
+				ext = ".wasm"
 			}
 			dnaFile.Zomes[i].CodeFile = zome.Name + ext
 		}
@@ -419,7 +425,11 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		if err != nil {
 			return
 		}
-		dna.Zomes[i].Code = string(code[:])
+		if zome.RibosomeType == WASMRibosomeType {
+			dna.Zomes[i].Code = EncodeWASMCode(code)
+		} else {
+			dna.Zomes[i].Code = string(code[:])
+		}
 
 		dna.Zomes[i].Entries = make([]EntryDef, len(zome.Entries))
 		for j, entry := range zome.Entries {
@@ -427,6 +437,7 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 			dna.Zomes[i].Entries[j].DataFormat = entry.DataFormat
 			dna.Zomes[i].Entries[j].Sharing = entry.Sharing
 			dna.Zomes[i].Entries[j].Schema = entry.Schema
+			dna.Zomes[i].Entries[j].Rules = entry.Rules
 			if entry.Schema == "" && entry.SchemaFile != "" {
 				schemaFilePath := filepath.Join(zomePath, entry.SchemaFile)
 				if !FileExists(schemaFilePath) {
@@ -511,8 +522,13 @@ func (s *Service) load(name string, format string) (hP *Holochain, err error) {
 
 	// if the chain has been started there should be a DNAHashFile which
 	// we can load to check against the actual hash of the DNA entry
-	if len(h.chain.Headers) > 0 {
-		h.dnaHash = h.chain.Headers[0].EntryLink.Clone()
+	if h.chain.Length() > 0 {
+		var dnaHeader *Header
+		dnaHeader, err = h.chain.header(0)
+		if err != nil {
+			return
+		}
+		h.dnaHash = dnaHeader.EntryLink.Clone()
 
 		var b []byte
 		b, err = ReadFile(h.rootPath, DNAHashFileName)
@@ -527,7 +543,12 @@ func (s *Service) load(name string, format string) (hP *Holochain, err error) {
 	// @TODO compare value from file to actual hash
 
 	if h.chain.Length() > 0 {
-		h.agentHash = h.chain.Headers[1].EntryLink
+		var agentHeader *Header
+		agentHeader, err = h.chain.header(1)
+		if err != nil {
+			return
+		}
+		h.agentHash = agentHeader.EntryLink
 		_, topHeader := h.chain.TopType(AgentEntryType)
 		h.agentTopHash = topHeader.EntryLink
 	}
@@ -575,6 +596,8 @@ func suffixByRibosomeType(ribosomeType string) (suffix string) {
 		suffix = ".js"
 	case ZygoRibosomeType:
 		suffix = ".zy"
+	case WASMRibosomeType:
+		suffix = ".wasm"
 	default:
 	}
 	return
@@ -588,13 +611,20 @@ func _makeConfig(s *Service) (config Config, err error) {
 		BootstrapServer: s.Settings.DefaultBootstrapServer,
 		EnableNATUPnP:   s.Settings.DefaultEnableNATUPnP,
 		EnableMDNS:      s.Settings.DefaultEnableMDNS,
+		GossipRateLimit: DefaultGossipRateLimit,
+		GossipBurst:     DefaultGossipBurst,
+		GossipMaxPuts:   DefaultGossipMaxPuts,
+		EnableAdmin:     true,
+
+		ReputationDeprioritize: DefaultReputationDeprioritize,
+		ReputationBlock:        DefaultReputationBlock,
 		Loggers: Loggers{
-			Debug:      Logger{Name: "Debug", Format: "HC: %{file}.%{line}: %{message}", Enabled: false},
+			Debug:      Logger{Name: "Debug", Format: "HC: %{file}.%{line}: %{message}", Enabled: false, Level: "debug"},
 			App:        Logger{Name: "App", Format: "%{color:cyan}%{message}", Enabled: false},
 			DHT:        Logger{Name: "DHT", Format: "%{color:yellow}%{time} DHT: %{message}"},
 			Gossip:     Logger{Name: "Gossip", Format: "%{color:blue}%{time} Gossip: %{message}"},
 			TestPassed: Logger{Name: "TestPassed", Format: "%{color:green}%{message}", Enabled: true},
-			TestFailed: Logger{Name: "TestFailed", Format: "%{color:red}%{message}", Enabled: true},
+			TestFailed: Logger{Name: "TestFailed", Format: "%{color:red}%{message}", Enabled: true, Level: "error"},
 			TestInfo:   Logger{Name: "TestInfo", Format: "%{message}", Enabled: true},
 		},
 	}
@@ -938,6 +968,7 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 		BasedOn:              dna.BasedOn,
 		RequiresVersion:      dna.RequiresVersion,
 		DHTConfig:            dna.DHTConfig,
+		RibosomeLimits:       dna.RibosomeLimits,
 		Progenitor:           dna.Progenitor,
 	}
 	for _, z := range dna.Zomes {
@@ -945,7 +976,13 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 		if err = os.MkdirAll(zpath, os.ModePerm); err != nil {
 			return
 		}
-		if err = WriteFile([]byte(z.Code), zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
+		code := []byte(z.Code)
+		if z.RibosomeType == WASMRibosomeType {
+			if code, err = DecodeWASMCode(z.Code); err != nil {
+				return
+			}
+		}
+		if err = WriteFile(code, zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
 			return
 		}
 
@@ -963,6 +1000,7 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 				Name:       e.Name,
 				DataFormat: e.DataFormat,
 				Sharing:    e.Sharing,
+				Rules:      e.Rules,
 			}
 			if e.DataFormat == DataFormatJSON && e.Schema != "" {
 				entryDefFile.SchemaFile = e.Name + ".json"
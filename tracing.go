@@ -0,0 +1,424 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// tracing records spans of the work done for a zome call, on this node and on the nodes
+// it sends messages to, so that a single call can be followed across all the nodes it
+// touched. Spans are exported to a local file or to an OTLP collector over http.
+
+package holochain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// SpanContext identifies a span and the trace it's part of, and is carried in messages so
+// the spans of the receiving node can be recorded as children of the sender's
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// IsValid returns true if the context identifies a span
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != "" && c.SpanID != ""
+}
+
+// Span is a timed piece of work done by a node as part of a trace
+type Span struct {
+	TraceID    string            `json:"traceId"`
+	SpanID     string            `json:"spanId"`
+	ParentID   string            `json:"parentSpanId,omitempty"`
+	Name       string            `json:"name"`
+	Node       string            `json:"node"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	tracer     *Tracer
+}
+
+// SpanExporter receives the spans a tracer has finished. The tracer never calls an
+// exporter's ExportSpan concurrently.
+type SpanExporter interface {
+	ExportSpan(s *Span) error
+	Close() error
+}
+
+// Tracer starts spans for a node and exports them when they're finished.  It holds no
+// notion of a current span, the context of the span work is part of is passed along with
+// the work, in the messages it sends and to the API functions a zome call makes.
+type Tracer struct {
+	node     string
+	lk       sync.Mutex
+	exporter SpanExporter
+}
+
+// traced is implemented by the ribosomes and API functions that are handed the context
+// of the zome call they run for, so the work they do is recorded under its span
+type traced interface {
+	setTrace(c SpanContext)
+}
+
+// tracing is embedded in the API functions that record their work under the span of
+// the zome call making them
+type tracing struct {
+	trace SpanContext
+}
+
+func (t *tracing) setTrace(c SpanContext) {
+	t.trace = c
+}
+
+var ErrSpanDropped = errors.New("span dropped, exporter is behind")
+
+func NewTracer(node string, exporter SpanExporter) *Tracer {
+	return &Tracer{node: node, exporter: exporter}
+}
+
+func newTraceID(bytes int) string {
+	b := make([]byte, bytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// StartSpan starts a span that is a child of parent, or the root of a new trace if
+// parent isn't valid. It returns nil, which is safe to use as a span, if t is nil.
+func (t *Tracer) StartSpan(name string, parent SpanContext) (s *Span) {
+	if t == nil {
+		return
+	}
+	s = &Span{
+		SpanID: newTraceID(8),
+		Name:   name,
+		Node:   t.node,
+		Start:  time.Now(),
+		tracer: t,
+	}
+	if parent.IsValid() {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+	} else {
+		s.TraceID = newTraceID(16)
+	}
+	return
+}
+
+// Close closes the tracer's exporter, spans finished afterwards aren't exported
+func (t *Tracer) Close() (err error) {
+	if t == nil {
+		return
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if t.exporter != nil {
+		err = t.exporter.Close()
+		t.exporter = nil
+	}
+	return
+}
+
+// Context returns the context identifying the span
+func (s *Span) Context() (c SpanContext) {
+	if s != nil {
+		c = SpanContext{TraceID: s.TraceID, SpanID: s.SpanID}
+	}
+	return
+}
+
+// SetAttribute adds a key value pair describing the span
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// Finish ends the span, recording err if the work failed, and exports it
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	t := s.tracer
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if t.exporter != nil {
+		t.exporter.ExportSpan(s) // ignore error, tracing mustn't get in the way of the work
+	}
+}
+
+// FileSpanExporter appends spans to a file, one JSON object per line
+type FileSpanExporter struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewFileSpanExporter(path string) (e *FileSpanExporter, err error) {
+	var f *os.File
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	e = &FileSpanExporter{f: f, enc: json.NewEncoder(f)}
+	return
+}
+
+func (e *FileSpanExporter) ExportSpan(s *Span) error {
+	return e.enc.Encode(s)
+}
+
+func (e *FileSpanExporter) Close() error {
+	return e.f.Close()
+}
+
+// OTLPBatchSize is the most spans an OTLPSpanExporter sends in one request
+const OTLPBatchSize = 100
+
+// OTLPFlushInterval is how often an OTLPSpanExporter sends the spans it's holding
+var OTLPFlushInterval = time.Second
+
+// OTLPSpanExporter sends batches of spans to a collector's url in the OTLP/HTTP JSON
+// encoding
+type OTLPSpanExporter struct {
+	url      string
+	resource []otlpKeyValue
+	spans    chan *Span
+	done     chan error
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// OTLP span status codes
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+func otlpAttributes(attrs map[string]string) (kvs []otlpKeyValue) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attrs[k]}})
+	}
+	return
+}
+
+// NewOTLPSpanExporter returns an exporter sending spans to the url, described by the
+// given resource attributes
+func NewOTLPSpanExporter(url string, resource map[string]string) *OTLPSpanExporter {
+	e := OTLPSpanExporter{
+		url:      url,
+		resource: otlpAttributes(resource),
+		spans:    make(chan *Span, 10*OTLPBatchSize),
+		done:     make(chan error, 1),
+	}
+	go e.run()
+	return &e
+}
+
+// ExportSpan queues a span to be sent, dropping it if the queue is full
+func (e *OTLPSpanExporter) ExportSpan(s *Span) (err error) {
+	select {
+	case e.spans <- s:
+	default:
+		err = ErrSpanDropped
+	}
+	return
+}
+
+// Close sends any queued spans and stops the exporter, returning the error of the last
+// request that failed
+func (e *OTLPSpanExporter) Close() error {
+	close(e.spans)
+	return <-e.done
+}
+
+func (e *OTLPSpanExporter) run() {
+	var batch []*Span
+	var err error
+	ticker := time.NewTicker(OTLPFlushInterval)
+	defer ticker.Stop()
+	flush := func() {
+		if len(batch) > 0 {
+			if perr := e.post(batch); perr != nil {
+				err = perr
+			}
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case s, ok := <-e.spans:
+			if !ok {
+				flush()
+				e.done <- err
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= OTLPBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (e *OTLPSpanExporter) post(batch []*Span) (err error) {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		o := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              1, // internal
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		o.Attributes = append(o.Attributes, otlpKeyValue{Key: "holochain.node", Value: otlpAnyValue{StringValue: s.Node}})
+		if s.Error != "" {
+			o.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		spans = append(spans, o)
+	}
+	traces := otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: e.resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "holochain"}, Spans: spans}},
+	}}}
+	var b []byte
+	b, err = json.Marshal(traces)
+	if err != nil {
+		return
+	}
+	var resp *http.Response
+	resp, err = http.Post(e.url, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("trace collector %s responded: %s", e.url, resp.Status)
+	}
+	return
+}
+
+// startTracing sets up the tracer if the config says where to export spans to, an http
+// url being taken as that of an OTLP collector and anything else as a file, relative to
+// the chain's directory
+func (h *Holochain) startTracing() (err error) {
+	h.tracer.Close()
+	h.tracer = nil
+	export := h.Config.TraceExport
+	if export == "" {
+		return
+	}
+	var exporter SpanExporter
+	if strings.HasPrefix(export, "http://") || strings.HasPrefix(export, "https://") {
+		exporter = NewOTLPSpanExporter(export, map[string]string{
+			"service.name":   "holochain",
+			"holochain.dna":  h.dnaHash.String(),
+			"holochain.name": h.Name(),
+		})
+	} else {
+		if !filepath.IsAbs(export) {
+			export = filepath.Join(h.rootPath, export)
+		}
+		var f *FileSpanExporter
+		f, err = NewFileSpanExporter(export)
+		if err != nil {
+			return
+		}
+		exporter = f
+	}
+	h.tracer = NewTracer(h.nodeIDStr, exporter)
+	return
+}
+
+// traceReceive starts a span for handling a received message that's part of a trace,
+// making the message's context that of the span so any messages sent while handling it
+// are recorded under it
+func (h *Holochain) traceReceive(m *Message) (s *Span) {
+	if !m.Trace.IsValid() {
+		return
+	}
+	s = h.tracer.StartSpan("receive "+m.Type.String(), m.Trace)
+	if s != nil {
+		s.SetAttribute("from", peer.IDB58Encode(m.From))
+		m.Trace = s.Context()
+	}
+	return
+}
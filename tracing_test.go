@@ -0,0 +1,227 @@
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testSpanExporter struct {
+	lk    sync.Mutex
+	spans []*Span
+}
+
+func (e *testSpanExporter) ExportSpan(s *Span) error {
+	e.lk.Lock()
+	e.spans = append(e.spans, s)
+	e.lk.Unlock()
+	return nil
+}
+
+func (e *testSpanExporter) Close() error {
+	return nil
+}
+
+// named returns the exported spans with the given name
+func (e *testSpanExporter) named(name string) (spans []*Span) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	for _, s := range e.spans {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return
+}
+
+func TestTracer(t *testing.T) {
+	Convey("a nil tracer should start nil spans that are safe to use", t, func() {
+		var tracer *Tracer
+		s := tracer.StartSpan("fish", SpanContext{})
+		So(s, ShouldBeNil)
+		s.SetAttribute("key", "value")
+		s.Finish(nil)
+		So(s.Context().IsValid(), ShouldBeFalse)
+	})
+
+	Convey("it should start spans in the trace of their parents", t, func() {
+		e := &testSpanExporter{}
+		tracer := NewTracer("node", e)
+		root := tracer.StartSpan("root", SpanContext{})
+		So(len(root.TraceID), ShouldEqual, 32)
+		So(len(root.SpanID), ShouldEqual, 16)
+		So(root.ParentID, ShouldEqual, "")
+
+		child := tracer.StartSpan("child", root.Context())
+		So(child.TraceID, ShouldEqual, root.TraceID)
+		So(child.ParentID, ShouldEqual, root.SpanID)
+		So(child.SpanID, ShouldNotEqual, root.SpanID)
+		So(child.Node, ShouldEqual, "node")
+
+		child.Finish(errors.New("bad fish"))
+		root.Finish(nil)
+		So(len(e.spans), ShouldEqual, 2)
+		So(e.spans[0].Error, ShouldEqual, "bad fish")
+		So(e.spans[0].End.Before(e.spans[0].Start), ShouldBeFalse)
+	})
+
+	Convey("it should not export spans after it's closed", t, func() {
+		e := &testSpanExporter{}
+		tracer := NewTracer("node", e)
+		s := tracer.StartSpan("fish", SpanContext{})
+		So(tracer.Close(), ShouldBeNil)
+		s.Finish(nil)
+		So(len(e.spans), ShouldEqual, 0)
+	})
+}
+
+func TestSpanExporters(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+
+	Convey("the file exporter should write spans as lines of JSON", t, func() {
+		path := filepath.Join(d, "spans.json")
+		e, err := NewFileSpanExporter(path)
+		So(err, ShouldBeNil)
+		tracer := NewTracer("node", e)
+		s := tracer.StartSpan("fish", SpanContext{})
+		s.SetAttribute("kind", "red")
+		s.Finish(nil)
+		tracer.StartSpan("fish2", s.Context()).Finish(nil)
+		So(tracer.Close(), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		So(len(lines), ShouldEqual, 2)
+		var span Span
+		err = json.Unmarshal([]byte(lines[1]), &span)
+		So(err, ShouldBeNil)
+		So(span.Name, ShouldEqual, "fish2")
+		So(span.ParentID, ShouldEqual, s.SpanID)
+		So(lines[0], ShouldContainSubstring, `"attributes":{"kind":"red"}`)
+	})
+
+	Convey("the OTLP exporter should post batches of spans to the collector", t, func() {
+		var lk sync.Mutex
+		var received []otlpTraces
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var traces otlpTraces
+			json.NewDecoder(r.Body).Decode(&traces)
+			lk.Lock()
+			received = append(received, traces)
+			lk.Unlock()
+		}))
+		defer collector.Close()
+
+		e := NewOTLPSpanExporter(collector.URL+"/v1/traces", map[string]string{"service.name": "holochain"})
+		tracer := NewTracer("node", e)
+		s := tracer.StartSpan("fish", SpanContext{})
+		s.Start = time.Unix(1, 0)
+		s.Finish(errors.New("bad fish"))
+		So(tracer.Close(), ShouldBeNil)
+
+		So(len(received), ShouldEqual, 1)
+		rs := received[0].ResourceSpans[0]
+		So(rs.Resource.Attributes, ShouldResemble, []otlpKeyValue{{Key: "service.name", Value: otlpAnyValue{StringValue: "holochain"}}})
+		span := rs.ScopeSpans[0].Spans[0]
+		So(span.TraceID, ShouldEqual, s.TraceID)
+		So(span.Name, ShouldEqual, "fish")
+		So(span.StartTimeUnixNano, ShouldEqual, "1000000000")
+		So(span.Status, ShouldResemble, otlpStatus{Code: otlpStatusError, Message: "bad fish"})
+	})
+}
+
+func TestTracingAcrossNodes(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+
+	h0, h1 := mt.nodes[0], mt.nodes[1]
+	e0, e1 := &testSpanExporter{}, &testSpanExporter{}
+	h0.tracer = NewTracer(h0.nodeIDStr, e0)
+	h1.tracer = NewTracer(h1.nodeIDStr, e1)
+
+	Convey("a zome call should be traced across the nodes it touches", t, func() {
+		_, err := h0.Call("zySampleZome", "addEven", "42", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		processChangeRequestsInTesting(h0)
+
+		calls := e0.named("call zySampleZome.addEven")
+		So(len(calls), ShouldEqual, 1)
+		trace := calls[0].TraceID
+		for _, name := range []string{"commitAndShare", "doCommit", "change PUT_REQUEST"} {
+			spans := e0.named(name)
+			So(len(spans), ShouldBeGreaterThan, 0)
+			So(spans[0].TraceID, ShouldEqual, trace)
+		}
+
+		// the put reaches the other node which asks this one for validation
+		var puts, validates []*Span
+		for i := 0; i < 50 && (len(puts) == 0 || len(validates) == 0); i++ {
+			time.Sleep(100 * time.Millisecond)
+			puts = e1.named("receive PUT_REQUEST")
+			validates = nil
+			for _, s := range e0.named("receive VALIDATE_PUT_REQUEST") {
+				if s.Attributes["from"] == h1.nodeIDStr {
+					validates = append(validates, s)
+				}
+			}
+		}
+		So(len(puts), ShouldBeGreaterThan, 0)
+		So(puts[0].TraceID, ShouldEqual, trace)
+		So(puts[0].Node, ShouldEqual, h1.nodeIDStr)
+		So(len(validates), ShouldBeGreaterThan, 0)
+		So(validates[0].TraceID, ShouldEqual, trace)
+	})
+
+	Convey("zome calls running at the same time should each be traced on their own", t, func() {
+		e0.lk.Lock()
+		e0.spans = nil
+		e0.lk.Unlock()
+		var wg sync.WaitGroup
+		for _, n := range []string{"44", "46"} {
+			wg.Add(1)
+			go func(n string) {
+				defer wg.Done()
+				h0.Call("zySampleZome", "addEven", n, ZOME_EXPOSURE)
+			}(n)
+		}
+		wg.Wait()
+
+		calls := e0.named("call zySampleZome.addEven")
+		So(len(calls), ShouldEqual, 2)
+		So(calls[0].TraceID, ShouldNotEqual, calls[1].TraceID)
+		commits := e0.named("commitAndShare")
+		So(len(commits), ShouldEqual, 2)
+		for _, c := range commits {
+			found := false
+			for _, call := range calls {
+				if c.TraceID == call.TraceID && c.ParentID == call.SpanID {
+					found = true
+				}
+			}
+			So(found, ShouldBeTrue)
+		}
+	})
+
+	Convey("messages sent outside of a traced call shouldn't be traced", t, func() {
+		e0.lk.Lock()
+		e0.spans = nil
+		e0.lk.Unlock()
+		m := h0.node.NewMessage(APP_MESSAGE, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		_, err := h0.Send(h0.node.ctx, ActionProtocol, h1.nodeID, m, 0)
+		So(err, ShouldBeNil)
+		So(len(e0.named("send APP_MESSAGE")), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,283 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements the JSON-RPC admin api of a running node, and a client for it
+
+package ui
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	holo "github.com/HC-Interns/holochain-proto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCServerError    = -32000
+)
+
+// RPCRequest is a JSON-RPC 2.0 request
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// RPCError is the error of a failed JSON-RPC call
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// RPCResponse is a JSON-RPC 2.0 response
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// PeerParams are the params of the block and unblock methods
+type PeerParams struct {
+	Peer string `json:"peer"`
+}
+
+// AdminServer serves the admin api of a running node on localhost. Clients authenticate
+// with the token the server writes, along with its port, to the chain's admin file.
+type AdminServer struct {
+	h        *holo.Holochain
+	token    string
+	log      holo.Logger
+	errs     holo.Logger
+	listener net.Listener
+	server   *http.Server
+}
+
+func NewAdminServer(h *holo.Holochain) *AdminServer {
+	a := AdminServer{h: h}
+	a.log = holo.Logger{Format: "%{color:magenta}%{message}"}
+	a.errs = holo.Logger{Format: "%{color:red}%{time} %{message}", Enabled: true}
+	return &a
+}
+
+// Start starts serving the admin api and writes the admin file
+func (a *AdminServer) Start() (err error) {
+	a.log.New(nil)
+	a.errs.New(os.Stderr)
+
+	a.token, err = holo.NewAdminToken()
+	if err != nil {
+		return
+	}
+	a.listener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", a.h.Config.AdminPort))
+	if err != nil {
+		return
+	}
+	port := a.listener.Addr().(*net.TCPAddr).Port
+	err = a.h.WriteAdminInfo(holo.AdminInfo{Port: port, Token: a.token})
+	if err != nil {
+		a.listener.Close()
+		return
+	}
+	a.log.Logf("Starting admin api on localhost:%d\n", port)
+
+	a.server = &http.Server{Handler: a}
+	go func() {
+		if err := a.server.Serve(a.listener); err != nil && err != http.ErrServerClosed {
+			a.errs.Logf("admin api stopped: %v", err)
+		}
+	}()
+	return
+}
+
+// Stop shuts down the admin api and removes the admin file
+func (a *AdminServer) Stop() {
+	if a.server != nil {
+		a.server.Shutdown(context.Background())
+		a.server = nil
+	}
+	a.h.RemoveAdminInfo()
+}
+
+// Authorized returns true if the request carries the token as its bearer token
+func Authorized(r *http.Request, token string) bool {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(auth), []byte(token)) == 1
+}
+
+// ServeHTTP checks the client's token and handles a JSON-RPC request
+func (a *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !Authorized(r, a.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RPCRequest
+	resp := RPCResponse{JSONRPC: "2.0"}
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		resp.Error = &RPCError{Code: RPCParseError, Message: err.Error()}
+	} else if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.ID = req.ID
+		resp.Error = &RPCError{Code: RPCInvalidRequest, Message: "invalid request"}
+	} else {
+		resp.ID = req.ID
+		a.log.Logf("admin call: %s", req.Method)
+		var result interface{}
+		result, resp.Error = a.call(req.Method, req.Params)
+		if resp.Error == nil {
+			resp.Result, err = json.Marshal(result)
+			if err != nil {
+				resp.Error = &RPCError{Code: RPCServerError, Message: err.Error()}
+			}
+		}
+	}
+	b, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (a *AdminServer) peerParam(params json.RawMessage) (id peer.ID, rpcErr *RPCError) {
+	var p PeerParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		rpcErr = &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+		return
+	}
+	id, err := peer.IDB58Decode(p.Peer)
+	if err != nil {
+		rpcErr = &RPCError{Code: RPCInvalidParams, Message: fmt.Sprintf("bad peer id %s: %v", p.Peer, err)}
+	}
+	return
+}
+
+func (a *AdminServer) call(method string, params json.RawMessage) (result interface{}, rpcErr *RPCError) {
+	var err error
+	switch method {
+	case "status":
+		result, err = a.h.NodeStatus()
+	case "peers":
+		result = a.h.NodePeers()
+	case "gossipers":
+		result, err = a.h.NodeGossipers()
+	case "block", "unblock":
+		var id peer.ID
+		id, rpcErr = a.peerParam(params)
+		if rpcErr != nil {
+			return
+		}
+		if method == "block" {
+			a.h.BlockPeer(id)
+		} else {
+			a.h.UnblockPeer(id)
+		}
+		result = true
+	case "gossip":
+		err = a.h.TriggerGossip()
+		result = true
+	case "holding":
+		err = a.h.TriggerHoldingCheck()
+		result = true
+	default:
+		rpcErr = &RPCError{Code: RPCMethodNotFound, Message: "method not found: " + method}
+		return
+	}
+	if err != nil {
+		rpcErr = &RPCError{Code: RPCServerError, Message: err.Error()}
+	}
+	return
+}
+
+// AdminClient makes calls to the admin api of a running node
+type AdminClient struct {
+	info holo.AdminInfo
+	id   int
+}
+
+// NewAdminClient returns a client for the node running the chain at the given path
+func NewAdminClient(root string) (c *AdminClient, err error) {
+	var info holo.AdminInfo
+	info, err = holo.ReadAdminInfo(root)
+	if err != nil {
+		return
+	}
+	c = &AdminClient{info: info}
+	return
+}
+
+// Call calls a method of the admin api decoding the result into result
+func (c *AdminClient) Call(method string, params interface{}, result interface{}) (err error) {
+	c.id++
+	req := RPCRequest{JSONRPC: "2.0", Method: method, ID: json.RawMessage(fmt.Sprintf("%d", c.id))}
+	if params != nil {
+		req.Params, err = json.Marshal(params)
+		if err != nil {
+			return
+		}
+	}
+	var b []byte
+	b, err = json.Marshal(req)
+	if err != nil {
+		return
+	}
+	var hreq *http.Request
+	hreq, err = http.NewRequest("POST", fmt.Sprintf("http://127.0.0.1:%d/", c.info.Port), bytes.NewBuffer(b))
+	if err != nil {
+		return
+	}
+	hreq.Header.Set("Authorization", "Bearer "+c.info.Token)
+	hreq.Header.Set("Content-Type", "application/json")
+	var hresp *http.Response
+	hresp, err = http.DefaultClient.Do(hreq)
+	if err != nil {
+		return
+	}
+	defer hresp.Body.Close()
+	b, err = ioutil.ReadAll(hresp.Body)
+	if err != nil {
+		return
+	}
+	if hresp.StatusCode != 200 {
+		err = errors.New(strings.TrimSpace(string(b)))
+		return
+	}
+	var resp RPCResponse
+	err = json.Unmarshal(b, &resp)
+	if err != nil {
+		return
+	}
+	if resp.Error != nil {
+		err = resp.Error
+		return
+	}
+	if result != nil {
+		err = json.Unmarshal(resp.Result, result)
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/HC-Interns/holochain-proto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"testing"
+)
+
+func TestAdminServer(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("a client should fail when the node isn't running", t, func() {
+		_, err := NewAdminClient(h.RootPath())
+		So(err, ShouldEqual, ErrAdminNotRunning)
+	})
+
+	admin := NewAdminServer(h)
+	err := admin.Start()
+	if err != nil {
+		panic(err)
+	}
+	client, err := NewAdminClient(h.RootPath())
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should report the node's status", t, func() {
+		var status NodeStatus
+		err := client.Call("status", nil, &status)
+		So(err, ShouldBeNil)
+		So(status.DNA, ShouldEqual, h.DNAHash().String())
+		So(status.ID, ShouldEqual, h.NodeIDStr())
+		So(status.ChainLength, ShouldEqual, 2)
+		So(status.ChainBytes, ShouldBeGreaterThan, 0)
+		So(status.DHTIdx, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("it should list peers and gossipers", t, func() {
+		var peers []NodePeer
+		So(client.Call("peers", nil, &peers), ShouldBeNil)
+		So(len(peers), ShouldEqual, 0)
+		var gossipers []NodeGossiper
+		So(client.Call("gossipers", nil, &gossipers), ShouldBeNil)
+		So(len(gossipers), ShouldEqual, 0)
+	})
+
+	Convey("it should block and unblock peers", t, func() {
+		id, _ := peer.IDB58Decode("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(client.Call("block", PeerParams{Peer: peer.IDB58Encode(id)}, nil), ShouldBeNil)
+		So(h.Node().IsBlocked(id), ShouldBeTrue)
+		So(client.Call("unblock", PeerParams{Peer: peer.IDB58Encode(id)}, nil), ShouldBeNil)
+		So(h.Node().IsBlocked(id), ShouldBeFalse)
+
+		err := client.Call("block", PeerParams{Peer: "bogus"}, nil)
+		So(err, ShouldNotBeNil)
+		So(err.(*RPCError).Code, ShouldEqual, RPCInvalidParams)
+	})
+
+	Convey("it should report errors from triggered tasks", t, func() {
+		err := client.Call("gossip", nil, nil)
+		So(err.Error(), ShouldEqual, "no gossipers available")
+		err = client.Call("holding", nil, nil)
+		So(err.Error(), ShouldEqual, ErrHoldingNeedsWorldModel.Error())
+	})
+
+	Convey("it should fail unknown methods", t, func() {
+		err := client.Call("bogus", nil, nil)
+		So(err.(*RPCError).Code, ShouldEqual, RPCMethodNotFound)
+	})
+
+	Convey("it should reject calls without the token", t, func() {
+		client.info.Token = "bogus"
+		err := client.Call("status", nil, nil)
+		So(err.Error(), ShouldEqual, "unauthorized")
+		resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/", client.info.Port), "application/json", bytes.NewBuffer([]byte(`{"jsonrpc":"2.0","method":"status","id":1}`)))
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+	})
+
+	admin.Stop()
+	Convey("it should remove the admin file when stopped", t, func() {
+		_, err := NewAdminClient(h.RootPath())
+		So(err, ShouldEqual, ErrAdminNotRunning)
+	})
+}
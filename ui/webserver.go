@@ -44,8 +44,9 @@ func AddCors(w http.ResponseWriter) {
 	headers.Set("Access-Control-Allow-Headers", "Content-Type")
 }
 
-//Start starts up a web server and returns a channel which will shutdown
-func (ws *WebServer) Start() {
+// Handler returns the http handler for the chain's UI, functions and bridging, which
+// can be mounted under a prefix when more than one chain is being served
+func (ws *WebServer) Handler() http.Handler {
 
 	mux := http.NewServeMux()
 
@@ -54,6 +55,7 @@ func (ws *WebServer) Start() {
 
 	fs := http.FileServer(http.Dir(ws.h.UIPath()))
 	mux.Handle("/", fs)
+	mux.Handle("/_metrics", ws.h.MetricsHandler())
 
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
@@ -242,10 +244,17 @@ func (ws *WebServer) Start() {
 		}
 	})
 
+	return mux
+}
+
+//Start starts up a web server and returns a channel which will shutdown
+func (ws *WebServer) Start() {
+
 	// set router
+	handler := ws.Handler()
 	ws.log.Logf("Starting server on localhost:%s\n", ws.port)
 
-	ws.server = &http.Server{Addr: ":" + ws.port, Handler: mux}
+	ws.server = &http.Server{Addr: ":" + ws.port, Handler: handler}
 
 	go func() {
 		if err := ws.server.ListenAndServe(); err != nil {
@@ -117,6 +117,18 @@ func TestWebServer(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(string(b), ShouldEqual, "en")
 	})
+
+	Convey("it should serve the metrics", t, func() {
+		resp, err := http.Get("http://0.0.0.0:31415/_metrics")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		var b []byte
+		b, err = ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(string(b), ShouldContainSubstring, "# TYPE holochain_zome_call_duration_seconds histogram\n")
+		So(string(b), ShouldContainSubstring, `holochain_zome_call_duration_seconds_count{dna="`+h.DNAHash().String()+`",zome="jsSampleZome",function="getProperty"}`)
+	})
 	ws.Stop()
 	ws.Wait()
 }
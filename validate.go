@@ -22,7 +22,8 @@ type Package struct {
 // holds the package with any chain data un-marshaled after validation for passing
 // into the app for app level validation
 type ValidationPackage struct {
-	Chain *Chain
+	Chain  *Chain
+	Status int // status of the entry on the DHT when it's other than live, i.e. StatusForked
 }
 
 const (
@@ -110,7 +111,12 @@ func MakeValidationPackage(h *Holochain, pkg *Package) (vpkg *ValidationPackage,
 		}
 		if flags&ChainMarshalFlagsNoEntries == 0 {
 			// restore the chain's DNA data
-			vp.Chain.Entries[0].(*GobEntry).C = h.chain.Entries[0].(*GobEntry).C
+			var dna Entry
+			dna, err = h.chain.entry(0)
+			if err != nil {
+				return
+			}
+			vp.Chain.Entries[0].(*GobEntry).C = dna.(*GobEntry).C
 		}
 		if flags&ChainMarshalFlagsNoHeaders == 0 {
 			err = vp.Chain.Validate(flags&ChainMarshalFlagsNoEntries != 0)
@@ -8,6 +8,7 @@ package holochain
 
 import (
 	"errors"
+	"fmt"
 	. "github.com/HC-Interns/holochain-proto/hash"
 	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
@@ -15,6 +16,8 @@ import (
 
 const (
 	SelfRevocationType = iota
+	InvalidEntryType
+	ChainForkType
 )
 
 // Warrant abstracts the notion of a multi-party cryptographically verifiable signed claim
@@ -45,6 +48,10 @@ type Warrant interface {
 
 var WarrantPropertyNotFoundErr = errors.New("warrant property not found")
 var UnknownWarrantTypeErr = errors.New("unknown warrant type")
+var ErrWarrantBadSignature = errors.New("warrant header signature does not verify")
+var ErrWarrantLegacyHeader = errors.New("warrant header is a legacy header whose signature only covers its entry")
+var ErrWarrantEntryValid = errors.New("warranted entry is valid")
+var ErrWarrantNoFork = errors.New("warranted headers are not a fork")
 
 // SelfRevocationWarrant warrants that the first party revoked its own key in favor of the second
 type SelfRevocationWarrant struct {
@@ -62,6 +69,12 @@ func DecodeWarrant(warrantType int, data []byte) (w Warrant, err error) {
 	case SelfRevocationType:
 		w = &SelfRevocationWarrant{}
 		err = w.Decode(data)
+	case InvalidEntryType:
+		w = &InvalidEntryWarrant{}
+		err = w.Decode(data)
+	case ChainForkType:
+		w = &ChainForkWarrant{}
+		err = w.Decode(data)
 	default:
 		err = UnknownWarrantTypeErr
 	}
@@ -158,3 +171,301 @@ func (w *SelfRevocationWarrant) Decode(data []byte) (err error) {
 	err = w.Revocation.Unmarshal(string(data))
 	return
 }
+
+// keyParty returns the hash of the public key of a warranted agent
+func keyParty(key []byte) (party Hash, err error) {
+	var pubKey ic.PubKey
+	pubKey, err = ic.UnmarshalPublicKey(key)
+	if err != nil {
+		return
+	}
+	var ID peer.ID
+	ID, err = peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return
+	}
+	party, err = NewHash(peer.IDB58Encode(ID))
+	return
+}
+
+// verifyHeaderSig checks that a header's signature was made by the key and covers the
+// whole header
+func verifyHeaderSig(spec HashSpec, key []byte, header *Header) (err error) {
+	if !header.FullySigned() {
+		err = ErrWarrantLegacyHeader
+		return
+	}
+	var pubKey ic.PubKey
+	pubKey, err = ic.UnmarshalPublicKey(key)
+	if err != nil {
+		return
+	}
+	var matches bool
+	matches, err = header.VerifySig(spec, pubKey)
+	if err != nil {
+		return
+	}
+	if !matches {
+		err = ErrWarrantBadSignature
+	}
+	return
+}
+
+// InvalidEntryWarrant warrants that an agent signed a header whose entry fails the
+// self-contained validation checks of the DNA, see validateSelfContained
+type InvalidEntryWarrant struct {
+	Key       []byte // the agent's marshaled public key
+	Header    Header
+	EntryType string
+	Entry     GobEntry
+}
+
+func NewInvalidEntryWarrant(key ic.PubKey, resp *ValidateResponse) (wP *InvalidEntryWarrant, err error) {
+	w := InvalidEntryWarrant{Header: resp.Header, EntryType: resp.Type, Entry: resp.Entry}
+	w.Key, err = ic.MarshalPublicKey(key)
+	if err != nil {
+		return
+	}
+	wP = &w
+	return
+}
+
+func (w *InvalidEntryWarrant) Type() int {
+	return InvalidEntryType
+}
+
+func (w *InvalidEntryWarrant) Parties() (parties []Hash, err error) {
+	var party Hash
+	party, err = keyParty(w.Key)
+	if err == nil {
+		parties = append(parties, party)
+	}
+	return
+}
+
+// Verify checks that the agent signed the header, that the header is for the entry, and
+// that the entry fails the self-contained validation checks
+func (w *InvalidEntryWarrant) Verify(h *Holochain) (err error) {
+	err = verifyHeaderSig(h.hashSpec, w.Key, &w.Header)
+	if err != nil {
+		return
+	}
+	var hash Hash
+	hash, err = w.Entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if !hash.Equal(w.Header.EntryLink) || w.Header.Type != w.EntryType {
+		err = errors.New("warranted header is not for the warranted entry")
+		return
+	}
+	err = h.validateSelfContained(w.EntryType, &w.Entry)
+	if err == nil {
+		err = ErrWarrantEntryValid
+	} else if IsValidationFailedErr(err) {
+		err = nil
+	}
+	return
+}
+
+func (w *InvalidEntryWarrant) Property(key string) (value interface{}, err error) {
+	switch key {
+	case "header":
+		value = w.Header
+	case "entryType":
+		value = w.EntryType
+	case "entry":
+		value = w.Entry
+	default:
+		err = WarrantPropertyNotFoundErr
+	}
+	return
+}
+
+func (w *InvalidEntryWarrant) Encode() (data []byte, err error) {
+	data, err = ByteEncoder(w)
+	return
+}
+
+func (w *InvalidEntryWarrant) Decode(data []byte) (err error) {
+	err = ByteDecoder(data, w)
+	return
+}
+
+// ChainForkWarrant warrants that an agent signed two different headers that follow the
+// same header, i.e. that it forked its source chain
+type ChainForkWarrant struct {
+	Key     []byte // the agent's marshaled public key
+	Header1 Header
+	Header2 Header
+}
+
+func NewChainForkWarrant(key ic.PubKey, header1, header2 *Header) (wP *ChainForkWarrant, err error) {
+	w := ChainForkWarrant{Header1: *header1, Header2: *header2}
+	w.Key, err = ic.MarshalPublicKey(key)
+	if err != nil {
+		return
+	}
+	wP = &w
+	return
+}
+
+func (w *ChainForkWarrant) Type() int {
+	return ChainForkType
+}
+
+func (w *ChainForkWarrant) Parties() (parties []Hash, err error) {
+	var party Hash
+	party, err = keyParty(w.Key)
+	if err == nil {
+		parties = append(parties, party)
+	}
+	return
+}
+
+// Verify checks that the agent signed both headers, and that they are different headers
+// with the same previous header
+func (w *ChainForkWarrant) Verify(h *Holochain) (err error) {
+	for _, header := range []*Header{&w.Header1, &w.Header2} {
+		err = verifyHeaderSig(h.hashSpec, w.Key, header)
+		if err != nil {
+			return
+		}
+	}
+	if !w.Header1.HeaderLink.Equal(w.Header2.HeaderLink) {
+		err = ErrWarrantNoFork
+		return
+	}
+	var hash1, hash2 Hash
+	hash1, _, err = w.Header1.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	hash2, _, err = w.Header2.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if hash1.Equal(hash2) {
+		err = ErrWarrantNoFork
+	}
+	return
+}
+
+func (w *ChainForkWarrant) Property(key string) (value interface{}, err error) {
+	switch key {
+	case "headerLink":
+		value = w.Header1.HeaderLink
+	case "headers":
+		value = []Header{w.Header1, w.Header2}
+	default:
+		err = WarrantPropertyNotFoundErr
+	}
+	return
+}
+
+func (w *ChainForkWarrant) Encode() (data []byte, err error) {
+	data, err = ByteEncoder(w)
+	return
+}
+
+func (w *ChainForkWarrant) Decode(data []byte) (err error) {
+	err = ByteDecoder(data, w)
+	return
+}
+
+// warrantBlock sends a list add request with a warrant to block the parties it warrants
+// against, blocking them on this node too when the request is handled locally
+func (h *Holochain) warrantBlock(w Warrant) (err error) {
+	var parties []Hash
+	parties, err = w.Parties()
+	if err != nil {
+		return
+	}
+	var peers []string
+	for _, p := range parties {
+		peers = append(peers, p.String())
+	}
+	var data []byte
+	data, err = w.Encode()
+	if err != nil {
+		return
+	}
+	err = h.dht.Change(SpanContext{}, parties[0], LISTADD_REQUEST,
+		ListAddReq{
+			ListType:    BlockedList,
+			Peers:       peers,
+			WarrantType: w.Type(),
+			Warrant:     data,
+		})
+	if err != nil {
+		err = fmt.Errorf("unable to send warrant against %v: %v", peers, err)
+	}
+	return
+}
+
+// validateSelfContained runs the validation checks on an entry that depend only on the
+// entry and the DNA: the system checks, the entry type's schema and its MaxSize rule.
+// Every node gets the same answer from these, whereas checks that need a validation
+// package, the DHT or the zome's code depend on what the node checking was given or has
+// seen, so a failure of those proves nothing to anyone else and can't be warranted.
+func (h *Holochain) validateSelfContained(entryType string, entry Entry) (err error) {
+	var def *EntryDef
+	_, def, err = h.GetEntryDef(entryType)
+	if err != nil {
+		return
+	}
+	err = sysValidateEntry(h, def, entry, nil)
+	if err == nil && def.Rules != nil {
+		err = def.Rules.checkEntry(def, entry)
+	}
+	return
+}
+
+// warrantInvalidEntry warrants against the source of an entry that failed validation, if
+// the source signed the entry's header and the entry fails the self-contained checks
+func (h *Holochain) warrantInvalidEntry(source peer.ID, resp *ValidateResponse) {
+	if h.node.IsBlocked(source) {
+		return
+	}
+	if !IsValidationFailedErr(h.validateSelfContained(resp.Type, &resp.Entry)) {
+		return
+	}
+	key := h.node.host.Peerstore().PubKey(source)
+	if key == nil {
+		h.dht.dlog.Logf("no key for %v to warrant its invalid entry", source)
+		return
+	}
+	w, err := NewInvalidEntryWarrant(key, resp)
+	if err == nil {
+		err = verifyHeaderSig(h.hashSpec, w.Key, &w.Header)
+	}
+	if err == nil {
+		err = h.warrantBlock(w)
+	}
+	if err != nil {
+		h.dht.dlog.Logf("unable to warrant invalid entry from %v: %v", source, err)
+	}
+}
+
+// warrantChainFork warrants against an agent that signed two headers following the same
+// header
+func (h *Holochain) warrantChainFork(agent peer.ID, header1 *Header, header2 *Header) {
+	if h.node.IsBlocked(agent) {
+		return
+	}
+	key, err := h.dht.agentKey(agent)
+	if err != nil {
+		h.dht.dlog.Logf("no key for %v to warrant its chain fork: %v", agent, err)
+		return
+	}
+	w, err := NewChainForkWarrant(key, header1, header2)
+	if err == nil {
+		err = w.Verify(h)
+	}
+	if err == nil {
+		err = h.warrantBlock(w)
+	}
+	if err != nil {
+		h.dht.dlog.Logf("unable to warrant chain fork by %v: %v", agent, err)
+	}
+}
@@ -2,10 +2,12 @@ package holochain
 
 import (
 	"fmt"
+	. "github.com/HC-Interns/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/smartystreets/goconvey/convey"
 
 	"testing"
+	"time"
 )
 
 func TestSelfRevocationWarrant(t *testing.T) {
@@ -88,3 +90,158 @@ func TestSelfRevocationWarrant(t *testing.T) {
 
 	})
 }
+
+func TestInvalidEntryWarrant(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	pid, privKey := makePeer("peer1")
+	setEntryRules(h, "evenNumbers", &EntryRules{MaxSize: 3})
+
+	entry := GobEntry{C: "1234"}
+	_, header, err := newHeader(h.hashSpec, time.Now(), "evenNumbers", &entry, privKey, NullHash(), NullHash(), NullHash())
+	if err != nil {
+		panic(err)
+	}
+	resp := ValidateResponse{Type: "evenNumbers", Header: *header, Entry: entry}
+	w, err := NewInvalidEntryWarrant(privKey.GetPublic(), &resp)
+
+	Convey("it should be against the agent that signed the header", t, func() {
+		So(err, ShouldBeNil)
+		So(w.Type(), ShouldEqual, InvalidEntryType)
+		parties, err := w.Parties()
+		So(err, ShouldBeNil)
+		So(parties[0].String(), ShouldEqual, peer.IDB58Encode(pid))
+		v, err := w.Property("entryType")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "evenNumbers")
+	})
+
+	Convey("it should verify if the entry fails validation", t, func() {
+		So(w.Verify(h), ShouldBeNil)
+	})
+
+	Convey("it should not verify if the entry is valid", t, func() {
+		valid := GobEntry{C: "2"}
+		_, header, _ := newHeader(h.hashSpec, time.Now(), "evenNumbers", &valid, privKey, NullHash(), NullHash(), NullHash())
+		w, _ := NewInvalidEntryWarrant(privKey.GetPublic(), &ValidateResponse{Type: "evenNumbers", Header: *header, Entry: valid})
+		So(w.Verify(h), ShouldEqual, ErrWarrantEntryValid)
+	})
+
+	Convey("it should not verify if the entry only fails checks that aren't self-contained", t, func() {
+		odd := GobEntry{C: "1"}
+		_, header, _ := newHeader(h.hashSpec, time.Now(), "evenNumbers", &odd, privKey, NullHash(), NullHash(), NullHash())
+		w, _ := NewInvalidEntryWarrant(privKey.GetPublic(), &ValidateResponse{Type: "evenNumbers", Header: *header, Entry: odd})
+		So(w.Verify(h), ShouldEqual, ErrWarrantEntryValid)
+	})
+
+	Convey("it should not verify a legacy header", t, func() {
+		legacy := *header
+		legacy.Version = LegacyHeaderVersion
+		sig, _ := privKey.Sign([]byte(legacy.EntryLink))
+		legacy.Sig = Signature{S: sig}
+		w, _ := NewInvalidEntryWarrant(privKey.GetPublic(), &ValidateResponse{Type: "evenNumbers", Header: legacy, Entry: entry})
+		So(w.Verify(h), ShouldEqual, ErrWarrantLegacyHeader)
+	})
+
+	Convey("it should not verify if the agent didn't sign the header", t, func() {
+		_, otherKey := makePeer("peer2")
+		w, _ := NewInvalidEntryWarrant(otherKey.GetPublic(), &resp)
+		So(w.Verify(h), ShouldEqual, ErrWarrantBadSignature)
+	})
+
+	Convey("it should not verify if the header isn't for the entry", t, func() {
+		w, _ := NewInvalidEntryWarrant(privKey.GetPublic(), &ValidateResponse{Type: "evenNumbers", Header: *header, Entry: GobEntry{C: "3"}})
+		So(w.Verify(h).Error(), ShouldEqual, "warranted header is not for the warranted entry")
+	})
+
+	Convey("it should encode and decode", t, func() {
+		data, err := w.Encode()
+		So(err, ShouldBeNil)
+		w2, err := DecodeWarrant(InvalidEntryType, data)
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%v", w2), ShouldEqual, fmt.Sprintf("%v", w))
+	})
+
+	Convey("LISTADD_REQUEST with the warrant should block the agent", t, func() {
+		other, _ := makePeer("peer2")
+		data, _ := w.Encode()
+		m := h.node.NewMessage(LISTADD_REQUEST,
+			ListAddReq{
+				ListType:    BlockedList,
+				Peers:       []string{peer.IDB58Encode(other)},
+				WarrantType: InvalidEntryType,
+				Warrant:     data,
+			})
+		_, err := ActionReceiver(h, m)
+		So(err.Error(), ShouldEqual, fmt.Sprintf("List add request rejected on warrant failure: %v is not a party to the warrant", other))
+
+		err = h.warrantBlock(w)
+		So(err, ShouldBeNil)
+		processChangeRequestsInTesting(h)
+		So(h.node.IsBlocked(pid), ShouldBeTrue)
+		peerList, err := h.dht.getList(BlockedList)
+		So(err, ShouldBeNil)
+		So(len(peerList.Records), ShouldEqual, 1)
+		So(peerList.Records[0].ID, ShouldEqual, pid)
+	})
+}
+
+func TestChainForkWarrant(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	pid, privKey := makePeer("peer1")
+
+	prev := h.chain.Top()
+	prevHash, _, _ := prev.Sum(h.hashSpec)
+	now := time.Now()
+	_, header1, _ := newHeader(h.hashSpec, now, "evenNumbers", &GobEntry{C: "2"}, privKey, prevHash, NullHash(), NullHash())
+	_, header2, _ := newHeader(h.hashSpec, now, "evenNumbers", &GobEntry{C: "4"}, privKey, prevHash, NullHash(), NullHash())
+	w, err := NewChainForkWarrant(privKey.GetPublic(), header1, header2)
+
+	Convey("it should be against the agent that signed the headers", t, func() {
+		So(err, ShouldBeNil)
+		So(w.Type(), ShouldEqual, ChainForkType)
+		parties, err := w.Parties()
+		So(err, ShouldBeNil)
+		So(parties[0].String(), ShouldEqual, peer.IDB58Encode(pid))
+		v, err := w.Property("headerLink")
+		So(err, ShouldBeNil)
+		So(v.(Hash).String(), ShouldEqual, prevHash.String())
+	})
+
+	Convey("it should verify two signed headers following the same header", t, func() {
+		So(w.Verify(h), ShouldBeNil)
+	})
+
+	Convey("it should not verify the same header twice", t, func() {
+		w, _ := NewChainForkWarrant(privKey.GetPublic(), header1, header1)
+		So(w.Verify(h), ShouldEqual, ErrWarrantNoFork)
+	})
+
+	Convey("it should not verify headers following different headers", t, func() {
+		_, header3, _ := newHeader(h.hashSpec, now, "evenNumbers", &GobEntry{C: "6"}, privKey, NullHash(), NullHash(), NullHash())
+		w, _ := NewChainForkWarrant(privKey.GetPublic(), header1, header3)
+		So(w.Verify(h), ShouldEqual, ErrWarrantNoFork)
+	})
+
+	Convey("it should not verify headers the agent didn't sign", t, func() {
+		_, otherKey := makePeer("peer2")
+		w, _ := NewChainForkWarrant(otherKey.GetPublic(), header1, header2)
+		So(w.Verify(h), ShouldEqual, ErrWarrantBadSignature)
+	})
+
+	Convey("it should not verify a header built around an entry the agent signed elsewhere", t, func() {
+		_, forged, _ := newHeader(h.hashSpec, now, "evenNumbers", &GobEntry{C: "6"}, privKey, NullHash(), NullHash(), NullHash())
+		forged.HeaderLink = prevHash
+		w, _ := NewChainForkWarrant(privKey.GetPublic(), forged, header2)
+		So(w.Verify(h), ShouldEqual, ErrWarrantBadSignature)
+	})
+
+	Convey("it should encode and decode", t, func() {
+		data, err := w.Encode()
+		So(err, ShouldBeNil)
+		w2, err := DecodeWarrant(ChainForkType, data)
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%v", w2), ShouldEqual, fmt.Sprintf("%v", w))
+	})
+}
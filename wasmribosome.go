@@ -0,0 +1,1332 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// WASMRibosome implements a WebAssembly use of the Ribosome interface
+//
+// Zomes are WebAssembly modules, e.g. compiled from Rust or AssemblyScript, that get run by
+// a pure Go WebAssembly runtime. Everything passed between the ribosome and a zome is a
+// string in the zome's memory, so the host ABI is:
+//
+//   - the zome exports its memory and an hc_alloc(size i32) i32 function returning the
+//     address of size bytes the ribosome can write a string into
+//   - strings get passed as an address and length pair of i32s, and returned as an i64
+//     holding the address in its high 32 bits and the length in its low 32 bits
+//   - the API functions (commit, get, getLinks, query, send and the rest) are imported from
+//     the "hc" module.  They take a JSON array of the same arguments as their javascript
+//     versions and return their result as JSON, or a {"name":"HolochainError","message":...}
+//     object on error.  The app function returns the values of the javascript App object.
+//   - exposed zome functions take their parameters as a string and return their result as
+//     a string, which is JSON for json calling functions.  A json calling function can
+//     return an error the same way API functions do, and any function can trap.
+//   - the genesis, bridgeGenesis, receive, bundleCanceled, validate and validate package
+//     callbacks, and send callbacks, take a JSON array of the same arguments as their
+//     javascript versions and return their result as JSON
+//
+// As WebAssembly is binary, a WASM zome's Code holds its module base64 encoded so the
+// DNA can still be encoded as json, toml or yaml.
+
+package holochain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	WASMRibosomeType = "wasm"
+
+	WASMHostModule = "hc"       // module the API functions are imported from
+	WASMAllocFn    = "hc_alloc" // function zomes export to allocate memory for the ribosome
+
+	WASMMaxMemoryPages = 1024 // 64k pages of memory a zome may grow to
+)
+
+// WASMAPIFunctions are the functions zomes can import from the host module
+var WASMAPIFunctions = []string{
+	"app", "property", "debug", "makeHash", "getBridges", "sign", "verifySignature", "send",
+	"call", "bridge", "commit", "migrate", "queryDHT", "query", "get", "update", "updateAgent",
+	"remove", "getLinks", "bundleStart", "bundleClose",
+}
+
+// WASMRibosome holds data needed for the WebAssembly module instance of a zome
+type WASMRibosome struct {
+	tracing
+	h          *Holochain
+	zome       *Zome
+	runtime    wazero.Runtime
+	compiled   wazero.CompiledModule
+	mod        api.Module
+	funcs      map[string]wasmFnData
+	lastResult string
+	limiter    *executionLimiter
+}
+
+type wasmFnData struct {
+	apiFn APIFunction
+	f     func(args []Arg, apiFn APIFunction, argc int) (result interface{}, err error)
+}
+
+// wasmError is how errors get passed to and from zomes
+type wasmError struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// wasmHeader is the header passed to the validation callbacks
+type wasmHeader struct {
+	EntryLink string
+	Type      string
+	Time      string
+}
+
+// wasmRibosomeKey is the context key under which API functions find the calling ribosome
+type wasmRibosomeKey struct{}
+
+// the runtime is shared by all WASM ribosomes, which find themselves in the context
+// passed to the API functions, so zomes are only compiled once.  Compiled zomes are kept
+// until the last holochain running them is closed.
+var wasmRuntime struct {
+	lk       sync.Mutex
+	r        wazero.Runtime
+	compiled map[[sha256.Size]byte]*wasmCompiled
+}
+
+// wasmCompiled is a compiled zome and the holochains running it
+type wasmCompiled struct {
+	m     wazero.CompiledModule
+	users map[*Holochain]bool
+}
+
+// EncodeWASMCode encodes a WebAssembly module to be held in a zome's Code
+func EncodeWASMCode(code []byte) string {
+	return base64.StdEncoding.EncodeToString(code)
+}
+
+// DecodeWASMCode decodes a WebAssembly module held in a zome's Code
+func DecodeWASMCode(code string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(code)
+}
+
+// initWASMRuntime sets up the shared runtime, must be called with wasmRuntime locked
+func initWASMRuntime() (err error) {
+	if wasmRuntime.r != nil {
+		return
+	}
+	ctx := context.Background()
+	// closing modules when their context is done is what stops calls that time out
+	config := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(WASMMaxMemoryPages)
+	r := wazero.NewRuntimeWithConfig(ctx, config)
+	defer func() {
+		if err != nil {
+			r.Close(ctx)
+		}
+	}()
+
+	// for zomes compiled to wasm32-wasi, e.g. from Rust
+	_, err = wasi_snapshot_preview1.Instantiate(ctx, r)
+	if err != nil {
+		return
+	}
+
+	hc := r.NewHostModuleBuilder(WASMHostModule)
+	for _, name := range WASMAPIFunctions {
+		name := name
+		hc.NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) uint64 {
+			wr, _ := ctx.Value(wasmRibosomeKey{}).(*WASMRibosome)
+			if wr == nil {
+				panic(fmt.Errorf("%s called outside of a ribosome", name))
+			}
+			return wr.callAPI(ctx, m, name, ptr, size)
+		}).Export(name)
+	}
+	_, err = hc.Instantiate(ctx)
+	if err != nil {
+		return
+	}
+
+	// AssemblyScript zomes import abort to report failed assertions
+	_, err = r.NewHostModuleBuilder("env").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, msg, file, line, col uint32) {
+		panic(fmt.Errorf("abort called at line %d column %d", line, col))
+	}).Export("abort").
+		Instantiate(ctx)
+	if err != nil {
+		return
+	}
+
+	wasmRuntime.r = r
+	wasmRuntime.compiled = make(map[[sha256.Size]byte]*wasmCompiled)
+	return
+}
+
+// CloseWASMRuntime closes the runtime shared by WASM ribosomes along with the modules
+// compiled and instantiated in it, to be called once no more zomes will be run
+func CloseWASMRuntime() (err error) {
+	wasmRuntime.lk.Lock()
+	defer wasmRuntime.lk.Unlock()
+	if wasmRuntime.r != nil {
+		err = wasmRuntime.r.Close(context.Background())
+		wasmRuntime.r = nil
+		wasmRuntime.compiled = nil
+	}
+	return
+}
+
+// compileWASM returns the compiled module of some code for a holochain to run, compiling
+// it the first time it's seen
+func compileWASM(h *Holochain, code []byte) (r wazero.Runtime, compiled wazero.CompiledModule, err error) {
+	wasmRuntime.lk.Lock()
+	defer wasmRuntime.lk.Unlock()
+	err = initWASMRuntime()
+	if err != nil {
+		return
+	}
+	r = wasmRuntime.r
+	sum := sha256.Sum256(code)
+	c, ok := wasmRuntime.compiled[sum]
+	if !ok {
+		c = &wasmCompiled{users: make(map[*Holochain]bool)}
+		c.m, err = r.CompileModule(context.Background(), code)
+		if err != nil {
+			return
+		}
+		wasmRuntime.compiled[sum] = c
+	}
+	c.users[h] = true
+	compiled = c.m
+	return
+}
+
+// releaseWASM closes the compiled modules no holochain but the given one is running
+func releaseWASM(h *Holochain) {
+	wasmRuntime.lk.Lock()
+	defer wasmRuntime.lk.Unlock()
+	for sum, c := range wasmRuntime.compiled {
+		if !c.users[h] {
+			continue
+		}
+		delete(c.users, h)
+		if len(c.users) == 0 {
+			c.m.Close(context.Background()) // ignore error
+			delete(wasmRuntime.compiled, sum)
+		}
+	}
+}
+
+// Type returns the string value under which this ribosome is registered
+func (wr *WASMRibosome) Type() string { return WASMRibosomeType }
+
+// context returns the context for calling into the zome, which is done when the call
+// runs out of time
+func (wr *WASMRibosome) context() (ctx context.Context, cancel context.CancelFunc) {
+	ctx = context.WithValue(context.Background(), wasmRibosomeKey{}, wr)
+	if wr.limiter != nil && wr.limiter.limits.Timeout > 0 {
+		return context.WithDeadline(ctx, wr.limiter.deadline)
+	}
+	ctx, cancel = context.WithCancel(ctx)
+	return
+}
+
+// limit applies the execution limits of a kind of call to the calls into the zome until
+// the returned function gets called, which must be deferred so it can set the call's error
+// if it timed out.  Zomes get no step budget as the runtime can't count instructions.
+func (wr *WASMRibosome) limit(kind RibosomeCallKind, err *error) func() {
+	prev := wr.limiter
+	l := newExecutionLimiter(kind, wr.h.executionLimits(kind))
+	wr.limiter = l
+	return func() {
+		wr.limiter = prev
+		if l.err != nil {
+			*err = l.err
+		}
+	}
+}
+
+// wasmRead copies a string out of a zome's memory
+func wasmRead(m api.Module, ptr, size uint32) (b []byte, err error) {
+	if size == 0 {
+		return
+	}
+	view, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		err = fmt.Errorf("reading %d bytes at %d is outside the zome's memory", size, ptr)
+		return
+	}
+	b = make([]byte, size)
+	copy(b, view)
+	return
+}
+
+// wasmWrite writes a string into memory allocated by the zome, returning its address and
+// length packed into a uint64
+func wasmWrite(ctx context.Context, m api.Module, b []byte) (packed uint64, err error) {
+	if len(b) == 0 {
+		return
+	}
+	var results []uint64
+	results, err = m.ExportedFunction(WASMAllocFn).Call(ctx, uint64(len(b)))
+	if err != nil {
+		err = fmt.Errorf("%s failed: %v", WASMAllocFn, err)
+		return
+	}
+	ptr := uint32(results[0])
+	if !m.Memory().Write(ptr, b) {
+		err = fmt.Errorf("writing %d bytes at %d is outside the zome's memory", len(b), ptr)
+		return
+	}
+	packed = uint64(ptr)<<32 | uint64(len(b))
+	return
+}
+
+// call calls a function exported by the zome with a string returning the string it returns
+func (wr *WASMRibosome) call(fnName string, arg []byte) (result []byte, err error) {
+	fn := wr.mod.ExportedFunction(fnName)
+	if fn == nil {
+		err = fmt.Errorf("zome %s doesn't export %s", wr.zome.Name, fnName)
+		return
+	}
+	ctx, cancel := wr.context()
+	defer func() {
+		cancel()
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			wr.limiter.err = wr.limiter.timedOut()
+		}
+	}()
+	var packed uint64
+	packed, err = wasmWrite(ctx, wr.mod, arg)
+	if err != nil {
+		return
+	}
+	var results []uint64
+	results, err = fn.Call(ctx, packed>>32, packed&0xffffffff)
+	if err != nil {
+		return
+	}
+	if len(results) != 1 {
+		err = fmt.Errorf("%s should return an i64", fnName)
+		return
+	}
+	result, err = wasmRead(wr.mod, uint32(results[0]>>32), uint32(results[0]))
+	return
+}
+
+// callJSON calls a callback function with its arguments as a JSON array returning the JSON
+// it returns
+func (wr *WASMRibosome) callJSON(fnName string, args ...interface{}) (result []byte, err error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	var j []byte
+	j, err = json.Marshal(args)
+	if err != nil {
+		return
+	}
+	wr.h.Debugf("WASM %s(%s)", fnName, string(j))
+	result, err = wr.call(fnName, j)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+	}
+	return
+}
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (wr *WASMRibosome) ChainGenesis() (err error) {
+	defer wr.limit(GenesisCallKind, &err)()
+	err = wr.boolFn("genesis")
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (wr *WASMRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	defer wr.limit(GenesisCallKind, &err)()
+	err = wr.boolFn("bridgeGenesis", side, dnaHash.String(), data)
+	return
+}
+
+func (wr *WASMRibosome) boolFn(fnName string, args ...interface{}) (err error) {
+	var r []byte
+	r, err = wr.callJSON(fnName, args...)
+	if err != nil {
+		return
+	}
+	var b bool
+	if json.Unmarshal(r, &b) != nil {
+		err = fmt.Errorf("%s should return boolean, got: %s", fnName, string(r))
+		return
+	}
+	if !b {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (wr *WASMRibosome) Receive(from string, msg string) (response string, err error) {
+	defer wr.limit(ZomeCallKind, &err)()
+	var r []byte
+	r, err = wr.callJSON("receive", from, json.RawMessage(msg))
+	if err == nil {
+		response = string(r)
+	}
+	return
+}
+
+// BundleCanceled calls the app bundleCanceled function
+func (wr *WASMRibosome) BundleCanceled(reason string) (response string, err error) {
+	defer wr.limit(ZomeCallKind, &err)()
+	bundle := wr.h.chain.BundleStarted()
+	if bundle == nil {
+		err = ErrBundleNotStarted
+		return
+	}
+	var r []byte
+	r, err = wr.callJSON("bundleCanceled", reason, json.RawMessage(bundle.userParam))
+	if err != nil {
+		return
+	}
+	if json.Unmarshal(r, &response) != nil {
+		response = string(r)
+	}
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (wr *WASMRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	defer wr.limit(ValidateCallKind, &err)()
+	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
+	var r []byte
+	r, err = wr.callJSON(fnName, def.Name)
+	if err != nil {
+		return
+	}
+	var m map[string]interface{}
+	if json.Unmarshal(r, &m) != nil {
+		err = fmt.Errorf("%s should return null or object, got: %s", fnName, string(r))
+		return
+	}
+	if m == nil {
+		return
+	}
+	// MakePackage expects the types javascript objects export to
+	if c, ok := m[PkgReqChain]; ok {
+		flags, ok := numInterfaceToInt(c)
+		if !ok {
+			err = fmt.Errorf("%s should return an int %s, got: %v", fnName, PkgReqChain, c)
+			return
+		}
+		m[PkgReqChain] = int64(flags)
+	}
+	if t, ok := m[PkgReqEntryTypes]; ok {
+		var types []string
+		if list, ok := t.([]interface{}); ok {
+			for _, et := range list {
+				if s, ok := et.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		m[PkgReqEntryTypes] = types
+	}
+	req = m
+	return
+}
+
+// wasmEntryValue returns the value of an entry to pass to a zome, JSON for JSON entries
+// and a string for everything else
+func wasmEntryValue(def *EntryDef, content string) interface{} {
+	switch def.DataFormat {
+	case DataFormatLinks:
+		fallthrough
+	case DataFormatJSON:
+		return json.RawMessage(content)
+	}
+	return content
+}
+
+func prepareWASMEntryArgs(def *EntryDef, entry Entry, header *Header) (args []interface{}) {
+	hdr := wasmHeader{}
+	if header != nil {
+		hdr.EntryLink = header.EntryLink.String()
+		hdr.Type = header.Type
+		hdr.Time = header.Time.UTC().Format(time.RFC3339)
+	}
+	args = []interface{}{wasmEntryValue(def, entry.Content().(string)), hdr}
+	return
+}
+
+func prepareWASMValidateArgs(action Action, def *EntryDef) (args []interface{}, err error) {
+	switch t := action.(type) {
+	case *ActionPut:
+		args = prepareWASMEntryArgs(def, t.entry, t.header)
+	case *ActionCommit:
+		args = prepareWASMEntryArgs(def, t.entry, t.header)
+	case *ActionMod:
+		args = append(prepareWASMEntryArgs(def, t.entry, t.header), t.replaces.String())
+	case *ActionDel:
+		args = []interface{}{t.entry.Hash.String()}
+	case *ActionLink:
+		args = []interface{}{t.validationBase.String(), t.links}
+	default:
+		err = fmt.Errorf("can't prepare args for %T: ", t)
+	}
+	return
+}
+
+// ValidateAction builds the correct validation function based on the action an calls it
+func (wr *WASMRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	defer wr.limit(ValidateCallKind, &err)()
+	var args []interface{}
+	args, err = prepareWASMValidateArgs(action, def)
+	if err != nil {
+		return
+	}
+	p := make(map[string]interface{})
+	if pkg != nil {
+		if pkg.Chain != nil {
+			p["Chain"] = pkg.Chain
+		}
+		if pkg.Status != StatusDefault {
+			p["Status"] = pkg.Status
+		}
+	}
+	if sources == nil {
+		sources = []string{}
+	}
+	args = append([]interface{}{def.Name}, args...)
+	args = append(args, p, sources)
+	err = wr.runValidate("validate"+strings.Title(action.Name()), args)
+	return
+}
+
+func (wr *WASMRibosome) runValidate(fnName string, args []interface{}) (err error) {
+	var r []byte
+	r, err = wr.callJSON(fnName, args...)
+	if err != nil {
+		return
+	}
+	var v interface{}
+	json.Unmarshal(r, &v)
+	switch t := v.(type) {
+	case bool:
+		if !t {
+			err = ValidationFailed()
+		}
+	case string:
+		if t != "" {
+			err = ValidationFailed(t)
+		}
+	default:
+		err = fmt.Errorf("%s should return boolean or string, got: %s", fnName, string(r))
+	}
+	return
+}
+
+// Call calls a function exposed by the zome
+func (wr *WASMRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	defer wr.limit(ZomeCallKind, &err)()
+	switch fn.CallingType {
+	case STRING_CALLING:
+	case JSON_CALLING:
+	default:
+		err = errors.New("params type not implemented")
+		return
+	}
+	wr.h.Debugf("WASM Call: %s(%s)", fn.Name, params)
+	var r []byte
+	r, err = wr.call(fn.Name, []byte(params.(string)))
+	if err != nil {
+		return
+	}
+	if fn.CallingType == JSON_CALLING {
+		var e wasmError
+		if json.Unmarshal(r, &e) == nil && e.Name == HolochainErrorPrefix {
+			err = errors.New(e.Message)
+			return
+		}
+	}
+	wr.lastResult = string(r)
+	result = wr.lastResult
+	return
+}
+
+// Run calls the function exported by the zome with the given name without any parameters
+func (wr *WASMRibosome) Run(fnName string) (result interface{}, err error) {
+	var r []byte
+	r, err = wr.call(fnName, nil)
+	if err != nil {
+		err = fmt.Errorf("Error executing WebAssembly: %v", err)
+		return
+	}
+	wr.lastResult = string(r)
+	result = wr.lastResult
+	return
+}
+
+// RunWithTimers is the same as Run as zomes can't set timers
+func (wr *WASMRibosome) RunWithTimers(fnName string) (result interface{}, err error) {
+	result, err = wr.Run(fnName)
+	return
+}
+
+// RunAsyncSendResponse calls the callback of an asynchronous send with the response
+func (wr *WASMRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	defer wr.limit(ZomeCallKind, &err)()
+	var r []byte
+	r, err = wr.callJSON(callback, json.RawMessage(response.Body), callbackID)
+	if err == nil {
+		result = string(r)
+	}
+	return
+}
+
+// callAPI runs an API function for the zome reading its arguments from, and writing its
+// result to, the zome's memory
+func (wr *WASMRibosome) callAPI(ctx context.Context, m api.Module, name string, ptr, size uint32) uint64 {
+	var result interface{}
+	b, err := wasmRead(m, ptr, size)
+	if err == nil {
+		result, err = wr.runAPI(name, b)
+	}
+	var j []byte
+	if err == nil {
+		j, err = json.Marshal(result)
+	}
+	if err != nil {
+		j, _ = json.Marshal(wasmError{Name: HolochainErrorPrefix, Message: err.Error()})
+	}
+	packed, err := wasmWrite(ctx, m, j)
+	if err != nil {
+		// trap as there's no way to return the result
+		panic(err)
+	}
+	return packed
+}
+
+func (wr *WASMRibosome) runAPI(name string, b []byte) (result interface{}, err error) {
+	if name == "app" {
+		result = wr.app()
+		return
+	}
+	data, ok := wr.funcs[name]
+	if !ok {
+		err = fmt.Errorf("unknown API function: %s", name)
+		return
+	}
+	var wArgs []interface{}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &wArgs)
+		if err != nil {
+			err = fmt.Errorf("arguments to %s should be a JSON array: %v", name, err)
+			return
+		}
+	}
+	args := data.apiFn.Args()
+	err = wasmProcessArgs(wr, args, wArgs)
+	if err == nil {
+		if t, ok := data.apiFn.(traced); ok {
+			t.setTrace(wr.trace)
+		}
+		result, err = data.f(args, data.apiFn, len(wArgs))
+	}
+	return
+}
+
+// app returns the values of the javascript App object
+func (wr *WASMRibosome) app() interface{} {
+	h := wr.h
+	if h == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"Name": h.Name(),
+		"DNA":  map[string]string{"Hash": h.dnaHash.String()},
+		"Agent": map[string]string{
+			"Hash":    h.agentHash.String(),
+			"TopHash": h.agentTopHash.String(),
+			"String":  string(h.Agent().Identity()),
+		},
+		"Key": map[string]string{"Hash": h.nodeIDStr},
+	}
+}
+
+// wasmProcessArgs processes wArgs according to the args spec filling args[].value with the converted value
+func wasmProcessArgs(wr *WASMRibosome, args []Arg, wArgs []interface{}) (err error) {
+	err = checkArgCount(args, len(wArgs))
+	if err != nil {
+		return err
+	}
+
+	for i, arg := range wArgs {
+		if arg == nil && args[i].Optional {
+			continue
+		}
+		switch args[i].Type {
+		case StringArg:
+			str, ok := arg.(string)
+			if !ok {
+				return argErr("string", i+1, args[i])
+			}
+			args[i].value = str
+		case HashArg:
+			str, ok := arg.(string)
+			if !ok {
+				return argErr("string", i+1, args[i])
+			}
+			var hash Hash
+			hash, err = NewHash(str)
+			if err != nil {
+				return
+			}
+			args[i].value = hash
+		case IntArg:
+			integer, ok := numInterfaceToInt(arg)
+			if !ok {
+				return argErr("int", i+1, args[i])
+			}
+			args[i].value = int64(integer)
+		case BoolArg:
+			boolean, ok := arg.(bool)
+			if !ok {
+				return argErr("boolean", i+1, args[i])
+			}
+			args[i].value = boolean
+		case ArgsArg:
+			switch arg.(type) {
+			case string:
+				args[i].value = arg
+			case map[string]interface{}, []interface{}:
+				var j []byte
+				j, err = json.Marshal(arg)
+				if err != nil {
+					return
+				}
+				args[i].value = string(j)
+			default:
+				return argErr("string or object", i+1, args[i])
+			}
+		case EntryArg:
+			// this a special case in that all EntryArgs must be preceeded by
+			// string arg that specifies the entry type
+			entryType, _ := args[i-1].value.(string)
+			var def *EntryDef
+			_, def, err = wr.h.GetEntryDef(entryType)
+			if err != nil {
+				return
+			}
+			switch def.DataFormat {
+			case DataFormatRawJS:
+				fallthrough
+			case DataFormatRawZygo:
+				fallthrough
+			case DataFormatString:
+				str, ok := arg.(string)
+				if !ok {
+					return argErr("string", i+1, args[i])
+				}
+				args[i].value = str
+			case DataFormatLinks:
+				if _, ok := arg.(map[string]interface{}); !ok {
+					return argErr("object", i+1, args[i])
+				}
+				fallthrough
+			case DataFormatJSON:
+				var j []byte
+				j, err = json.Marshal(arg)
+				if err != nil {
+					return
+				}
+				args[i].value = string(j)
+			default:
+				return errors.New("data format not implemented: " + def.DataFormat)
+			}
+		case MapArg:
+			m, ok := arg.(map[string]interface{})
+			if !ok {
+				return argErr("object", i+1, args[i])
+			}
+			args[i].value = m
+		case ToStrArg:
+			if str, ok := arg.(string); ok {
+				args[i].value = str
+			} else {
+				var j []byte
+				j, err = json.Marshal(arg)
+				if err != nil {
+					return
+				}
+				args[i].value = string(j)
+			}
+		}
+	}
+	return
+}
+
+// wasmOptions decodes an options argument into the options of an API function
+func wasmOptions(arg Arg, options interface{}) (err error) {
+	if arg.value == nil {
+		return
+	}
+	var j []byte
+	j, err = json.Marshal(arg.value)
+	if err == nil {
+		err = json.Unmarshal(j, options)
+	}
+	return
+}
+
+// wasmHashResult converts the hash returned by an API function to a string
+func wasmHashResult(r interface{}) string {
+	var hash Hash
+	if r != nil {
+		hash = r.(Hash)
+	}
+	return hash.String()
+}
+
+// NewWASMRibosome factory function to build a WebAssembly execution environment for a zome
+func NewWASMRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	var code []byte
+	code, err = DecodeWASMCode(zome.Code)
+	if err != nil {
+		err = fmt.Errorf("Error decoding WebAssembly for zome %s: %v", zome.Name, err)
+		return
+	}
+	r, compiled, err := compileWASM(h, code)
+	if err != nil {
+		err = fmt.Errorf("Error compiling WebAssembly for zome %s: %v", zome.Name, err)
+		return
+	}
+
+	wr := WASMRibosome{
+		h:        h,
+		zome:     zome,
+		runtime:  r,
+		compiled: compiled,
+	}
+
+	wr.funcs = map[string]wasmFnData{
+		"property": {
+			apiFn: &APIFnProperty{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnProperty)
+				f.prop = args[0].value.(string)
+				result, err = f.Call(h)
+				if err != nil {
+					// unknown properties are null
+					return nil, nil
+				}
+				return
+			},
+		},
+		"debug": {
+			apiFn: &APIFnDebug{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnDebug)
+				f.msg = args[0].value.(string)
+				f.Call(h)
+				return
+			},
+		},
+		"makeHash": {
+			apiFn: &APIFnMakeHash{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnMakeHash)
+				f.entryType = args[0].value.(string)
+				f.entry = &GobEntry{C: args[1].value.(string)}
+				var r interface{}
+				r, err = f.Call(h)
+				if err == nil {
+					result = wasmHashResult(r)
+				}
+				return
+			},
+		},
+		"getBridges": {
+			apiFn: &APIFnGetBridges{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnGetBridges)
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				bridges := make([]map[string]interface{}, 0)
+				for _, b := range r.([]Bridge) {
+					if b.Side == BridgeCallee {
+						bridges = append(bridges, map[string]interface{}{"Side": b.Side, "Token": b.Token})
+					} else {
+						bridges = append(bridges, map[string]interface{}{"Side": b.Side, "CalleeApp": b.CalleeApp.String(), "CalleeName": b.CalleeName})
+					}
+				}
+				result = bridges
+				return
+			},
+		},
+		"sign": {
+			apiFn: &APIFnSign{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnSign)
+				f.data = []byte(args[0].value.(string))
+				result, err = f.Call(h)
+				return
+			},
+		},
+		"verifySignature": {
+			apiFn: &APIFnVerifySignature{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnVerifySignature)
+				f.b58signature = args[0].value.(string)
+				f.data = args[1].value.(string)
+				f.b58pubKey = args[2].value.(string)
+				result, err = f.Call(h)
+				return
+			},
+		},
+		"send": {
+			apiFn: &APIFnSend{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnSend)
+				a := &f.action
+				a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
+				if err != nil {
+					return
+				}
+				var j []byte
+				j, err = json.Marshal(args[1].value)
+				if err != nil {
+					return
+				}
+				a.msg.ZomeType = zome.Name
+				a.msg.Body = string(j)
+
+				a.options = nil
+				if args[2].value != nil {
+					a.options = &SendOptions{}
+					err = wasmOptions(args[2], a.options)
+					if err != nil {
+						return
+					}
+					if cb := a.options.Callback; cb != nil {
+						if cb.Function == "" {
+							err = errors.New("callback option requires Function")
+							return
+						}
+						if cb.ID == "" {
+							err = errors.New("callback option requires ID")
+							return
+						}
+						cb.zomeType = zome.Name
+					}
+				}
+				result, err = f.Call(h)
+				return
+			},
+		},
+		"call": {
+			apiFn: &APIFnCall{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnCall)
+				f.zome = args[0].value.(string)
+				f.function = args[1].value.(string)
+				f.args = args[2].value.(string)
+				result, err = f.Call(h)
+				return
+			},
+		},
+		"bridge": {
+			apiFn: &APIFnBridge{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnBridge)
+				hash := args[0].value.(Hash)
+				f.app = hash
+				f.token, f.url, err = h.GetBridgeToken(hash)
+				if err != nil {
+					return
+				}
+				f.zome = args[1].value.(string)
+				f.function = args[2].value.(string)
+				f.args = args[3].value.(string)
+				result, err = f.Call(h)
+				return
+			},
+		},
+		"commit": {
+			apiFn: &APIFnCommit{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnCommit)
+				f.action.entryType = args[0].value.(string)
+				f.action.entry = &GobEntry{C: args[1].value.(string)}
+				var options CommitOptions
+				err = wasmOptions(args[2], &options)
+				if err != nil {
+					return
+				}
+				f.action.ttl = options.TTL
+				var r interface{}
+				r, err = f.Call(h)
+				if err == nil {
+					result = wasmHashResult(r)
+				}
+				return
+			},
+		},
+		"migrate": {
+			apiFn: &APIFnMigrate{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnMigrate)
+				f.action.entry.Type = args[0].value.(string)
+				f.action.entry.DNAHash = args[1].value.(Hash)
+				f.action.entry.Key = args[2].value.(Hash)
+				f.action.entry.Data = args[3].value.(string)
+				var r interface{}
+				r, err = f.Call(h)
+				if err == nil {
+					result = wasmHashResult(r)
+				}
+				return
+			},
+		},
+		"queryDHT": {
+			apiFn: &APIFnQueryDHT{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnQueryDHT)
+				f.entryType = args[0].value.(string)
+				options := QueryDHTOptions{
+					Constrain: QueryDHTConstraint{
+						Range: QueryDHTRange{},
+					},
+				}
+				err = wasmOptions(args[1], &options)
+				if err != nil {
+					return
+				}
+				f.options = &options
+				f.zome = zome
+
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				switch v := r.(type) {
+				case []QueryDHTResponse:
+					responses := make([]map[string]interface{}, len(v))
+					for i, resp := range v {
+						responses[i] = map[string]interface{}{"Entry": json.RawMessage(resp.Entry), "Hash": resp.Hash}
+					}
+					result = responses
+				default:
+					result = r
+				}
+				return
+			},
+		},
+		"query": {
+			apiFn: &APIFnQuery{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnQuery)
+				f.options = &QueryOptions{}
+				err = wasmOptions(args[0], f.options)
+				if err != nil {
+					return
+				}
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				defs := make(map[string]*EntryDef)
+				results := make([]interface{}, 0)
+				for _, qresult := range r.([]QueryResult) {
+					qr := make(map[string]interface{})
+					if f.options.Return.Hashes {
+						qr["Hash"] = qresult.Header.EntryLink.String()
+					}
+					if f.options.Return.Headers {
+						var hdr string
+						hdr, err = qresult.Header.ToJSON()
+						if err != nil {
+							return
+						}
+						qr["Header"] = json.RawMessage(hdr)
+					}
+					if f.options.Return.Entries {
+						def, ok := defs[qresult.Header.Type]
+						if !ok {
+							_, def, err = h.GetEntryDef(qresult.Header.Type)
+							if err != nil {
+								return
+							}
+							defs[qresult.Header.Type] = def
+						}
+						qr["Entry"] = wasmEntryValue(def, qresult.Entry.Content().(string))
+					}
+					if len(qr) == 1 {
+						for _, v := range qr {
+							results = append(results, v)
+						}
+					} else {
+						results = append(results, qr)
+					}
+				}
+				result = results
+				return
+			},
+		},
+		"get": {
+			apiFn: &APIFnGet{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnGet)
+				options := GetOptions{StatusMask: StatusDefault}
+				err = wasmOptions(args[1], &options)
+				if err != nil {
+					return
+				}
+				req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
+				f.action = ActionGet{req: req, options: &options}
+				var r interface{}
+				r, err = f.Call(h)
+				if err == ErrHashNotFound {
+					// if the hash wasn't found this isn't actually an error
+					// so return null which is the same as HC.HashNotFound
+					err = nil
+					return
+				}
+				if err != nil {
+					return
+				}
+				getResp := r.(GetResp)
+				mask := options.GetMask
+				if mask == GetMaskDefault {
+					mask = GetMaskEntry
+				}
+				var entry interface{}
+				if mask&GetMaskEntry != 0 {
+					var def *EntryDef
+					_, def, err = h.GetEntryDef(getResp.EntryType)
+					if err != nil {
+						return
+					}
+					entry = wasmEntryValue(def, getResp.Entry.Content().(string))
+				}
+				switch mask {
+				case GetMaskEntry:
+					result = entry
+				case GetMaskEntryType:
+					result = getResp.EntryType
+				case GetMaskSources:
+					result = getResp.Sources
+				default:
+					resp := make(map[string]interface{})
+					if mask&GetMaskEntry != 0 {
+						resp["Entry"] = entry
+					}
+					if mask&GetMaskEntryType != 0 {
+						resp["EntryType"] = getResp.EntryType
+					}
+					if mask&GetMaskSources != 0 {
+						resp["Sources"] = getResp.Sources
+					}
+					result = resp
+				}
+				return
+			},
+		},
+		"update": {
+			apiFn: &APIFnMod{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnMod)
+				entry := GobEntry{C: args[1].value.(string)}
+				f.action = *NewModAction(args[0].value.(string), &entry, args[2].value.(Hash))
+				var r interface{}
+				r, err = f.Call(h)
+				if err == nil {
+					result = wasmHashResult(r)
+				}
+				return
+			},
+		},
+		"updateAgent": {
+			apiFn: &APIFnModAgent{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnModAgent)
+				var options ModAgentOptions
+				err = wasmOptions(args[0], &options)
+				if err != nil {
+					return
+				}
+				f.Identity = AgentIdentity(options.Identity)
+				f.Revocation = options.Revocation
+				var r interface{}
+				r, err = f.Call(h)
+				if err == nil {
+					result = wasmHashResult(r)
+				}
+				return
+			},
+		},
+		"remove": {
+			apiFn: &APIFnDel{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnDel)
+				entry := DelEntry{
+					Hash:    args[0].value.(Hash),
+					Message: args[1].value.(string),
+				}
+				f.action = *NewDelAction(entry)
+				var r interface{}
+				r, err = f.Call(h)
+				if err == nil {
+					result = wasmHashResult(r)
+				}
+				return
+			},
+		},
+		"getLinks": {
+			apiFn: &APIFnGetLinks{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnGetLinks)
+				base := args[0].value.(Hash)
+				tag := args[1].value.(string)
+				options := GetLinksOptions{Load: false, StatusMask: StatusLive}
+				err = wasmOptions(args[2], &options)
+				if err != nil {
+					return
+				}
+				// paged requests get back an object holding the links and the next cursor
+				var paged bool
+				if opts, ok := args[2].value.(map[string]interface{}); ok {
+					for _, o := range []string{"Order", "Limit", "Cursor"} {
+						if _, ok := opts[o]; ok {
+							paged = true
+						}
+					}
+				}
+				f.action = *NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask, Order: options.Order, Limit: options.Limit, Cursor: options.Cursor}, &options)
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				lqr := r.(*LinkQueryResp)
+				links := make([]map[string]interface{}, 0, len(lqr.Links))
+				for _, th := range lqr.Links {
+					l := map[string]interface{}{"Hash": th.H}
+					if tag == "" {
+						l["Tag"] = th.T
+					}
+					if options.Load {
+						l["EntryType"] = th.EntryType
+						l["Source"] = th.Source
+						var def *EntryDef
+						_, def, err = h.GetEntryDef(th.EntryType)
+						if err != nil {
+							return
+						}
+						l["Entry"] = wasmEntryValue(def, th.E)
+					}
+					links = append(links, l)
+				}
+				if paged {
+					result = map[string]interface{}{"Links": links, "Next": lqr.Next}
+				} else {
+					result = links
+				}
+				return
+			},
+		},
+		"bundleStart": {
+			apiFn: &APIFnStartBundle{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnStartBundle)
+				f.timeout = args[0].value.(int64)
+				f.userParam = args[1].value.(string)
+				_, err = f.Call(h)
+				return
+			},
+		},
+		"bundleClose": {
+			apiFn: &APIFnCloseBundle{},
+			f: func(args []Arg, _f APIFunction, argc int) (result interface{}, err error) {
+				f := _f.(*APIFnCloseBundle)
+				f.commit = args[0].value.(bool)
+				_, err = f.Call(h)
+				return
+			},
+		},
+	}
+
+	err = wr.instantiate()
+	if err != nil {
+		return
+	}
+	// in case the ribosome gets dropped without being closed
+	runtime.SetFinalizer(&wr, func(wr *WASMRibosome) {
+		wr.Close()
+	})
+	n = &wr
+	return
+}
+
+// instantiate makes a new instance of the zome's compiled module under the zome call
+// limits, closing the previous one
+func (wr *WASMRibosome) instantiate() (err error) {
+	if wr.mod != nil {
+		wr.mod.Close(context.Background())
+		wr.mod = nil
+	}
+	defer wr.limit(ZomeCallKind, &err)()
+	ctx, cancel := wr.context()
+	defer cancel()
+	// wasi reactors, i.e. libraries, export _initialize to set themselves up
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	var mod api.Module
+	mod, err = wr.runtime.InstantiateModule(ctx, wr.compiled, config)
+	if err != nil {
+		err = fmt.Errorf("Error instantiating WebAssembly for zome %s: %v", wr.zome.Name, err)
+		return
+	}
+	if mod.Memory() == nil || mod.ExportedFunction(WASMAllocFn) == nil {
+		mod.Close(context.Background())
+		err = fmt.Errorf("WebAssembly for zome %s must export its memory and %s", wr.zome.Name, WASMAllocFn)
+		return
+	}
+	wr.mod = mod
+	return
+}
+
+// Reset replaces the zome's module instance with a new one, so nothing a call left in the
+// module's memory or globals is seen by the next call
+func (wr *WASMRibosome) Reset() (err error) {
+	wr.lastResult = ""
+	err = wr.instantiate()
+	return
+}
+
+// Close closes the zome's module instance, after which the ribosome can't be used
+func (wr *WASMRibosome) Close() (err error) {
+	runtime.SetFinalizer(wr, nil)
+	if wr.mod != nil {
+		err = wr.mod.Close(context.Background())
+		wr.mod = nil
+	}
+	return
+}
@@ -0,0 +1,237 @@
+package holochain
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/HC-Interns/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// wasmTestCode is a hand assembled module with a bump allocator for hc_alloc, genesis and
+// validateCommit functions that return true, a validateCommitPkg function that returns
+// null, echo, commitEntry and appInfo functions that return their parameters, the result
+// of calling commit with their parameters, and the result of calling app, and a spin
+// function that loops forever
+var wasmTestCode = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0c, 0x02, 0x60, 0x02, 0x7f, 0x7f, 0x01,
+	0x7e, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x02, 0x16, 0x02, 0x02, 0x68, 0x63, 0x06, 0x63, 0x6f, 0x6d,
+	0x6d, 0x69, 0x74, 0x00, 0x00, 0x02, 0x68, 0x63, 0x03, 0x61, 0x70, 0x70, 0x00, 0x00, 0x03, 0x08,
+	0x07, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x03, 0x01, 0x00, 0x01, 0x06, 0x07, 0x01,
+	0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b, 0x07, 0x6a, 0x09, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79,
+	0x02, 0x00, 0x08, 0x68, 0x63, 0x5f, 0x61, 0x6c, 0x6c, 0x6f, 0x63, 0x00, 0x02, 0x07, 0x67, 0x65,
+	0x6e, 0x65, 0x73, 0x69, 0x73, 0x00, 0x03, 0x0e, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x65,
+	0x43, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x00, 0x03, 0x11, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74,
+	0x65, 0x43, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x50, 0x6b, 0x67, 0x00, 0x04, 0x04, 0x65, 0x63, 0x68,
+	0x6f, 0x00, 0x05, 0x0b, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x00,
+	0x06, 0x07, 0x61, 0x70, 0x70, 0x49, 0x6e, 0x66, 0x6f, 0x00, 0x07, 0x04, 0x73, 0x70, 0x69, 0x6e,
+	0x00, 0x08, 0x0a, 0x49, 0x07, 0x0b, 0x00, 0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00,
+	0x0b, 0x09, 0x00, 0x42, 0x84, 0x80, 0x80, 0x80, 0x80, 0x02, 0x0b, 0x09, 0x00, 0x42, 0x84, 0x80,
+	0x80, 0x80, 0x80, 0x03, 0x0b, 0x0c, 0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad,
+	0x84, 0x0b, 0x08, 0x00, 0x20, 0x00, 0x20, 0x01, 0x10, 0x00, 0x0b, 0x08, 0x00, 0x41, 0x00, 0x41,
+	0x00, 0x10, 0x01, 0x0b, 0x08, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b, 0x0b, 0x13, 0x02,
+	0x00, 0x41, 0x10, 0x0b, 0x04, 0x74, 0x72, 0x75, 0x65, 0x00, 0x41, 0x18, 0x0b, 0x04, 0x6e, 0x75,
+	0x6c, 0x6c,
+}
+
+func TestNewWASMRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("new should create a ribosome", t, func() {
+		v, err := NewWASMRibosome(h, &Zome{RibosomeType: WASMRibosomeType, Code: EncodeWASMCode(wasmTestCode)})
+		So(err, ShouldBeNil)
+		So(v.Type(), ShouldEqual, WASMRibosomeType)
+	})
+
+	Convey("new should fail to create a ribosome when the code is bad", t, func() {
+		_, err := NewWASMRibosome(h, &Zome{Name: "bad", RibosomeType: WASMRibosomeType, Code: "fish"})
+		So(err, ShouldNotBeNil)
+		_, err = NewWASMRibosome(h, &Zome{Name: "bad", RibosomeType: WASMRibosomeType, Code: EncodeWASMCode([]byte("\x00asm fish"))})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("the code should round trip through the DNA", t, func() {
+		code, err := DecodeWASMCode(EncodeWASMCode(wasmTestCode))
+		So(err, ShouldBeNil)
+		So(code, ShouldResemble, wasmTestCode)
+		So((&Zome{Name: "foo", RibosomeType: WASMRibosomeType}).CodeFileName(), ShouldEqual, "foo.wasm")
+	})
+}
+
+func TestWASMRibosomeCallbacks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	v, err := NewWASMRibosome(h, &Zome{Name: "wasmZome", RibosomeType: WASMRibosomeType, Code: EncodeWASMCode(wasmTestCode)})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should run genesis", t, func() {
+		So(v.ChainGenesis(), ShouldBeNil)
+	})
+
+	Convey("it should run validation", t, func() {
+		_, def, err := h.GetEntryDef("evenNumbers")
+		So(err, ShouldBeNil)
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+		req, err := v.ValidatePackagingRequest(a, def)
+		So(err, ShouldBeNil)
+		So(req, ShouldBeNil)
+		So(v.ValidateAction(a, def, nil, []string{h.nodeIDStr}), ShouldBeNil)
+	})
+
+	Convey("it should fail callbacks the zome doesn't export", t, func() {
+		err := v.BridgeGenesis(BridgeCaller, h.dnaHash, "")
+		So(err.Error(), ShouldEqual, "Error executing bridgeGenesis: zome wasmZome doesn't export bridgeGenesis")
+	})
+}
+
+func TestWASMRibosomeCall(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	v, err := NewWASMRibosome(h, &Zome{Name: "wasmZome", RibosomeType: WASMRibosomeType, Code: EncodeWASMCode(wasmTestCode)})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should call exposed functions with strings", t, func() {
+		result, err := v.Call(&FunctionDef{Name: "echo", CallingType: STRING_CALLING}, "hello")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "hello")
+	})
+
+	Convey("json calling functions should return errors", t, func() {
+		_, err := v.Call(&FunctionDef{Name: "echo", CallingType: JSON_CALLING}, `{"name":"HolochainError","message":"fish"}`)
+		So(err.Error(), ShouldEqual, "fish")
+	})
+
+	Convey("it should call API functions", t, func() {
+		result, err := v.Call(&FunctionDef{Name: "commitEntry", CallingType: JSON_CALLING}, `["evenNumbers","2"]`)
+		So(err, ShouldBeNil)
+		var hash string
+		So(json.Unmarshal([]byte(result.(string)), &hash), ShouldBeNil)
+		h2, err := NewHash(hash)
+		So(err, ShouldBeNil)
+		So(h2.Equal(h.chain.Top().EntryLink), ShouldBeTrue)
+
+		result, err = v.Call(&FunctionDef{Name: "appInfo", CallingType: JSON_CALLING}, "")
+		So(err, ShouldBeNil)
+		var app map[string]interface{}
+		So(json.Unmarshal([]byte(result.(string)), &app), ShouldBeNil)
+		So(app["Name"], ShouldEqual, h.Name())
+	})
+
+	Convey("API functions should return errors as HolochainErrors", t, func() {
+		result, err := v.Call(&FunctionDef{Name: "commitEntry", CallingType: STRING_CALLING}, `["evenNumbers"]`)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, `{"name":"HolochainError","message":"wrong number of arguments"}`)
+		result, err = v.Call(&FunctionDef{Name: "commitEntry", CallingType: STRING_CALLING}, `["evenNumbers","3"]`)
+		So(err, ShouldBeNil)
+		So(result, ShouldContainSubstring, ValidationFailedErrMsg)
+	})
+}
+
+func TestWASMRibosomeResetAndClose(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	v, err := NewWASMRibosome(h, &Zome{Name: "wasmZome", RibosomeType: WASMRibosomeType, Code: EncodeWASMCode(wasmTestCode)})
+	if err != nil {
+		panic(err)
+	}
+	wr := v.(*WASMRibosome)
+	alloc := func() uint64 {
+		results, err := wr.mod.ExportedFunction(WASMAllocFn).Call(context.Background(), 16)
+		if err != nil {
+			panic(err)
+		}
+		return results[0]
+	}
+
+	Convey("it should be reusable and closable", t, func() {
+		var r Ribosome = wr
+		_, ok := r.(ReusableRibosome)
+		So(ok, ShouldBeTrue)
+		_, ok = r.(ClosableRibosome)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("reset should start a new instance of the module", t, func() {
+		first := alloc()
+		So(alloc(), ShouldEqual, first+16)
+		So(wr.Reset(), ShouldBeNil)
+		So(alloc(), ShouldEqual, first)
+	})
+
+	Convey("close should close the module instance", t, func() {
+		mod := wr.mod
+		So(wr.Close(), ShouldBeNil)
+		So(mod.IsClosed(), ShouldBeTrue)
+		So(wr.mod, ShouldBeNil)
+		So(wr.Close(), ShouldBeNil)
+	})
+
+	Convey("the pool should close the ribosomes it drops", t, func() {
+		zome := &Zome{Name: "wasmPoolZome", RibosomeType: WASMRibosomeType, Code: EncodeWASMCode(wasmTestCode)}
+		var rs []*WASMRibosome
+		for i := 0; i < DefaultRibosomePoolSize+1; i++ {
+			r, err := h.ribosomes.get(h, zome)
+			So(err, ShouldBeNil)
+			rs = append(rs, r.(*WASMRibosome))
+		}
+		for _, r := range rs {
+			h.ribosomes.put(zome, r)
+		}
+		So(rs[DefaultRibosomePoolSize].mod, ShouldBeNil)
+		h.ribosomes.close()
+		So(rs[0].mod, ShouldBeNil)
+	})
+}
+
+func TestWASMCompiledLifetime(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	d2, _, h2 := PrepareTestChain("test2")
+	defer CleanupTestChain(h2, d2)
+	zome := &Zome{Name: "wasmZome", RibosomeType: WASMRibosomeType, Code: EncodeWASMCode(wasmTestCode)}
+	held := func() bool {
+		wasmRuntime.lk.Lock()
+		defer wasmRuntime.lk.Unlock()
+		for _, c := range wasmRuntime.compiled {
+			if c.users[h] || c.users[h2] {
+				return true
+			}
+		}
+		return false
+	}
+
+	Convey("compiled zomes should be kept until the last holochain running them is closed", t, func() {
+		_, err := NewWASMRibosome(h, zome)
+		So(err, ShouldBeNil)
+		v, err := NewWASMRibosome(h2, zome)
+		So(err, ShouldBeNil)
+		So(held(), ShouldBeTrue)
+		releaseWASM(h)
+		So(held(), ShouldBeTrue)
+		So(v.(*WASMRibosome).Reset(), ShouldBeNil)
+		releaseWASM(h2)
+		So(held(), ShouldBeFalse)
+	})
+}
+
+func TestWASMRibosomeLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	defer func() { h.nucleus.dna.RibosomeLimits = RibosomeLimits{} }()
+	v, err := NewWASMRibosome(h, &Zome{Name: "wasmZome", RibosomeType: WASMRibosomeType, Code: EncodeWASMCode(wasmTestCode)})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should stop zome calls that run out of time", t, func() {
+		h.nucleus.dna.RibosomeLimits.Call = ExecutionLimits{Timeout: 50}
+		_, err := v.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ZomeCallKind, Limit: TimeoutLimit, Value: 50})
+	})
+}
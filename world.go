@@ -180,6 +180,53 @@ func (world *World) UpdateResponsible(hash Hash, redundancy int) (responsible bo
 	return
 }
 
+// IsResponsible returns whether I am one of the redundancy nodes closest to the hash.
+// Unlike UpdateResponsible it doesn't change the responsible map.
+func (world *World) IsResponsible(hash Hash, redundancy int) (responsible bool, err error) {
+	if redundancy <= 1 {
+		responsible = true
+		return
+	}
+	world.lk.RLock()
+	defer world.lk.RUnlock()
+	var nodes []peer.ID
+	nodes, err = world.nodesByHash(hash)
+	if err != nil {
+		return
+	}
+	for i := 0; i < redundancy && i < len(nodes); i++ {
+		if nodes[i] == world.me {
+			responsible = true
+			break
+		}
+	}
+	return
+}
+
+// IsResponsible returns whether this node should hold the given hash, i.e. whether the
+// hash is in the neighborhood that the RedundancyFactor determines. The world model
+// is used if it's enabled, otherwise the routing table.
+func (h *Holochain) IsResponsible(hash Hash) (responsible bool, err error) {
+	r := h.RedundancyFactor()
+	if r <= 1 {
+		responsible = true
+		return
+	}
+	if h.Config.EnableWorldModel {
+		responsible, err = h.world.IsResponsible(hash, r)
+		return
+	}
+	nodes := h.node.nearestPeersToHash(&hash, r)
+	nodes = SortClosestPeers(append(nodes, h.nodeID), hash)
+	for i := 0; i < r && i < len(nodes); i++ {
+		if nodes[i] == h.nodeID {
+			responsible = true
+			break
+		}
+	}
+	return
+}
+
 // Responsible returns a list of all the entries I'm responsible for holding
 func (world *World) Responsible() (entries []Hash, err error) {
 	world.lk.RLock()
@@ -227,12 +274,18 @@ func HoldingTask(h *Holochain) {
 			continue
 		}
 
-		// TODO forget the hashes we are no longer responsible for
-		// https://waffle.io/Holochain/holochain-proto/cards/5af33e3b361c27001d5348c6
 		// TODO this really shouldn't be called in the holding task
 		//     but instead should be called with the Node list or hash list changes.
-		h.world.UpdateResponsible(hash, h.RedundancyFactor())
+		responsible, err := h.world.UpdateResponsible(hash, h.RedundancyFactor())
+		if err != nil {
+			continue
+		}
 		h.world.log.Logf("HoldingTask: updated %v\n", hash)
+
+		// HandoffTask takes care of the hashes that have left our neighborhood
+		if !responsible {
+			continue
+		}
 		overlap, err := h.Overlap(hash)
 		if err == nil {
 			h.world.log.Logf("HoldingTask: sending put requests to %d nodes\n", len(overlap))
@@ -138,6 +138,124 @@ func TestWorldUpdateResponsible(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(responsible, ShouldBeFalse)
 	})
+	Convey("IsResponsible should agree with UpdateResponsible", t, func() {
+		responsible, err := world.IsResponsible(hash1, 2)
+		So(err, ShouldBeNil)
+		So(responsible, ShouldBeTrue)
+		responsible, err = world.IsResponsible(hash2, 2)
+		So(err, ShouldBeNil)
+		So(responsible, ShouldBeFalse)
+		responsible, err = world.IsResponsible(hash4, 2)
+		So(err, ShouldBeNil)
+		So(responsible, ShouldBeFalse)
+		responsible, err = world.IsResponsible(hash4, 0)
+		So(err, ShouldBeNil)
+		So(responsible, ShouldBeTrue)
+	})
+}
+
+func TestWorldSharding(t *testing.T) {
+	nodesCount := 4
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	r := 2
+	for _, n := range nodes {
+		n.nucleus.dna.DHTConfig.RedundancyFactor = r
+		n.Config.EnableWorldModel = true
+		n.world = NewWorld(n.node.HashAddr, n.dht.ht, &n.Config.Loggers.World)
+	}
+	h0 := nodes[0]
+
+	// while h0 knows nobody else it should hold everything it's sent
+	var hashes []Hash
+	for i := 1; i < 12; i += 2 {
+		hashes = append(hashes, commit(h0, "oddNumbers", fmt.Sprintf("%d", i)))
+	}
+	Convey("a node that knows no others should hold everything", t, func() {
+		for _, hash := range hashes {
+			So(h0.dht.Exists(hash, StatusLive), ShouldBeNil)
+		}
+	})
+
+	fullConnect(t, mt.ctx, nodes, nodesCount)
+
+	var moved []Hash
+	for _, hash := range hashes {
+		responsible, err := h0.IsResponsible(hash)
+		if err != nil {
+			panic(err)
+		}
+		if !responsible {
+			moved = append(moved, hash)
+		}
+	}
+
+	Convey("puts outside of a node's neighborhood should not be held", t, func() {
+		So(len(moved), ShouldBeGreaterThan, 0)
+		hash := moved[0]
+		for _, n := range nodes[1:] {
+			responsible, _ := n.IsResponsible(hash)
+			if responsible {
+				continue
+			}
+			response, err := ActionReceiver(n, h0.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash}))
+			So(err, ShouldBeNil)
+			_, ok := response.(CloserPeersResp)
+			So(ok, ShouldBeTrue)
+			So(n.dht.Exists(hash, StatusAny), ShouldEqual, ErrHashNotFound)
+		}
+	})
+
+	Convey("hashes that leave the neighborhood should be handed off and forgotten", t, func() {
+		HandoffTask(h0)
+		for _, hash := range moved {
+			So(h0.dht.Exists(hash, StatusAny), ShouldEqual, ErrHashNotFound)
+			holders := 0
+			for _, n := range nodes[1:] {
+				if n.dht.Exists(hash, StatusLive) == nil {
+					holders++
+				}
+			}
+			So(holders, ShouldBeGreaterThan, 0)
+		}
+	})
+}
+
+func TestHandoffTaskWithoutWorldModel(t *testing.T) {
+	nodesCount := 4
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	for _, n := range nodes {
+		n.nucleus.dna.DHTConfig.RedundancyFactor = 2
+		n.Config.EnableWorldModel = false
+	}
+	h0 := nodes[0]
+
+	var hashes []Hash
+	for i := 1; i < 12; i += 2 {
+		hashes = append(hashes, commit(h0, "oddNumbers", fmt.Sprintf("%d", i)))
+	}
+	fullConnect(t, mt.ctx, nodes, nodesCount)
+
+	Convey("the handoff task should hand off hashes using the routing table", t, func() {
+		So(h0.Config.handoffInterval, ShouldEqual, DefaultHandoffInterval)
+		var moved []Hash
+		for _, hash := range hashes {
+			responsible, err := h0.IsResponsible(hash)
+			So(err, ShouldBeNil)
+			if !responsible {
+				moved = append(moved, hash)
+			}
+		}
+		So(len(moved), ShouldBeGreaterThan, 0)
+
+		HandoffTask(h0)
+		for _, hash := range moved {
+			So(h0.dht.Exists(hash, StatusAny), ShouldEqual, ErrHashNotFound)
+		}
+	})
 }
 
 func TestWorldOverlap(t *testing.T) {
@@ -160,7 +278,8 @@ func TestWorldOverlap(t *testing.T) {
 	Convey("when redundancy is 0 overlap is 100%", t, func() {
 		for i := 0; i < nodesCount; i++ {
 			chain := nodes[i].Chain()
-			for _, hd := range chain.Headers {
+			for j := 0; j < chain.Length(); j++ {
+				hd := chain.Nth(j)
 				responsible, err := h.world.UpdateResponsible(hd.EntryLink, 0)
 				So(err, ShouldBeNil)
 				So(responsible, ShouldBeTrue)
@@ -183,7 +302,8 @@ func TestWorldOverlap(t *testing.T) {
 		for i := 0; i < nodesCount; i++ {
 			nodes[i].nucleus.dna.DHTConfig.RedundancyFactor = r
 			chain := nodes[i].Chain()
-			for _, hd := range chain.Headers {
+			for j := 0; j < chain.Length(); j++ {
+				hd := chain.Nth(j)
 				h.world.UpdateResponsible(hd.EntryLink, r)
 			}
 		}
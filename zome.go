@@ -69,6 +69,8 @@ func (zome *Zome) CodeFileName() string {
 		return zome.Name + ".zy"
 	} else if zome.RibosomeType == JSRibosomeType {
 		return zome.Name + ".js"
+	} else if zome.RibosomeType == WASMRibosomeType {
+		return zome.Name + ".wasm"
 	}
 	panic("unknown ribosome type:" + zome.RibosomeType)
 }
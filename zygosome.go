@@ -21,15 +21,22 @@ import (
 
 const (
 	ZygoRibosomeType = "zygo"
+
+	// ZygoStepFn is the function added to the test of every for loop so that each pass
+	// through a loop is a step of the execution limits
+	ZygoStepFn = "hcStep"
 )
 
 // ZygoRibosome holds data needed for the Zygo VM
 type ZygoRibosome struct {
+	tracing
 	h          *Holochain
 	zome       *Zome
 	env        *zygo.Zlisp
+	parser     *zygo.Parser
 	lastResult zygo.Sexp
 	library    string
+	limiter    *executionLimiter
 }
 
 // Type returns the string value under which this ribosome is registered
@@ -38,6 +45,7 @@ func (z *ZygoRibosome) Type() string { return ZygoRibosomeType }
 // ChainGenesis runs the application genesis function
 // this function gets called after the genesis entries are added to the chain
 func (z *ZygoRibosome) ChainGenesis() (err error) {
+	defer z.limit(GenesisCallKind, &err)()
 	err = z.boolFn("genesis", "")
 	return
 }
@@ -45,6 +53,7 @@ func (z *ZygoRibosome) ChainGenesis() (err error) {
 // BridgeGenesis runs the bridging genesis function
 // this function gets called on both sides of the bridging
 func (z *ZygoRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	defer z.limit(GenesisCallKind, &err)()
 	err = z.boolFn("bridgeGenesis", fmt.Sprintf(`%d "%s" "%s"`, side, dnaHash.String(), sanitizeZyString(data)))
 	return
 }
@@ -77,6 +86,7 @@ func (z *ZygoRibosome) boolFn(fnName string, args string) (err error) {
 
 // Receive calls the app receive function for node-to-node messages
 func (z *ZygoRibosome) Receive(from string, msg string) (response string, err error) {
+	defer z.limit(ZomeCallKind, &err)()
 	var code string
 	fnName := "receive"
 
@@ -105,11 +115,13 @@ func (z *ZygoRibosome) Receive(from string, msg string) (response string, err er
 
 // BundleCancel calls the app bundleCanceled function
 func (z *ZygoRibosome) BundleCanceled(reason string) (response string, err error) {
+	defer z.limit(ZomeCallKind, &err)()
 	return
 }
 
 // ValidatePackagingRequest calls the app for a validation packaging request for an action
 func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	defer z.limit(ValidateCallKind, &err)()
 	var code string
 	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
 	code = fmt.Sprintf(`(%s "%s")`, fnName, def.Name)
@@ -212,12 +224,19 @@ func buildZyValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 	var pkgObj string
 	if pkg == nil || pkg.Chain == nil {
 		pkgObj = "(hash)"
+		if pkg != nil && pkg.Status != StatusDefault {
+			pkgObj = fmt.Sprintf("(hash Status:%d)", pkg.Status)
+		}
 	} else {
 		var j []byte
 		j, err = json.Marshal(pkg.Chain)
 		if err != nil {
 			return
 		}
+		if pkg.Status != StatusDefault {
+			// add the status to the fields of the chain's object
+			j = append([]byte(fmt.Sprintf(`{"Status":%d,`, pkg.Status)), j[1:]...)
+		}
 		pkgObj = fmt.Sprintf(`(unjson (raw "%s"))`, sanitizeZyString(string(j)))
 	}
 
@@ -228,6 +247,7 @@ func buildZyValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 
 // ValidateAction builds the correct validation function based on the action an calls it
 func (z *ZygoRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	defer z.limit(ValidateCallKind, &err)()
 	var code string
 	code, err = buildZyValidateAction(action, def, pkg, sources)
 	if err != nil {
@@ -331,6 +351,7 @@ func sanitizeZyString(s string) string {
 
 // Call calls the zygo function that was registered with expose
 func (z *ZygoRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	defer z.limit(ZomeCallKind, &err)()
 	var code string
 	switch fn.CallingType {
 	case STRING_CALLING:
@@ -387,6 +408,7 @@ const (
 		`(def HC_Status_Rejected ` + StatusRejectedVal + ")" +
 		`(def HC_Status_Deleted ` + StatusDeletedVal + ")" +
 		`(def HC_Status_Modified ` + StatusModifiedVal + ")" +
+		`(def HC_Status_Forked ` + StatusForkedVal + ")" +
 		`(def HC_Status_Any ` + StatusAnyVal + ")" +
 		`(def HC_GetMask_Default ` + GetMaskDefaultStr + ")" +
 		`(def HC_GetMask_Entry ` + GetMaskEntryStr + ")" +
@@ -581,6 +603,23 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		zome: zome,
 		env:  zygo.NewZlispSandbox(),
 	}
+	z.parser = z.env.NewParser()
+	z.parser.Start()
+
+	// zygo runs pre hooks before every function call, which are the steps of the limits,
+	// and loops call the step function on each pass so loops that make no calls of their
+	// own take steps too
+	z.env.AddPreHook(func(env *zygo.Zlisp, name string, args []zygo.Sexp) {
+		if z.limiter != nil {
+			if e := z.limiter.step(); e != nil {
+				panic(e)
+			}
+		}
+	})
+	z.env.AddFunction(ZygoStepFn,
+		func(env *zygo.Zlisp, name string, args []zygo.Sexp) (zygo.Sexp, error) {
+			return zygo.SexpNull, nil
+		})
 
 	z.env.AddFunction("version",
 		func(env *zygo.Zlisp, name string, args []zygo.Sexp) (zygo.Sexp, error) {
@@ -709,6 +748,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("send",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			fn := &APIFnSend{}
+			fn.setTrace(z.trace)
 			a := &fn.action
 			args := fn.Args()
 			err := zyProcessArgs(&z, args, zyargs)
@@ -819,6 +859,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return zygo.SexpNull, err
 			}
 			hash := args[0].value.(Hash)
+			a.app = hash
 			a.token, a.url, err = h.GetBridgeToken(hash)
 			if err != nil {
 				return zygo.SexpNull, err
@@ -840,6 +881,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("commit",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &APIFnCommit{}
+			a.setTrace(z.trace)
 			args := a.Args()
 			err := zyProcessArgs(&z, args, zyargs)
 			if err != nil {
@@ -851,6 +893,18 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			e := GobEntry{C: entry}
 			a.action.entryType = entryType
 			a.action.entry = &e
+			if len(zyargs) == 3 {
+				opts := args[2].value.(map[string]interface{})
+				ttl, ok := opts["TTL"]
+				if ok {
+					ttlval, ok := ttl.(float64)
+					if !ok {
+						return zygo.SexpNull,
+							fmt.Errorf("expecting int TTL attribute in object, got %T", ttl)
+					}
+					a.action.ttl = int(ttlval)
+				}
+			}
 			r, err = a.Call(h)
 			if err != nil {
 				return zygo.SexpNull, err
@@ -866,6 +920,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("migrate",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			fn := &APIFnMigrate{}
+			fn.setTrace(z.trace)
 			args := fn.Args()
 			err := zyProcessArgs(&z, args, zyargs)
 			if err != nil {
@@ -1025,6 +1080,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("get",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			fn := &APIFnGet{}
+			fn.setTrace(z.trace)
 			args := fn.Args()
 			err := zyProcessArgs(&z, args, zyargs)
 			if err != nil {
@@ -1060,7 +1116,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
 
 			var r interface{}
-			r, err = callGet(h, req, &options)
+			r, err = callTracedGet(h, z.trace, req, &options)
 			mask := options.GetMask
 			if mask == GetMaskDefault {
 				mask = GetMaskEntry
@@ -1129,6 +1185,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("update",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			fn := &APIFnMod{}
+			fn.setTrace(z.trace)
 			args := fn.Args()
 			err := zyProcessArgs(&z, args, zyargs)
 			if err != nil {
@@ -1155,6 +1212,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("updateAgent",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &APIFnModAgent{}
+			a.setTrace(z.trace)
 			//		var a Action = &ActionModAgent{}
 			args := a.Args()
 			err := zyProcessArgs(&z, args, zyargs)
@@ -1199,6 +1257,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("remove",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			fn := &APIFnDel{}
+			fn.setTrace(z.trace)
 			args := fn.Args()
 			err := zyProcessArgs(&z, args, zyargs)
 			if err != nil {
@@ -1225,6 +1284,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z.env.AddFunction("getLinks",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			fn := &APIFnGetLinks{}
+			fn.setTrace(z.trace)
 			args := fn.Args()
 			err := zyProcessArgs(&z, args, zyargs)
 			if err != nil {
@@ -1234,6 +1294,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			tag := args[1].value.(string)
 
 			options := GetLinksOptions{Load: false, StatusMask: StatusLive}
+			var paged bool
 			if len(zyargs) == 3 {
 				opts := args[2].value.(map[string]interface{})
 				load, ok := opts["Load"]
@@ -1254,17 +1315,88 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 					}
 					options.StatusMask = int(maskval)
 				}
+				order, ok := opts["Order"]
+				if ok {
+					orderval, ok := order.(string)
+					if !ok {
+						return zygo.SexpNull,
+							fmt.Errorf("expecting string Order attribute in object, got %T", order)
+					}
+					options.Order = orderval
+					paged = true
+				}
+				limit, ok := opts["Limit"]
+				if ok {
+					limitval, ok := limit.(float64)
+					if !ok {
+						return zygo.SexpNull,
+							fmt.Errorf("expecting int Limit attribute in object, got %T", limit)
+					}
+					options.Limit = int(limitval)
+					paged = true
+				}
+				cursor, ok := opts["Cursor"]
+				if ok {
+					cursorval, ok := cursor.(string)
+					if !ok {
+						return zygo.SexpNull,
+							fmt.Errorf("expecting string Cursor attribute in object, got %T", cursor)
+					}
+					options.Cursor = cursorval
+					paged = true
+				}
 			}
 
 			var r interface{}
-			fn.action = *NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options)
+			fn.action = *NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask, Order: options.Order, Limit: options.Limit, Cursor: options.Cursor}, &options)
 			r, err = fn.Call(h)
 			var resultValue zygo.Sexp
 			if err == nil {
 				response := r.(*LinkQueryResp)
 				resultValue = zygo.SexpNull
 				var j []byte
-				j, err = json.Marshal(response.Links)
+				if paged {
+					// paged requests get back the links and the next cursor
+					j, err = json.Marshal(response)
+				} else {
+					j, err = json.Marshal(response.Links)
+				}
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("queryDHT",
+		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &APIFnQueryDHT{}
+			args := a.Args()
+			err := zyProcessArgs(&z, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.entryType = args[0].value.(string)
+			a.zome = zome
+
+			options := QueryDHTOptions{}
+			var j []byte
+			j, err = json.Marshal(args[1].value)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			err = json.Unmarshal(j, &options)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.options = &options
+
+			var r interface{}
+			r, err = a.Call(h)
+			var resultValue zygo.Sexp
+			if err == nil {
+				resultValue = zygo.SexpNull
+				j, err = json.Marshal(r)
 				if err == nil {
 					resultValue = &zygo.SexpStr{S: string(j)}
 				}
@@ -1283,7 +1415,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	}
 	z.library = l
 
-	_, err = z.Run(l + zome.Code)
+	err = z.load(l + zome.Code)
 	if err != nil {
 		return
 	}
@@ -1291,10 +1423,44 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	return
 }
 
+// load runs the zome's code under the zome call limits
+func (z *ZygoRibosome) load(code string) (err error) {
+	defer z.limit(ZomeCallKind, &err)()
+	_, err = z.Run(code)
+	return
+}
+
+// limit applies the execution limits of a kind of call to the code run until the returned
+// function gets called, which must be deferred so it can turn the panic used to stop the
+// code into the call's error
+func (z *ZygoRibosome) limit(kind RibosomeCallKind, err *error) func() {
+	limits := z.h.executionLimits(kind)
+	if limits.Timeout <= 0 && limits.MaxSteps <= 0 {
+		return func() {}
+	}
+	prev := z.limiter
+	z.limiter = newExecutionLimiter(kind, limits)
+	return func() {
+		z.limiter = prev
+		recoverExecutionLimit(recover(), err)
+	}
+}
+
 // Run executes zygo code
 func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
 	c := fmt.Sprintf("(begin %s %s)", z.library, code)
-	err = z.env.LoadString(c)
+	z.parser.ResetAddNewInput(strings.NewReader(c))
+	var exprs []zygo.Sexp
+	exprs, err = z.parser.ParseTokens()
+	if err == nil {
+		for i := range exprs {
+			exprs[i] = z.stepLoops(exprs[i])
+		}
+		err = z.env.LoadExpressions(exprs)
+	} else {
+		// loading the code fails in the same place, but reports the line it failed on
+		err = z.env.LoadString(c)
+	}
 	if err != nil {
 		err = errors.New("Zygomys load error: " + err.Error())
 		return
@@ -1310,6 +1476,44 @@ func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
 	return
 }
 
+// stepLoops returns an expression with a call to the step function added to the test of
+// every for loop in it, including the loops in the templates of macros
+func (z *ZygoRibosome) stepLoops(expr zygo.Sexp) zygo.Sexp {
+	switch e := expr.(type) {
+	case *zygo.SexpPair:
+		list, err := zygo.ListToArray(e)
+		if err != nil {
+			return &zygo.SexpPair{Head: z.stepLoops(e.Head), Tail: z.stepLoops(e.Tail)}
+		}
+		for i := range list {
+			list[i] = z.stepLoops(list[i])
+		}
+		if sym, ok := list[0].(*zygo.SexpSymbol); ok && sym.SexpString(nil) == "for" {
+			// the controls are the first array, after the loop's label if it has one
+			for i, arg := range list[1:] {
+				if controls, ok := arg.(*zygo.SexpArray); ok {
+					if len(controls.Val) == 3 {
+						step := zygo.MakeList([]zygo.Sexp{z.env.MakeSymbol(ZygoStepFn)})
+						stepped := *controls
+						stepped.Val = []zygo.Sexp{controls.Val[0], zygo.MakeList([]zygo.Sexp{z.env.MakeSymbol("begin"), step, controls.Val[1]}), controls.Val[2]}
+						list[i+1] = &stepped
+					}
+					break
+				}
+			}
+		}
+		return zygo.MakeList(list)
+	case *zygo.SexpArray:
+		stepped := *e
+		stepped.Val = make([]zygo.Sexp, len(e.Val))
+		for i := range e.Val {
+			stepped.Val[i] = z.stepLoops(e.Val[i])
+		}
+		return &stepped
+	}
+	return expr
+}
+
 func (z *ZygoRibosome) RunWithTimers(code string) (result interface{}, err error) {
 	result, err = z.Run(code)
 	return
@@ -1376,6 +1580,7 @@ func addExtras(z *ZygoRibosome) {
 }
 
 func (z *ZygoRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	defer z.limit(ZomeCallKind, &err)()
 	code := fmt.Sprintf(`(%s (unjson (raw "%s")) "%s")`, callback, sanitizeZyString(response.Body), sanitizeZyString(callbackID))
 	z.h.Debugf("Calling %s\n", code)
 	result, err = z.Run(code)
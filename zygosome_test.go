@@ -207,7 +207,8 @@ func TestNewZygoRibosome(t *testing.T) {
 			// a string calling function
 			_, err := z.Run(`(call "jsSampleZome" "addOdd" "321")`)
 			So(err, ShouldBeNil)
-			So(h.chain.Entries[len(h.chain.Hashes)-1].Content(), ShouldEqual, "321")
+			top, _, _ := h.chain.GetEntry(h.chain.Top().EntryLink)
+			So(top.Content(), ShouldEqual, "321")
 			z := v.(*ZygoRibosome)
 			hashStr := z.lastResult.(*zygo.SexpStr).S
 			hash, _ := NewHash(hashStr)
@@ -217,7 +218,8 @@ func TestNewZygoRibosome(t *testing.T) {
 			// a json calling function
 			_, err = z.Run(`(call "jsSampleZome" "addProfile" (hash firstName: "Jane" lastName: "Jetson"))`)
 			So(err, ShouldBeNil)
-			So(h.chain.Entries[len(h.chain.Hashes)-1].Content(), ShouldEqual, `{"firstName":"Jane","lastName":"Jetson"}`)
+			top, _, _ = h.chain.GetEntry(h.chain.Top().EntryLink)
+			So(top.Content(), ShouldEqual, `{"firstName":"Jane","lastName":"Jetson"}`)
 			hashJSONStr := z.lastResult.(*zygo.SexpStr).S
 			json.Unmarshal([]byte(hashJSONStr), &hashStr)
 			hash, _ = NewHash(hashStr)
@@ -349,6 +351,48 @@ func TestZygoBridgeGenesis(t *testing.T) {
 	})
 }
 
+func TestZygoExecutionLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	defer func() { h.nucleus.dna.RibosomeLimits = RibosomeLimits{} }()
+	code := `(defn spin [x] (spin (+ x 1)))
+(defn spinner [s] (spin 0))
+(defn looper [s] (for [(def i 0) true (set i i)] 1))
+(defn genesis [] (spin 0))
+(defn validateCommit [entryType entry header pkg sources] (spin 0))`
+	z, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: code})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should stop zome calls that run out of steps", t, func() {
+		h.nucleus.dna.RibosomeLimits.Call = ExecutionLimits{Timeout: -1, MaxSteps: 1000}
+		_, err := z.Call(&FunctionDef{Name: "spinner", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ZomeCallKind, Limit: StepsLimit, Value: 1000})
+	})
+
+	Convey("it should stop loops that don't call any functions", t, func() {
+		h.nucleus.dna.RibosomeLimits.Call = ExecutionLimits{Timeout: -1, MaxSteps: 1000}
+		_, err := z.Call(&FunctionDef{Name: "looper", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ZomeCallKind, Limit: StepsLimit, Value: 1000})
+		h.nucleus.dna.RibosomeLimits.Call = ExecutionLimits{Timeout: 50, MaxSteps: -1}
+		_, err = z.Call(&FunctionDef{Name: "looper", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ZomeCallKind, Limit: TimeoutLimit, Value: 50})
+	})
+
+	Convey("it should stop validation and genesis calls that run out of time", t, func() {
+		h.nucleus.dna.RibosomeLimits.Validate = ExecutionLimits{Timeout: 50, MaxSteps: -1}
+		h.nucleus.dna.RibosomeLimits.Genesis = ExecutionLimits{Timeout: 50, MaxSteps: -1}
+		_, def, _ := h.GetEntryDef("evenNumbers")
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+		a.header = &Header{}
+		err := z.ValidateAction(a, def, nil, []string{h.nodeIDStr})
+		So(err, ShouldResemble, &ExecutionLimitErr{Kind: ValidateCallKind, Limit: TimeoutLimit, Value: 50})
+		err = z.ChainGenesis()
+		So(err.Error(), ShouldEqual, "genesis call exceeded its time limit of 50ms")
+	})
+}
+
 func TestZyReceive(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestChain(h, d)
@@ -398,6 +442,12 @@ func TestZybuildValidate(t *testing.T) {
 		So(err, ShouldBeNil)
 		//So(code, ShouldEqual, `validatePut("evenNumbers","2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"},pgk,["fake_src_hash"])`)
 	})
+	Convey("it should build put with the status of forked entries", t, func() {
+		a := NewPutAction("oddNumbers", &e, &header)
+		code, err := buildZyValidateAction(a, &def, &ValidationPackage{Status: StatusForked}, []string{"fake_src_hash"})
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, `(validatePut "oddNumbers" "3" (hash EntryLink:"" Type:"" Time:"0001-01-01T00:00:00Z") (hash Status:16) (unjson (raw "[\"fake_src_hash\"]")))`)
+	})
 }
 
 func TestZyValidateCommit(t *testing.T) {
@@ -647,6 +697,17 @@ func TestZygoDHT(t *testing.T) {
 		So(r.(*zygo.SexpStr).S, ShouldEqual, fmt.Sprintf(`[{"H":"QmYeinX5vhuA91D3v24YbgyLofw9QAxY6PoATrBHnRwbtt","E":"{\"firstName\":\"Zippy\",\"lastName\":\"Pinhead\"}","EntryType":"profile","T":"","Source":"%s"}]`, h.nodeIDStr))
 	})
 
+	Convey("getLinks function with paging options should return the Links and next cursor", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: fmt.Sprintf(`(getLinks "%s" "4stars" (hash Limit:1 Order:"time"))`, hash.String())})
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		sh := z.lastResult.(*zygo.SexpHash)
+
+		r, err := sh.HashGet(z.env, z.env.MakeSymbol("result"))
+		So(err, ShouldBeNil)
+		So(r.(*zygo.SexpStr).S, ShouldEqual, fmt.Sprintf(`{"Links":[{"H":"QmYeinX5vhuA91D3v24YbgyLofw9QAxY6PoATrBHnRwbtt","E":"","EntryType":"","T":"","Source":"%s"}],"Next":""}`, h.nodeIDStr))
+	})
+
 	Convey("commit with del link should delete link", t, func() {
 		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: fmt.Sprintf(`(commit "rating" (hash Links:[(hash LinkAction:HC_LinkAction_Del Base:"%s" Link:"%s" Tag:"4stars")]))`, hash.String(), profileHash.String())})
 		So(err, ShouldBeNil)